@@ -2,28 +2,84 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/rolledback/pwsafe-service/backend/internal/cli"
 	"github.com/rolledback/pwsafe-service/backend/internal/config"
 	"github.com/rolledback/pwsafe-service/backend/internal/handlers"
 	"github.com/rolledback/pwsafe-service/backend/internal/middleware"
+	"github.com/rolledback/pwsafe-service/backend/internal/outbound"
 	"github.com/rolledback/pwsafe-service/backend/internal/provider"
 	"github.com/rolledback/pwsafe-service/backend/internal/provider/onedrive"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider/webdav"
+	"github.com/rolledback/pwsafe-service/backend/internal/selftest"
 	"github.com/rolledback/pwsafe-service/backend/internal/service"
 	"golang.org/x/time/rate"
 )
 
+// shutdownTimeout is how long in-flight requests get to finish on SIGINT or
+// SIGTERM before their connections are closed
+const shutdownTimeout = 15 * time.Second
+
 func main() {
+	runSelfTest := flag.Bool("selftest", false, "verify the pwsafe library can open the bundled test safe, then exit")
+	flag.Parse()
+
+	if *runSelfTest {
+		if err := selftest.Run(); err != nil {
+			log.Printf("Self-test failed: %v", err)
+			os.Exit(1)
+		}
+		log.Printf("Self-test passed")
+		return
+	}
+
 	cfg := config.Load()
 
+	// Listing and sync cleanup must agree on which files are safes
+	extensions := provider.ParseExtensions(cfg.Extensions)
+
+	safeService := service.NewSafeService(cfg.SafesDirectory,
+		service.WithMaxGroupDepth(cfg.MaxGroupDepth),
+		service.WithMaxRecords(cfg.MaxRecords),
+		service.WithExtensions(extensions),
+		service.WithKeyfileDirectory(cfg.KeyfileDirectory),
+		service.WithSessionTTL(cfg.SessionTTL),
+		service.WithSafeCacheTTL(cfg.SafeCacheTTL),
+		service.WithDuplicatePrecedence(cfg.DuplicatePrecedence),
+	)
+
+	// Offline subcommands use the same SafeService without starting the server
+	if flag.NArg() > 0 {
+		if !cli.IsCommand(flag.Arg(0)) {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n%s\n", flag.Arg(0), cli.Usage)
+			os.Exit(2)
+		}
+		if err := cli.Run(safeService, flag.Args(), os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.Printf("pwsafe-service - Password Safe Web Service")
 	log.Printf("Safes Directory: %s", cfg.SafesDirectory)
 	log.Printf("Server: %s:%s", cfg.ServerHost, cfg.ServerPort)
 
+	// Offline commands may run beside a server, so only the server clears
+	// edits left half-written by a previous run
+	safeService.RemoveSafeTempFiles()
+
 	staticDir := os.Getenv("PWSAFE_STATIC_DIR")
 	if staticDir == "" {
 		staticDir = "./static"
@@ -32,12 +88,29 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	safeService := service.NewSafeService(cfg.SafesDirectory)
 	safeHandler := handlers.NewSafeHandler(safeService)
 
+	// Every server-initiated request goes through the same SSRF guard
+	outboundGuard, err := outbound.NewGuard(cfg.OutboundAllow, cfg.OutboundBlock)
+	if err != nil {
+		log.Fatalf("Invalid outbound allow/block list: %v", err)
+	}
+
 	// Create provider registry and register factories
 	registry := provider.NewRegistry()
-	registry.Register("onedrive", onedrive.Factory)
+	registry.RegisterType(onedrive.Type, onedrive.Factory)
+	registry.RegisterType(webdav.Type, webdav.Factory)
+
+	// Like SSH with a permissive key file: secrets in these directories must not
+	// be readable by other users
+	if problems := registry.CheckPermissions(cfg.SafesDirectory); len(problems) > 0 {
+		for _, problem := range problems {
+			log.Printf("Warning: %s", problem)
+		}
+		if cfg.StrictPermissions {
+			log.Fatalf("Refusing to start with permissive directories (PWSAFE_STRICT_PERMISSIONS=true); chmod 700 them")
+		}
+	}
 
 	// Discover providers from safes directory
 	providers, err := registry.Discover(cfg.SafesDirectory)
@@ -45,44 +118,204 @@ func main() {
 		log.Fatalf("Failed to discover providers: %v", err)
 	}
 
-	// Create SyncableSafesService for each discovered provider
+	// Root settings were validated by Discover; reload for service-level options.
+	// They may be absent when no providers are configured.
+	rootSettings := &provider.RootSettings{}
+	if len(providers) > 0 {
+		rootSettings, err = provider.LoadRootSettings(cfg.SafesDirectory)
+		if err != nil {
+			log.Fatalf("Failed to load settings: %v", err)
+		}
+	}
+
+	// Providers share one sync log per path so rotation isn't raced
+	var syncLogsMutex sync.Mutex
+	syncLogs := make(map[string]*service.SyncLog)
+	syncLogFor := func(path string) *service.SyncLog {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cfg.SafesDirectory, path)
+		}
+		syncLogsMutex.Lock()
+		defer syncLogsMutex.Unlock()
+		if syncLogs[path] == nil {
+			syncLogs[path] = service.NewSyncLog(path, service.DefaultSyncLogMaxBytes)
+			log.Printf("Logging sync outcomes to %s", path)
+		}
+		return syncLogs[path]
+	}
+
+	// Shared by every provider, including ones configured later over the API
+	syncLimiter := service.NewSyncLimiter(cfg.MaxConcurrentSyncs)
+
+	// startSyncService wires a provider into a sync service with the server-wide options
+	startSyncService := func(id string, p provider.SyncableSafesProvider, rootSettings *provider.RootSettings) *service.SyncableSafesService {
+		providerDir := filepath.Join(cfg.SafesDirectory, id)
+		common := provider.LoadCommonSettings(providerDir)
+
+		if es, ok := p.(provider.ExtensionsSetter); ok {
+			es.SetExtensions(extensions)
+		}
+		if cs, ok := p.(provider.HTTPClientSetter); ok {
+			// Discover already rejected providers whose CA bundle doesn't load
+			rootCAs, _ := common.RootCAs(providerDir)
+			var hosts []string
+			if hr, ok := p.(provider.APIHostReporter); ok {
+				hosts = hr.APIHosts()
+			}
+			cs.SetHTTPClient(common.Headers.Client(outboundGuard.ClientWithRootCAs(rootCAs), hosts))
+			if len(common.Headers) > 0 {
+				log.Printf("%s: sending custom headers %s to %s", id, common.Headers, strings.Join(hosts, ", "))
+			}
+		}
+
+		opts := []service.SyncOption{
+			service.WithDownloadStallTimeout(cfg.DownloadStallTimeout),
+			service.WithSyncJitter(float64(cfg.SyncJitterPercent) / 100),
+			service.WithSyncExtensions(extensions),
+			service.WithOutboundGuard(outboundGuard),
+			service.WithSyncLimiter(syncLimiter),
+			service.WithSyncHistorySize(cfg.SyncHistorySize),
+		}
+
+		// On a read-only mount, list remote and already-synced files rather than failing every sync
+		if err := provider.CheckWritable(providerDir); err != nil {
+			log.Printf("Warning: %s: %s is not writable (%v); running in listing-only mode, nothing will sync", id, providerDir, err)
+			opts = append(opts, service.WithReadOnly())
+		}
+
+		flattenPaths := rootSettings.FlattenPaths
+		if common.FlattenPaths != nil {
+			flattenPaths = *common.FlattenPaths
+		}
+		opts = append(opts, service.WithFlattenPaths(flattenPaths))
+		if len(common.Exclude) > 0 {
+			opts = append(opts, service.WithExcludePatterns(common.Exclude))
+		}
+		if minutes := common.SyncIntervalMinutes; minutes >= 1 {
+			opts = append(opts, service.WithSyncInterval(time.Duration(minutes)*time.Minute))
+			log.Printf("%s: syncing every %d minute(s)", id, minutes)
+		} else if minutes != 0 {
+			log.Printf("Warning: %s: syncIntervalMinutes must be at least 1, using the default", id)
+		}
+
+		if rootSettings.SyncLogPath != "" {
+			opts = append(opts, service.WithSyncLog(syncLogFor(rootSettings.SyncLogPath)))
+		}
+
+		webhookURL := rootSettings.OnSyncWebhook
+		if common.OnSyncWebhook != "" {
+			webhookURL = common.OnSyncWebhook
+		}
+		if webhookURL != "" {
+			opts = append(opts, service.WithSyncWebhook(webhookURL, rootSettings.AllowPrivateWebhook))
+		}
+
+		return service.NewSyncableSafesService(ctx, cfg.SafesDirectory, p, opts...)
+	}
+
+	// Create SyncableSafesService for each discovered provider, first removing
+	// partial downloads left by a previous run that was killed mid-sync
 	services := make(map[string]*service.SyncableSafesService)
 	for id, p := range providers {
-		svc := service.NewSyncableSafesService(ctx, cfg.SafesDirectory, p)
-		services[id] = svc
-		defer svc.Stop()
+		service.RemoveTempFiles(filepath.Join(cfg.SafesDirectory, id))
+		services[id] = startSyncService(id, p, rootSettings)
 	}
 
 	log.Printf("Discovered %d provider(s)", len(services))
 
 	// Create providers handler
 	providersHandler := handlers.NewProvidersHandler(services)
+	providersHandler.SetProviderTypes(registry.Types())
+	providersHandler.SetSyncTimeout(cfg.MaxSyncDuration)
+	if cfg.EnableProviderSettings {
+		providersHandler.SetConfigurer(func(id string, settingsJSON []byte, stopPrevious func()) (*service.SyncableSafesService, error) {
+			p, err := registry.Configure(cfg.SafesDirectory, id, settingsJSON)
+			if err != nil {
+				return nil, err
+			}
+			rootSettings, err := provider.LoadRootSettings(cfg.SafesDirectory)
+			if err != nil {
+				return nil, err
+			}
+			stopPrevious()
+			return startSyncService(id, p, rootSettings), nil
+		})
+		log.Printf("Provider settings endpoint enabled")
+	}
 
 	// Create static provider handler (for upload/delete of static safes)
-	staticProviderHandler := handlers.NewStaticProviderHandler(cfg.SafesDirectory)
+	staticProviderHandler := handlers.NewStaticProviderHandler(cfg.SafesDirectory, extensions)
+	passwordPolicy := &service.PasswordPolicy{MinLength: cfg.MinMasterPasswordLength}
+	if cfg.BreachedPasswordList != "" {
+		count, err := passwordPolicy.LoadBreachedList(cfg.BreachedPasswordList)
+		if err != nil {
+			log.Fatalf("Invalid breached password list: %v", err)
+		}
+		log.Printf("Loaded %d breached passwords", count)
+	}
+	staticProviderHandler.SetPasswordPolicy(passwordPolicy)
+	staticProviderHandler.SetTempDirectory(cfg.UploadTempDirectory)
+	staticProviderHandler.RemoveUploadTempFiles()
+	staticProviderHandler.SetIdempotencyTTL(cfg.UploadIdempotencyTTL)
 
 	rateLimiter := middleware.NewRateLimiter(rate.Limit(5), 5)
+	rateLimiter.SetMaxVisitors(cfg.RateLimitMaxVisitors)
+	rateLimiter.SetIdleTimeout(cfg.RateLimitIdleTimeout)
+	if err := rateLimiter.SetBypass(cfg.RateLimitBypass); err != nil {
+		log.Fatalf("Invalid rate limit bypass: %v", err)
+	}
+	if len(cfg.RateLimitBypass) > 0 {
+		log.Printf("Rate limiting disabled for %s", strings.Join(cfg.RateLimitBypass, ", "))
+	}
 
-	http.HandleFunc("/api/safes", middleware.CORS(rateLimiter.Limit(safeHandler.ListSafes)))
-	http.HandleFunc("/api/safes/", middleware.CORS(rateLimiter.Limit(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path[len(r.URL.Path)-7:] == "/unlock" {
+	// Inside the rate limiter, so guessing the token is rate limited too
+	auth := middleware.Auth(cfg.APIToken)
+	if cfg.APIToken != "" {
+		log.Printf("API token required on /api requests")
+	}
+
+	http.HandleFunc("/api/safes", middleware.CORS(rateLimiter.Limit(auth(safeHandler.ListSafes))))
+	http.HandleFunc("/api/safes/", middleware.CORS(rateLimiter.Limit(auth(func(w http.ResponseWriter, r *http.Request) {
+		if handlers.IsEntryRequest(r, "/move") {
+			safeHandler.MoveEntry(w, r)
+		} else if handlers.IsEntryRequest(r, "") {
+			safeHandler.UpdateEntry(w, r)
+		} else if r.URL.Path[len(r.URL.Path)-7:] == "/unlock" {
 			safeHandler.UnlockSafe(w, r)
+		} else if cfg.EnableDiagnostics && strings.HasSuffix(r.URL.Path, "/diagnose") {
+			safeHandler.DiagnoseSafe(w, r)
+		} else if cfg.EnableExport && strings.HasSuffix(r.URL.Path, "/export") {
+			safeHandler.ExportSafe(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/verify") {
+			// Shares the /api/safes/ rate limiter with unlock since it is a password check
+			safeHandler.VerifySafe(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/changes") {
+			safeHandler.GetChanges(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/info") {
+			safeHandler.GetSafeInfo(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/entry/strength") {
+			safeHandler.GetEntryPasswordStrength(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/entry/totp") {
+			safeHandler.GetEntryTOTP(w, r)
 		} else if r.URL.Path[len(r.URL.Path)-6:] == "/entry" {
 			safeHandler.GetEntryPassword(w, r)
 		} else {
 			http.NotFound(w, r)
 		}
-	})))
+	}))))
 
 	// Provider routes (new generic API)
-	http.HandleFunc("/api/providers", middleware.CORS(rateLimiter.Limit(providersHandler.ListProviders)))
-	http.HandleFunc("/api/providers/static/", middleware.CORS(rateLimiter.Limit(staticProviderHandler.Route)))
+	http.HandleFunc("/api/provider-types", middleware.CORS(rateLimiter.Limit(auth(providersHandler.ListProviderTypes))))
+	http.HandleFunc("/api/providers", middleware.CORS(rateLimiter.Limit(auth(providersHandler.ListProviders))))
+	http.HandleFunc("/api/debug/capabilities", middleware.CORS(rateLimiter.Limit(auth(providersHandler.ListCapabilities))))
+	http.HandleFunc("/api/providers/static/", middleware.CORS(rateLimiter.Limit(auth(staticProviderHandler.Route))))
 	http.HandleFunc("/api/providers/", middleware.CORS(func(w http.ResponseWriter, r *http.Request) {
-		// Don't rate limit callbacks (they come from OAuth redirects)
-		if strings.HasSuffix(r.URL.Path, "/auth/callback") {
+		// Don't rate limit callbacks (they come from OAuth redirects) or cacheable
+		// icons, and don't require the API token since browsers can't send it there
+		if strings.HasSuffix(r.URL.Path, "/auth/callback") || strings.HasSuffix(r.URL.Path, "/icon") {
 			providersHandler.Route(w, r)
 		} else {
-			rateLimiter.Limit(providersHandler.Route)(w, r)
+			rateLimiter.Limit(auth(providersHandler.Route))(w, r)
 		}
 	}))
 
@@ -93,6 +326,11 @@ func main() {
 		
 		// Check if file exists
 		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+			// Missing assets (anything with an extension) are real 404s
+			if filepath.Ext(path) != "" {
+				http.NotFound(w, r)
+				return
+			}
 			// File doesn't exist, serve index.html for SPA routing
 			http.ServeFile(w, r, staticDir+"/index.html")
 			return
@@ -117,8 +355,33 @@ func main() {
 	})
 
 	addr := fmt.Sprintf("%s:%s", cfg.ServerHost, cfg.ServerPort)
-	log.Printf("Starting server on %s", addr)
-	if err := http.ListenAndServe(addr, nil); err != nil {
+	server := &http.Server{Addr: addr}
+
+	signalled, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on %s", addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Fatalf("Server failed to start: %v", err)
+	case <-signalled.Done():
+	}
+
+	// Stop taking requests and let in-flight ones finish, then stop the sync
+	// loops, which cancels running syncs and removes their temp files
+	log.Printf("Shutting down")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Requests still running after %s, closing them: %v", shutdownTimeout, err)
+		server.Close()
 	}
+	providersHandler.StopServices()
+	rateLimiter.Stop()
+	log.Printf("Shutdown complete")
 }
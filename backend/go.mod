@@ -4,6 +4,7 @@ go 1.25.5
 
 require (
 	github.com/tkuhlman/gopwsafe v0.0.0-20260116044207-30e4268e4ead
+	golang.org/x/text v0.32.0
 	golang.org/x/time v0.14.0
 )
 
@@ -0,0 +1,134 @@
+// Package cli implements the offline subcommands, which use SafeService
+// directly so operators can check safes on the box without the HTTP server.
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+	"github.com/rolledback/pwsafe-service/backend/internal/service"
+)
+
+// PasswordEnv is read for the master password before falling back to stdin
+const PasswordEnv = "PWSAFE_PASSWORD"
+
+// Usage describes the subcommands
+const Usage = `Usage:
+  pwsafe-service list              list safes in the safes directory
+  pwsafe-service list <safe>       list a safe's entries with their UUIDs
+  pwsafe-service cat <safe> <uuid> print an entry's password
+
+<safe> is a path as returned by list, or a file name for the first listed
+safe of that name. The master password is read from
+` + PasswordEnv + ` or, if unset, the first line of stdin.`
+
+// IsCommand reports whether name is a subcommand handled by Run
+func IsCommand(name string) bool {
+	return name == "list" || name == "cat"
+}
+
+// Run executes the subcommand in args, writing results to stdout
+func Run(svc *service.SafeService, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command given\n%s", Usage)
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		return listSafes(svc, stdout)
+	case args[0] == "list" && len(args) == 2:
+		password, err := readPassword(stdin)
+		if err != nil {
+			return err
+		}
+		safePath, err := resolveSafe(svc, args[1])
+		if err != nil {
+			return err
+		}
+		return listEntries(svc, safePath, password, stdout)
+	case args[0] == "cat" && len(args) == 3:
+		password, err := readPassword(stdin)
+		if err != nil {
+			return err
+		}
+		safePath, err := resolveSafe(svc, args[1])
+		if err != nil {
+			return err
+		}
+		entryPassword, err := svc.GetEntryPassword(safePath, password, args[2])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, entryPassword)
+		return nil
+	default:
+		return fmt.Errorf("invalid arguments\n%s", Usage)
+	}
+}
+
+// resolveSafe accepts a path as listed or a bare file name, which resolves to
+// the copy listing prefers
+func resolveSafe(svc *service.SafeService, arg string) (string, error) {
+	if strings.Contains(arg, "/") {
+		return arg, nil
+	}
+	return svc.ResolveSafeName(arg)
+}
+
+func listSafes(svc *service.SafeService, stdout io.Writer) error {
+	safes, err := svc.ListSafes()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tPROVIDER\tMODIFIED")
+	for _, safe := range safes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", safe.Path, safe.Provider, safe.LastModified.Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
+
+func listEntries(svc *service.SafeService, safePath, password string, stdout io.Writer) error {
+	structure, err := svc.UnlockSafe(safePath, password)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "UUID\tGROUP\tTITLE\tUSERNAME")
+	var walk func(group string, groups []*models.Group, entries []models.Entry)
+	walk = func(group string, groups []*models.Group, entries []models.Entry) {
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.UUID, group, e.Title, e.Username)
+		}
+		for _, g := range groups {
+			name := g.Name
+			if group != "" {
+				name = group + "." + g.Name
+			}
+			walk(name, g.Groups, g.Entries)
+		}
+	}
+	walk("", structure.Groups, structure.Entries)
+	return tw.Flush()
+}
+
+// readPassword takes the master password from PasswordEnv, or the first line of stdin
+func readPassword(stdin io.Reader) (string, error) {
+	if password := os.Getenv(PasswordEnv); password != "" {
+		return password, nil
+	}
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("no password given; set %s or pipe it on stdin", PasswordEnv)
+	}
+	return password, nil
+}
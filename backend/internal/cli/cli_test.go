@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/service"
+)
+
+func TestRun(t *testing.T) {
+	t.Setenv(PasswordEnv, "")
+	svc := service.NewSafeService("../../testdata")
+
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		want    string
+		wantErr string
+	}{
+		{"list safes", []string{"list"}, "", "/testdata/simple.psafe3", ""},
+		{"list entries", []string{"list", "/testdata/simple.psafe3"}, "password\n", "c4dcfb52-b944-f141-af96-b746f184afe2", ""},
+		{"cat", []string{"cat", "/testdata/simple.psafe3", "c4dcfb52-b944-f141-af96-b746f184afe2"}, "password\n", "password\n", ""},
+		{"cat by name", []string{"cat", "simple.psafe3", "c4dcfb52-b944-f141-af96-b746f184afe2"}, "password\n", "password\n", ""},
+		{"unknown name", []string{"list", "missing.psafe3"}, "password\n", "", "not found"},
+		{"wrong password", []string{"list", "/testdata/simple.psafe3"}, "wrong\n", "", "failed to unlock"},
+		{"no password", []string{"cat", "/testdata/simple.psafe3", "x"}, "", "", "no password given"},
+		{"bad arguments", []string{"cat", "/testdata/simple.psafe3"}, "", "", "invalid arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Run(svc, tt.args, strings.NewReader(tt.stdin), &out)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("Expected output containing %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+}
+
+func TestRun_PasswordFromEnv(t *testing.T) {
+	t.Setenv(PasswordEnv, "password")
+	svc := service.NewSafeService("../../testdata")
+
+	var out bytes.Buffer
+	if err := Run(svc, []string{"cat", "/testdata/simple.psafe3", "c4dcfb52-b944-f141-af96-b746f184afe2"}, strings.NewReader(""), &out); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if out.String() != "password\n" {
+		t.Errorf("Expected the entry password, got %q", out.String())
+	}
+}
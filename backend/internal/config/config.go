@@ -1,13 +1,73 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	SafesDirectory string
 	ServerPort     string
 	ServerHost     string
+	MaxGroupDepth  int
+	MaxRecords     int
+	Extensions     []string // Safe file extensions, e.g. ".psafe3"
+
+	// Where uploads are staged until complete; empty uses the safes directory
+	UploadTempDirectory string
+	// How long an upload's result is replayed for repeats of its Idempotency-Key
+	UploadIdempotencyTTL time.Duration
+
+	// Directory of files holding master passwords; empty disables keyfiles
+	KeyfileDirectory string
+
+	// How long an unlock session token stays valid; zero disables sessions
+	SessionTTL time.Duration
+	// How long a decrypted safe is cached for repeat reads; zero disables the cache
+	SafeCacheTTL time.Duration
+
+	// Master password policy for safes the service creates: minimum length
+	// (zero disables) and a file of breached passwords, one per line
+	MinMasterPasswordLength int
+	BreachedPasswordList    string
+
+	// Which copy wins when a static and a synced safe share a name:
+	// "static-first" or "provider-first"
+	DuplicatePrecedence string
+
+	// Percentage each periodic sync interval randomly varies by
+	SyncJitterPercent int
+	// Upper bound on provider syncs running at once, across all providers
+	MaxConcurrentSyncs int
+	// Longest a sync triggered over HTTP may run
+	MaxSyncDuration time.Duration
+	// Completed syncs each provider keeps for GET /api/providers/{id}/history
+	SyncHistorySize int
+
+	DownloadStallTimeout time.Duration
+	EnableDiagnostics    bool
+	EnableExport         bool
+	// Refuse to start when the safes or a provider directory is group/world accessible
+	StrictPermissions bool
+	// Allow writing provider settings.json over the API
+	EnableProviderSettings bool
+
+	// Bearer token every API request must carry; empty disables the check
+	APIToken string
+
+	// Clients exempt from rate limiting (CIDR list); empty unless configured or in dev mode
+	RateLimitBypass []string
+	// Upper bound on client IPs tracked by the rate limiter
+	RateLimitMaxVisitors int
+	// How long a client IP goes unseen before the rate limiter forgets it
+	RateLimitIdleTimeout time.Duration
+
+	// Outbound request guard (CIDR lists)
+	OutboundAllow []string
+	OutboundBlock []string
 }
 
 func Load() *Config {
@@ -26,9 +86,112 @@ func Load() *Config {
 		serverHost = "localhost"
 	}
 
+	maxGroupDepth := getEnvInt("PWSAFE_MAX_GROUP_DEPTH", 32)
+	maxRecords := getEnvInt("PWSAFE_MAX_RECORDS", 100000)
+
+	extensions := getEnvList("PWSAFE_EXTENSIONS")
+	if extensions == nil {
+		extensions = []string{".psafe3"}
+	}
+
+	// Dev mode exempts loopback from rate limiting unless an explicit list is given
+	rateLimitBypass := getEnvList("PWSAFE_RATE_LIMIT_BYPASS")
+	if rateLimitBypass == nil && os.Getenv("PWSAFE_DEV_MODE") == "true" {
+		rateLimitBypass = []string{"127.0.0.0/8", "::1/128"}
+	}
+
+	duplicatePrecedence := os.Getenv("PWSAFE_DUPLICATE_PRECEDENCE")
+	switch duplicatePrecedence {
+	case "":
+		duplicatePrecedence = "static-first"
+	case "static-first", "provider-first":
+	default:
+		log.Printf("Warning: invalid PWSAFE_DUPLICATE_PRECEDENCE %q, using default static-first", duplicatePrecedence)
+		duplicatePrecedence = "static-first"
+	}
+
+	downloadStallTimeout := time.Duration(getEnvInt("PWSAFE_DOWNLOAD_STALL_TIMEOUT", 60)) * time.Second
+
+	// Zero turns the cache off, which getEnvInt would reject
+	var safeCacheTTL time.Duration
+	if os.Getenv("PWSAFE_SAFE_CACHE_TTL") != "0" {
+		safeCacheTTL = time.Duration(getEnvInt("PWSAFE_SAFE_CACHE_TTL", 60)) * time.Second
+	}
+
+	// Zero turns jitter off, which getEnvInt would reject; WithSyncJitter
+	// ignores 50 or more, so warn here rather than silently keep the default
+	syncJitterPercent := 0
+	if value := os.Getenv("PWSAFE_SYNC_JITTER_PERCENT"); value != "0" {
+		syncJitterPercent = getEnvInt("PWSAFE_SYNC_JITTER_PERCENT", 10)
+		if syncJitterPercent >= 50 {
+			log.Printf("Warning: invalid PWSAFE_SYNC_JITTER_PERCENT %q, must be below 50, using default 10", value)
+			syncJitterPercent = 10
+		}
+	}
+
 	return &Config{
 		SafesDirectory: safesDir,
 		ServerPort:     serverPort,
 		ServerHost:     serverHost,
+		MaxGroupDepth:  maxGroupDepth,
+		MaxRecords:     maxRecords,
+		Extensions:     extensions,
+
+		UploadTempDirectory:  os.Getenv("PWSAFE_UPLOAD_TEMP_DIR"),
+		UploadIdempotencyTTL: time.Duration(getEnvInt("PWSAFE_UPLOAD_IDEMPOTENCY_TTL", 300)) * time.Second,
+
+		KeyfileDirectory: os.Getenv("PWSAFE_KEYFILE_DIRECTORY"),
+		SessionTTL:       time.Duration(getEnvInt("PWSAFE_SESSION_TTL", 0)) * time.Second,
+		SafeCacheTTL:     safeCacheTTL,
+
+		MinMasterPasswordLength: getEnvInt("PWSAFE_MIN_MASTER_PASSWORD_LENGTH", 0),
+		BreachedPasswordList:    os.Getenv("PWSAFE_BREACHED_PASSWORD_LIST"),
+
+		DuplicatePrecedence: duplicatePrecedence,
+
+		DownloadStallTimeout: downloadStallTimeout,
+		SyncJitterPercent:    syncJitterPercent,
+		MaxConcurrentSyncs:   getEnvInt("PWSAFE_MAX_CONCURRENT_SYNCS", 4),
+		SyncHistorySize:      getEnvInt("PWSAFE_SYNC_HISTORY_SIZE", 50),
+		MaxSyncDuration:      time.Duration(getEnvInt("PWSAFE_MAX_SYNC_DURATION", 600)) * time.Second,
+		EnableDiagnostics:    os.Getenv("PWSAFE_ENABLE_DIAGNOSTICS") == "true",
+		EnableExport:         os.Getenv("PWSAFE_ENABLE_EXPORT") == "true",
+
+		EnableProviderSettings: os.Getenv("PWSAFE_ENABLE_PROVIDER_SETTINGS") == "true",
+		StrictPermissions:      os.Getenv("PWSAFE_STRICT_PERMISSIONS") == "true",
+
+		APIToken: os.Getenv("PWSAFE_API_TOKEN"),
+
+		RateLimitBypass:      rateLimitBypass,
+		RateLimitMaxVisitors: getEnvInt("PWSAFE_RATE_LIMIT_MAX_VISITORS", 10000),
+		RateLimitIdleTimeout: time.Duration(getEnvInt("PWSAFE_RATE_LIMIT_IDLE_TIMEOUT", 600)) * time.Second,
+
+		OutboundAllow: getEnvList("PWSAFE_OUTBOUND_ALLOW"),
+		OutboundBlock: getEnvList("PWSAFE_OUTBOUND_BLOCK"),
+	}
+}
+
+// getEnvInt reads a positive integer from the environment, falling back to def
+func getEnvInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Warning: invalid %s %q, using default %d", key, value, def)
+		return def
+	}
+	return n
+}
+
+// getEnvList reads a comma-separated list from the environment
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
 	}
+	return values
 }
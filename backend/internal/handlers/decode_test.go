@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/service"
+)
+
+func TestDecodeJSONBody_FieldSpecificErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty", ``, "request body is required"},
+		{"malformed", `{"password": `, "request body is not valid JSON"},
+		{"syntax", `{"password" "x"}`, "request body is not valid JSON (at offset 13)"},
+		{"wrong type", `{"password": 123}`, "password must be a string"},
+		{"wrong nested type", `{"files": [{"selected": "yes"}]}`, "files.0.selected must be a boolean"},
+		{"not an object", `[]`, "request body must be an object"},
+		{"unknown field", `{"password": "x", "pasword": "y"}`, `unknown field "pasword"`},
+		{"trailing data", `{"password": "x"} {}`, "request body must contain a single JSON object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst struct {
+				Password string                 `json:"password"`
+				Files    []service.SelectedFile `json:"files"`
+			}
+			err := decodeJSONBody(strings.NewReader(tt.body), &dst)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("Expected %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestUnlockSafe_ReportsInvalidField(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata"))
+
+	encodedPath := url.PathEscape("/testdata/simple.psafe3")
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/unlock", strings.NewReader(`{"password": true}`))
+	w := httptest.NewRecorder()
+
+	handler.UnlockSafe(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "password must be a string") {
+		t.Errorf("Expected field-specific error, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+)
+
+// parseEntryFields reads a comma-separated ?fields= value. Nil means every
+// field; an unknown name is an error so typos don't silently drop data.
+func parseEntryFields(raw string) (map[string]bool, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	fields := map[string]bool{"uuid": true}
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "uuid" {
+			continue
+		}
+		if !slices.Contains(models.EntryFields, name) {
+			return nil, fmt.Errorf("unknown field %q; valid fields are %s", name, strings.Join(models.EntryFields, ", "))
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// filteredGroup mirrors models.Group with each entry reduced to a field map
+type filteredGroup struct {
+	Name    string                   `json:"name"`
+	Groups  []*filteredGroup         `json:"groups,omitempty"`
+	Entries []map[string]interface{} `json:"entries,omitempty"`
+}
+
+type filteredStructure struct {
+	Groups  []*filteredGroup         `json:"groups"`
+	Entries []map[string]interface{} `json:"entries"`
+}
+
+// filterEntryFields returns structure with each entry reduced to fields.
+// Groups are kept whole so the tree shape doesn't change.
+func filterEntryFields(structure *models.SafeStructure, fields map[string]bool) *filteredStructure {
+	return &filteredStructure{
+		Groups:  filterGroups(structure.Groups, fields),
+		Entries: filterEntries(structure.Entries, fields),
+	}
+}
+
+func filterGroups(groups []*models.Group, fields map[string]bool) []*filteredGroup {
+	if groups == nil {
+		return nil
+	}
+	filtered := make([]*filteredGroup, len(groups))
+	for i, group := range groups {
+		filtered[i] = &filteredGroup{
+			Name:    group.Name,
+			Groups:  filterGroups(group.Groups, fields),
+			Entries: filterEntries(group.Entries, fields),
+		}
+	}
+	return filtered
+}
+
+func filterEntries(entries []models.Entry, fields map[string]bool) []map[string]interface{} {
+	if entries == nil {
+		return nil
+	}
+	filtered := make([]map[string]interface{}, len(entries))
+	for i := range entries {
+		filtered[i] = filterEntry(&entries[i], fields)
+	}
+	return filtered
+}
+
+// filterEntry picks the selected fields off entry, leaving out empty ones the
+// same way the Entry JSON tags do
+func filterEntry(entry *models.Entry, fields map[string]bool) map[string]interface{} {
+	m := map[string]interface{}{"uuid": entry.UUID}
+	if fields["title"] {
+		m["title"] = entry.Title
+	}
+	if fields["username"] {
+		m["username"] = entry.Username
+	}
+	if fields["url"] && entry.URL != "" {
+		m["url"] = entry.URL
+	}
+	if fields["notes"] && entry.Notes != "" {
+		m["notes"] = entry.Notes
+	}
+	if fields["extraFields"] && len(entry.ExtraFields) > 0 {
+		m["extraFields"] = entry.ExtraFields
+	}
+	if fields["hasTOTP"] && entry.HasTOTP {
+		m["hasTOTP"] = true
+	}
+	if fields["createdAt"] && entry.CreatedAt != nil {
+		m["createdAt"] = entry.CreatedAt
+	}
+	if fields["modifiedAt"] && entry.ModifiedAt != nil {
+		m["modifiedAt"] = entry.ModifiedAt
+	}
+	if fields["passwordChangedAt"] && entry.PasswordChangedAt != nil {
+		m["passwordChangedAt"] = entry.PasswordChangedAt
+	}
+	return m
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIdempotencyKeys bounds how many request results are remembered at once
+const maxIdempotencyKeys = 1000
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key header accepted
+const maxIdempotencyKeyLength = 255
+
+// idempotentResult is the response to the first request sent with a key.
+// fingerprint identifies that request, so the key can't be reused for a
+// different one. done is closed once it is recorded; retry is set when it
+// didn't succeed, so a duplicate should run the request itself instead.
+type idempotentResult struct {
+	fingerprint string
+	done        chan struct{}
+	retry       bool
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// idempotencyStore remembers responses by client-supplied Idempotency-Key,
+// so a retried or double-submitted request gets the original result
+// instead of being processed again
+type idempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	results map[string]*idempotentResult
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{ttl: ttl, results: make(map[string]*idempotentResult)}
+}
+
+// begin returns the result for key and true if the caller is the first to
+// use it, in which case it must call finish
+func (st *idempotencyStore) begin(key, fingerprint string) (*idempotentResult, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.pruneLocked(time.Now())
+	if res, ok := st.results[key]; ok {
+		return res, false
+	}
+	res := &idempotentResult{fingerprint: fingerprint, done: make(chan struct{})}
+	if len(st.results) < maxIdempotencyKeys {
+		st.results[key] = res
+	}
+	return res, true
+}
+
+// finish records the response for key. Only successes are kept; any other
+// result is forgotten so the request can be retried, for example after
+// fixing what made it fail.
+func (st *idempotencyStore) finish(key string, res *idempotentResult, rec *recordingWriter) {
+	st.mu.Lock()
+	if rec.status < 200 || rec.status >= 300 {
+		res.retry = true
+		if st.results[key] == res {
+			delete(st.results, key)
+		}
+	} else {
+		res.status = rec.status
+		res.contentType = rec.Header().Get("Content-Type")
+		res.body = rec.body.Bytes()
+		res.expiresAt = time.Now().Add(st.ttl)
+	}
+	st.mu.Unlock()
+	close(res.done)
+}
+
+func (st *idempotencyStore) pruneLocked(now time.Time) {
+	for key, res := range st.results {
+		select {
+		case <-res.done:
+			if !now.Before(res.expiresAt) {
+				delete(st.results, key)
+			}
+		default:
+			// Still in flight
+		}
+	}
+}
+
+// recordingWriter passes a response through while keeping a copy of it
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(p []byte) (int, error) {
+	rw.body.Write(p)
+	return rw.ResponseWriter.Write(p)
+}
+
+// requestFingerprint identifies a request by its method, path, query and
+// extra, which holds what the body contributes (an upload's filename and
+// content hash)
+func requestFingerprint(r *http.Request, extra string) string {
+	return strings.Join([]string{r.Method, r.URL.Path, r.URL.RawQuery, extra}, "\x00")
+}
+
+// idempotent runs next once per Idempotency-Key header within the store's
+// TTL. A duplicate waits for the first request to finish and receives its
+// response, marked with Idempotent-Replayed: true; a key reused for a
+// different request (see requestFingerprint) is refused with 422. Requests
+// without the header, or when store is nil, always run.
+func idempotent(store *idempotencyStore, w http.ResponseWriter, r *http.Request, extra func(*http.Request) string, next http.HandlerFunc, respondError func(http.ResponseWriter, string, int)) {
+	key := r.Header.Get("Idempotency-Key")
+	if store == nil || key == "" {
+		next(w, r)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		respondError(w, "Idempotency-Key is too long", http.StatusBadRequest)
+		return
+	}
+
+	fingerprint := requestFingerprint(r, extra(r))
+	for {
+		res, first := store.begin(key, fingerprint)
+		if res.fingerprint != fingerprint {
+			respondError(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+			return
+		}
+		if first {
+			rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			next(rec, r)
+			store.finish(key, res, rec)
+			return
+		}
+
+		select {
+		case <-res.done:
+		case <-r.Context().Done():
+			return
+		}
+		if res.retry {
+			continue
+		}
+
+		w.Header().Set("Content-Type", res.contentType)
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(res.status)
+		w.Write(res.body)
+		return
+	}
+}
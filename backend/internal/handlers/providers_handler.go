@@ -1,12 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rolledback/pwsafe-service/backend/internal/models"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider"
 	"github.com/rolledback/pwsafe-service/backend/internal/service"
 )
 
@@ -18,18 +28,115 @@ type ProviderInfo struct {
 	BrandColor  string `json:"brandColor"`
 }
 
+// ProviderConfigurer validates and saves a provider's settings.json and returns
+// a started sync service for the resulting provider. It calls stopPrevious
+// once the settings are accepted and before starting the new service, so the
+// provider's current service never runs alongside its replacement but keeps
+// running if the settings are rejected.
+type ProviderConfigurer func(providerID string, settingsJSON []byte, stopPrevious func()) (*service.SyncableSafesService, error)
+
+// syncAllConcurrency bounds how many providers POST /api/providers/sync-all syncs at once
+const syncAllConcurrency = 4
+
+// ProviderSyncSummary is one provider's outcome in a sync-all response
+type ProviderSyncSummary struct {
+	ProviderID   string               `json:"providerId"`
+	Status       string               `json:"status"` // synced, partial, skipped or failed
+	Results      []service.SyncResult `json:"results,omitempty"`
+	SuccessCount int                  `json:"successCount"`
+	FailureCount int                  `json:"failureCount"`
+	Error        string               `json:"error,omitempty"` // Why the provider was skipped or failed
+	Code         string               `json:"code,omitempty"`
+}
+
+// maxSettingsSize bounds POST /api/providers/{id}/settings bodies
+const maxSettingsSize = 64 << 10
+
 // ProvidersHandler handles HTTP requests for all providers
 type ProvidersHandler struct {
-	services map[string]*service.SyncableSafesService
+	servicesMutex sync.RWMutex // services is replaced when settings are saved
+	services      map[string]*service.SyncableSafesService
+	settingsLocks map[string]*sync.Mutex  // providerID -> serializes settings saves; guarded by servicesMutex
+	types         []provider.ProviderType // Supported provider types, configured or not
+	configure     ProviderConfigurer      // nil disables the settings endpoint
+	syncTimeout   time.Duration           // bounds syncs triggered over HTTP; zero leaves them to the client
+
+	iconMutex sync.RWMutex
+	icons     map[string]*provider.Icon // providerID -> decoded icon
 }
 
 // NewProvidersHandler creates a new providers handler
 func NewProvidersHandler(services map[string]*service.SyncableSafesService) *ProvidersHandler {
 	return &ProvidersHandler{
 		services: services,
+		icons:    make(map[string]*provider.Icon),
+	}
+}
+
+// settingsLock returns the mutex serializing settings saves for providerID
+func (h *ProvidersHandler) settingsLock(providerID string) *sync.Mutex {
+	h.servicesMutex.Lock()
+	defer h.servicesMutex.Unlock()
+	if h.settingsLocks == nil {
+		h.settingsLocks = make(map[string]*sync.Mutex)
+	}
+	if h.settingsLocks[providerID] == nil {
+		h.settingsLocks[providerID] = &sync.Mutex{}
+	}
+	return h.settingsLocks[providerID]
+}
+
+// SetConfigurer enables POST /api/providers/{id}/settings, which saves settings
+// through configure and swaps in the returned service
+func (h *ProvidersHandler) SetConfigurer(configure ProviderConfigurer) {
+	h.configure = configure
+}
+
+// SetSyncTimeout bounds how long a sync triggered by POST /sync or /sync-all
+// may run, however long the client stays connected
+func (h *ProvidersHandler) SetSyncTimeout(d time.Duration) {
+	h.syncTimeout = d
+}
+
+// syncContext derives the context for an HTTP-triggered sync from the request
+func (h *ProvidersHandler) syncContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if h.syncTimeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), h.syncTimeout)
+}
+
+// StopServices stops every provider's sync service
+func (h *ProvidersHandler) StopServices() {
+	h.servicesMutex.RLock()
+	defer h.servicesMutex.RUnlock()
+	for _, svc := range h.services {
+		svc.Stop()
 	}
 }
 
+// SetProviderTypes sets the provider types listed by ListProviderTypes
+func (h *ProvidersHandler) SetProviderTypes(types []provider.ProviderType) {
+	h.types = types
+}
+
+// ListProviderTypes handles GET /api/provider-types - lists the provider types
+// this binary supports, including ones with no configured instance
+func (h *ProvidersHandler) ListProviderTypes(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET /api/provider-types")
+
+	if r.Method != http.MethodGet {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	types := h.types
+	if types == nil {
+		types = []provider.ProviderType{}
+	}
+	h.respondJSON(w, map[string]interface{}{"providerTypes": types}, http.StatusOK)
+}
+
 // ListProviders handles GET /api/providers - lists all available providers
 func (h *ProvidersHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
 	log.Printf("GET /api/providers")
@@ -39,13 +146,29 @@ func (h *ProvidersHandler) ListProviders(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	connectedOnly := r.URL.Query().Get("connected") == "true"
+
+	h.servicesMutex.RLock()
+	defer h.servicesMutex.RUnlock()
+
 	providers := make([]ProviderInfo, 0, len(h.services))
 	for _, svc := range h.services {
 		p := svc.Provider()
+		if connectedOnly {
+			// Cheap check only - no token refresh just to build a list
+			status, err := p.GetConnectionStatus(r.Context(), false)
+			if err != nil || !status.Connected {
+				continue
+			}
+		}
+		icon := ""
+		if p.Icon() != "" {
+			icon = "/api/providers/" + p.ID() + "/icon"
+		}
 		providers = append(providers, ProviderInfo{
 			ID:          p.ID(),
 			DisplayName: p.DisplayName(),
-			Icon:        p.Icon(),
+			Icon:        icon,
 			BrandColor:  p.BrandColor(),
 		})
 	}
@@ -53,6 +176,29 @@ func (h *ProvidersHandler) ListProviders(w http.ResponseWriter, r *http.Request)
 	h.respondJSON(w, map[string]interface{}{"providers": providers}, http.StatusOK)
 }
 
+// ListCapabilities handles GET /api/debug/capabilities - reports which optional
+// features each configured provider supports
+func (h *ProvidersHandler) ListCapabilities(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET /api/debug/capabilities")
+
+	if r.Method != http.MethodGet {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.servicesMutex.RLock()
+	capabilities := make([]service.ProviderCapabilities, 0, len(h.services))
+	for _, svc := range h.services {
+		capabilities = append(capabilities, svc.Capabilities())
+	}
+	h.servicesMutex.RUnlock()
+
+	slices.SortFunc(capabilities, func(a, b service.ProviderCapabilities) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	h.respondJSON(w, map[string]interface{}{"providers": capabilities}, http.StatusOK)
+}
+
 // Route handles all /api/providers/{id}/* requests
 func (h *ProvidersHandler) Route(w http.ResponseWriter, r *http.Request) {
 	// Parse provider ID and action from path
@@ -71,10 +217,23 @@ func (h *ProvidersHandler) Route(w http.ResponseWriter, r *http.Request) {
 		action = parts[1]
 	}
 
+	if providerID == "sync-all" && action == "" {
+		h.syncAll(w, r)
+		return
+	}
+
+	// Settings may be written for a provider that isn't configured yet
+	if action == "settings" {
+		h.saveSettings(w, r, providerID)
+		return
+	}
+
 	// Get the service for this provider
+	h.servicesMutex.RLock()
 	svc, ok := h.services[providerID]
+	h.servicesMutex.RUnlock()
 	if !ok {
-		h.respondError(w, "Provider not found", http.StatusNotFound)
+		h.respondErrorCode(w, "Provider not found", models.ErrorCodeProviderNotFound, http.StatusNotFound)
 		return
 	}
 
@@ -82,21 +241,112 @@ func (h *ProvidersHandler) Route(w http.ResponseWriter, r *http.Request) {
 	switch action {
 	case "status":
 		h.getStatus(w, r, svc)
+	case "icon":
+		h.getIcon(w, r, svc)
 	case "auth/url":
 		h.getAuthURL(w, r, svc)
 	case "auth/callback":
-		h.handleCallback(w, r, svc, providerID)
+		h.handleCallback(w, r, svc)
+	case "auth/device":
+		h.startDeviceAuth(w, r, svc)
+	case "auth/reset":
+		h.resetAuth(w, r, svc)
+	case "reauth":
+		h.forceReauth(w, r, svc)
 	case "disconnect":
 		h.disconnect(w, r, svc)
 	case "files":
 		h.handleFiles(w, r, svc)
+	case "files/selected":
+		h.selectedFiles(w, r, svc)
+	case "files/push":
+		h.pushFile(w, r, svc)
+	case "browse":
+		h.browseFolder(w, r, svc)
 	case "sync":
 		h.sync(w, r, svc)
+	case "quota":
+		h.getQuota(w, r, svc)
+	case "history":
+		h.getHistory(w, r, svc)
 	default:
 		h.respondError(w, "Unknown action", http.StatusNotFound)
 	}
 }
 
+// saveSettings handles POST /api/providers/{id}/settings. The body is the new
+// settings.json; once it validates, the provider starts (or restarts) syncing.
+func (h *ProvidersHandler) saveSettings(w http.ResponseWriter, r *http.Request, providerID string) {
+	log.Printf("POST /api/providers/%s/settings", providerID)
+
+	if h.configure == nil {
+		h.respondError(w, "Unknown action", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settingsJSON, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSettingsSize))
+	if err != nil {
+		h.respondError(w, "Settings too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(settingsJSON, &fields); err != nil || fields == nil {
+		h.respondError(w, "Settings must be a JSON object", http.StatusBadRequest)
+		return
+	}
+
+	// One save per provider at a time, so each replaced service is stopped
+	// rather than one save's service silently overwriting another's
+	lock := h.settingsLock(providerID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	h.servicesMutex.RLock()
+	previous := h.services[providerID]
+	h.servicesMutex.RUnlock()
+	var stopOnce sync.Once
+	stopPrevious := func() {
+		stopOnce.Do(func() {
+			if previous != nil {
+				previous.Stop()
+			}
+		})
+	}
+
+	svc, err := h.configure(providerID, settingsJSON, stopPrevious)
+	if err != nil {
+		log.Printf("Error saving %s settings: %v", providerID, err)
+		if strings.Contains(err.Error(), "unknown provider type") {
+			h.respondErrorCode(w, "Provider not found", models.ErrorCodeProviderNotFound, http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "invalid settings") || strings.Contains(err.Error(), "baseUrl is required") {
+			h.respondError(w, err.Error(), http.StatusBadRequest)
+		} else {
+			h.respondError(w, "Failed to save settings", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	stopPrevious() // In case the configurer didn't
+
+	h.servicesMutex.Lock()
+	replaced := h.services[providerID]
+	h.services[providerID] = svc
+	h.servicesMutex.Unlock()
+	if replaced != nil && replaced != previous {
+		replaced.Stop()
+	}
+
+	h.iconMutex.Lock()
+	delete(h.icons, providerID)
+	h.iconMutex.Unlock()
+
+	h.respondJSON(w, map[string]bool{"success": true}, http.StatusOK)
+}
+
 func (h *ProvidersHandler) getStatus(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
 	providerID := svc.Provider().ID()
 	log.Printf("GET /api/providers/%s/status", providerID)
@@ -116,6 +366,127 @@ func (h *ProvidersHandler) getStatus(w http.ResponseWriter, r *http.Request, svc
 	h.respondJSON(w, status, http.StatusOK)
 }
 
+// getQuota handles GET /api/providers/{id}/quota
+func (h *ProvidersHandler) getQuota(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
+	providerID := svc.Provider().ID()
+	log.Printf("GET /api/providers/%s/quota", providerID)
+
+	if r.Method != http.MethodGet {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	quota, err := svc.GetQuota(r.Context())
+	if err != nil {
+		log.Printf("Error getting %s quota: %v", providerID, err)
+		if strings.Contains(err.Error(), "quota not supported") {
+			h.respondError(w, "Provider does not report storage quota", http.StatusNotImplemented)
+			return
+		}
+		if needsReauth(err) {
+			h.respondErrorCode(w, "Failed to get quota", models.ErrorCodeReauthRequired, http.StatusInternalServerError)
+			return
+		}
+		h.respondError(w, "Failed to get quota", http.StatusInternalServerError)
+		return
+	}
+
+	h.respondJSON(w, quota, http.StatusOK)
+}
+
+// browseFolder handles GET /api/providers/{id}/browse?path=/Documents. The
+// path defaults to the drive root.
+func (h *ProvidersHandler) browseFolder(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
+	providerID := svc.Provider().ID()
+	log.Printf("GET /api/providers/%s/browse", providerID)
+
+	if r.Method != http.MethodGet {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	folderPath := r.URL.Query().Get("path")
+	if folderPath == "" {
+		folderPath = "/"
+	}
+
+	contents, err := svc.BrowseFolder(r.Context(), folderPath)
+	if err != nil {
+		log.Printf("Error browsing %s folder: %v", providerID, err)
+		switch {
+		case strings.Contains(err.Error(), "browse not supported"):
+			h.respondError(w, "Provider does not support browsing folders", http.StatusNotImplemented)
+		case strings.Contains(err.Error(), "invalid folder path"):
+			h.respondError(w, err.Error(), http.StatusBadRequest)
+		case strings.Contains(err.Error(), "folder not found"):
+			h.respondError(w, "Folder not found", http.StatusNotFound)
+		case needsReauth(err):
+			h.respondErrorCode(w, "Failed to browse folder", models.ErrorCodeReauthRequired, http.StatusInternalServerError)
+		default:
+			h.respondError(w, "Failed to browse folder", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.respondJSON(w, contents, http.StatusOK)
+}
+
+// getHistory handles GET /api/providers/{id}/history
+func (h *ProvidersHandler) getHistory(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
+	log.Printf("GET /api/providers/%s/history", svc.Provider().ID())
+
+	if r.Method != http.MethodGet {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.respondJSON(w, map[string]interface{}{"history": svc.History()}, http.StatusOK)
+}
+
+func (h *ProvidersHandler) getIcon(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
+	if r.Method != http.MethodGet {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	icon, err := h.loadIcon(svc)
+	if err != nil {
+		log.Printf("Error decoding %s icon: %v", svc.Provider().ID(), err)
+		h.respondError(w, "Icon not available", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", icon.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=604800")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(icon.Data)
+}
+
+// loadIcon decodes the provider's icon data URL once and caches the result
+func (h *ProvidersHandler) loadIcon(svc *service.SyncableSafesService) (*provider.Icon, error) {
+	providerID := svc.Provider().ID()
+
+	h.iconMutex.RLock()
+	icon, ok := h.icons[providerID]
+	h.iconMutex.RUnlock()
+	if ok {
+		return icon, nil
+	}
+
+	decoded, err := provider.ParseDataURL(svc.Provider().Icon())
+	if err != nil {
+		return nil, err
+	}
+	icon = &decoded
+
+	h.iconMutex.Lock()
+	h.icons[providerID] = icon
+	h.iconMutex.Unlock()
+
+	return icon, nil
+}
+
 func (h *ProvidersHandler) getAuthURL(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
 	providerID := svc.Provider().ID()
 	log.Printf("GET /api/providers/%s/auth/url", providerID)
@@ -135,7 +506,55 @@ func (h *ProvidersHandler) getAuthURL(w http.ResponseWriter, r *http.Request, sv
 	h.respondJSON(w, map[string]string{"url": authURL}, http.StatusOK)
 }
 
-func (h *ProvidersHandler) handleCallback(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService, providerID string) {
+// startDeviceAuth handles POST /api/providers/{id}/auth/device. It returns the
+// code for the user to enter; the server then polls until they do, and status
+// reports connected once it succeeds.
+func (h *ProvidersHandler) startDeviceAuth(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
+	providerID := svc.Provider().ID()
+	log.Printf("POST /api/providers/%s/auth/device", providerID)
+
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code, err := svc.StartDeviceAuth(r.Context())
+	if err != nil {
+		log.Printf("Error starting %s device sign-in: %v", providerID, err)
+		if strings.Contains(err.Error(), "not supported") {
+			h.respondError(w, "Provider does not support device code sign-in", http.StatusNotImplemented)
+			return
+		}
+		if strings.Contains(err.Error(), "read-only") {
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeReadOnly, http.StatusConflict)
+			return
+		}
+		h.respondError(w, "Failed to start device sign-in", http.StatusInternalServerError)
+		return
+	}
+
+	h.respondJSON(w, code, http.StatusOK)
+}
+
+// safeProviderID matches provider IDs that can be placed in a redirect path as-is
+var safeProviderID = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// callbackRedirect builds the post-auth redirect into the web UI. The ID comes
+// from the provider itself rather than the request path, and anything that
+// isn't a plain identifier falls back to the UI root.
+func callbackRedirect(providerID, errorCode string) string {
+	if !safeProviderID.MatchString(providerID) {
+		return "/web/"
+	}
+	target := "/web/add/" + providerID
+	if errorCode != "" {
+		target += "?error=" + url.QueryEscape(errorCode)
+	}
+	return target
+}
+
+func (h *ProvidersHandler) handleCallback(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
+	providerID := svc.Provider().ID()
 	log.Printf("GET /api/providers/%s/auth/callback", providerID)
 
 	if r.Method != http.MethodGet {
@@ -149,17 +568,59 @@ func (h *ProvidersHandler) handleCallback(w http.ResponseWriter, r *http.Request
 		if errorDesc != "" {
 			log.Printf("OAuth error for %s: %s", providerID, errorDesc)
 		}
-		http.Redirect(w, r, "/web/add/"+providerID+"?error=auth_failed", http.StatusFound)
+		http.Redirect(w, r, callbackRedirect(providerID, "auth_failed"), http.StatusFound)
 		return
 	}
 
-	if err := svc.Provider().HandleCallback(r.Context(), code); err != nil {
+	if err := svc.HandleCallback(r.Context(), code); err != nil {
 		log.Printf("Error handling %s callback: %v", providerID, err)
-		http.Redirect(w, r, "/web/add/"+providerID+"?error=token_exchange_failed", http.StatusFound)
+		if strings.Contains(err.Error(), "read-only") {
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeReadOnly, http.StatusConflict)
+			return
+		}
+		http.Redirect(w, r, callbackRedirect(providerID, "token_exchange_failed"), http.StatusFound)
 		return
 	}
 
-	http.Redirect(w, r, "/web/add/"+providerID, http.StatusFound)
+	http.Redirect(w, r, callbackRedirect(providerID, ""), http.StatusFound)
+}
+
+func (h *ProvidersHandler) resetAuth(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
+	providerID := svc.Provider().ID()
+	log.Printf("POST /api/providers/%s/auth/reset", providerID)
+
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := svc.Provider().ResetAuthState(r.Context()); err != nil {
+		log.Printf("Error resetting %s auth state: %v", providerID, err)
+		h.respondError(w, "Failed to reset auth state", http.StatusInternalServerError)
+		return
+	}
+
+	h.respondJSON(w, map[string]bool{"success": true}, http.StatusOK)
+}
+
+// forceReauth handles POST /api/providers/{id}/reauth, signing the provider
+// out without forgetting which files it syncs
+func (h *ProvidersHandler) forceReauth(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
+	providerID := svc.Provider().ID()
+	log.Printf("POST /api/providers/%s/reauth", providerID)
+
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := svc.ForceReauth(r.Context()); err != nil {
+		log.Printf("Error forcing %s reauth: %v", providerID, err)
+		h.respondError(w, "Failed to clear provider tokens", http.StatusInternalServerError)
+		return
+	}
+
+	h.respondJSON(w, map[string]bool{"success": true}, http.StatusOK)
 }
 
 func (h *ProvidersHandler) disconnect(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
@@ -198,13 +659,88 @@ func (h *ProvidersHandler) listFiles(w http.ResponseWriter, r *http.Request, svc
 	files, err := svc.ListFiles(r.Context())
 	if err != nil {
 		log.Printf("Error listing %s files: %v", providerID, err)
+		if needsReauth(err) {
+			h.respondErrorCode(w, "Failed to list files", models.ErrorCodeReauthRequired, http.StatusInternalServerError)
+			return
+		}
 		h.respondError(w, "Failed to list files", http.StatusInternalServerError)
 		return
 	}
 
+	response := map[string]interface{}{"files": files}
+	if r.URL.Query().Get("groupBy") == "folder" {
+		response["byFolder"] = service.GroupFilesByFolder(files)
+	}
+	h.respondJSON(w, response, http.StatusOK)
+}
+
+// selectedFiles handles GET /api/providers/{id}/files/selected from saved config only
+func (h *ProvidersHandler) selectedFiles(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
+	providerID := svc.Provider().ID()
+	log.Printf("GET /api/providers/%s/files/selected", providerID)
+
+	if r.Method != http.MethodGet {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	files, err := svc.SelectedFiles()
+	if err != nil {
+		log.Printf("Error reading %s selection: %v", providerID, err)
+		h.respondError(w, "Failed to read selected files", http.StatusInternalServerError)
+		return
+	}
+
 	h.respondJSON(w, map[string]interface{}{"files": files}, http.StatusOK)
 }
 
+// pushFile handles POST /api/providers/{id}/files/push, uploading the synced
+// copy of a selected file back to the provider
+func (h *ProvidersHandler) pushFile(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
+	providerID := svc.Provider().ID()
+	log.Printf("POST /api/providers/%s/files/push", providerID)
+
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		FileID string `json:"fileId"`
+	}
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		h.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.FileID == "" {
+		h.respondError(w, "fileId is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := svc.PushFile(r.Context(), req.FileID); err != nil {
+		log.Printf("Error uploading %s file: %v", providerID, err)
+		switch {
+		case strings.Contains(err.Error(), "upload not supported"):
+			h.respondError(w, "Provider does not support uploading files", http.StatusNotImplemented)
+		case strings.Contains(err.Error(), "upload not enabled"):
+			h.respondErrorCode(w, "Uploads are not enabled in the provider's settings.json", models.ErrorCodeNotSupported, http.StatusNotImplemented)
+		case strings.Contains(err.Error(), "read-only"):
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeReadOnly, http.StatusConflict)
+		case strings.Contains(err.Error(), "upload conflict"):
+			h.respondErrorCode(w, "The remote file changed since the last sync - sync and resolve the conflict before pushing", models.ErrorCodeConflict, http.StatusConflict)
+		case strings.Contains(err.Error(), "file not selected"), strings.Contains(err.Error(), "file not synced"):
+			h.respondError(w, err.Error(), http.StatusNotFound)
+		case needsReauth(err):
+			h.respondErrorCode(w, "Failed to upload file", models.ErrorCodeReauthRequired, http.StatusInternalServerError)
+		default:
+			h.respondError(w, "Failed to upload file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.respondJSON(w, map[string]bool{"success": true}, http.StatusOK)
+}
+
 func (h *ProvidersHandler) saveFiles(w http.ResponseWriter, r *http.Request, svc *service.SyncableSafesService) {
 	providerID := svc.Provider().ID()
 	log.Printf("PUT /api/providers/%s/files", providerID)
@@ -212,13 +748,17 @@ func (h *ProvidersHandler) saveFiles(w http.ResponseWriter, r *http.Request, svc
 	var req struct {
 		Files []service.SelectedFile `json:"files"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.respondError(w, "Invalid request body", http.StatusBadRequest)
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		h.respondError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	if err := svc.SaveFiles(req.Files); err != nil {
 		log.Printf("Error saving %s files: %v", providerID, err)
+		if strings.Contains(err.Error(), "read-only") {
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeReadOnly, http.StatusConflict)
+			return
+		}
 		h.respondError(w, "Failed to save files", http.StatusInternalServerError)
 		return
 	}
@@ -235,14 +775,151 @@ func (h *ProvidersHandler) sync(w http.ResponseWriter, r *http.Request, svc *ser
 		return
 	}
 
-	results, err := svc.Sync(r.Context())
+	ctx, cancel := h.syncContext(r)
+	defer cancel()
+
+	// Don't leave the request hanging behind a periodic sync
+	results, err := svc.TrySync(ctx)
+	if err != nil && strings.Contains(err.Error(), "already in progress") {
+		body := map[string]interface{}{
+			"error":          "Sync already in progress",
+			"code":           models.ErrorCodeSyncInProgress,
+			"syncInProgress": true,
+		}
+		if startedAt := svc.SyncStartedAt(); !startedAt.IsZero() {
+			body["syncStartedAt"] = startedAt.Format(time.RFC3339)
+		}
+		h.respondJSON(w, body, http.StatusConflict)
+		return
+	}
 	if err != nil {
 		log.Printf("Error syncing %s files: %v", providerID, err)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			h.respondErrorCode(w, fmt.Sprintf("Sync exceeded %s and was stopped; files already downloaded were kept", h.syncTimeout),
+				models.ErrorCodeSyncTimeout, http.StatusGatewayTimeout)
+			return
+		}
+		if strings.Contains(err.Error(), "read-only") {
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeReadOnly, http.StatusConflict)
+			return
+		}
+		if needsReauth(err) {
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeReauthRequired, http.StatusInternalServerError)
+			return
+		}
 		h.respondError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	h.respondJSON(w, map[string]interface{}{"results": results}, http.StatusOK)
+	successCount := 0
+	for _, result := range results {
+		if result.Success {
+			successCount++
+		}
+	}
+	failureCount := len(results) - successCount
+
+	// 200 when every file synced, 207 Multi-Status when any file failed
+	status := http.StatusOK
+	if failureCount > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	h.respondJSON(w, map[string]interface{}{
+		"results":      results,
+		"successCount": successCount,
+		"failureCount": failureCount,
+	}, status)
+}
+
+// syncAll handles POST /api/providers/sync-all. Connected providers sync
+// concurrently; ones that are disconnected or already syncing are reported as
+// skipped instead of delaying the response.
+func (h *ProvidersHandler) syncAll(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST /api/providers/sync-all")
+
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.servicesMutex.RLock()
+	services := make([]*service.SyncableSafesService, 0, len(h.services))
+	for _, svc := range h.services {
+		services = append(services, svc)
+	}
+	h.servicesMutex.RUnlock()
+
+	ctx, cancel := h.syncContext(r)
+	defer cancel()
+
+	summaries := make([]ProviderSyncSummary, len(services))
+	sem := make(chan struct{}, syncAllConcurrency)
+	var wg sync.WaitGroup
+	for i, svc := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			summaries[i] = syncProvider(ctx, svc)
+		}()
+	}
+	wg.Wait()
+
+	slices.SortFunc(summaries, func(a, b ProviderSyncSummary) int {
+		return strings.Compare(a.ProviderID, b.ProviderID)
+	})
+	h.respondJSON(w, map[string]interface{}{"providers": summaries}, http.StatusOK)
+}
+
+// syncProvider runs one provider's part of a sync-all
+func syncProvider(ctx context.Context, svc *service.SyncableSafesService) ProviderSyncSummary {
+	summary := ProviderSyncSummary{ProviderID: svc.Provider().ID()}
+
+	// Cheap check only, like the connected filter on the provider list
+	status, err := svc.Provider().GetConnectionStatus(ctx, false)
+	if err != nil || !status.Connected {
+		summary.Status = "skipped"
+		summary.Error = "Not connected"
+		return summary
+	}
+
+	results, err := svc.TrySync(ctx)
+	if err != nil {
+		summary.Error = err.Error()
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			summary.Status = "failed"
+			summary.Code = models.ErrorCodeSyncTimeout
+		case strings.Contains(err.Error(), "already in progress"):
+			summary.Status = "skipped"
+			summary.Error = "Sync already in progress"
+			summary.Code = models.ErrorCodeSyncInProgress
+		case strings.Contains(err.Error(), "read-only"):
+			summary.Status = "skipped"
+			summary.Code = models.ErrorCodeReadOnly
+		case needsReauth(err):
+			summary.Status = "failed"
+			summary.Code = models.ErrorCodeReauthRequired
+		default:
+			summary.Status = "failed"
+		}
+		return summary
+	}
+
+	summary.Results = results
+	for _, result := range results {
+		if result.Success {
+			summary.SuccessCount++
+		}
+	}
+	summary.FailureCount = len(results) - summary.SuccessCount
+	summary.Status = "synced"
+	if summary.FailureCount > 0 {
+		summary.Status = "partial"
+	}
+	return summary
 }
 
 func (h *ProvidersHandler) respondJSON(w http.ResponseWriter, data interface{}, status int) {
@@ -252,5 +929,14 @@ func (h *ProvidersHandler) respondJSON(w http.ResponseWriter, data interface{},
 }
 
 func (h *ProvidersHandler) respondError(w http.ResponseWriter, message string, status int) {
-	h.respondJSON(w, models.ErrorResponse{Error: message}, status)
+	h.respondErrorCode(w, message, models.ErrorCodeForStatus(status), status)
+}
+
+func (h *ProvidersHandler) respondErrorCode(w http.ResponseWriter, message, code string, status int) {
+	h.respondJSON(w, models.ErrorResponse{Error: message, Code: code}, status)
+}
+
+// needsReauth reports whether a provider error means the user must sign in again
+func needsReauth(err error) bool {
+	return strings.Contains(err.Error(), "REAUTH_REQUIRED") || strings.Contains(err.Error(), "not authenticated")
 }
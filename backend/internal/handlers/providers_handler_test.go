@@ -0,0 +1,873 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider/mock"
+	"github.com/rolledback/pwsafe-service/backend/internal/service"
+)
+
+func newTestProvidersHandler(t *testing.T, p *mock.Provider) *ProvidersHandler {
+	t.Helper()
+	svc := service.NewSyncableSafesService(context.Background(), t.TempDir(), p)
+	t.Cleanup(svc.Stop)
+	return NewProvidersHandler(map[string]*service.SyncableSafesService{p.ID(): svc})
+}
+
+func TestResetAuth_Success(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	handler := newTestProvidersHandler(t, mockProvider)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/providers/mock/auth/reset", nil)
+	w := httptest.NewRecorder()
+
+	handler.Route(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if mockProvider.ResetAuthCalls != 1 {
+		t.Errorf("Expected 1 ResetAuthState call, got %d", mockProvider.ResetAuthCalls)
+	}
+	if mockProvider.DisconnectCalls != 0 {
+		t.Errorf("Expected reset to not disconnect, got %d Disconnect calls", mockProvider.DisconnectCalls)
+	}
+}
+
+func TestForceReauth(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	handler := newTestProvidersHandler(t, mockProvider)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/providers/mock/reauth", nil)
+	w := httptest.NewRecorder()
+
+	handler.Route(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if mockProvider.DisconnectCalls != 1 {
+		t.Errorf("Expected 1 Disconnect call, got %d", mockProvider.DisconnectCalls)
+	}
+}
+
+func TestResetAuth_WrongMethod(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	handler := newTestProvidersHandler(t, mockProvider)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/providers/mock/auth/reset", nil)
+	w := httptest.NewRecorder()
+
+	handler.Route(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", w.Code)
+	}
+}
+
+func TestListProviders_IconIsURL(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	handler := newTestProvidersHandler(t, mockProvider)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/providers", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListProviders(w, req)
+
+	var resp struct {
+		Providers []ProviderInfo `json:"providers"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(resp.Providers) != 1 {
+		t.Fatalf("Expected 1 provider, got %d", len(resp.Providers))
+	}
+	if resp.Providers[0].Icon != "/api/providers/mock/icon" {
+		t.Errorf("Expected icon URL '/api/providers/mock/icon', got '%s'", resp.Providers[0].Icon)
+	}
+}
+
+func TestListProviderTypes_IncludesUnconfiguredTypes(t *testing.T) {
+	handler := NewProvidersHandler(map[string]*service.SyncableSafesService{})
+	handler.SetProviderTypes([]provider.ProviderType{{
+		ID:       "onedrive",
+		Settings: []provider.SettingsField{{Name: "clientId", Required: true}},
+	}})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/provider-types", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListProviderTypes(w, req)
+
+	var resp struct {
+		ProviderTypes []provider.ProviderType `json:"providerTypes"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(resp.ProviderTypes) != 1 || resp.ProviderTypes[0].ID != "onedrive" {
+		t.Fatalf("Expected the onedrive type, got %+v", resp.ProviderTypes)
+	}
+	if fields := resp.ProviderTypes[0].Settings; len(fields) != 1 || fields[0].Name != "clientId" || !fields[0].Required {
+		t.Errorf("Expected required clientId setting, got %+v", fields)
+	}
+}
+
+func TestGetIcon_ServesDecodedSVG(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetIcon("data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte("<svg></svg>")))
+	handler := newTestProvidersHandler(t, mockProvider)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/providers/mock/icon", nil)
+	w := httptest.NewRecorder()
+
+	handler.Route(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/svg+xml" {
+		t.Errorf("Expected Content-Type 'image/svg+xml', got '%s'", ct)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "max-age") {
+		t.Errorf("Expected long-lived Cache-Control, got '%s'", cc)
+	}
+	if w.Body.String() != "<svg></svg>" {
+		t.Errorf("Expected raw SVG body, got '%s'", w.Body.String())
+	}
+}
+
+func TestGetIcon_InvalidDataURL(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetIcon("not-a-data-url")
+	handler := newTestProvidersHandler(t, mockProvider)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/providers/mock/icon", nil)
+	w := httptest.NewRecorder()
+
+	handler.Route(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func syncAndDecode(t *testing.T, handler *ProvidersHandler) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/providers/mock/sync", nil)
+	w := httptest.NewRecorder()
+
+	handler.Route(w, req)
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return w.Code, body
+}
+
+func TestSync_AllSucceeded(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+	handler := newTestProvidersHandler(t, mockProvider)
+	handler.services["mock"].SaveFiles([]service.SelectedFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true},
+	})
+
+	code, body := syncAndDecode(t, handler)
+
+	if code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+	if body["successCount"] != float64(1) || body["failureCount"] != float64(0) {
+		t.Errorf("Expected 1 success and 0 failures, got %v/%v", body["successCount"], body["failureCount"])
+	}
+}
+
+func TestSync_PartialFailure(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+	handler := newTestProvidersHandler(t, mockProvider)
+	handler.services["mock"].SaveFiles([]service.SelectedFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true},
+		{ID: "f2", Name: "b.psafe3", Path: "/", Selected: true},
+	})
+
+	code, body := syncAndDecode(t, handler)
+
+	if code != http.StatusMultiStatus {
+		t.Errorf("Expected status 207, got %d", code)
+	}
+	if body["successCount"] != float64(1) || body["failureCount"] != float64(1) {
+		t.Errorf("Expected 1 success and 1 failure, got %v/%v", body["successCount"], body["failureCount"])
+	}
+}
+
+func TestSync_NotConnected(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetConnected(false)
+	handler := newTestProvidersHandler(t, mockProvider)
+
+	code, body := syncAndDecode(t, handler)
+
+	if code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", code)
+	}
+	if body["code"] != models.ErrorCodeReauthRequired {
+		t.Errorf("Expected code %s, got %v", models.ErrorCodeReauthRequired, body["code"])
+	}
+}
+
+func TestSync_TimesOut(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	mockProvider.SetContentReader("f2", pr)
+
+	dir := t.TempDir()
+	svc := service.NewSyncableSafesService(context.Background(), dir, mockProvider)
+	t.Cleanup(svc.Stop)
+	svc.SaveFiles([]service.SelectedFile{
+		{ID: "f1", Name: "fast.psafe3", Path: "/", Selected: true},
+		{ID: "f2", Name: "slow.psafe3", Path: "/", Selected: true},
+	})
+	handler := NewProvidersHandler(map[string]*service.SyncableSafesService{"mock": svc})
+	handler.SetSyncTimeout(50 * time.Millisecond)
+
+	code, body := syncAndDecode(t, handler)
+
+	if code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status 504, got %d", code)
+	}
+	if body["code"] != models.ErrorCodeSyncTimeout {
+		t.Errorf("Expected code %s, got %v", models.ErrorCodeSyncTimeout, body["code"])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mock", "fast.psafe3")); err != nil {
+		t.Errorf("Expected the file downloaded before the timeout to be kept: %v", err)
+	}
+}
+
+func TestListProviders_ConnectedFilter(t *testing.T) {
+	connected := mock.NewProvider("connected")
+	disconnected := mock.NewProvider("disconnected")
+	disconnected.SetConnected(false)
+
+	services := make(map[string]*service.SyncableSafesService)
+	for _, p := range []*mock.Provider{connected, disconnected} {
+		svc := service.NewSyncableSafesService(context.Background(), t.TempDir(), p)
+		t.Cleanup(svc.Stop)
+		services[p.ID()] = svc
+	}
+	handler := NewProvidersHandler(services)
+
+	tests := []struct {
+		url      string
+		expected int
+	}{
+		{"/api/providers", 2},
+		{"/api/providers?connected=true", 1},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		w := httptest.NewRecorder()
+
+		handler.ListProviders(w, req)
+
+		var resp struct {
+			Providers []ProviderInfo `json:"providers"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(resp.Providers) != tt.expected {
+			t.Errorf("%s: expected %d providers, got %d", tt.url, tt.expected, len(resp.Providers))
+		}
+		if tt.expected == 1 && len(resp.Providers) == 1 && resp.Providers[0].ID != "connected" {
+			t.Errorf("Expected only 'connected' provider, got '%s'", resp.Providers[0].ID)
+		}
+	}
+}
+
+func TestSync_ConflictWhileInProgress(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	pr, pw := io.Pipe()
+	mockProvider.SetContentReader("f1", pr)
+
+	svc := service.NewSyncableSafesService(context.Background(), t.TempDir(), mockProvider)
+	t.Cleanup(svc.Stop)
+	svc.SaveFiles([]service.SelectedFile{{ID: "f1", Name: "slow.psafe3", Path: "/", Selected: true}})
+	handler := NewProvidersHandler(map[string]*service.SyncableSafesService{"mock": svc})
+
+	// Start a sync that blocks on the download until the pipe is written
+	done := make(chan struct{})
+	go func() {
+		svc.Sync(context.Background())
+		close(done)
+	}()
+	for svc.SyncStartedAt().IsZero() {
+		time.Sleep(time.Millisecond)
+	}
+
+	code, body := syncAndDecode(t, handler)
+
+	if code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", code)
+	}
+	if body["code"] != models.ErrorCodeSyncInProgress || body["syncInProgress"] != true {
+		t.Errorf("Expected in-progress body, got %v", body)
+	}
+	if _, ok := body["syncStartedAt"]; !ok {
+		t.Error("Expected syncStartedAt in response")
+	}
+
+	pw.Write([]byte("content"))
+	pw.Close()
+	<-done
+}
+
+func TestListFiles_GroupByFolder(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetFiles([]provider.RemoteFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/work"},
+		{ID: "f2", Name: "b.psafe3", Path: "/"},
+	})
+	handler := newTestProvidersHandler(t, mockProvider)
+
+	for _, tt := range []struct {
+		query       string
+		wantFolders bool
+	}{
+		{"", false},
+		{"?groupBy=folder", true},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/providers/mock/files"+tt.query, nil)
+		w := httptest.NewRecorder()
+		handler.Route(w, req)
+
+		var body struct {
+			Files    []service.SelectedFile `json:"files"`
+			ByFolder []service.FileFolder   `json:"byFolder"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if len(body.Files) != 2 {
+			t.Errorf("%q: expected 2 files, got %d", tt.query, len(body.Files))
+		}
+		if (body.ByFolder != nil) != tt.wantFolders {
+			t.Errorf("%q: expected byFolder present=%v, got %+v", tt.query, tt.wantFolders, body.ByFolder)
+		}
+		if tt.wantFolders && (len(body.ByFolder) != 2 || body.ByFolder[0].Path != "/") {
+			t.Errorf("Expected folders / then /work, got %+v", body.ByFolder)
+		}
+	}
+}
+
+func TestSelectedFiles_WorksWhileOffline(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.ListError = io.ErrUnexpectedEOF
+	mockProvider.SetConnected(false)
+	handler := newTestProvidersHandler(t, mockProvider)
+	handler.services["mock"].SaveFiles([]service.SelectedFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true},
+		{ID: "f2", Name: "b.psafe3", Path: "/", Selected: false},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/providers/mock/files/selected", nil)
+	w := httptest.NewRecorder()
+	handler.Route(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var body struct {
+		Files []service.SelectedFile `json:"files"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Files) != 1 || body.Files[0].ID != "f1" {
+		t.Errorf("Expected only the selected file f1, got %+v", body.Files)
+	}
+}
+
+func TestSaveSettings_SwapsInConfiguredService(t *testing.T) {
+	handler := NewProvidersHandler(map[string]*service.SyncableSafesService{})
+
+	var gotSettings string
+	handler.SetConfigurer(func(providerID string, settingsJSON []byte, stopPrevious func()) (*service.SyncableSafesService, error) {
+		gotSettings = string(settingsJSON)
+		stopPrevious() // No previous service: a no-op
+		svc := service.NewSyncableSafesService(context.Background(), t.TempDir(), mock.NewProvider(providerID))
+		t.Cleanup(svc.Stop)
+		return svc, nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/providers/mock/settings", strings.NewReader(`{"clientId": "abc"}`))
+	w := httptest.NewRecorder()
+	handler.Route(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if gotSettings != `{"clientId": "abc"}` {
+		t.Errorf("Expected settings to be passed through, got %s", gotSettings)
+	}
+
+	// The new provider is now routable
+	w = httptest.NewRecorder()
+	handler.Route(w, httptest.NewRequest(http.MethodGet, "/api/providers/mock/status", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected configured provider to serve status, got %d", w.Code)
+	}
+}
+
+func TestSaveSettings_StopsPreviousServiceFirst(t *testing.T) {
+	previous := service.NewSyncableSafesService(context.Background(), t.TempDir(), mock.NewProvider("mock"))
+	handler := NewProvidersHandler(map[string]*service.SyncableSafesService{"mock": previous})
+	t.Cleanup(handler.StopServices)
+	stopped := func() bool {
+		_, err := previous.Sync(context.Background())
+		return err != nil && strings.Contains(err.Error(), "stopped")
+	}
+
+	reject := true
+	handler.SetConfigurer(func(providerID string, settingsJSON []byte, stopPrevious func()) (*service.SyncableSafesService, error) {
+		if reject {
+			return nil, fmt.Errorf("invalid settings: clientId is required in settings.json")
+		}
+		if stopped() {
+			t.Error("Expected the previous service to run until the settings are accepted")
+		}
+		stopPrevious()
+		if !stopped() {
+			t.Error("Expected the previous service to be stopped before the new one starts")
+		}
+		return service.NewSyncableSafesService(context.Background(), t.TempDir(), mock.NewProvider(providerID)), nil
+	})
+
+	save := func() int {
+		w := httptest.NewRecorder()
+		handler.Route(w, httptest.NewRequest(http.MethodPost, "/api/providers/mock/settings", strings.NewReader(`{}`)))
+		return w.Code
+	}
+
+	if code := save(); code != http.StatusBadRequest {
+		t.Fatalf("Expected rejected settings to return 400, got %d", code)
+	}
+	if stopped() || handler.services["mock"] != previous {
+		t.Error("Expected rejected settings to leave the previous service running")
+	}
+
+	reject = false
+	if code := save(); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if handler.services["mock"] == previous {
+		t.Error("Expected the new service to be swapped in")
+	}
+}
+
+func TestSaveSettings_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		configure  ProviderConfigurer
+		body       string
+		wantStatus int
+	}{
+		{"disabled", nil, `{}`, http.StatusNotFound},
+		{"not an object", func(string, []byte, func()) (*service.SyncableSafesService, error) {
+			t.Error("configurer should not be called")
+			return nil, nil
+		}, `"x"`, http.StatusBadRequest},
+		{"invalid settings", func(string, []byte, func()) (*service.SyncableSafesService, error) {
+			return nil, fmt.Errorf("invalid settings: clientId is required in settings.json")
+		}, `{}`, http.StatusBadRequest},
+		{"unknown type", func(string, []byte, func()) (*service.SyncableSafesService, error) {
+			return nil, fmt.Errorf("unknown provider type: mock")
+		}, `{}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewProvidersHandler(map[string]*service.SyncableSafesService{})
+			if tt.configure != nil {
+				handler.SetConfigurer(tt.configure)
+			}
+
+			w := httptest.NewRecorder()
+			handler.Route(w, httptest.NewRequest(http.MethodPost, "/api/providers/mock/settings", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleCallback_RedirectsToAddPage(t *testing.T) {
+	handler := newTestProvidersHandler(t, mock.NewProvider("mock"))
+
+	w := httptest.NewRecorder()
+	handler.Route(w, httptest.NewRequest(http.MethodGet, "/api/providers/mock/auth/callback?code=abc", nil))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status 302, got %d", w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "/web/add/mock" {
+		t.Errorf("Expected redirect to /web/add/mock, got %s", location)
+	}
+}
+
+func TestCallbackRedirect_RejectsUnsafeProviderIDs(t *testing.T) {
+	tests := []struct {
+		providerID string
+		errorCode  string
+		want       string
+	}{
+		{"onedrive", "", "/web/add/onedrive"},
+		{"onedrive", "auth_failed", "/web/add/onedrive?error=auth_failed"},
+		{"/evil.example", "", "/web/"},
+		{"a\r\nSet-Cookie: x=1", "", "/web/"},
+		{"../admin", "", "/web/"},
+		{"", "", "/web/"},
+	}
+	for _, tt := range tests {
+		if got := callbackRedirect(tt.providerID, tt.errorCode); got != tt.want {
+			t.Errorf("callbackRedirect(%q, %q) = %q, want %q", tt.providerID, tt.errorCode, got, tt.want)
+		}
+	}
+}
+
+func TestSyncAll_ReportsEachProvider(t *testing.T) {
+	newService := func(p *mock.Provider) *service.SyncableSafesService {
+		svc := service.NewSyncableSafesService(context.Background(), t.TempDir(), p)
+		t.Cleanup(svc.Stop)
+		return svc
+	}
+
+	ready := mock.NewProvider("ready")
+	ready.SetContent("f1", []byte("content"))
+	readySvc := newService(ready)
+	readySvc.SaveFiles([]service.SelectedFile{{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true}})
+
+	offline := mock.NewProvider("offline")
+	offline.SetConnected(false)
+
+	busy := mock.NewProvider("busy")
+	pr, pw := io.Pipe()
+	busy.SetContentReader("f1", pr)
+	busySvc := newService(busy)
+	busySvc.SaveFiles([]service.SelectedFile{{ID: "f1", Name: "slow.psafe3", Path: "/", Selected: true}})
+
+	handler := NewProvidersHandler(map[string]*service.SyncableSafesService{
+		"ready":   readySvc,
+		"offline": newService(offline),
+		"busy":    busySvc,
+	})
+
+	done := make(chan struct{})
+	go func() {
+		busySvc.Sync(context.Background())
+		close(done)
+	}()
+	for busySvc.SyncStartedAt().IsZero() {
+		time.Sleep(time.Millisecond)
+	}
+
+	w := httptest.NewRecorder()
+	handler.Route(w, httptest.NewRequest(http.MethodPost, "/api/providers/sync-all", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Providers []ProviderSyncSummary `json:"providers"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	want := map[string]string{"busy": "skipped", "offline": "skipped", "ready": "synced"}
+	if len(resp.Providers) != len(want) {
+		t.Fatalf("Expected %d providers, got %+v", len(want), resp.Providers)
+	}
+	for _, summary := range resp.Providers {
+		if summary.Status != want[summary.ProviderID] {
+			t.Errorf("%s: expected %s, got %+v", summary.ProviderID, want[summary.ProviderID], summary)
+		}
+	}
+	if resp.Providers[0].ProviderID != "busy" || resp.Providers[0].Code != models.ErrorCodeSyncInProgress {
+		t.Errorf("Expected busy first with in-progress code, got %+v", resp.Providers[0])
+	}
+
+	pw.Write([]byte("content"))
+	pw.Close()
+	<-done
+}
+
+func TestGetQuota(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetQuota(250, 1000)
+	handler := newTestProvidersHandler(t, mockProvider)
+
+	w := httptest.NewRecorder()
+	handler.Route(w, httptest.NewRequest(http.MethodGet, "/api/providers/mock/quota", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var quota provider.Quota
+	if err := json.NewDecoder(w.Body).Decode(&quota); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if quota.Used != 250 || quota.Total != 1000 || quota.Remaining != 750 {
+		t.Errorf("Unexpected quota: %+v", quota)
+	}
+}
+
+func TestGetQuota_NotSupported(t *testing.T) {
+	// Embedding only the interface hides the mock's Quota method
+	p := struct{ provider.SyncableSafesProvider }{mock.NewProvider("plain")}
+	svc := service.NewSyncableSafesService(context.Background(), t.TempDir(), p)
+	t.Cleanup(svc.Stop)
+	handler := NewProvidersHandler(map[string]*service.SyncableSafesService{"plain": svc})
+
+	w := httptest.NewRecorder()
+	handler.Route(w, httptest.NewRequest(http.MethodGet, "/api/providers/plain/quota", nil))
+
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("Expected status 501, got %d", w.Code)
+	}
+	var resp models.ErrorResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Code != models.ErrorCodeNotSupported {
+		t.Errorf("Expected code %s, got %s", models.ErrorCodeNotSupported, resp.Code)
+	}
+}
+
+func TestListCapabilities(t *testing.T) {
+	full := mock.NewProvider("full")
+	limited := mock.NewProvider("limited")
+	noUpload := mock.NewProvider("noupload")
+	noUpload.UploadDisabled = true
+	handler := NewProvidersHandler(map[string]*service.SyncableSafesService{
+		"full":     service.NewSyncableSafesService(context.Background(), t.TempDir(), full),
+		"noupload": service.NewSyncableSafesService(context.Background(), t.TempDir(), noUpload),
+		"limited": service.NewSyncableSafesService(context.Background(), t.TempDir(),
+			struct{ provider.SyncableSafesProvider }{limited}, service.WithReadOnly()),
+	})
+	t.Cleanup(handler.StopServices)
+
+	w := httptest.NewRecorder()
+	handler.ListCapabilities(w, httptest.NewRequest(http.MethodGet, "/api/debug/capabilities", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Providers []service.ProviderCapabilities `json:"providers"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := []service.ProviderCapabilities{
+		{ID: "full", DisplayName: full.DisplayName(), ConditionalDownload: true, Quota: true, Browse: true, DeviceAuth: true, Upload: true},
+		{ID: "limited", DisplayName: limited.DisplayName(), ReadOnly: true},
+		{ID: "noupload", DisplayName: noUpload.DisplayName(), ConditionalDownload: true, Quota: true, Browse: true, DeviceAuth: true},
+	}
+	if !reflect.DeepEqual(body.Providers, want) {
+		t.Errorf("Expected %+v, got %+v", want, body.Providers)
+	}
+}
+
+func TestPushFile_RemoteChanged(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+	mockProvider.SetETag("f1", `"v1"`)
+	handler := newTestProvidersHandler(t, mockProvider)
+	svc := handler.services["mock"]
+	svc.SaveFiles([]service.SelectedFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true},
+	})
+	if _, err := svc.Sync(context.Background()); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	mockProvider.SetETag("f1", `"v2"`)
+
+	w := httptest.NewRecorder()
+	handler.Route(w, httptest.NewRequest(http.MethodPost, "/api/providers/mock/files/push", strings.NewReader(`{"fileId":"f1"}`)))
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var resp models.ErrorResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Code != models.ErrorCodeConflict {
+		t.Errorf("Expected code %s, got %s", models.ErrorCodeConflict, resp.Code)
+	}
+	if len(mockProvider.UploadedFiles) != 0 {
+		t.Errorf("Expected nothing to be uploaded, got %v", mockProvider.UploadedFiles)
+	}
+}
+
+func TestBrowseFolder(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetFiles([]provider.RemoteFile{
+		{ID: "f1", Name: "work.psafe3", Path: "/Documents"},
+		{ID: "f2", Name: "old.psafe3", Path: "/Documents/Archive"},
+		{ID: "f3", Name: "home.psafe3", Path: "/Documents/Personal"},
+		{ID: "f4", Name: "notes.txt", Path: "/Documents"},
+	})
+	svc := service.NewSyncableSafesService(context.Background(), t.TempDir(), mockProvider,
+		service.WithExcludePatterns(provider.ExcludePatterns{"/Documents/Archive"}))
+	t.Cleanup(svc.Stop)
+	svc.SaveFiles([]service.SelectedFile{{ID: "f1", Name: "work.psafe3", Path: "/Documents", Selected: true}})
+	handler := NewProvidersHandler(map[string]*service.SyncableSafesService{"mock": svc})
+
+	tests := []struct {
+		path     string
+		wantCode int
+	}{
+		{"/Documents", http.StatusOK},
+		{"/Documents/Archive", http.StatusNotFound},
+		{"/Missing", http.StatusNotFound},
+		{"Documents", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.Route(w, httptest.NewRequest(http.MethodGet, "/api/providers/mock/browse?path="+url.QueryEscape(tt.path), nil))
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: expected status %d, got %d. Body: %s", tt.path, tt.wantCode, w.Code, w.Body.String())
+			continue
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+
+		var contents service.FolderContents
+		if err := json.NewDecoder(w.Body).Decode(&contents); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if !reflect.DeepEqual(contents.Folders, []string{"Personal"}) {
+			t.Errorf("Expected only the non-excluded subfolder, got %v", contents.Folders)
+		}
+		want := []service.SelectedFile{{ID: "f1", Name: "work.psafe3", Path: "/Documents", Selected: true}}
+		if !reflect.DeepEqual(contents.Files, want) {
+			t.Errorf("Expected %+v, got %+v", want, contents.Files)
+		}
+	}
+}
+
+func TestBrowseFolder_NotSupported(t *testing.T) {
+	plain := struct{ provider.SyncableSafesProvider }{mock.NewProvider("plain")}
+	svc := service.NewSyncableSafesService(context.Background(), t.TempDir(), plain)
+	t.Cleanup(svc.Stop)
+	handler := NewProvidersHandler(map[string]*service.SyncableSafesService{"plain": svc})
+
+	w := httptest.NewRecorder()
+	handler.Route(w, httptest.NewRequest(http.MethodGet, "/api/providers/plain/browse", nil))
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501, got %d", w.Code)
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	handler := newTestProvidersHandler(t, mockProvider)
+
+	handler.Route(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/providers/mock/sync", nil))
+
+	w := httptest.NewRecorder()
+	handler.Route(w, httptest.NewRequest(http.MethodGet, "/api/providers/mock/history", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		History []service.SyncLogEntry `json:"history"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.History) != 1 || body.History[0].ProviderID != "mock" {
+		t.Errorf("Expected one sync in history, got %+v", body.History)
+	}
+}
+
+func TestStartDeviceAuth(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	handler := newTestProvidersHandler(t, mockProvider)
+
+	w := httptest.NewRecorder()
+	handler.Route(w, httptest.NewRequest(http.MethodPost, "/api/providers/mock/auth/device", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body["userCode"] != "MOCK-CODE" || body["verificationUri"] == nil {
+		t.Errorf("Expected user code and verification URI, got %v", body)
+	}
+	if _, ok := body["deviceCode"]; ok {
+		t.Error("Expected the device code secret to stay server-side")
+	}
+
+	// Providers without the device flow report it as unsupported
+	p := struct{ provider.SyncableSafesProvider }{mock.NewProvider("plain")}
+	svc := service.NewSyncableSafesService(context.Background(), t.TempDir(), p)
+	t.Cleanup(svc.Stop)
+	plain := NewProvidersHandler(map[string]*service.SyncableSafesService{"plain": svc})
+
+	w = httptest.NewRecorder()
+	plain.Route(w, httptest.NewRequest(http.MethodPost, "/api/providers/plain/auth/device", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected status 501, got %d", w.Code)
+	}
+}
+
+func TestSignIn_ReadOnly(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetConnected(false)
+	svc := service.NewSyncableSafesService(context.Background(), t.TempDir(), mockProvider, service.WithReadOnly())
+	t.Cleanup(svc.Stop)
+	handler := NewProvidersHandler(map[string]*service.SyncableSafesService{"mock": svc})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/api/providers/mock/auth/device", nil),
+		httptest.NewRequest(http.MethodGet, "/api/providers/mock/auth/callback?code=abc", nil),
+	} {
+		w := httptest.NewRecorder()
+		handler.Route(w, req)
+		if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), models.ErrorCodeReadOnly) {
+			t.Errorf("%s: expected 409 %s, got %d. Body: %s", req.URL.Path, models.ErrorCodeReadOnly, w.Code, w.Body.String())
+		}
+	}
+	if status, _ := mockProvider.GetConnectionStatus(context.Background(), false); status.Connected {
+		t.Error("Expected the read-only callback not to sign in")
+	}
+}
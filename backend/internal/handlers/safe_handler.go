@@ -2,15 +2,22 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/rolledback/pwsafe-service/backend/internal/models"
 	"github.com/rolledback/pwsafe-service/backend/internal/service"
 )
 
+// listSafesCacheControl lets the browser reuse a listing briefly while the UI
+// polls, without shared proxies keeping a copy of the safe names
+const listSafesCacheControl = "private, max-age=5"
+
 type SafeHandler struct {
 	safeService *service.SafeService
 }
@@ -29,17 +36,32 @@ func (h *SafeHandler) ListSafes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	safes, err := h.safeService.ListSafes()
+	var safes []models.SafeFile
+	var err error
+	query := r.URL.Query()
+	if dedupe := query.Get("dedupe") == "true"; dedupe || query.Get("merged") == "true" {
+		safes, err = h.safeService.ListSafesMerged(dedupe)
+	} else {
+		safes, err = h.safeService.ListSafes()
+	}
 	if err != nil {
 		log.Printf("Error listing safes: %v", err)
 		h.respondError(w, "Failed to list safes", http.StatusInternalServerError)
 		return
 	}
+	if query.Get("verify") == "true" {
+		h.safeService.VerifySafeFiles(safes)
+	}
 
+	// The UI polls this; a short shared cache absorbs bursts while uploads and
+	// syncs still show up within seconds
+	w.Header().Set("Cache-Control", listSafesCacheControl)
+	w.Header().Add("Vary", "Accept-Encoding")
 	h.respondJSON(w, safes, http.StatusOK)
 }
 
 func (h *SafeHandler) UnlockSafe(w http.ResponseWriter, r *http.Request) {
+	noStore(w)
 	if r.Method != http.MethodPost {
 		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -53,6 +75,192 @@ func (h *SafeHandler) UnlockSafe(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("POST /api/safes/%s/unlock", safePath)
 
+	var req models.UnlockRequest
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		h.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	password, ok := h.resolvePassword(w, safePath, req.Password, req.Keyfile, req.Session)
+	if !ok {
+		return
+	}
+	if password == "" {
+		h.respondError(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	fields, err := parseEntryFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		h.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := service.UnlockOptions{
+		IncludeExtra: r.URL.Query().Get("includeExtra") == "true",
+	}
+
+	structure, err := h.safeService.UnlockSafeWithOptions(safePath, password, opts)
+	if err != nil {
+		log.Printf("Error unlocking safe %s: %v", safePath, err)
+		if strings.Contains(err.Error(), "not found") {
+			h.respondErrorCode(w, "Safe file not found", models.ErrorCodeSafeNotFound, http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
+			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "safe too large") {
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeSafeTooLarge, http.StatusUnprocessableEntity)
+		} else if strings.Contains(err.Error(), "unsupported format") {
+			h.respondErrorCode(w, "Unsupported or not a Password Safe v3 file", models.ErrorCodeUnsupportedSafe, http.StatusUnprocessableEntity)
+		} else {
+			h.respondError(w, "Failed to unlock safe - invalid password or corrupted file", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	if req.CreateSession && h.safeService.SessionsEnabled() {
+		token, expiresAt, err := h.safeService.CreateSession(safePath, password)
+		if err != nil {
+			// The unlock itself succeeded; the client falls back to sending the password
+			log.Printf("Error creating session for %s: %v", safePath, err)
+		} else {
+			w.Header().Set("X-Session-Token", token)
+			w.Header().Set("X-Session-Expires", expiresAt.UTC().Format(time.RFC3339))
+		}
+	}
+
+	if fields != nil {
+		h.respondJSON(w, filterEntryFields(structure, fields), http.StatusOK)
+		return
+	}
+
+	h.respondJSON(w, structure, http.StatusOK)
+}
+
+// GetChanges returns the entries modified after ?since=, so a client that has
+// already loaded the safe can refresh just what changed. Passwords are never
+// included.
+func (h *SafeHandler) GetChanges(w http.ResponseWriter, r *http.Request) {
+	noStore(w)
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	safePath := extractSafePath(r.URL.Path, "/api/safes/", "/changes")
+	if safePath == "" {
+		h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("POST /api/safes/%s/changes", safePath)
+
+	since, err := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	if err != nil {
+		h.respondError(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UnlockRequest
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		h.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	password, ok := h.resolvePassword(w, safePath, req.Password, req.Keyfile, req.Session)
+	if !ok {
+		return
+	}
+	if password == "" {
+		h.respondError(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	changes, err := h.safeService.GetChanges(safePath, password, since)
+	if err != nil {
+		log.Printf("Error getting changes for safe %s: %v", safePath, err)
+		if strings.Contains(err.Error(), "not found") {
+			h.respondErrorCode(w, "Safe file not found", models.ErrorCodeSafeNotFound, http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
+			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "safe too large") {
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeSafeTooLarge, http.StatusUnprocessableEntity)
+		} else if strings.Contains(err.Error(), "unsupported format") {
+			h.respondErrorCode(w, "Unsupported or not a Password Safe v3 file", models.ErrorCodeUnsupportedSafe, http.StatusUnprocessableEntity)
+		} else {
+			h.respondError(w, "Failed to unlock safe - invalid password or corrupted file", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	h.respondJSON(w, changes, http.StatusOK)
+}
+
+// GetSafeInfo returns a safe's record count and last-save details, for
+// listing safes without loading their whole tree
+func (h *SafeHandler) GetSafeInfo(w http.ResponseWriter, r *http.Request) {
+	noStore(w)
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	safePath := extractSafePath(r.URL.Path, "/api/safes/", "/info")
+	if safePath == "" {
+		h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("POST /api/safes/%s/info", safePath)
+
+	var req models.UnlockRequest
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		h.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	password, ok := h.resolvePassword(w, safePath, req.Password, req.Keyfile, req.Session)
+	if !ok {
+		return
+	}
+	if password == "" {
+		h.respondError(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	info, err := h.safeService.GetSafeInfo(safePath, password)
+	if err != nil {
+		log.Printf("Error getting info for safe %s: %v", safePath, err)
+		if strings.Contains(err.Error(), "not found") {
+			h.respondErrorCode(w, "Safe file not found", models.ErrorCodeSafeNotFound, http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
+			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "unsupported format") {
+			h.respondErrorCode(w, "Unsupported or not a Password Safe v3 file", models.ErrorCodeUnsupportedSafe, http.StatusUnprocessableEntity)
+		} else {
+			h.respondError(w, "Failed to unlock safe - invalid password or corrupted file", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	h.respondJSON(w, info, http.StatusOK)
+}
+
+// VerifySafe confirms a master password is correct. Success and wrong-password
+// responses have empty bodies so nothing about the safe is exposed.
+func (h *SafeHandler) VerifySafe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	safePath := extractSafePath(r.URL.Path, "/api/safes/", "/verify")
+	if safePath == "" {
+		h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("POST /api/safes/%s/verify", safePath)
+
 	var req models.UnlockRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.respondError(w, "Invalid request body", http.StatusBadRequest)
@@ -64,11 +272,54 @@ func (h *SafeHandler) UnlockSafe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	structure, err := h.safeService.UnlockSafe(safePath, req.Password)
+	if err := h.safeService.VerifyPassword(safePath, req.Password); err != nil {
+		log.Printf("Error verifying safe %s: %v", safePath, err)
+		if strings.Contains(err.Error(), "not found") {
+			h.respondErrorCode(w, "Safe file not found", models.ErrorCodeSafeNotFound, http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
+			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// DiagnoseSafe returns record/tree counts for support debugging. Only routed when
+// diagnostics are enabled in config.
+func (h *SafeHandler) DiagnoseSafe(w http.ResponseWriter, r *http.Request) {
+	noStore(w)
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	safePath := extractSafePath(r.URL.Path, "/api/safes/", "/diagnose")
+	if safePath == "" {
+		h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("POST /api/safes/%s/diagnose", safePath)
+
+	var req models.UnlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Password == "" {
+		h.respondError(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	diag, err := h.safeService.DiagnoseSafe(safePath, req.Password)
 	if err != nil {
-		log.Printf("Error unlocking safe %s: %v", safePath, err)
+		log.Printf("Error diagnosing safe %s: %v", safePath, err)
 		if strings.Contains(err.Error(), "not found") {
-			h.respondError(w, "Safe file not found", http.StatusNotFound)
+			h.respondErrorCode(w, "Safe file not found", models.ErrorCodeSafeNotFound, http.StatusNotFound)
 		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
 			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
 		} else {
@@ -77,10 +328,68 @@ func (h *SafeHandler) UnlockSafe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.respondJSON(w, diag, http.StatusOK)
+}
+
+// ExportSafe returns the whole safe, passwords included, as a JSON backup.
+// Only routed when export is enabled in config.
+func (h *SafeHandler) ExportSafe(w http.ResponseWriter, r *http.Request) {
+	noStore(w)
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	safePath := extractSafePath(r.URL.Path, "/api/safes/", "/export")
+	if safePath == "" {
+		h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("POST /api/safes/%s/export", safePath)
+
+	if format := r.URL.Query().Get("format"); format != "" && format != "json" {
+		h.respondError(w, "Unsupported export format", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UnlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Password == "" {
+		h.respondError(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	structure, err := h.safeService.ExportSafe(safePath, req.Password)
+	if err != nil {
+		log.Printf("Error exporting safe %s: %v", safePath, err)
+		if strings.Contains(err.Error(), "not found") {
+			h.respondErrorCode(w, "Safe file not found", models.ErrorCodeSafeNotFound, http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
+			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "safe too large") {
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeSafeTooLarge, http.StatusUnprocessableEntity)
+		} else if strings.Contains(err.Error(), "unsupported format") {
+			h.respondErrorCode(w, "Unsupported or not a Password Safe v3 file", models.ErrorCodeUnsupportedSafe, http.StatusUnprocessableEntity)
+		} else {
+			h.respondError(w, "Failed to unlock safe - invalid password or corrupted file", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	// The body holds every password in plain text - let clients warn before saving it
+	name := strings.TrimSuffix(filepath.Base(safePath), filepath.Ext(safePath))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".json"))
+	w.Header().Set("X-Contains-Secrets", "true")
 	h.respondJSON(w, structure, http.StatusOK)
 }
 
 func (h *SafeHandler) GetEntryPassword(w http.ResponseWriter, r *http.Request) {
+	noStore(w)
 	if r.Method != http.MethodPost {
 		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -95,21 +404,25 @@ func (h *SafeHandler) GetEntryPassword(w http.ResponseWriter, r *http.Request) {
 	log.Printf("POST /api/safes/%s/entry", safePath)
 
 	var req models.EntryPasswordRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.respondError(w, "Invalid request body", http.StatusBadRequest)
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		h.respondError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if req.Password == "" || req.EntryUUID == "" {
+	masterPassword, ok := h.resolvePassword(w, safePath, req.Password, req.Keyfile, req.Session)
+	if !ok {
+		return
+	}
+	if masterPassword == "" || req.EntryUUID == "" {
 		h.respondError(w, "Password and entryUuid are required", http.StatusBadRequest)
 		return
 	}
 
-	password, err := h.safeService.GetEntryPassword(safePath, req.Password, req.EntryUUID)
+	password, err := h.safeService.GetEntryPassword(safePath, masterPassword, req.EntryUUID)
 	if err != nil {
 		log.Printf("Error getting entry password for %s in %s: %v", req.EntryUUID, safePath, err)
 		if strings.Contains(err.Error(), "not found") {
-			h.respondError(w, err.Error(), http.StatusNotFound)
+			h.respondErrorCode(w, err.Error(), notFoundCode(err), http.StatusNotFound)
 		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
 			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
 		} else {
@@ -124,6 +437,244 @@ func (h *SafeHandler) GetEntryPassword(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, response, http.StatusOK)
 }
 
+// GetEntryPasswordStrength rates one entry's password. The password itself is
+// never included in the response.
+func (h *SafeHandler) GetEntryPasswordStrength(w http.ResponseWriter, r *http.Request) {
+	noStore(w)
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	safePath := extractSafePath(r.URL.Path, "/api/safes/", "/entry/strength")
+	if safePath == "" {
+		h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("POST /api/safes/%s/entry/strength", safePath)
+
+	var req models.EntryPasswordRequest
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		h.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	masterPassword, ok := h.resolvePassword(w, safePath, req.Password, req.Keyfile, req.Session)
+	if !ok {
+		return
+	}
+	if masterPassword == "" || req.EntryUUID == "" {
+		h.respondError(w, "Password and entryUuid are required", http.StatusBadRequest)
+		return
+	}
+
+	strength, err := h.safeService.GetEntryPasswordStrength(safePath, masterPassword, req.EntryUUID)
+	if err != nil {
+		log.Printf("Error rating entry password for %s in %s: %v", req.EntryUUID, safePath, err)
+		if strings.Contains(err.Error(), "not found") {
+			h.respondErrorCode(w, err.Error(), notFoundCode(err), http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
+			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		} else {
+			h.respondError(w, "Failed to get entry password", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	h.respondJSON(w, strength, http.StatusOK)
+}
+
+// GetEntryTOTP returns the current TOTP code for an entry that stores a
+// secret. The secret itself is never included in the response.
+func (h *SafeHandler) GetEntryTOTP(w http.ResponseWriter, r *http.Request) {
+	noStore(w)
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	safePath := extractSafePath(r.URL.Path, "/api/safes/", "/entry/totp")
+	if safePath == "" {
+		h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("POST /api/safes/%s/entry/totp", safePath)
+
+	var req models.EntryPasswordRequest
+	if err := decodeJSONBody(r.Body, &req); err != nil {
+		h.respondError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	masterPassword, ok := h.resolvePassword(w, safePath, req.Password, req.Keyfile, req.Session)
+	if !ok {
+		return
+	}
+	if masterPassword == "" || req.EntryUUID == "" {
+		h.respondError(w, "Password and entryUuid are required", http.StatusBadRequest)
+		return
+	}
+
+	code, err := h.safeService.GetEntryTOTP(safePath, masterPassword, req.EntryUUID)
+	if err != nil {
+		log.Printf("Error generating TOTP code for %s in %s: %v", req.EntryUUID, safePath, err)
+		if strings.Contains(err.Error(), "not found") {
+			h.respondErrorCode(w, err.Error(), notFoundCode(err), http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "no TOTP secret") {
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeNoTOTP, http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
+			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		} else {
+			h.respondError(w, "Failed to get entry TOTP code", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	h.respondJSON(w, code, http.StatusOK)
+}
+
+func (h *SafeHandler) MoveEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	safePath, entryUUID := extractEntryPath(r.URL.Path, "/move")
+	if safePath == "" || entryUUID == "" {
+		h.respondError(w, "Invalid entry path", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("POST /api/safes/%s/entries/%s/move", safePath, entryUUID)
+
+	var req models.MoveEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Password == "" {
+		h.respondError(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	structure, err := h.safeService.MoveEntry(safePath, req.Password, entryUUID, req.Group)
+	if err != nil {
+		log.Printf("Error moving entry %s in %s: %v", entryUUID, safePath, err)
+		if strings.Contains(err.Error(), "not found") {
+			h.respondErrorCode(w, err.Error(), notFoundCode(err), http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
+			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "safe too large") {
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeSafeTooLarge, http.StatusUnprocessableEntity)
+		} else if strings.Contains(err.Error(), "invalid group path") {
+			h.respondError(w, err.Error(), http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "read-only") {
+			h.respondError(w, "Safe is read-only", http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "failed to write safe") {
+			h.respondError(w, "Failed to save safe", http.StatusInternalServerError)
+		} else {
+			h.respondError(w, "Failed to move entry", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	h.respondJSON(w, structure, http.StatusOK)
+}
+
+// UpdateEntry edits fields of an existing entry in a writable safe
+func (h *SafeHandler) UpdateEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	safePath, entryUUID := extractEntryPath(r.URL.Path, "")
+	if safePath == "" || entryUUID == "" {
+		h.respondError(w, "Invalid entry path", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("POST /api/safes/%s/entries/%s", safePath, entryUUID)
+
+	var req models.UpdateEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Password == "" {
+		h.respondError(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	structure, err := h.safeService.UpdateEntry(safePath, req.Password, entryUUID, req.Fields)
+	if err != nil {
+		log.Printf("Error updating entry %s in %s: %v", entryUUID, safePath, err)
+		if strings.Contains(err.Error(), "not found") {
+			h.respondErrorCode(w, err.Error(), notFoundCode(err), http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
+			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "safe too large") {
+			h.respondErrorCode(w, err.Error(), models.ErrorCodeSafeTooLarge, http.StatusUnprocessableEntity)
+		} else if strings.Contains(err.Error(), "invalid entry") {
+			h.respondError(w, err.Error(), http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "already exists") {
+			h.respondError(w, err.Error(), http.StatusConflict)
+		} else if strings.Contains(err.Error(), "read-only") {
+			h.respondError(w, "Safe is read-only", http.StatusForbidden)
+		} else if strings.Contains(err.Error(), "failed to write safe") {
+			h.respondError(w, "Failed to save safe", http.StatusInternalServerError)
+		} else {
+			h.respondError(w, "Failed to update entry", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	h.respondJSON(w, structure, http.StatusOK)
+}
+
+// resolvePassword returns the master password from the request's password,
+// keyfile or session, writing an error response and returning false if the
+// keyfile or session can't be used
+func (h *SafeHandler) resolvePassword(w http.ResponseWriter, safePath, password, keyfile, session string) (string, bool) {
+	if session != "" {
+		if password != "" || keyfile != "" {
+			h.respondError(w, "session cannot be combined with password or keyfile", http.StatusBadRequest)
+			return "", false
+		}
+		resolved, err := h.safeService.SessionPassword(safePath, session)
+		if err != nil {
+			log.Printf("Rejected session for %s: %v", safePath, err)
+			if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
+				h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+			} else {
+				h.respondErrorCode(w, "Session expired or invalid - unlock the safe again", models.ErrorCodeSessionExpired, http.StatusUnauthorized)
+			}
+			return "", false
+		}
+		return resolved, true
+	}
+
+	resolved, err := h.safeService.ResolvePassword(safePath, password, keyfile)
+	if err != nil {
+		log.Printf("Error resolving keyfile %q: %v", keyfile, err)
+		if strings.Contains(err.Error(), "invalid keyfile") || strings.Contains(err.Error(), "keyfile not found") {
+			h.respondError(w, err.Error(), http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "not found") {
+			h.respondErrorCode(w, "Safe file not found", models.ErrorCodeSafeNotFound, http.StatusNotFound)
+		} else if strings.Contains(err.Error(), "directory traversal") || strings.Contains(err.Error(), "invalid safe path") {
+			h.respondError(w, "Invalid safe path", http.StatusBadRequest)
+		} else {
+			h.respondError(w, "Failed to read keyfile", http.StatusInternalServerError)
+		}
+		return "", false
+	}
+	return resolved, true
+}
+
 func (h *SafeHandler) respondJSON(w http.ResponseWriter, data interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -131,7 +682,26 @@ func (h *SafeHandler) respondJSON(w http.ResponseWriter, data interface{}, statu
 }
 
 func (h *SafeHandler) respondError(w http.ResponseWriter, message string, status int) {
-	h.respondJSON(w, models.ErrorResponse{Error: message}, status)
+	h.respondErrorCode(w, message, models.ErrorCodeForStatus(status), status)
+}
+
+func (h *SafeHandler) respondErrorCode(w http.ResponseWriter, message, code string, status int) {
+	h.respondJSON(w, models.ErrorResponse{Error: message, Code: code}, status)
+}
+
+// noStore keeps a response out of every cache. Set it before anything else so
+// error responses from endpoints handling decrypted data are covered too.
+func noStore(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+}
+
+// notFoundCode distinguishes a missing entry from a missing safe file
+func notFoundCode(err error) string {
+	if strings.Contains(err.Error(), "entry not found") {
+		return models.ErrorCodeEntryNotFound
+	}
+	return models.ErrorCodeSafeNotFound
 }
 
 // extractSafePath extracts and URL-decodes the safe path from the URL.
@@ -148,3 +718,45 @@ func extractSafePath(urlPath, prefix, suffix string) string {
 	
 	return decodedPath
 }
+
+// IsEntryRequest reports whether r addresses /api/safes/{path}/entries/{uuid}{suffix}.
+// It matches the escaped path and needs a single segment after the last
+// "/entries/", so a safe inside a folder named "entries" still routes to its
+// own endpoints.
+func IsEntryRequest(r *http.Request, suffix string) bool {
+	path := r.URL.EscapedPath()
+	if !strings.HasSuffix(path, suffix) {
+		return false
+	}
+	path = strings.TrimSuffix(path, suffix)
+
+	idx := strings.LastIndex(path, "/entries/")
+	if idx == -1 {
+		return false
+	}
+	entryUUID := path[idx+len("/entries/"):]
+	return entryUUID != "" && !strings.Contains(entryUUID, "/")
+}
+
+// extractEntryPath splits /api/safes/{path}/entries/{uuid}{suffix} into the
+// URL-decoded safe path and entry UUID
+func extractEntryPath(urlPath, suffix string) (string, string) {
+	path := strings.TrimPrefix(urlPath, "/api/safes/")
+	path = strings.TrimSuffix(path, suffix)
+
+	idx := strings.LastIndex(path, "/entries/")
+	if idx == -1 {
+		return "", ""
+	}
+
+	safePath, err := url.PathUnescape(path[:idx])
+	if err != nil {
+		return "", ""
+	}
+	entryUUID := path[idx+len("/entries/"):]
+	if strings.Contains(entryUUID, "/") {
+		return "", ""
+	}
+
+	return safePath, entryUUID
+}
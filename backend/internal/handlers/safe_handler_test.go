@@ -6,7 +6,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rolledback/pwsafe-service/backend/internal/models"
 	"github.com/rolledback/pwsafe-service/backend/internal/service"
@@ -45,6 +49,49 @@ func TestListSafes_Handler(t *testing.T) {
 	}
 }
 
+func TestListSafes_Verify(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata"))
+
+	w := httptest.NewRecorder()
+	handler.ListSafes(w, httptest.NewRequest(http.MethodGet, "/api/safes?verify=true", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var safes []models.SafeFile
+	if err := json.NewDecoder(w.Body).Decode(&safes); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	for _, safe := range safes {
+		if safe.Valid == nil || !*safe.Valid {
+			t.Errorf("Expected %s to be valid, got %v", safe.Name, safe.Valid)
+		}
+	}
+}
+
+func TestListSafes_Dedupe(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata"))
+
+	w := httptest.NewRecorder()
+	handler.ListSafes(w, httptest.NewRequest(http.MethodGet, "/api/safes?dedupe=true", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var safes []models.SafeFile
+	if err := json.NewDecoder(w.Body).Decode(&safes); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(safes) == 0 {
+		t.Fatal("Expected safes to be listed")
+	}
+	for _, safe := range safes {
+		if len(safe.Sources) == 0 || safe.Sources[0] != safe.Provider {
+			t.Errorf("Expected %s's sources to start with its provider, got %v", safe.Path, safe.Sources)
+		}
+	}
+}
+
 func TestListSafes_WrongMethod(t *testing.T) {
 	service := service.NewSafeService("../../testdata")
 	handler := NewSafeHandler(service)
@@ -231,6 +278,119 @@ func TestGetEntryPassword_WrongUUID(t *testing.T) {
 	if w.Code != http.StatusNotFound {
 		t.Errorf("Expected status 404, got %d", w.Code)
 	}
+
+	var response models.ErrorResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Code != models.ErrorCodeEntryNotFound {
+		t.Errorf("Expected code %s, got '%s'", models.ErrorCodeEntryNotFound, response.Code)
+	}
+}
+
+func TestGetEntryPasswordStrength_DoesNotReturnPassword(t *testing.T) {
+	service := service.NewSafeService("../../testdata")
+	handler := NewSafeHandler(service)
+
+	reqBody := models.EntryPasswordRequest{
+		Password:  "password",
+		EntryUUID: "c4dcfb52-b944-f141-af96-b746f184afe2",
+	}
+	body, _ := json.Marshal(reqBody)
+
+	encodedPath := url.PathEscape("/testdata/simple.psafe3")
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/entry/strength", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.GetEntryPasswordStrength(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), `"password"`) {
+		t.Errorf("Expected response to omit the password, got %s", w.Body.String())
+	}
+
+	var response models.PasswordStrength
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Length != models.LengthMedium {
+		t.Errorf("Expected length %q, got %q", models.LengthMedium, response.Length)
+	}
+	if response.Score > 1 {
+		t.Errorf("Expected a weak score for 'password', got %d", response.Score)
+	}
+}
+
+func TestUnlockSafe_OmitsTOTPSecret(t *testing.T) {
+	tmpDir := t.TempDir()
+	structure := &models.SafeStructure{Entries: []models.Entry{
+		{UUID: "11111111-1111-1111-1111-111111111111", Title: "with", Password: "p", Notes: "recovery codes in the drawer\nTOTP: JBSWY3DPEHPK3PXP\notpauth://totp/x?secret=KRSXG5CTMVRXEZLU"},
+	}}
+	if err := service.CreateSafeFromStructure(filepath.Join(tmpDir, "totp.psafe3"), "master", structure); err != nil {
+		t.Fatal(err)
+	}
+	svc := service.NewSafeService(tmpDir)
+	handler := NewSafeHandler(svc)
+	safePath := "/" + filepath.Base(tmpDir) + "/totp.psafe3"
+	encodedPath := url.PathEscape(safePath)
+
+	// Saving the stripped notes back, as a client would, keeps the secret and
+	// gives the record a modified time for /changes
+	notes := "recovery codes in the safe"
+	if _, err := svc.UpdateEntry(safePath, "master", "11111111-1111-1111-1111-111111111111", models.EntryUpdate{Notes: &notes}); err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if _, err := svc.GetEntryTOTP(safePath, "master", "11111111-1111-1111-1111-111111111111"); err != nil {
+		t.Fatalf("Expected the secret to survive the update: %v", err)
+	}
+
+	for _, target := range []string{"/unlock", "/changes?since=2000-01-01T00:00:00Z"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+target, strings.NewReader(`{"password": "master"}`))
+		w := httptest.NewRecorder()
+		if strings.HasPrefix(target, "/unlock") {
+			handler.UnlockSafe(w, req)
+		} else {
+			handler.GetChanges(w, req)
+		}
+
+		body := w.Body.String()
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d. Body: %s", target, w.Code, body)
+		}
+		if strings.Contains(body, "JBSWY3DPEHPK3PXP") || strings.Contains(body, "KRSXG5CTMVRXEZLU") || strings.Contains(body, "otpauth") {
+			t.Errorf("%s: expected the TOTP secret to be left out, got %s", target, body)
+		}
+		if !strings.Contains(body, "recovery codes in the safe") || !strings.Contains(body, `"hasTOTP":true`) {
+			t.Errorf("%s: expected the other notes and hasTOTP, got %s", target, body)
+		}
+	}
+}
+
+func TestGetEntryTOTP_NoSecret(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata"))
+
+	body, _ := json.Marshal(models.EntryPasswordRequest{
+		Password:  "password",
+		EntryUUID: "c4dcfb52-b944-f141-af96-b746f184afe2",
+	})
+	encodedPath := url.PathEscape("/testdata/simple.psafe3")
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/entry/totp", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.GetEntryTOTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var response models.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Code != models.ErrorCodeNoTOTP {
+		t.Errorf("Expected code %s, got '%s'", models.ErrorCodeNoTOTP, response.Code)
+	}
 }
 
 func TestGetEntryPassword_MissingFields(t *testing.T) {
@@ -285,3 +445,624 @@ func TestGetEntryPassword_SpecialCharacters(t *testing.T) {
 		t.Errorf("Expected password with special chars, got '%s'", response.Password)
 	}
 }
+
+// copyTestSafe copies a testdata safe into dir and returns its API path
+func copyTestSafe(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("../../testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return "/" + filepath.Base(dir) + "/" + name
+}
+
+func TestMoveEntry_Success(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	handler := NewSafeHandler(service.NewSafeService(tmpDir))
+
+	body, _ := json.Marshal(models.MoveEntryRequest{Password: "password", Group: "moved"})
+
+	encodedPath := url.PathEscape(safePath)
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/entries/c4dcfb52-b944-f141-af96-b746f184afe2/move", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.MoveEntry(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	var structure models.SafeStructure
+	if err := json.NewDecoder(w.Body).Decode(&structure); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(structure.Groups) != 1 || structure.Groups[0].Name != "moved" {
+		t.Errorf("Expected group 'moved', got %+v", structure.Groups)
+	}
+}
+
+func TestMoveEntry_InvalidGroup(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	handler := NewSafeHandler(service.NewSafeService(tmpDir))
+
+	body, _ := json.Marshal(models.MoveEntryRequest{Password: "password", Group: "a..b"})
+
+	encodedPath := url.PathEscape(safePath)
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/entries/c4dcfb52-b944-f141-af96-b746f184afe2/move", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.MoveEntry(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestMoveEntry_WrongPassword(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	handler := NewSafeHandler(service.NewSafeService(tmpDir))
+
+	body, _ := json.Marshal(models.MoveEntryRequest{Password: "wrongpassword", Group: "moved"})
+
+	encodedPath := url.PathEscape(safePath)
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/entries/c4dcfb52-b944-f141-af96-b746f184afe2/move", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.MoveEntry(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+}
+
+func TestGetSafeInfo(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata"))
+	info := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/safes/"+url.PathEscape("/testdata/simple.psafe3")+"/info", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.GetSafeInfo(w, req)
+		return w
+	}
+
+	w := info(`{"password": "password"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected Cache-Control: no-store, got %q", w.Header().Get("Cache-Control"))
+	}
+	var resp map[string]any
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["recordCount"] != float64(1) || resp["lastSavedBy"] != "Loxodo 0.0-git" || resp["lastSaved"] == nil {
+		t.Errorf("Unexpected info: %v", resp)
+	}
+	if _, ok := resp["entries"]; ok {
+		t.Error("Expected no entries in the info response")
+	}
+
+	if w := info(`{"password": "wrong"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for a wrong password, got %d", w.Code)
+	}
+	if w := info(`{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a password, got %d", w.Code)
+	}
+}
+
+func TestVerifySafe_Success(t *testing.T) {
+	service := service.NewSafeService("../../testdata")
+	handler := NewSafeHandler(service)
+
+	body, _ := json.Marshal(models.UnlockRequest{Password: "password"})
+
+	encodedPath := url.PathEscape("/testdata/simple.psafe3")
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/verify", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.VerifySafe(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got %q", w.Body.String())
+	}
+}
+
+func TestVerifySafe_WrongPassword(t *testing.T) {
+	service := service.NewSafeService("../../testdata")
+	handler := NewSafeHandler(service)
+
+	body, _ := json.Marshal(models.UnlockRequest{Password: "wrongpassword"})
+
+	encodedPath := url.PathEscape("/testdata/simple.psafe3")
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/verify", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.VerifySafe(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got %q", w.Body.String())
+	}
+}
+
+func TestVerifySafe_NonexistentFile(t *testing.T) {
+	service := service.NewSafeService("../../testdata")
+	handler := NewSafeHandler(service)
+
+	body, _ := json.Marshal(models.UnlockRequest{Password: "password"})
+
+	encodedPath := url.PathEscape("/testdata/nonexistent.psafe3")
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/verify", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.VerifySafe(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestUnlockSafe_IncludeExtra(t *testing.T) {
+	tmpDir := t.TempDir()
+	structure := &models.SafeStructure{Entries: []models.Entry{
+		{UUID: "11111111-1111-1111-1111-111111111111", Title: "with", Password: "p", ExtraFields: map[string]string{"email": "me@example.com"}},
+	}}
+	if err := service.CreateSafeFromStructure(filepath.Join(tmpDir, "extra.psafe3"), "master", structure); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewSafeHandler(service.NewSafeService(tmpDir))
+	encodedPath := url.PathEscape("/" + filepath.Base(tmpDir) + "/extra.psafe3")
+	body, _ := json.Marshal(models.UnlockRequest{Password: "master"})
+
+	unlock := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/unlock"+query, bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.UnlockSafe(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	var withExtra models.SafeStructure
+	if err := json.NewDecoder(unlock("?includeExtra=true").Body).Decode(&withExtra); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(withExtra.Entries) != 1 || withExtra.Entries[0].ExtraFields["email"] != "me@example.com" {
+		t.Errorf("Expected extraFields with includeExtra, got %+v", withExtra.Entries)
+	}
+
+	// Without the flag the key must be absent entirely
+	if w := unlock(""); bytes.Contains(w.Body.Bytes(), []byte("extraFields")) || strings.Contains(w.Body.String(), "me@example.com") {
+		t.Errorf("Expected no extraFields without includeExtra, got %s", w.Body.String())
+	}
+}
+
+func TestDiagnoseSafe_OmitsSecrets(t *testing.T) {
+	service := service.NewSafeService("../../testdata")
+	handler := NewSafeHandler(service)
+
+	body, _ := json.Marshal(models.UnlockRequest{Password: "password"})
+
+	encodedPath := url.PathEscape("/testdata/simple.psafe3")
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/diagnose", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.DiagnoseSafe(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	responseBody := w.Body.String()
+	for _, secret := range []string{"Test entry", "http://test.com", "no notes"} {
+		if strings.Contains(responseBody, secret) {
+			t.Errorf("Expected diagnostics to omit %q, got %s", secret, responseBody)
+		}
+	}
+
+	var diag models.SafeDiagnostics
+	if err := json.Unmarshal(w.Body.Bytes(), &diag); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if diag.RawRecordCount != 1 {
+		t.Errorf("Expected 1 raw record, got %d", diag.RawRecordCount)
+	}
+}
+
+func TestIsEntryRequest(t *testing.T) {
+	// A synced safe under a remote folder named "entries"
+	nested := url.PathEscape("/onedrive/entries/work.psafe3")
+	uuid := "c4dcfb52-b944-f141-af96-b746f184afe2"
+
+	tests := []struct {
+		path   string
+		suffix string
+		want   bool
+	}{
+		{"/api/safes/" + nested + "/entries/" + uuid, "", true},
+		{"/api/safes/" + nested + "/entries/" + uuid + "/move", "/move", true},
+		{"/api/safes/" + nested + "/entries/" + uuid + "/move", "", false},
+		{"/api/safes/" + nested + "/unlock", "", false},
+		{"/api/safes/" + nested + "/entry", "", false},
+		{"/api/safes/" + nested + "/info", "", false},
+		{"/api/safes/" + nested + "/changes", "/move", false},
+		// Unescaped slashes still only match a final UUID segment
+		{"/api/safes//onedrive/entries/work.psafe3/unlock", "", false},
+		{"/api/safes//onedrive/entries/work.psafe3/entries/" + uuid, "", true},
+		{"/api/safes/" + nested + "/entries/", "", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		if got := IsEntryRequest(req, tt.suffix); got != tt.want {
+			t.Errorf("IsEntryRequest(%q, %q) = %v, expected %v", tt.path, tt.suffix, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateEntry_Responses(t *testing.T) {
+	notes := "updated notes"
+	tests := []struct {
+		name     string
+		password string
+		uuid     string
+		expected int
+	}{
+		{"success", "password", "c4dcfb52-b944-f141-af96-b746f184afe2", http.StatusOK},
+		{"unknown uuid", "password", "00000000-0000-0000-0000-000000000000", http.StatusNotFound},
+		{"wrong password", "wrongpassword", "c4dcfb52-b944-f141-af96-b746f184afe2", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+			handler := NewSafeHandler(service.NewSafeService(tmpDir))
+
+			body, _ := json.Marshal(models.UpdateEntryRequest{
+				Password: tt.password,
+				Fields:   models.EntryUpdate{Notes: &notes},
+			})
+
+			encodedPath := url.PathEscape(safePath)
+			req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/entries/"+tt.uuid, bytes.NewReader(body))
+			w := httptest.NewRecorder()
+
+			handler.UpdateEntry(w, req)
+
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.expected, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestErrorResponses_IncludeCode(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata"))
+
+	tests := []struct {
+		name     string
+		path     string
+		password string
+		expected string
+	}{
+		{"safe not found", "/testdata/nonexistent.psafe3", "password", models.ErrorCodeSafeNotFound},
+		{"wrong password", "/testdata/simple.psafe3", "wrongpassword", models.ErrorCodeUnauthorized},
+		{"missing password", "/testdata/simple.psafe3", "", models.ErrorCodeValidation},
+	}
+
+	for _, tt := range tests {
+		body, _ := json.Marshal(models.UnlockRequest{Password: tt.password})
+		req := httptest.NewRequest(http.MethodPost, "/api/safes/"+url.PathEscape(tt.path)+"/unlock", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+
+		handler.UnlockSafe(w, req)
+
+		var response models.ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.name, err)
+		}
+		if response.Code != tt.expected {
+			t.Errorf("%s: expected code %s, got '%s'", tt.name, tt.expected, response.Code)
+		}
+	}
+}
+
+func TestUnlockSafe_TooLarge(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata", service.WithMaxRecords(2)))
+
+	body, _ := json.Marshal(models.UnlockRequest{Password: "three3#;"})
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+url.PathEscape("/testdata/three.psafe3")+"/unlock", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.UnlockSafe(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d", w.Code)
+	}
+	var response models.ErrorResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Code != models.ErrorCodeSafeTooLarge || !strings.Contains(response.Error, "3 records") {
+		t.Errorf("Expected SAFE_TOO_LARGE with record count, got %+v", response)
+	}
+}
+
+func TestExportSafe_IncludesPasswords(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata"))
+
+	body, _ := json.Marshal(models.UnlockRequest{Password: "password"})
+	encodedPath := url.PathEscape("/testdata/simple.psafe3")
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/export?format=json", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.ExportSafe(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Contains-Secrets") != "true" || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected secret-warning headers, got %v", w.Header())
+	}
+
+	var structure models.SafeStructure
+	if err := json.Unmarshal(w.Body.Bytes(), &structure); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(structure.Groups) != 1 || len(structure.Groups[0].Entries) != 1 {
+		t.Fatalf("Expected 1 group with 1 entry, got %+v", structure.Groups)
+	}
+	if structure.Groups[0].Entries[0].Password != "password" {
+		t.Errorf("Expected exported entry to include its password, got %+v", structure.Groups[0].Entries[0])
+	}
+
+	// Unlock never includes passwords
+	req = httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/unlock", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	handler.UnlockSafe(w, req)
+	if strings.Contains(w.Body.String(), `"password"`) {
+		t.Errorf("Expected unlock response to omit passwords, got %s", w.Body.String())
+	}
+}
+
+func TestExportSafe_UnsupportedFormat(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata"))
+
+	body, _ := json.Marshal(models.UnlockRequest{Password: "password"})
+	encodedPath := url.PathEscape("/testdata/simple.psafe3")
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/export?format=csv", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.ExportSafe(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestUnlockSafe_Keyfile(t *testing.T) {
+	keyDir := t.TempDir()
+	os.WriteFile(filepath.Join(keyDir, "simple.key"), []byte("password\n"), 0600)
+	os.WriteFile(filepath.Join(keyDir, "three.key"), []byte("password\n"), 0600)
+	handler := NewSafeHandler(service.NewSafeService("../../testdata", service.WithKeyfileDirectory(keyDir)))
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"keyfile", `{"keyfile": "simple.key"}`, http.StatusOK},
+		{"keyfile and password", `{"keyfile": "simple.key", "password": "password"}`, http.StatusBadRequest},
+		{"traversal", `{"keyfile": "../../etc/passwd"}`, http.StatusBadRequest},
+		{"another safe's keyfile", `{"keyfile": "three.key"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encodedPath := url.PathEscape("/testdata/simple.psafe3")
+			req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/unlock", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.UnlockSafe(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata"))
+	encodedPath := url.PathEscape("/testdata/simple.psafe3")
+
+	w := httptest.NewRecorder()
+	handler.ListSafes(w, httptest.NewRequest(http.MethodGet, "/api/safes", nil))
+	if got := w.Header().Get("Cache-Control"); got != "private, max-age=5" {
+		t.Errorf("Expected a private listing Cache-Control, got %q", got)
+	}
+	if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", got)
+	}
+
+	tests := []struct {
+		name   string
+		action string
+		body   string
+		handle http.HandlerFunc
+	}{
+		{"unlock", "/unlock", `{"password": "password"}`, handler.UnlockSafe},
+		{"unlock wrong password", "/unlock", `{"password": "wrong"}`, handler.UnlockSafe},
+		{"entry", "/entry", `{"password": "password", "entryUuid": "00000000-0000-0000-0000-000000000000"}`, handler.GetEntryPassword},
+		{"entry strength", "/entry/strength", `{"password": "password", "entryUuid": "x"}`, handler.GetEntryPasswordStrength},
+		{"export", "/export", `{"password": "password"}`, handler.ExportSafe},
+		{"diagnose", "/diagnose", `{"password": "password"}`, handler.DiagnoseSafe},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+tt.action, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			tt.handle(w, req)
+
+			if got := w.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Expected Cache-Control: no-store (status %d), got %q", w.Code, got)
+			}
+		})
+	}
+}
+
+func TestUnlockSafe_Fields(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata"))
+	encodedPath := url.PathEscape("/testdata/simple.psafe3")
+
+	unlock := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/unlock"+query, strings.NewReader(`{"password": "password"}`))
+		w := httptest.NewRecorder()
+		handler.UnlockSafe(w, req)
+		return w
+	}
+
+	w := unlock("?fields=title")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var structure models.SafeStructure
+	body := w.Body.String()
+	if err := json.Unmarshal([]byte(body), &structure); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(structure.Groups) != 1 || len(structure.Groups[0].Entries) == 0 {
+		t.Fatalf("Expected the tree shape to be kept, got %s", body)
+	}
+	entry := structure.Groups[0].Entries[0]
+	if entry.UUID == "" || entry.Title == "" {
+		t.Errorf("Expected uuid and title, got %+v", entry)
+	}
+	if strings.Contains(body, `"username"`) {
+		t.Errorf("Expected username to be omitted, got %s", body)
+	}
+
+	if w := unlock("?fields=title,password"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown field, got %d", w.Code)
+	}
+}
+
+func TestUnlockSafe_UnsupportedFormat(t *testing.T) {
+	safesDir := t.TempDir()
+	os.WriteFile(filepath.Join(safesDir, "old.psafe3"), []byte("not a v3 safe"), 0600)
+	handler := NewSafeHandler(service.NewSafeService(safesDir))
+
+	encodedPath := url.PathEscape("/" + filepath.Base(safesDir) + "/old.psafe3")
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/unlock", strings.NewReader(`{"password": "password"}`))
+	w := httptest.NewRecorder()
+
+	handler.UnlockSafe(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	var response models.ErrorResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	if response.Code != models.ErrorCodeUnsupportedSafe {
+		t.Errorf("Expected %s, got %+v", models.ErrorCodeUnsupportedSafe, response)
+	}
+}
+
+func TestGetChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	svc := service.NewSafeService(tmpDir)
+	handler := NewSafeHandler(svc)
+	entryUUID := "c4dcfb52-b944-f141-af96-b746f184afe2"
+
+	changes := func(since string) (int, models.SafeChanges) {
+		req := httptest.NewRequest(http.MethodPost, "/api/safes/"+url.PathEscape(safePath)+"/changes?since="+url.QueryEscape(since), strings.NewReader(`{"password": "password"}`))
+		w := httptest.NewRecorder()
+		handler.GetChanges(w, req)
+		var resp models.SafeChanges
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	before := time.Now().Add(-time.Second)
+	code, resp := changes(before.Format(time.RFC3339))
+	if code != http.StatusOK || len(resp.Entries) != 0 {
+		t.Fatalf("Expected no changes before the edit, got %d %+v", code, resp.Entries)
+	}
+
+	notes := "changed"
+	if _, err := svc.UpdateEntry(safePath, "password", entryUUID, models.EntryUpdate{Notes: &notes}); err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+
+	code, resp = changes(before.Format(time.RFC3339))
+	if code != http.StatusOK || len(resp.Entries) != 1 {
+		t.Fatalf("Expected the edited entry, got %d %+v", code, resp.Entries)
+	}
+	changed := resp.Entries[0]
+	if changed.UUID != entryUUID || changed.Notes != "changed" || changed.Group != "test" || changed.Password != "" {
+		t.Errorf("Unexpected changed entry: %+v", changed)
+	}
+	if changed.ModifiedAt == nil || changed.ModifiedAt.Before(before) {
+		t.Errorf("Expected the edit's modification time, got %v", changed.ModifiedAt)
+	}
+
+	if code, _ := changes("yesterday"); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid since, got %d", code)
+	}
+}
+
+func TestUnlockSafe_Session(t *testing.T) {
+	handler := NewSafeHandler(service.NewSafeService("../../testdata", service.WithSessionTTL(time.Minute)))
+	encodedPath := url.PathEscape("/testdata/simple.psafe3")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/unlock", strings.NewReader(`{"password": "password", "createSession": true}`))
+	w := httptest.NewRecorder()
+	handler.UnlockSafe(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	token := w.Header().Get("X-Session-Token")
+	if token == "" || w.Header().Get("X-Session-Expires") == "" {
+		t.Fatalf("Expected session headers, got %v", w.Header())
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"session", `{"session": "` + token + `", "entryUuid": "c4dcfb52-b944-f141-af96-b746f184afe2"}`, http.StatusOK, ""},
+		{"session and password", `{"session": "` + token + `", "password": "password", "entryUuid": "c4dcfb52-b944-f141-af96-b746f184afe2"}`, http.StatusBadRequest, models.ErrorCodeValidation},
+		{"unknown session", `{"session": "nope", "entryUuid": "c4dcfb52-b944-f141-af96-b746f184afe2"}`, http.StatusUnauthorized, models.ErrorCodeSessionExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/safes/"+encodedPath+"/entry", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			handler.GetEntryPassword(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d. Body: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantCode != "" {
+				var resp models.ErrorResponse
+				json.NewDecoder(w.Body).Decode(&resp)
+				if resp.Code != tt.wantCode {
+					t.Errorf("Expected code %s, got %s", tt.wantCode, resp.Code)
+				}
+			}
+		})
+	}
+}
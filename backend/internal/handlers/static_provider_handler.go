@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -9,19 +13,58 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/rolledback/pwsafe-service/backend/internal/models"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider"
+	"github.com/rolledback/pwsafe-service/backend/internal/service"
+	"github.com/tkuhlman/gopwsafe/pwsafe"
 )
 
+// maxUploadMemory is how much of an upload form is held in memory (the rest
+// spills to temp files)
+const maxUploadMemory = 10 << 20
+
 // StaticProviderHandler handles HTTP requests for static safe operations (upload, delete)
 type StaticProviderHandler struct {
 	safesDirectory string
+	extensions     provider.Extensions
+	passwordPolicy *service.PasswordPolicy // nil accepts any master password for imports
+	tempDirectory  string                  // where uploads are written before moving into place; empty uses safesDirectory
+	idempotency    *idempotencyStore       // nil processes every upload, ignoring Idempotency-Key
 }
 
-// NewStaticProviderHandler creates a new static provider handler
-func NewStaticProviderHandler(safesDirectory string) *StaticProviderHandler {
+// NewStaticProviderHandler creates a new static provider handler.
+// Only files matching extensions may be uploaded or deleted.
+func NewStaticProviderHandler(safesDirectory string, extensions provider.Extensions) *StaticProviderHandler {
+	if len(extensions) == 0 {
+		extensions = provider.DefaultExtensions
+	}
 	return &StaticProviderHandler{
 		safesDirectory: safesDirectory,
+		extensions:     extensions,
+	}
+}
+
+// SetPasswordPolicy sets the standard imported safes' master passwords must meet
+func (h *StaticProviderHandler) SetPasswordPolicy(policy *service.PasswordPolicy) {
+	h.passwordPolicy = policy
+}
+
+// SetTempDirectory sets where uploads are staged until they are complete. It
+// may be on a different filesystem than the safes directory.
+func (h *StaticProviderHandler) SetTempDirectory(dir string) {
+	h.tempDirectory = dir
+}
+
+// SetIdempotencyTTL makes uploads sent with the same Idempotency-Key header
+// within ttl return the first upload's result instead of being processed
+// again. Zero disables it.
+func (h *StaticProviderHandler) SetIdempotencyTTL(ttl time.Duration) {
+	h.idempotency = nil
+	if ttl > 0 {
+		h.idempotency = newIdempotencyStore(ttl)
 	}
 }
 
@@ -32,6 +75,8 @@ func (h *StaticProviderHandler) Route(w http.ResponseWriter, r *http.Request) {
 
 	if strings.HasPrefix(path, "files") {
 		h.handleFiles(w, r, strings.TrimPrefix(path, "files"))
+	} else if path == "import" {
+		h.importSafe(w, r)
 	} else {
 		h.respondError(w, "Unknown action", http.StatusNotFound)
 	}
@@ -47,7 +92,7 @@ func (h *StaticProviderHandler) handleFiles(w http.ResponseWriter, r *http.Reque
 			h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		h.uploadFile(w, r)
+		idempotent(h.idempotency, w, r, uploadFingerprint, h.uploadFile, h.respondError)
 	case http.MethodDelete:
 		if subpath == "" {
 			h.respondError(w, "Filename required", http.StatusBadRequest)
@@ -59,11 +104,35 @@ func (h *StaticProviderHandler) handleFiles(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+// uploadFingerprint identifies the file an upload carries by its name and a
+// hash of its content, so a key reused for a different file is refused. It
+// returns "" if the form can't be parsed (uploadFile then rejects it).
+func uploadFingerprint(r *http.Request) string {
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		return ""
+	}
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		return ""
+	}
+
+	file, err := files[0].Open()
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return ""
+	}
+	return files[0].Filename + "\x00" + hex.EncodeToString(hash.Sum(nil))
+}
+
 func (h *StaticProviderHandler) uploadFile(w http.ResponseWriter, r *http.Request) {
 	log.Printf("POST /api/providers/static/files")
 
-	// Parse multipart form (limit to 10MB)
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
+	// Parse multipart form; a no-op if uploadFingerprint already did
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
 		log.Printf("Error parsing multipart form: %v", err)
 		h.respondError(w, "Failed to parse upload", http.StatusBadRequest)
 		return
@@ -77,16 +146,18 @@ func (h *StaticProviderHandler) uploadFile(w http.ResponseWriter, r *http.Reques
 	}
 	defer file.Close()
 
-	// Validate and sanitize filename
+	// Validate and sanitize filename. Dropping path components isn't a rename,
+	// but stripping characters is, so the client can say where the file went.
 	filename := h.sanitizeFilename(header.Filename)
 	if filename == "" {
 		h.respondError(w, "Invalid filename", http.StatusBadRequest)
 		return
 	}
+	renamed := filename != filepath.Base(header.Filename)
 
 	// Validate extension
-	if !strings.HasSuffix(strings.ToLower(filename), ".psafe3") {
-		h.respondError(w, "Only .psafe3 files are allowed", http.StatusBadRequest)
+	if !h.extensions.Match(filename) {
+		h.respondError(w, "Only "+h.extensionList()+" files are allowed", http.StatusBadRequest)
 		return
 	}
 
@@ -98,30 +169,131 @@ func (h *StaticProviderHandler) uploadFile(w http.ResponseWriter, r *http.Reques
 		overwrite := r.URL.Query().Get("overwrite") == "true"
 		if !overwrite {
 			h.respondJSON(w, map[string]interface{}{
-				"exists": true,
-				"name":   filename,
+				"exists":  true,
+				"name":    filename,
+				"renamed": renamed,
 			}, http.StatusConflict)
 			return
 		}
 	}
 
-	// Create destination file
-	dst, err := os.Create(destPath)
-	if err != nil {
-		log.Printf("Error creating file %s: %v", destPath, err)
+	// Stage the upload so the destination only ever appears complete
+	if err := h.writeUpload(file, destPath); err != nil {
+		log.Printf("Error writing file %s: %v", destPath, err)
 		h.respondError(w, "Failed to save file", http.StatusInternalServerError)
 		return
 	}
-	defer dst.Close()
 
-	// Copy content
-	if _, err := io.Copy(dst, file); err != nil {
-		log.Printf("Error writing file %s: %v", destPath, err)
-		h.respondError(w, "Failed to save file", http.StatusInternalServerError)
+	log.Printf("Uploaded static safe: %s", filename)
+	response := map[string]interface{}{
+		"success": true,
+		"name":    filename,
+		"renamed": renamed,
+	}
+
+	// Optionally confirm the upload opens, so a corrupt file or wrong password
+	// shows up now rather than at the first unlock. The file is kept either way.
+	if password := r.FormValue("password"); password != "" {
+		_, err := pwsafe.OpenPWSafeFile(destPath, password)
+		if err != nil {
+			log.Printf("Uploaded safe %s failed verification: %v", filename, err)
+		}
+		response["verified"] = err == nil
+	}
+
+	h.respondJSON(w, response, http.StatusOK)
+}
+
+// importSafe creates a new static safe from a JSON export. Form fields: file
+// (the export), password (master password for the new safe) and an optional
+// name (defaults to the uploaded filename with the first configured extension).
+func (h *StaticProviderHandler) importSafe(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST /api/providers/static/import")
+
+	if r.Method != http.MethodPost {
+		h.respondError(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	log.Printf("Uploaded static safe: %s", filename)
+	if format := r.URL.Query().Get("format"); format != "" && format != "json" {
+		h.respondError(w, "Unsupported import format", http.StatusBadRequest)
+		return
+	}
+
+	// Parse multipart form (limit to 10MB)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		log.Printf("Error parsing multipart form: %v", err)
+		h.respondError(w, "Failed to parse upload", http.StatusBadRequest)
+		return
+	}
+
+	password := r.FormValue("password")
+	if password == "" {
+		h.respondError(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.passwordPolicy.Check(password); err != nil {
+		h.respondErrorCode(w, err.Error(), models.ErrorCodeWeakPassword, http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		log.Printf("Error getting form file: %v", err)
+		h.respondError(w, "No file provided", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	name := r.FormValue("name")
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename)) + h.extensions[0]
+	}
+	filename := h.sanitizeFilename(name)
+	if filename == "" {
+		h.respondError(w, "Invalid filename", http.StatusBadRequest)
+		return
+	}
+	if !h.extensions.Match(filename) {
+		h.respondError(w, "Only "+h.extensionList()+" files are allowed", http.StatusBadRequest)
+		return
+	}
+
+	var structure models.SafeStructure
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&structure); err != nil {
+		h.respondError(w, "Invalid export file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	destPath := filepath.Join(h.safesDirectory, filename)
+
+	// Imports never overwrite an existing safe
+	if _, err := os.Stat(destPath); err == nil {
+		h.respondJSON(w, map[string]interface{}{
+			"exists": true,
+			"name":   filename,
+		}, http.StatusConflict)
+		return
+	}
+
+	if err := service.CreateSafeFromStructure(destPath, password, &structure); err != nil {
+		log.Printf("Error importing safe %s: %v", filename, err)
+		if strings.Contains(err.Error(), "invalid import") {
+			h.respondError(w, err.Error(), http.StatusBadRequest)
+		} else if strings.Contains(err.Error(), "already exists") {
+			h.respondJSON(w, map[string]interface{}{
+				"exists": true,
+				"name":   filename,
+			}, http.StatusConflict)
+		} else {
+			h.respondError(w, "Failed to save file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("Imported static safe: %s", filename)
 	h.respondJSON(w, map[string]interface{}{
 		"success": true,
 		"name":    filename,
@@ -139,8 +311,8 @@ func (h *StaticProviderHandler) deleteFile(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Validate extension
-	if !strings.HasSuffix(strings.ToLower(filename), ".psafe3") {
-		h.respondError(w, "Only .psafe3 files can be deleted", http.StatusBadRequest)
+	if !h.extensions.Match(filename) {
+		h.respondError(w, "Only "+h.extensionList()+" files can be deleted", http.StatusBadRequest)
 		return
 	}
 
@@ -181,6 +353,115 @@ func (h *StaticProviderHandler) deleteFile(w http.ResponseWriter, r *http.Reques
 	h.respondJSON(w, map[string]bool{"success": true}, http.StatusOK)
 }
 
+// uploadTempPattern names the temp files uploads are staged in
+const uploadTempPattern = ".upload-*.tmp"
+
+// RemoveUploadTempFiles deletes staged uploads left in the safes and temp
+// directories by a process killed mid-upload. Call it before serving requests.
+func (h *StaticProviderHandler) RemoveUploadTempFiles() {
+	dirs := []string{h.safesDirectory}
+	if h.tempDirectory != "" {
+		dirs = append(dirs, h.tempDirectory)
+	}
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, uploadTempPattern))
+		for _, path := range matches {
+			if err := os.Remove(path); err != nil {
+				log.Printf("Error removing leftover upload %s: %v", path, err)
+			}
+		}
+	}
+}
+
+// writeUpload copies src to a temp file and moves it to destPath once it is
+// fully written
+func (h *StaticProviderHandler) writeUpload(src io.Reader, destPath string) error {
+	tempDir := h.tempDirectory
+	if tempDir == "" {
+		tempDir = filepath.Dir(destPath)
+	}
+
+	tmp, err := os.CreateTemp(tempDir, uploadTempPattern)
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := moveFile(tmpPath, destPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// renameFile is os.Rename, swappable so tests can simulate a cross-device move
+var renameFile = os.Rename
+
+// moveFile renames src to dst. When they are on different filesystems
+// (EXDEV) it copies src to a temp file beside dst and renames that instead,
+// so dst is still replaced in one step, then removes src.
+func moveFile(src, dst string) error {
+	err := renameFile(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), uploadTempPattern)
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to copy across filesystems: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to copy across filesystems: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to copy across filesystems: %w", err)
+	}
+
+	if err := renameFile(tmpPath, dst); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	in.Close()
+	os.Remove(src)
+	return nil
+}
+
+// extensionList formats the allowed extensions for error messages
+func (h *StaticProviderHandler) extensionList() string {
+	return strings.Join(h.extensions, ", ")
+}
+
 // sanitizeFilename removes path components and invalid characters from filename
 func (h *StaticProviderHandler) sanitizeFilename(filename string) string {
 	// Get just the base name (remove any path components)
@@ -214,5 +495,9 @@ func (h *StaticProviderHandler) respondJSON(w http.ResponseWriter, data interfac
 }
 
 func (h *StaticProviderHandler) respondError(w http.ResponseWriter, message string, status int) {
-	h.respondJSON(w, models.ErrorResponse{Error: message}, status)
+	h.respondErrorCode(w, message, models.ErrorCodeForStatus(status), status)
+}
+
+func (h *StaticProviderHandler) respondErrorCode(w http.ResponseWriter, message, code string, status int) {
+	h.respondJSON(w, models.ErrorResponse{Error: message, Code: code}, status)
 }
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider"
+	"github.com/rolledback/pwsafe-service/backend/internal/service"
+)
+
+func uploadRequest(t *testing.T, filename string, content []byte, password string) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(content)
+	if password != "" {
+		mw.WriteField("password", password)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/providers/static/files", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestUploadFile_Verification(t *testing.T) {
+	safe, err := os.ReadFile("../../testdata/simple.psafe3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		content  []byte
+		password string
+		verified interface{} // nil when verification is skipped
+	}{
+		{"no password", safe, "", nil},
+		{"correct password", safe, "password", true},
+		{"wrong password", safe, "wrong", false},
+		{"corrupt file", []byte("not a safe"), "password", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewStaticProviderHandler(t.TempDir(), provider.DefaultExtensions)
+
+			w := httptest.NewRecorder()
+			handler.Route(w, uploadRequest(t, "upload.psafe3", tt.content, tt.password))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+			}
+			var body map[string]interface{}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if body["verified"] != tt.verified {
+				t.Errorf("Expected verified=%v, got %v", tt.verified, body["verified"])
+			}
+		})
+	}
+}
+
+func TestUploadFile_ReportsRename(t *testing.T) {
+	tests := []struct {
+		filename    string
+		wantName    string
+		wantRenamed bool
+	}{
+		{"vault.psafe3", "vault.psafe3", false},
+		{"my vault (work).psafe3", "my vault work.psafe3", true},
+		{"dir/vault.psafe3", "vault.psafe3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			handler := NewStaticProviderHandler(t.TempDir(), provider.DefaultExtensions)
+
+			w := httptest.NewRecorder()
+			handler.Route(w, uploadRequest(t, tt.filename, []byte("content"), ""))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+			}
+			var body map[string]interface{}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if body["name"] != tt.wantName || body["renamed"] != tt.wantRenamed {
+				t.Errorf("Expected name %q renamed=%v, got %v renamed=%v", tt.wantName, tt.wantRenamed, body["name"], body["renamed"])
+			}
+		})
+	}
+}
+
+func TestUploadFile_CrossDeviceTempDir(t *testing.T) {
+	safesDir, tempDir := t.TempDir(), t.TempDir()
+	destPath := filepath.Join(safesDir, "vault.psafe3")
+	if err := os.WriteFile(destPath, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Renames out of tempDir fail as they would from another filesystem
+	renameFile = func(oldpath, newpath string) error {
+		if filepath.Dir(oldpath) == tempDir {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+		}
+		if data, _ := os.ReadFile(destPath); string(data) != "old" {
+			t.Errorf("Destination changed before the copy was complete: %q", data)
+		}
+		return os.Rename(oldpath, newpath)
+	}
+	defer func() { renameFile = os.Rename }()
+
+	handler := NewStaticProviderHandler(safesDir, provider.DefaultExtensions)
+	handler.SetTempDirectory(tempDir)
+
+	req := uploadRequest(t, "vault.psafe3", []byte("new"), "")
+	req.URL.RawQuery = "overwrite=true"
+	w := httptest.NewRecorder()
+	handler.Route(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if data, _ := os.ReadFile(destPath); string(data) != "new" {
+		t.Errorf("Expected uploaded content, got %q", data)
+	}
+	for _, dir := range []string{safesDir, tempDir} {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if entry.Name() != "vault.psafe3" {
+				t.Errorf("Temp file %s left in %s", entry.Name(), dir)
+			}
+		}
+	}
+}
+
+func TestRemoveUploadTempFiles(t *testing.T) {
+	safesDir, tempDir := t.TempDir(), t.TempDir()
+	keep := filepath.Join(safesDir, "vault.psafe3")
+	leftovers := []string{
+		filepath.Join(safesDir, ".upload-123.tmp"),
+		filepath.Join(tempDir, ".upload-456.tmp"),
+	}
+	for _, path := range append(leftovers, keep) {
+		os.WriteFile(path, []byte("data"), 0600)
+	}
+
+	handler := NewStaticProviderHandler(safesDir, provider.DefaultExtensions)
+	handler.SetTempDirectory(tempDir)
+	handler.RemoveUploadTempFiles()
+
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("Expected the safe to be kept: %v", err)
+	}
+	for _, path := range leftovers {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", path)
+		}
+	}
+}
+
+func TestUploadFile_IdempotencyKey(t *testing.T) {
+	safesDir := t.TempDir()
+	destPath := filepath.Join(safesDir, "vault.psafe3")
+	handler := NewStaticProviderHandler(safesDir, provider.DefaultExtensions)
+	handler.SetIdempotencyTTL(time.Minute)
+
+	uploadContent := func(key, filename, content string) *httptest.ResponseRecorder {
+		req := uploadRequest(t, filename, []byte(content), "")
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		handler.Route(w, req)
+		return w
+	}
+	uploadAs := func(key, filename string) *httptest.ResponseRecorder {
+		return uploadContent(key, filename, "content")
+	}
+	upload := func(key string) *httptest.ResponseRecorder {
+		return uploadAs(key, "vault.psafe3")
+	}
+
+	first := upload("key-1")
+	if first.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", first.Code, first.Body.String())
+	}
+
+	// A repeat is answered from the first result, not processed again: the
+	// file is not recreated and there is no 409 for it already existing
+	os.Remove(destPath)
+	repeat := upload("key-1")
+	if repeat.Code != http.StatusOK || repeat.Body.String() != first.Body.String() {
+		t.Errorf("Expected the original response, got %d: %s", repeat.Code, repeat.Body.String())
+	}
+	if repeat.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("Expected Idempotent-Replayed header on the repeat")
+	}
+	if _, err := os.Stat(destPath); !os.IsNotExist(err) {
+		t.Error("Expected the repeated upload not to be written")
+	}
+
+	if w := upload("key-2"); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected a new key to be processed, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(destPath); err != nil {
+		t.Errorf("Expected a new key's upload to be written: %v", err)
+	}
+
+	if w := uploadAs("key-1", "other.psafe3"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected a key reused for another file to be refused with 422, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(safesDir, "other.psafe3")); !os.IsNotExist(err) {
+		t.Error("Expected the refused upload not to be written")
+	}
+	if w := uploadContent("key-1", "vault.psafe3", "different content"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected a key reused for the same name with other content to be refused with 422, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// A failure isn't kept, so the same request can succeed once the cause is gone
+	if w := upload("key-3"); w.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for an existing file, got %d: %s", w.Code, w.Body.String())
+	}
+	os.Remove(destPath)
+	if w := upload("key-3"); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("Expected the retry to be processed, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestImportSafe_PasswordPolicy(t *testing.T) {
+	tests := []struct {
+		password string
+		wantCode int
+	}{
+		{"short", http.StatusBadRequest},
+		{"long enough", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			handler := NewStaticProviderHandler(t.TempDir(), provider.DefaultExtensions)
+			handler.SetPasswordPolicy(&service.PasswordPolicy{MinLength: 8})
+
+			req := uploadRequest(t, "restored.json", []byte(`{"entries": [{"title": "a", "password": "p"}]}`), tt.password)
+			req.URL.Path = "/api/providers/static/import"
+			w := httptest.NewRecorder()
+			handler.Route(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d. Body: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantCode == http.StatusBadRequest {
+				var body models.ErrorResponse
+				json.NewDecoder(w.Body).Decode(&body)
+				if body.Code != models.ErrorCodeWeakPassword {
+					t.Errorf("Expected code %s, got %q", models.ErrorCodeWeakPassword, body.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+)
+
+// Auth returns middleware that requires "Authorization: Bearer <token>" on
+// every request. An empty token disables the check, so setups without
+// PWSAFE_API_TOKEN keep working unchanged.
+func Auth(token string) func(http.HandlerFunc) http.HandlerFunc {
+	// Comparing digests keeps the comparison constant-time regardless of length
+	expected := sha256.Sum256([]byte(token))
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if token == "" {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			scheme, presented, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			got := sha256.Sum256([]byte(presented))
+			if !strings.EqualFold(scheme, "Bearer") || subtle.ConstantTimeCompare(got[:], expected[:]) != 1 {
+				// Tells clients this 401 is about the API token, not a master password
+				w.Header().Set("WWW-Authenticate", `Bearer realm="pwsafe-service"`)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(models.ErrorResponse{
+					Error: "Missing or invalid API token",
+					Code:  models.ErrorCodeUnauthorized,
+				})
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORS_Headers(t *testing.T) {
+	handler := CORS(func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodOptions, "/api/safes", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected preflight status 200, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(allow, "Idempotency-Key") {
+		t.Errorf("Expected Idempotency-Key to be allowed, got %q", allow)
+	}
+	expose := w.Header().Get("Access-Control-Expose-Headers")
+	for _, header := range []string{"Retry-After", "Idempotent-Replayed"} {
+		if !strings.Contains(expose, header) {
+			t.Errorf("Expected %s to be exposed, got %q", header, expose)
+		}
+	}
+}
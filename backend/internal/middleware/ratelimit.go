@@ -1,39 +1,173 @@
 package middleware
 
 import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
 	"golang.org/x/time/rate"
 )
 
+const (
+	defaultIdleTimeout = 10 * time.Minute
+	// janitorInterval is how often idle visitors are looked for
+	janitorInterval = time.Minute
+)
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+	elem     *list.Element // Position in RateLimiter.order
+}
+
 type RateLimiter struct {
-	visitors map[string]*rate.Limiter
-	mu       sync.RWMutex
-	rate     rate.Limit
-	burst    int
+	visitors    map[string]*visitor
+	order       *list.List // Visitor IPs, least recently seen first
+	mu          sync.RWMutex
+	rate        rate.Limit
+	burst       int
+	maxVisitors int           // 0 means unbounded
+	idleTimeout time.Duration // Visitors unseen this long are forgotten
+	bypass      []*net.IPNet  // Clients in these ranges are never limited
+
+	now      func() time.Time // Replaced in tests
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
+// NewRateLimiter starts a janitor that forgets visitors idle for ten minutes;
+// call Stop to end it
 func NewRateLimiter(r rate.Limit, b int) *RateLimiter {
-	return &RateLimiter{
-		visitors: make(map[string]*rate.Limiter),
-		rate:     r,
-		burst:    b,
+	rl := &RateLimiter{
+		visitors:    make(map[string]*visitor),
+		order:       list.New(),
+		rate:        r,
+		burst:       b,
+		idleTimeout: defaultIdleTimeout,
+		now:         time.Now,
+		stop:        make(chan struct{}),
+	}
+	go rl.janitor()
+	return rl
+}
+
+// Stop ends the idle visitor janitor. The limiter keeps working, but idle
+// visitors are then only dropped by the SetMaxVisitors cap.
+func (rl *RateLimiter) Stop() {
+	rl.stopOnce.Do(func() { close(rl.stop) })
+}
+
+// SetIdleTimeout sets how long a client IP may go without a request before
+// it is forgotten. A forgotten client starts again with a full burst, which
+// it would have regained long before anyway. Non-positive values are ignored.
+func (rl *RateLimiter) SetIdleTimeout(d time.Duration) {
+	if d <= 0 {
+		return
 	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.idleTimeout = d
+}
+
+func (rl *RateLimiter) janitor() {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rl.stop:
+			return
+		case <-ticker.C:
+			rl.evictIdle()
+		}
+	}
+}
+
+// evictIdle drops every visitor not seen within the idle timeout
+func (rl *RateLimiter) evictIdle() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	cutoff := rl.now().Add(-rl.idleTimeout)
+	for ip, v := range rl.visitors {
+		if v.lastSeen.Before(cutoff) {
+			rl.order.Remove(v.elem)
+			delete(rl.visitors, ip)
+		}
+	}
+}
+
+// SetMaxVisitors caps how many client IPs are tracked at once. When the cap
+// is reached the least recently seen visitor is evicted, so memory stays bounded even
+// when requests arrive from many distinct addresses.
+func (rl *RateLimiter) SetMaxVisitors(n int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.maxVisitors = n
+	rl.evictOverflow()
+}
+
+// evictOverflow drops the least recently seen visitors until the cap is
+// respected. The caller must hold rl.mu.
+func (rl *RateLimiter) evictOverflow() {
+	for rl.maxVisitors > 0 && rl.order.Len() > rl.maxVisitors {
+		oldest := rl.order.Front()
+		rl.order.Remove(oldest)
+		delete(rl.visitors, oldest.Value.(string))
+	}
+}
+
+// SetBypass exempts clients in the given CIDRs (e.g. "127.0.0.0/8") from the
+// limit. Intended for local development; limits apply everywhere by default.
+func (rl *RateLimiter) SetBypass(cidrs []string) error {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return fmt.Errorf("invalid rate limit bypass CIDR %q: %w", cidr, err)
+		}
+		nets = append(nets, n)
+	}
+	rl.bypass = nets
+	return nil
+}
+
+func (rl *RateLimiter) isBypassed(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range rl.bypass {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
 }
 
 func (rl *RateLimiter) getVisitor(ip string) *rate.Limiter {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	limiter, exists := rl.visitors[ip]
+	v, exists := rl.visitors[ip]
 	if !exists {
-		limiter = rate.NewLimiter(rl.rate, rl.burst)
-		rl.visitors[ip] = limiter
+		v = &visitor{limiter: rate.NewLimiter(rl.rate, rl.burst)}
+		v.elem = rl.order.PushBack(ip)
+		rl.visitors[ip] = v
+		rl.evictOverflow()
 	}
+	v.lastSeen = rl.now()
+	rl.order.MoveToBack(v.elem)
 
-	return limiter
+	return v.limiter
 }
 
 func (rl *RateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
@@ -43,9 +177,25 @@ func (rl *RateLimiter) Limit(next http.HandlerFunc) http.HandlerFunc {
 			ip = r.RemoteAddr
 		}
 
-		limiter := rl.getVisitor(ip)
-		if !limiter.Allow() {
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		if rl.isBypassed(ip) {
+			next(w, r)
+			return
+		}
+
+		// A reservation that would have to wait is refused like Allow would,
+		// but says how long until the next token so clients can back off
+		reservation := rl.getVisitor(ip).Reserve()
+		if delay := reservation.Delay(); !reservation.OK() || delay > 0 {
+			reservation.Cancel()
+			if reservation.OK() {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(models.ErrorResponse{
+				Error: "Rate limit exceeded",
+				Code:  models.ErrorCodeRateLimited,
+			})
 			return
 		}
 
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+	"golang.org/x/time/rate"
+)
+
+func TestLimit_RetryAfter(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	// One request every two seconds, with no burst beyond the first
+	handler := NewRateLimiter(rate.Every(2*time.Second), 1).Limit(ok)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/safes", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	if w := send(); w.Code != http.StatusNoContent || w.Header().Get("Retry-After") != "" {
+		t.Fatalf("Expected the first request through, got %d (Retry-After %q)", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	w := send()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", got)
+	}
+	var body models.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.Code != models.ErrorCodeRateLimited {
+		t.Errorf("Expected a RATE_LIMITED JSON body, got %+v (err: %v)", body, err)
+	}
+
+	// A refused request must not use up the next token
+	if w := send(); w.Header().Get("Retry-After") != "2" {
+		t.Errorf("Expected refusals not to push the wait back, got Retry-After %q", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestEvictIdle(t *testing.T) {
+	rl := NewRateLimiter(rate.Limit(5), 5)
+	defer rl.Stop()
+	rl.SetIdleTimeout(10 * time.Minute)
+
+	now := time.Now()
+	rl.now = func() time.Time { return now }
+	rl.getVisitor("192.0.2.1")
+	rl.getVisitor("192.0.2.2")
+
+	now = now.Add(6 * time.Minute)
+	rl.getVisitor("192.0.2.3")
+	rl.getVisitor("192.0.2.2") // Seen again, so idle for less than the timeout
+
+	now = now.Add(5 * time.Minute)
+	rl.evictIdle()
+
+	if _, ok := rl.visitors["192.0.2.1"]; ok {
+		t.Error("Expected the idle visitor to be evicted")
+	}
+	if len(rl.visitors) != 2 || rl.order.Len() != 2 {
+		t.Errorf("Expected 2 recent visitors to remain, have %d (order %d)", len(rl.visitors), rl.order.Len())
+	}
+	if front := rl.order.Front().Value.(string); front != "192.0.2.3" {
+		t.Errorf("Expected 192.0.2.3 to be the least recently seen visitor, got %s", front)
+	}
+}
+
+func TestSetMaxVisitors(t *testing.T) {
+	rl := NewRateLimiter(rate.Limit(5), 5)
+	defer rl.Stop()
+	rl.SetMaxVisitors(2)
+
+	rl.getVisitor("192.0.2.1")
+	rl.getVisitor("192.0.2.2")
+	rl.getVisitor("192.0.2.1") // Seen again, so 192.0.2.2 is now the least recent
+	rl.getVisitor("192.0.2.3")
+
+	if _, ok := rl.visitors["192.0.2.2"]; ok {
+		t.Error("Expected the least recently seen visitor to be evicted")
+	}
+	for _, ip := range []string{"192.0.2.1", "192.0.2.3"} {
+		if _, ok := rl.visitors[ip]; !ok {
+			t.Errorf("Expected %s to be kept", ip)
+		}
+	}
+	if len(rl.visitors) != 2 || rl.order.Len() != 2 {
+		t.Fatalf("Expected 2 visitors, have %d (order %d)", len(rl.visitors), rl.order.Len())
+	}
+	for e := rl.order.Front(); e != nil; e = e.Next() {
+		if v, ok := rl.visitors[e.Value.(string)]; !ok || v.elem != e {
+			t.Errorf("Expected %s in order to match its visitor", e.Value)
+		}
+	}
+
+	// Lowering the cap evicts right away
+	rl.SetMaxVisitors(1)
+	if _, ok := rl.visitors["192.0.2.3"]; !ok || len(rl.visitors) != 1 || rl.order.Len() != 1 {
+		t.Errorf("Expected only 192.0.2.3 to remain, have %d (order %d)", len(rl.visitors), rl.order.Len())
+	}
+}
+
+func TestSetBypass(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	rl := NewRateLimiter(rate.Every(time.Hour), 1)
+	defer rl.Stop()
+	if err := rl.SetBypass([]string{"127.0.0.0/8", " 10.0.0.0/8 "}); err != nil {
+		t.Fatalf("SetBypass failed: %v", err)
+	}
+	handler := rl.Limit(ok)
+
+	send := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/safes", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := send("127.0.0.1:1234"); code != http.StatusNoContent {
+			t.Fatalf("Expected a bypassed client never to be limited, got %d on request %d", code, i+1)
+		}
+	}
+	if _, tracked := rl.visitors["127.0.0.1"]; tracked {
+		t.Error("Expected a bypassed client not to be tracked")
+	}
+
+	if code := send("192.0.2.1:1234"); code != http.StatusNoContent {
+		t.Fatalf("Expected the first request through, got %d", code)
+	}
+	if code := send("192.0.2.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected a client outside the bypass to be limited, got %d", code)
+	}
+
+	if err := rl.SetBypass([]string{"127.0.0.0/8", "not-a-cidr"}); err == nil || !strings.Contains(err.Error(), "not-a-cidr") {
+		t.Errorf("Expected an invalid CIDR error, got %v", err)
+	}
+	if !rl.isBypassed("127.0.0.1") {
+		t.Error("Expected a failed SetBypass to keep the previous ranges")
+	}
+}
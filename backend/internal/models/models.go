@@ -1,12 +1,19 @@
 package models
 
-import "time"
+import (
+	"net/http"
+	"time"
+)
 
 type SafeFile struct {
 	Name         string    `json:"name"`
 	Path         string    `json:"path"`
 	LastModified time.Time `json:"lastModified"`
 	Provider     string    `json:"provider"`
+	Writable     bool      `json:"writable"`           // Entry edits are supported (static safes only; synced copies are overwritten on sync)
+	Shadowed     bool      `json:"shadowed,omitempty"` // An earlier-listed safe has the same name and takes precedence
+	Valid        *bool     `json:"valid,omitempty"`    // File is laid out like a complete v3 safe; only set when listed with ?verify=true
+	Sources      []string  `json:"sources,omitempty"`  // Providers holding an identical copy, this one first; only set when listed with ?dedupe=true
 }
 
 type Group struct {
@@ -16,33 +23,171 @@ type Group struct {
 }
 
 type Entry struct {
-	UUID     string `json:"uuid"`
-	Title    string `json:"title"`
-	Username string `json:"username"`
-	URL      string `json:"url,omitempty"`
-	Notes    string `json:"notes,omitempty"`
+	UUID        string            `json:"uuid"`
+	Title       string            `json:"title"`
+	Username    string            `json:"username"`
+	URL         string            `json:"url,omitempty"`
+	Notes       string            `json:"notes,omitempty"`
+	ExtraFields map[string]string `json:"extraFields,omitempty"`
+	HasTOTP     bool              `json:"hasTOTP,omitempty"`  // Entry carries a TOTP secret; the secret itself is never included
+	Password    string            `json:"password,omitempty"` // Only populated by export
+
+	CreatedAt         *time.Time `json:"createdAt,omitempty"`         // Record creation time, if the safe records it
+	ModifiedAt        *time.Time `json:"modifiedAt,omitempty"`        // Record modification time, if the safe records it
+	PasswordChangedAt *time.Time `json:"passwordChangedAt,omitempty"` // When the password itself last changed, if the safe records it
 }
 
+// EntryFields are the JSON names of the Entry fields an unlock can be limited
+// to with ?fields=. The UUID is always included.
+var EntryFields = []string{"title", "username", "url", "notes", "extraFields", "hasTOTP", "createdAt", "modifiedAt", "passwordChangedAt"}
+
 type SafeStructure struct {
 	Groups  []*Group `json:"groups"`
 	Entries []Entry  `json:"entries"`
 }
 
+// ChangedEntry is an entry reported by the changes endpoint
+type ChangedEntry struct {
+	Entry
+	Group string `json:"group"` // Dotted group path; empty for root entries
+}
+
+// SafeChanges lists the entries modified after Since, oldest first
+type SafeChanges struct {
+	Since   time.Time      `json:"since"`
+	Entries []ChangedEntry `json:"entries"`
+}
+
+// SafeDiagnostics summarizes how a safe's raw records map onto the tree.
+// It intentionally carries counts only - never titles or secrets.
+type SafeDiagnostics struct {
+	RawRecordCount    int            `json:"rawRecordCount"`
+	TreeEntryCount    int            `json:"treeEntryCount"`
+	RootEntryCount    int            `json:"rootEntryCount"`
+	GroupedEntryCount int            `json:"groupedEntryCount"`
+	GroupCount        int            `json:"groupCount"`
+	Issues            map[string]int `json:"issues,omitempty"` // issue -> number of affected records
+}
+
+// SafeInfo summarizes a safe from its header and record count, without entries
+type SafeInfo struct {
+	RecordCount int        `json:"recordCount"`
+	LastSaved   *time.Time `json:"lastSaved,omitempty"`   // Omitted when the header has no save time
+	LastSavedBy string     `json:"lastSavedBy,omitempty"` // Application that last saved the safe
+}
+
 type UnlockRequest struct {
-	Password string `json:"password"`
+	Password      string `json:"password"`
+	Keyfile       string `json:"keyfile,omitempty"`       // Name of a server-side file holding the password, instead of Password
+	Session       string `json:"session,omitempty"`       // Token from an earlier unlock, instead of Password
+	CreateSession bool   `json:"createSession,omitempty"` // Issue a session token on success, when sessions are enabled
 }
 
 type EntryPasswordRequest struct {
 	Password  string `json:"password"`
+	Keyfile   string `json:"keyfile,omitempty"` // Name of a server-side file holding the password, instead of Password
+	Session   string `json:"session,omitempty"` // Token from an earlier unlock, instead of Password
 	EntryUUID string `json:"entryUuid"`
 }
 
+type MoveEntryRequest struct {
+	Password string `json:"password"`
+	Group    string `json:"group"`
+}
+
+// EntryUpdate holds the entry fields to change. Nil fields are left untouched.
+type EntryUpdate struct {
+	Title    *string `json:"title,omitempty"`
+	Username *string `json:"username,omitempty"`
+	URL      *string `json:"url,omitempty"`
+	Notes    *string `json:"notes,omitempty"`
+	Password *string `json:"password,omitempty"` // The entry's password, not the master password
+}
+
+type UpdateEntryRequest struct {
+	Password string      `json:"password"`
+	Fields   EntryUpdate `json:"fields"`
+}
+
 type EntryPasswordResponse struct {
 	Password string `json:"password"`
 }
 
+// PasswordStrength rates an entry's password without revealing it
+type PasswordStrength struct {
+	Score  int    `json:"score"`  // 0 (very weak) to 4 (very strong)
+	Length string `json:"length"` // One of the Length* buckets
+}
+
+// TOTPCode is an entry's current one-time code, generated from its stored
+// secret. The secret itself is never returned.
+type TOTPCode struct {
+	Code     string `json:"code"`
+	ValidFor int    `json:"validFor"` // Seconds until the code changes
+}
+
+// Password length buckets reported in PasswordStrength.Length
+const (
+	LengthEmpty    = "empty"
+	LengthShort    = "short"     // 1-7 characters
+	LengthMedium   = "medium"    // 8-11
+	LengthLong     = "long"      // 12-19
+	LengthVeryLong = "very_long" // 20+
+)
+
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error string `json:"error"`          // Human-readable message
+	Code  string `json:"code,omitempty"` // Stable machine-readable code, one of the ErrorCode* constants
+}
+
+// Machine-readable error codes returned in ErrorResponse.Code
+const (
+	ErrorCodeValidation       = "VALIDATION"
+	ErrorCodeUnauthorized     = "UNAUTHORIZED"
+	ErrorCodeReauthRequired   = "REAUTH_REQUIRED"
+	ErrorCodeForbidden        = "FORBIDDEN"
+	ErrorCodeNotFound         = "NOT_FOUND"
+	ErrorCodeSafeNotFound     = "SAFE_NOT_FOUND"
+	ErrorCodeEntryNotFound    = "ENTRY_NOT_FOUND"
+	ErrorCodeNoTOTP           = "NO_TOTP"
+	ErrorCodeProviderNotFound = "PROVIDER_NOT_FOUND"
+	ErrorCodeSafeTooLarge     = "SAFE_TOO_LARGE"
+	ErrorCodeUnsupportedSafe  = "UNSUPPORTED_FORMAT"
+	ErrorCodeSessionExpired   = "SESSION_EXPIRED"
+	ErrorCodeWeakPassword     = "WEAK_PASSWORD"
+	ErrorCodeSyncInProgress   = "SYNC_IN_PROGRESS"
+	ErrorCodeSyncTimeout      = "SYNC_TIMEOUT"
+	ErrorCodeReadOnly         = "READ_ONLY"
+	ErrorCodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	ErrorCodeConflict         = "CONFLICT"
+	ErrorCodeRateLimited      = "RATE_LIMITED"
+	ErrorCodeNotSupported     = "NOT_SUPPORTED"
+	ErrorCodeInternal         = "INTERNAL"
+)
+
+// ErrorCodeForStatus returns the generic error code for an HTTP status.
+// Handlers pass a more specific code where one applies.
+func ErrorCodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+		return ErrorCodeValidation
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrorCodeForbidden
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrorCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrorCodeConflict
+	case http.StatusTooManyRequests:
+		return ErrorCodeRateLimited
+	case http.StatusNotImplemented:
+		return ErrorCodeNotSupported
+	default:
+		return ErrorCodeInternal
+	}
 }
 
 // OneDrive models
@@ -0,0 +1,176 @@
+// Package outbound guards server-initiated HTTP requests (provider APIs,
+// webhooks) against being pointed at internal services.
+package outbound
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	dialTimeout = 10 * time.Second
+	// clientTimeout bounds a whole request made with Client, including
+	// reading the body, in case the caller's context has no deadline
+	clientTimeout = 30 * time.Second
+)
+
+// Guard decides which IP addresses outbound requests may connect to.
+// Private, loopback, link-local, shared and unspecified addresses are always blocked,
+// along with any extra blocked ranges, unless an allowed range matches first.
+type Guard struct {
+	allow        []*net.IPNet
+	block        []*net.IPNet
+	allowPrivate bool // skip the built-in private ranges, keeping block
+
+	privateOnce sync.Once
+	private     *Guard // Built by AllowingPrivate on first use
+
+	clientOnce sync.Once
+	client     *http.Client // Built by Client on first use
+}
+
+// NewGuard builds a guard from CIDR strings (e.g. "10.0.0.0/8"). Allowed ranges
+// take precedence so self-hosters can reach internal storage on purpose.
+func NewGuard(allow, block []string) (*Guard, error) {
+	allowNets, err := parseCIDRs(allow)
+	if err != nil {
+		return nil, err
+	}
+	blockNets, err := parseCIDRs(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Guard{allow: allowNets, block: blockNets}, nil
+}
+
+// Default returns a guard that blocks only the built-in private ranges
+func Default() *Guard {
+	return &Guard{}
+}
+
+// permissive is shared so its client, and the connections it pools, are too
+var permissive = func() *Guard {
+	_, v4, _ := net.ParseCIDR("0.0.0.0/0")
+	_, v6, _ := net.ParseCIDR("::/0")
+	return &Guard{allow: []*net.IPNet{v4, v6}}
+}()
+
+// Permissive returns a guard that allows every address
+func Permissive() *Guard {
+	return permissive
+}
+
+// AllowingPrivate returns a guard like g that also allows the built-in private
+// ranges, for targets an operator has opted into such as a LAN webhook. The
+// allowed and blocked ranges still apply. The guard is built once, so its
+// client is shared too.
+func (g *Guard) AllowingPrivate() *Guard {
+	g.privateOnce.Do(func() {
+		g.private = &Guard{allow: g.allow, block: g.block, allowPrivate: true}
+	})
+	return g.private
+}
+
+// Check returns an error if ip may not be connected to
+func (g *Guard) Check(ip net.IP) error {
+	if ip == nil {
+		return fmt.Errorf("outbound target is not an IP address")
+	}
+	for _, n := range g.allow {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+	if !g.allowPrivate && isPrivateIP(ip) {
+		return fmt.Errorf("outbound target %s is a private address", ip)
+	}
+	for _, n := range g.block {
+		if n.Contains(ip) {
+			return fmt.Errorf("outbound target %s is in blocked range %s", ip, n)
+		}
+	}
+	return nil
+}
+
+// Client returns the guard's HTTP client, whose connections are checked
+// against the guard. The check runs at dial time on the resolved address, so
+// it also covers redirects and DNS answers. The client is built once per guard
+// so connections are reused, and gives up on a request after clientTimeout.
+func (g *Guard) Client() *http.Client {
+	g.clientOnce.Do(func() {
+		g.client = g.ClientWithRootCAs(nil)
+		g.client.Timeout = clientTimeout
+	})
+	return g.client
+}
+
+// ClientWithRootCAs returns a new client like Client's that verifies servers
+// against rootCAs when non-nil. It has no overall timeout, since provider
+// downloads can legitimately take long - callers use contexts. Like Client's,
+// it connects directly, ignoring proxy environment variables.
+func (g *Guard) ClientWithRootCAs(rootCAs *x509.CertPool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: dialTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			return g.Check(net.ParseIP(host))
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Through a proxy the dial check would only ever see the proxy's address,
+	// never the real target, so HTTP(S)_PROXY is ignored
+	transport.Proxy = nil
+	if rootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+	return &http.Client{Transport: transport}
+}
+
+// reservedNets are blocked alongside the ranges net.IP classifies itself:
+// shared address space (CGNAT, often VPN and Tailscale services) and "this
+// network", which some systems route to the local host
+var reservedNets = func() []*net.IPNet {
+	nets, _ := parseCIDRs([]string{"100.64.0.0/10", "0.0.0.0/8"})
+	return nets
+}()
+
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		_, n, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
@@ -0,0 +1,138 @@
+package outbound
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGuard_DefaultBlocksPrivateRanges(t *testing.T) {
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"::1", true},
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"100.64.0.1", true},
+		{"100.127.255.255", true},
+		{"100.63.255.255", false},
+		{"100.128.0.1", false},
+		{"8.8.8.8", false},
+		{"2606:4700:4700::1111", false},
+	}
+
+	g := Default()
+	for _, tt := range tests {
+		err := g.Check(net.ParseIP(tt.ip))
+		if (err != nil) != tt.blocked {
+			t.Errorf("Check(%s) error = %v, expected blocked=%v", tt.ip, err, tt.blocked)
+		}
+	}
+}
+
+func TestGuard_AllowAndBlockLists(t *testing.T) {
+	g, err := NewGuard([]string{"10.0.5.0/24"}, []string{"203.0.113.0/24"})
+	if err != nil {
+		t.Fatalf("NewGuard failed: %v", err)
+	}
+
+	if err := g.Check(net.ParseIP("10.0.5.9")); err != nil {
+		t.Errorf("Expected allowlisted private address to pass, got: %v", err)
+	}
+	if err := g.Check(net.ParseIP("10.0.6.9")); err == nil {
+		t.Error("Expected private address outside the allowlist to be blocked")
+	}
+	if err := g.Check(net.ParseIP("203.0.113.7")); err == nil {
+		t.Error("Expected address in extra blocked range to be blocked")
+	}
+}
+
+func TestGuard_AllowingPrivateKeepsBlocks(t *testing.T) {
+	g, err := NewGuard(nil, []string{"10.9.0.0/16"})
+	if err != nil {
+		t.Fatalf("NewGuard failed: %v", err)
+	}
+	private := g.AllowingPrivate()
+
+	if err := private.Check(net.ParseIP("192.168.1.1")); err != nil {
+		t.Errorf("Expected private address to pass, got: %v", err)
+	}
+	if err := private.Check(net.ParseIP("10.9.1.1")); err == nil {
+		t.Error("Expected the configured block to still apply")
+	}
+	if err := g.Check(net.ParseIP("192.168.1.1")); err == nil {
+		t.Error("Expected the original guard to keep blocking private addresses")
+	}
+	if g.AllowingPrivate() != private {
+		t.Error("Expected the private-allowing guard to be built once")
+	}
+}
+
+func TestNewGuard_InvalidCIDR(t *testing.T) {
+	if _, err := NewGuard([]string{"not-a-cidr"}, nil); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+func TestGuard_ClientRefusesLoopback(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer server.Close()
+
+	if _, err := Default().Client().Get(server.URL); err == nil {
+		t.Error("Expected loopback request to be refused")
+	}
+	if hits != 0 {
+		t.Errorf("Expected no requests to reach the server, got %d", hits)
+	}
+
+	resp, err := Permissive().Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected permissive client to connect, got: %v", err)
+	}
+	resp.Body.Close()
+	if hits != 1 {
+		t.Errorf("Expected 1 request to reach the server, got %d", hits)
+	}
+}
+
+func TestGuard_ClientIsShared(t *testing.T) {
+	g := Default()
+	client := g.Client()
+	if client != g.Client() {
+		t.Error("Expected one client per guard")
+	}
+	if client.Timeout != clientTimeout {
+		t.Errorf("Expected a %s timeout, got %s", clientTimeout, client.Timeout)
+	}
+	if Default().Client() == client {
+		t.Error("Expected another guard to have its own client")
+	}
+	if Permissive().Client() != Permissive().Client() {
+		t.Error("Expected the permissive guard's client to be shared")
+	}
+}
+
+func TestGuard_ClientIgnoresProxyEnvironment(t *testing.T) {
+	// A proxy would hide the real target from the dial-time check
+	for name, client := range map[string]*http.Client{
+		"Client":            Default().Client(),
+		"ClientWithRootCAs": Default().ClientWithRootCAs(nil),
+	} {
+		transport, ok := client.Transport.(*http.Transport)
+		if !ok {
+			t.Fatalf("%s: expected an *http.Transport, got %T", name, client.Transport)
+		}
+		if transport.Proxy != nil {
+			t.Errorf("%s: expected no proxy", name)
+		}
+	}
+}
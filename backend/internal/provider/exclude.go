@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ExcludePatterns are globs (path.Match syntax) for remote files that are never
+// listed or synced. A pattern without a slash matches a file or folder name
+// anywhere, e.g. "*template*". A pattern with a slash matches the full path of
+// a file or folder from the root, e.g. "/Archive" or "/Work/*.old.psafe3".
+// Matching is case-insensitive. Excluding a folder excludes everything under it.
+type ExcludePatterns []string
+
+// Validate reports the first malformed pattern
+func (e ExcludePatterns) Validate() error {
+	for _, pattern := range e {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Match reports whether the file, or any folder it's in, matches a pattern
+func (e ExcludePatterns) Match(file RemoteFile) bool {
+	if len(e) == 0 {
+		return false
+	}
+
+	full := path.Join("/", file.Path, file.Name)
+	for _, pattern := range e {
+		pattern = strings.ToLower(pattern)
+		anchored := strings.Contains(pattern, "/")
+		if anchored {
+			pattern = path.Join("/", pattern)
+		}
+		// Walk up from the file itself through each parent folder
+		for p := strings.ToLower(full); p != "/"; p = path.Dir(p) {
+			subject := path.Base(p)
+			if anchored {
+				subject = p
+			}
+			if ok, _ := path.Match(pattern, subject); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package provider
+
+import "testing"
+
+func TestExcludePatterns_Match(t *testing.T) {
+	patterns := ExcludePatterns{"*template*", "/Archive", "/Work/*.old.psafe3"}
+
+	tests := []struct {
+		path, name string
+		want       bool
+	}{
+		{"/Documents", "passwords.psafe3", false},
+		{"/Documents", "Template.psafe3", true},      // name glob, any depth, case-insensitive
+		{"/Templates/Safes", "mine.psafe3", true},    // name glob matches a folder
+		{"/Archive", "2019.psafe3", true},            // anchored folder
+		{"/Archive/Deep", "2019.psafe3", true},       // everything under it
+		{"/Documents/Archive", "2019.psafe3", false}, // anchored, so not nested folders
+		{"/Work", "team.old.psafe3", true},
+		{"/Work/Sub", "team.old.psafe3", false},
+	}
+	for _, tt := range tests {
+		got := patterns.Match(RemoteFile{Path: tt.path, Name: tt.name})
+		if got != tt.want {
+			t.Errorf("Match(%s/%s) = %v, want %v", tt.path, tt.name, got, tt.want)
+		}
+	}
+
+	if (ExcludePatterns{}).Match(RemoteFile{Path: "/", Name: "a.psafe3"}) {
+		t.Error("Expected no patterns to match nothing")
+	}
+}
+
+func TestExcludePatterns_Validate(t *testing.T) {
+	if err := (ExcludePatterns{"*.bak", "/Archive"}).Validate(); err != nil {
+		t.Errorf("Expected valid patterns, got %v", err)
+	}
+	if err := (ExcludePatterns{"[unclosed"}).Validate(); err == nil {
+		t.Error("Expected malformed pattern to be rejected")
+	}
+}
@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Extensions is the set of file extensions recognized as Password Safe files
+type Extensions []string
+
+// DefaultExtensions is used when no extension set is configured
+var DefaultExtensions = Extensions{".psafe3"}
+
+// ParseExtensions normalizes configured extensions to lowercase with a leading
+// dot, dropping blanks. Returns DefaultExtensions if nothing remains.
+func ParseExtensions(values []string) Extensions {
+	var exts Extensions
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" || value == "." {
+			continue
+		}
+		if !strings.HasPrefix(value, ".") {
+			value = "." + value
+		}
+		exts = append(exts, value)
+	}
+	if len(exts) == 0 {
+		return DefaultExtensions
+	}
+	return exts
+}
+
+// Match reports whether name has one of the extensions.
+// Matching is case- and accent-insensitive and ignores trailing whitespace, dots and invisible
+// format characters that some filesystems and sync clients leave on names.
+func (e Extensions) Match(name string) bool {
+	trimmed := strings.TrimRightFunc(name, func(r rune) bool {
+		return r == '.' || unicode.IsSpace(r) || unicode.Is(unicode.Cf, r)
+	})
+	ext := filepath.Ext(trimmed)
+	if ext == "" {
+		return false
+	}
+	for _, allowed := range e {
+		if SameName(ext, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSafeFile reports whether name looks like a Password Safe file using DefaultExtensions
+func IsSafeFile(name string) bool {
+	return DefaultExtensions.Match(name)
+}
+
+// FoldName returns name lowercased with its accents removed, so names that
+// differ only in case, Unicode normalization form or diacritics compare equal
+func FoldName(name string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, name)
+	if err != nil {
+		folded = name
+	}
+	return strings.ToLower(folded)
+}
+
+// SameName reports whether a and b are the same file name once folded
+func SameName(a, b string) bool {
+	return FoldName(a) == FoldName(b)
+}
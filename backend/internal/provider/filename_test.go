@@ -0,0 +1,73 @@
+package provider
+
+import "testing"
+
+func TestIsSafeFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"passwords.psafe3", true},
+		{"PASSWORDS.PSAFE3", true},
+		{"Passwords.PSafe3", true},
+		{"passwords.psafe3 ", true},
+		{"passwords.psafe3.", true},
+		{"passwords.psafe3\u200b", true},
+		{"passwords.psafe3\t", true},
+		{"passwords.psafe3.bak", false},
+		{"passwords.psafe", false},
+		{"psafe3", false},
+		{".psafe3.txt", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsSafeFile(tt.name); got != tt.expected {
+			t.Errorf("IsSafeFile(%q) = %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestExtensions_Match(t *testing.T) {
+	exts := Extensions{".psafe3", ".psafe", ".dat"}
+
+	for _, name := range []string{"a.psafe3", "a.PSAFE", "a.dat", "a.Dat ", "a.dät"} {
+		if !exts.Match(name) {
+			t.Errorf("Expected %q to match %v", name, exts)
+		}
+	}
+	for _, name := range []string{"a.txt", "a", "a.psafe3.bak"} {
+		if exts.Match(name) {
+			t.Errorf("Expected %q to not match %v", name, exts)
+		}
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	got := ParseExtensions([]string{" PSAFE3 ", ".Dat", "", "."})
+	if len(got) != 2 || got[0] != ".psafe3" || got[1] != ".dat" {
+		t.Errorf("Expected [.psafe3 .dat], got %v", got)
+	}
+
+	if got := ParseExtensions(nil); len(got) != 1 || got[0] != ".psafe3" {
+		t.Errorf("Expected default extensions for empty config, got %v", got)
+	}
+}
+
+func TestSameName(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"cafe.psafe3", "Café.psafe3", true},
+		{"Cafe\u0301.psafe3", "café.PSAFE3", true},
+		{"Ünïcödé.psafe3", "unicode.psafe3", true},
+		{"cafe.psafe3", "cafes.psafe3", false},
+	}
+
+	for _, tt := range tests {
+		if got := SameName(tt.a, tt.b); got != tt.expected {
+			t.Errorf("SameName(%q, %q) = %v, expected %v", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Headers are extra HTTP headers sent on every request a provider makes, e.g.
+// for an auth proxy in front of self-hosted storage. Values often hold tokens,
+// so formatting Headers (%v, %s) prints only the names.
+type Headers map[string]string
+
+// reservedHeaders are managed by the HTTP client and can't be overridden
+var reservedHeaders = []string{"Host", "Content-Length", "Transfer-Encoding", "Connection"}
+
+// Validate reports the first header that can't be sent as given
+func (h Headers) Validate() error {
+	for name, value := range h {
+		if !isHeaderToken(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if slices.Contains(reservedHeaders, http.CanonicalHeaderKey(name)) {
+			return fmt.Errorf("header %s cannot be set", http.CanonicalHeaderKey(name))
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("invalid value for header %s", http.CanonicalHeaderKey(name))
+		}
+	}
+	return nil
+}
+
+// String lists the header names with their values redacted
+func (h Headers) String() string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, http.CanonicalHeaderKey(name)+": [redacted]")
+	}
+	slices.Sort(names)
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// Client returns a copy of client that adds the headers to each request to
+// one of hosts (host[:port], as in a URL). Requests elsewhere, such as a
+// redirect to a download CDN, get none, so a token meant for the provider's
+// proxy doesn't leak to other servers. Headers the provider sets itself,
+// such as Authorization, take precedence.
+func (h Headers) Client(client *http.Client, hosts []string) *http.Client {
+	if len(h) == 0 {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	wrapped := *client
+	wrapped.Transport = &headerTransport{base: base, headers: h, hosts: hosts}
+	return &wrapped
+}
+
+type headerTransport struct {
+	base    http.RoundTripper
+	headers Headers
+	hosts   []string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !slices.ContainsFunc(t.hosts, func(host string) bool { return strings.EqualFold(host, req.URL.Host) }) {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, value)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// isHeaderToken reports whether name is a valid RFC 9110 field name
+func isHeaderToken(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHeaders_Validate(t *testing.T) {
+	tests := []struct {
+		headers Headers
+		wantErr bool
+	}{
+		{Headers{"X-Proxy-Auth": "token"}, false},
+		{Headers{"Proxy-Authorization": "Bearer abc"}, false},
+		{Headers{"Bad Name": "x"}, true},
+		{Headers{"": "x"}, true},
+		{Headers{"host": "evil.example"}, true},
+		{Headers{"X-Proxy-Auth": "a\r\nX-Injected: b"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.headers.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%v) error = %v, wantErr %v", tt.headers, err, tt.wantErr)
+		}
+	}
+}
+
+func TestHeaders_Client(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	headers := Headers{"X-Proxy-Auth": "secret-token", "Authorization": "from-settings"}
+	client := headers.Client(server.Client(), []string{server.Listener.Addr().String()})
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Authorization", "Bearer provider")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if got.Get("X-Proxy-Auth") != "secret-token" {
+		t.Errorf("Expected custom header to be sent, got %v", got)
+	}
+	if got.Get("Authorization") != "Bearer provider" {
+		t.Errorf("Expected provider's Authorization to win, got %q", got.Get("Authorization"))
+	}
+	if req.Header.Get("X-Proxy-Auth") != "" {
+		t.Error("Expected the caller's request to be left unmodified")
+	}
+}
+
+func TestHeaders_ClientOnlyToProviderHosts(t *testing.T) {
+	var elsewhere http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		elsewhere = r.Header.Clone()
+	}))
+	defer other.Close()
+	var api http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api = r.Header.Clone()
+		http.Redirect(w, r, other.URL+"/download", http.StatusFound)
+	}))
+	defer server.Close()
+
+	headers := Headers{"X-Proxy-Auth": "secret-token", "Authorization": "Bearer from-settings"}
+	client := headers.Client(server.Client(), []string{server.Listener.Addr().String()})
+	resp, err := client.Get(server.URL + "/content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if api.Get("X-Proxy-Auth") != "secret-token" {
+		t.Errorf("Expected the provider's host to get the headers, got %v", api)
+	}
+	if elsewhere == nil {
+		t.Fatal("Expected the redirect to be followed")
+	}
+	if elsewhere.Get("X-Proxy-Auth") != "" || elsewhere.Get("Authorization") != "" {
+		t.Errorf("Expected no custom headers after a cross-host redirect, got %v", elsewhere)
+	}
+}
+
+func TestHeaders_StringRedactsValues(t *testing.T) {
+	headers := Headers{"x-proxy-auth": "secret-token"}
+	for _, s := range []string{fmt.Sprint(headers), fmt.Sprintf("%v", headers), fmt.Sprintf("%+v", CommonSettings{Headers: headers})} {
+		if strings.Contains(s, "secret-token") || !strings.Contains(s, "X-Proxy-Auth") {
+			t.Errorf("Expected redacted header names, got %s", s)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Icon is a provider image held as raw bytes, so the data URL in provider
+// listings and the bytes served from /icon come from the same source
+type Icon struct {
+	ContentType string
+	Data        []byte
+}
+
+// NewIcon wraps image data, detecting its content type. SVG is recognized
+// explicitly since content sniffing reports it as plain XML.
+func NewIcon(data []byte) Icon {
+	return Icon{ContentType: iconContentType(data), Data: data}
+}
+
+func iconContentType(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("<svg")) ||
+		(bytes.HasPrefix(trimmed, []byte("<?xml")) && bytes.Contains(trimmed, []byte("<svg"))) {
+		return "image/svg+xml"
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	return contentType
+}
+
+// DataURL encodes the icon as a base64 data URL
+func (i Icon) DataURL() string {
+	return "data:" + i.ContentType + ";base64," + base64.StdEncoding.EncodeToString(i.Data)
+}
+
+// ParseDataURL decodes a base64 data URL (data:<type>;base64,<payload>), as
+// returned by SyncableSafesProvider.Icon
+func ParseDataURL(dataURL string) (Icon, error) {
+	rest, ok := strings.CutPrefix(dataURL, "data:")
+	if !ok {
+		return Icon{}, fmt.Errorf("not a data URL")
+	}
+	meta, payload, ok := strings.Cut(rest, ",")
+	if !ok {
+		return Icon{}, fmt.Errorf("malformed data URL")
+	}
+	contentType, ok := strings.CutSuffix(meta, ";base64")
+	if !ok {
+		return Icon{}, fmt.Errorf("data URL is not base64-encoded")
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return Icon{}, fmt.Errorf("invalid base64 payload: %w", err)
+	}
+	return Icon{ContentType: contentType, Data: data}, nil
+}
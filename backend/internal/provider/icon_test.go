@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewIcon_DetectsContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "image/svg+xml"},
+		{"svg with xml declaration", []byte("<?xml version=\"1.0\"?>\n<svg></svg>"), "image/svg+xml"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png"},
+		{"other xml", []byte(`<?xml version="1.0"?><feed></feed>`), "text/xml"},
+	}
+	for _, tt := range tests {
+		if got := NewIcon(tt.data).ContentType; got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestIcon_DataURLRoundTrip(t *testing.T) {
+	icon := NewIcon([]byte("<svg></svg>"))
+
+	parsed, err := ParseDataURL(icon.DataURL())
+	if err != nil {
+		t.Fatalf("ParseDataURL failed: %v", err)
+	}
+	if parsed.ContentType != "image/svg+xml" || !bytes.Equal(parsed.Data, icon.Data) {
+		t.Errorf("Expected %+v, got %+v", icon, parsed)
+	}
+}
+
+func TestParseDataURL_Invalid(t *testing.T) {
+	for _, dataURL := range []string{
+		"not-a-data-url",
+		"data:image/svg+xml;base64",
+		"data:image/svg+xml,<svg></svg>",
+		"data:image/svg+xml;base64,!!!",
+	} {
+		if _, err := ParseDataURL(dataURL); err == nil {
+			t.Errorf("%q: expected an error", dataURL)
+		}
+	}
+}
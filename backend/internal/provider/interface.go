@@ -2,13 +2,21 @@ package provider
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
 )
 
 // DownloadResult contains the file content stream and metadata
 type DownloadResult struct {
-	Content      io.ReadCloser
-	LastModified string // From HTTP Last-Modified header
+	Content         io.ReadCloser
+	LastModified    string // From HTTP Last-Modified header
+	ETag            string // From HTTP ETag header, empty if the provider has none
+	NotModified     bool   // Conditional download matched; Content is nil
+	ExpectEmpty     bool   // Provider advertised a zero-length file, so an empty body is legitimate
+	Size            int64  // From HTTP Content-Length header, 0 if unknown
+	ContentEncoding string // From HTTP Content-Encoding header (e.g., "gzip"); Content and Size are still encoded
 }
 
 // SyncableSafesProvider defines the minimal interface for cloud storage providers.
@@ -20,16 +28,107 @@ type SyncableSafesProvider interface {
 	DisplayName() string // Human-readable name (e.g., "OneDrive", "Google Drive")
 
 	// Metadata for UI
-	Icon() string       // Base64-encoded image (data URL)
+	Icon() string       // Base64-encoded image (data URL), e.g. from Icon.DataURL
 	BrandColor() string // Hex color (e.g., "#0078D4")
 
 	// Auth lifecycle
 	GetAuthURL(ctx context.Context) (string, error)
 	HandleCallback(ctx context.Context, code string) error
 	Disconnect(ctx context.Context) error
+	ResetAuthState(ctx context.Context) error // Clears pending auth state (e.g., PKCE verifier) without touching tokens
 	GetConnectionStatus(ctx context.Context, attemptRefresh bool) (*ConnectionStatus, error)
 
 	// Remote operations - the ONLY provider-specific sync primitives
 	ListRemoteFiles(ctx context.Context) ([]RemoteFile, error)
-	DownloadFile(ctx context.Context, fileID string) (*DownloadResult, error)
+	DownloadFile(ctx context.Context, fileID string) (*DownloadResult, error) // fileID is a RemoteFile.ID, passed back unchanged
+}
+
+// ConditionalDownloader is optionally implemented by providers that support
+// ETag-based change detection. The provider sends etag as If-None-Match and,
+// on 304, returns a result with NotModified set instead of a content stream.
+type ConditionalDownloader interface {
+	DownloadFileIfNoneMatch(ctx context.Context, fileID, etag string) (*DownloadResult, error)
+}
+
+// WritableSafesProvider is optionally implemented by providers that can write
+// a file back. UploadFile replaces the remote content of fileID (a
+// RemoteFile.ID) with content, sending ifMatch as If-Match so a remote file
+// changed since that ETag is never overwritten; that case fails with
+// ErrUploadConflict. UploadEnabled reports whether uploads are allowed by the
+// provider's settings.
+type WritableSafesProvider interface {
+	UploadFile(ctx context.Context, fileID, ifMatch string, content io.Reader) (*UploadResult, error)
+	UploadEnabled() bool
+}
+
+// UploadResult describes the remote file an upload produced, in the same
+// form a download reports it
+type UploadResult struct {
+	ETag         string
+	LastModified string // HTTP date, like DownloadResult.LastModified
+}
+
+// ErrUploadConflict reports an upload refused because the remote file no
+// longer matches the If-Match ETag
+var ErrUploadConflict = errors.New("upload conflict: remote file changed since the last sync")
+
+// StatusError is an unexpected HTTP status from a provider API, so callers
+// can tell server-side failures apart without parsing the message
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Body)
+}
+
+// HTTPClientSetter is optionally implemented by providers that make HTTP requests.
+// The server injects a client that routes through the shared outbound guard.
+type HTTPClientSetter interface {
+	SetHTTPClient(client *http.Client)
+}
+
+// APIHostReporter is optionally implemented by providers that make HTTP
+// requests, naming the hosts (host[:port]) of their API and auth endpoints.
+// Custom headers from settings are only sent to these hosts.
+type APIHostReporter interface {
+	APIHosts() []string
+}
+
+// ExtensionsSetter is optionally implemented by providers that filter remote
+// files by name. The server passes the configured safe extensions.
+type ExtensionsSetter interface {
+	SetExtensions(exts Extensions)
+}
+
+// QuotaReporter is optionally implemented by providers that can report the
+// connected account's storage usage
+type QuotaReporter interface {
+	Quota(ctx context.Context) (*Quota, error)
+}
+
+// FolderBrowser is optionally implemented by providers that can list a single
+// remote folder, so file selection can navigate the drive instead of relying
+// on ListRemoteFiles alone. path is a folder path like RemoteFile.Path ("/" for
+// the root); a missing folder returns a "folder not found" error.
+type FolderBrowser interface {
+	BrowseFolder(ctx context.Context, path string) (*FolderListing, error)
+}
+
+// DeviceAuthorizer is optionally implemented by providers that support the
+// OAuth device-code flow, for servers whose callback URL the browser can't
+// reach. The user enters DeviceCode.UserCode at DeviceCode.VerificationURI
+// on any device while the server polls for approval.
+type DeviceAuthorizer interface {
+	RequestDeviceCode(ctx context.Context) (*DeviceCode, error)
+	// CompleteDeviceAuth polls until the user approves or declines code, or
+	// ctx is done, storing the tokens on approval
+	CompleteDeviceAuth(ctx context.Context, code *DeviceCode) error
+}
+
+// AuthStatePruner is optionally implemented by providers that keep short-lived
+// auth state on disk (e.g., PKCE verifiers). The sync loop calls it periodically.
+type AuthStatePruner interface {
+	PruneExpiredAuthState()
 }
@@ -5,6 +5,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/rolledback/pwsafe-service/backend/internal/provider"
 )
@@ -16,17 +19,35 @@ type Provider struct {
 	icon       string
 	brandColor string
 	files      []provider.RemoteFile
-	content    map[string][]byte // fileID -> content
+	content    map[string][]byte        // fileID -> content
+	readers    map[string]io.ReadCloser // fileID -> streaming content (takes precedence)
+	etags      map[string]string        // fileID -> ETag
 	status     *provider.ConnectionStatus
+	quota      *provider.Quota
 
 	// Error simulation
-	ListError     error
-	DownloadError error
-	AuthError     error
+	ListError      error
+	DownloadError  error
+	DownloadErrors []error // Returned one per download call, in order, before any other behavior
+	AuthError      error
+	DeviceAuth     chan error  // CompleteDeviceAuth waits for a value here; nil approves the sign-in
+	DownloadPanic  interface{} // If set, DownloadFile panics with this value
+	UploadError    error
+	UploadDisabled bool // If set, UploadEnabled reports false
+
+	// Download metadata
+	AdvertiseEmpty  bool   // If set, downloads report ExpectEmpty
+	AdvertisedSize  int64  // If set, downloads report this Size
+	ContentEncoding string // If set, downloads report this Content-Encoding
+	LastModified    string // If set, downloads report this Last-Modified instead of a fixed date
 
 	// Call tracking
-	DownloadedFiles []string
-	DisconnectCalls int
+	DownloadedFiles  []string
+	UploadedFiles    []string
+	NotModifiedFiles []string
+	DisconnectCalls  int
+	ResetAuthCalls   int
+	PruneCalls       atomic.Int32 // Called from the periodic sync loop, so read it with Load
 }
 
 // NewProvider creates a new mock provider for testing
@@ -38,6 +59,8 @@ func NewProvider(id string) *Provider {
 		brandColor: "#888888",
 		files:      []provider.RemoteFile{},
 		content:    make(map[string][]byte),
+		readers:    make(map[string]io.ReadCloser),
+		etags:      make(map[string]string),
 		status:     &provider.ConnectionStatus{Connected: true},
 	}
 }
@@ -52,6 +75,17 @@ func (p *Provider) SetContent(fileID string, content []byte) {
 	p.content[fileID] = content
 }
 
+// SetContentReader sets a streaming reader returned as-is by DownloadFile.
+// Useful for simulating slow or stalled downloads.
+func (p *Provider) SetContentReader(fileID string, r io.ReadCloser) {
+	p.readers[fileID] = r
+}
+
+// SetETag sets the ETag reported for a file ID
+func (p *Provider) SetETag(fileID, etag string) {
+	p.etags[fileID] = etag
+}
+
 // SetConnected sets the connection status
 func (p *Provider) SetConnected(connected bool) {
 	p.status.Connected = connected
@@ -62,6 +96,11 @@ func (p *Provider) SetStatus(status *provider.ConnectionStatus) {
 	p.status = status
 }
 
+// SetQuota sets the usage returned by Quota
+func (p *Provider) SetQuota(used, total int64) {
+	p.quota = &provider.Quota{Used: used, Total: total, Remaining: total - used}
+}
+
 // SetIcon sets the provider icon
 func (p *Provider) SetIcon(icon string) {
 	p.icon = icon
@@ -109,12 +148,48 @@ func (p *Provider) HandleCallback(ctx context.Context, code string) error {
 	return nil
 }
 
+func (p *Provider) RequestDeviceCode(ctx context.Context) (*provider.DeviceCode, error) {
+	if p.AuthError != nil {
+		return nil, p.AuthError
+	}
+	return &provider.DeviceCode{
+		UserCode:        "MOCK-CODE",
+		VerificationURI: "https://mock.auth.url/device",
+		ExpiresAt:       time.Now().Add(15 * time.Minute),
+		DeviceCode:      "mock-device-code",
+		Interval:        time.Second,
+	}, nil
+}
+
+// CompleteDeviceAuth connects once DeviceAuth receives nil
+func (p *Provider) CompleteDeviceAuth(ctx context.Context, code *provider.DeviceCode) error {
+	select {
+	case err := <-p.DeviceAuth:
+		if err != nil {
+			return err
+		}
+		p.status.Connected = true
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (p *Provider) Disconnect(ctx context.Context) error {
 	p.DisconnectCalls++
 	p.status.Connected = false
 	return nil
 }
 
+func (p *Provider) ResetAuthState(ctx context.Context) error {
+	p.ResetAuthCalls++
+	return nil
+}
+
+func (p *Provider) PruneExpiredAuthState() {
+	p.PruneCalls.Add(1)
+}
+
 func (p *Provider) GetConnectionStatus(ctx context.Context, attemptRefresh bool) (*provider.ConnectionStatus, error) {
 	return p.status, nil
 }
@@ -128,10 +203,85 @@ func (p *Provider) ListRemoteFiles(ctx context.Context) ([]provider.RemoteFile,
 	return p.files, nil
 }
 
+// BrowseFolder derives the folder's contents from the files set with SetFiles
+func (p *Provider) BrowseFolder(ctx context.Context, folderPath string) (*provider.FolderListing, error) {
+	if p.ListError != nil {
+		return nil, p.ListError
+	}
+	listing := &provider.FolderListing{Folders: []string{}, Files: []provider.RemoteFile{}}
+	found := folderPath == "/"
+	seen := make(map[string]bool)
+	prefix := strings.TrimSuffix(folderPath, "/") + "/"
+	for _, f := range p.files {
+		if f.Path == folderPath {
+			found = true
+			listing.Files = append(listing.Files, f)
+		} else if rest, ok := strings.CutPrefix(f.Path, prefix); ok {
+			found = true
+			name, _, _ := strings.Cut(rest, "/")
+			if !seen[name] {
+				seen[name] = true
+				listing.Folders = append(listing.Folders, name)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("folder not found: %s", folderPath)
+	}
+	return listing, nil
+}
+
+func (p *Provider) Quota(ctx context.Context) (*provider.Quota, error) {
+	if p.quota == nil {
+		return nil, fmt.Errorf("quota unavailable")
+	}
+	return p.quota, nil
+}
+
+func (p *Provider) lastModified() string {
+	if p.LastModified != "" {
+		return p.LastModified
+	}
+	return "Mon, 24 Jan 2026 12:00:00 GMT"
+}
+
 func (p *Provider) DownloadFile(ctx context.Context, fileID string) (*provider.DownloadResult, error) {
+	return p.DownloadFileIfNoneMatch(ctx, fileID, "")
+}
+
+func (p *Provider) DownloadFileIfNoneMatch(ctx context.Context, fileID, etag string) (*provider.DownloadResult, error) {
+	if p.DownloadPanic != nil {
+		panic(p.DownloadPanic)
+	}
 	if p.DownloadError != nil {
 		return nil, p.DownloadError
 	}
+	if len(p.DownloadErrors) > 0 {
+		err := p.DownloadErrors[0]
+		p.DownloadErrors = p.DownloadErrors[1:]
+		return nil, err
+	}
+
+	if etag != "" && p.etags[fileID] == etag {
+		p.NotModifiedFiles = append(p.NotModifiedFiles, fileID)
+		return &provider.DownloadResult{
+			LastModified: p.lastModified(),
+			ETag:         etag,
+			NotModified:  true,
+		}, nil
+	}
+
+	if r, ok := p.readers[fileID]; ok {
+		p.DownloadedFiles = append(p.DownloadedFiles, fileID)
+		return &provider.DownloadResult{
+			Content:         r,
+			LastModified:    p.lastModified(),
+			ETag:            p.etags[fileID],
+			ExpectEmpty:     p.AdvertiseEmpty,
+			Size:            p.AdvertisedSize,
+			ContentEncoding: p.ContentEncoding,
+		}, nil
+	}
 
 	content, ok := p.content[fileID]
 	if !ok {
@@ -142,7 +292,34 @@ func (p *Provider) DownloadFile(ctx context.Context, fileID string) (*provider.D
 
 	// Return an in-memory reader - no filesystem needed!
 	return &provider.DownloadResult{
-		Content:      io.NopCloser(bytes.NewReader(content)),
-		LastModified: "Mon, 24 Jan 2026 12:00:00 GMT",
+		Content:         io.NopCloser(bytes.NewReader(content)),
+		LastModified:    p.lastModified(),
+		ETag:            p.etags[fileID],
+		ExpectEmpty:     p.AdvertiseEmpty,
+		Size:            p.AdvertisedSize,
+		ContentEncoding: p.ContentEncoding,
 	}, nil
 }
+
+// UploadFile replaces fileID's content, so later downloads return it, and
+// gives it a new ETag
+func (p *Provider) UploadFile(ctx context.Context, fileID, ifMatch string, content io.Reader) (*provider.UploadResult, error) {
+	if p.UploadError != nil {
+		return nil, p.UploadError
+	}
+	if ifMatch != "" && p.etags[fileID] != ifMatch {
+		return nil, provider.ErrUploadConflict
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	p.UploadedFiles = append(p.UploadedFiles, fileID)
+	p.content[fileID] = data
+	p.etags[fileID] = fmt.Sprintf(`"upload-%d"`, len(p.UploadedFiles))
+	return &provider.UploadResult{ETag: p.etags[fileID], LastModified: p.lastModified()}, nil
+}
+
+func (p *Provider) UploadEnabled() bool {
+	return !p.UploadDisabled
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	_ "embed"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -24,20 +25,42 @@ const (
 	msAuthority        = "https://login.microsoftonline.com/consumers"
 	msAuthorizeURL     = msAuthority + "/oauth2/v2.0/authorize"
 	msTokenURL         = msAuthority + "/oauth2/v2.0/token"
+	msDeviceCodeURL    = msAuthority + "/oauth2/v2.0/devicecode"
 	msGraphURL         = "https://graph.microsoft.com/v1.0"
 	onedriveScopes     = "Files.Read User.Read offline_access"
+	uploadScopes       = "Files.ReadWrite User.Read offline_access" // with allowUpload
 	codeVerifierMaxAge = 15 * time.Minute
+	deviceCodeInterval = 5 * time.Second // poll interval when the device code response doesn't give one
+	tokenCacheTTL      = 30 * time.Second
 
 	// OneDrive brand color (Microsoft blue)
 	onedriveBrandColor = "#0078D4"
-
-	// OneDrive icon as base64-encoded SVG data URL
-	onedriveIcon = "data:image/svg+xml;base64,PHN2ZyB4bWxucz0iaHR0cDovL3d3dy53My5vcmcvMjAwMC9zdmciIHZpZXdCb3g9IjAgNS41IDMyIDIwLjUiPjx0aXRsZT5PZmZpY2VDb3JlMTBfMzJ4XzI0eF8yMHhfMTZ4XzAxLTIyLTIwMTk8L3RpdGxlPjxnIGlkPSJTVFlMRV9DT0xPUiI+PHBhdGggZD0iTTEyLjIwMjQ1LDExLjE5MjkybC4wMDAzMS0uMDAxMSw2LjcxNzY1LDQuMDIzNzksNC4wMDI5My0xLjY4NDUxLjAwMDE4LjAwMDY4QTYuNDc2OCw2LjQ3NjgsMCwwLDEsMjUuNSwxM2MuMTQ3NjQsMCwuMjkzNTguMDA2Ny40Mzg3OC4wMTYzOWExMC4wMDA3NSwxMC4wMDA3NSwwLDAsMC0xOC4wNDEtMy4wMTM4MUM3LjkzMiwxMC4wMDIxNSw3Ljk2NTcsMTAsOCwxMEE3Ljk2MDczLDcuOTYwNzMsMCwwLDEsMTIuMjAyNDUsMTEuMTkyOTJaIiBmaWxsPSIjMDM2NGI4Ii8+PHBhdGggZD0iTTEyLjIwMjc2LDExLjE5MTgybC0uMDAwMzEuMDAxMUE3Ljk2MDczLDcuOTYwNzMsMCwwLDAsOCwxMGMtLjAzNDMsMC0uMDY4MDUuMDAyMTUtLjEwMjIzLjAwMjU4QTcuOTk2NzYsNy45OTY3NiwwLDAsMCwxLjQzNzMyLDIyLjU3Mjc3bDUuOTI0LTIuNDkyOTIsMi42MzM0Mi0xLjEwODE5LDUuODYzNTMtMi40Njc0NiwzLjA2MjEzLTEuMjg4NTlaIiBmaWxsPSIjMDA3OGQ0Ii8+PHBhdGggZD0iTTI1LjkzODc4LDEzLjAxNjM5QzI1Ljc5MzU4LDEzLjAwNjcsMjUuNjQ3NjQsMTMsMjUuNSwxM2E2LjQ3NjgsNi40NzY4LDAsMCwwLTIuNTc2NDguNTMxNzhsLS4wMDAxOC0uMDAwNjgtNC4wMDI5MywxLjY4NDUxLDEuMTYwNzcuNjk1MjhMMjMuODg2MTEsMTguMTlsMS42NjAwOS45OTQzOCw1LjY3NjMzLDMuNDAwMDdhNi41MDAyLDYuNTAwMiwwLDAsMC01LjI4Mzc1LTkuNTY4MDVaIiBmaWxsPSIjMTQ5MGRmIi8+PHBhdGggZD0iTTI1LjU0NjIsMTkuMTg0MzcsMjMuODg2MTEsMTguMTlsLTMuODA0OTMtMi4yNzkxLTEuMTYwNzctLjY5NTI4TDE1Ljg1ODI4LDE2LjUwNDIsOS45OTQ3NSwxOC45NzE2Niw3LjM2MTMzLDIwLjA3OTg1bC01LjkyNCwyLjQ5MjkyQTcuOTg4ODksNy45ODg4OSwwLDAsMCw4LDI2SDI1LjVhNi40OTgzNyw2LjQ5ODM3LDAsMCwwLDUuNzIyNTMtMy40MTU1NloiIGZpbGw9IiMyOGE4ZWEiLz48L2c+PC9zdmc+"
 )
 
+// iconSVG is the OneDrive logo
+//
+//go:embed icon.svg
+var iconSVG []byte
+
+// onedriveIcon is iconSVG as a data URL
+var onedriveIcon = provider.NewIcon(iconSVG).DataURL()
+
+// Type describes the OneDrive provider for the provider types listing
+var Type = provider.ProviderType{
+	ID:          "onedrive",
+	DisplayName: "OneDrive",
+	Icon:        onedriveIcon,
+	BrandColor:  onedriveBrandColor,
+	Settings: []provider.SettingsField{
+		{Name: "clientId", Type: provider.SettingsTypeString, Description: "Application (client) ID of the Azure app registration", Required: true},
+		{Name: "allowUpload", Type: provider.SettingsTypeBoolean, Description: "Request write access so safes can be uploaded back to OneDrive; existing connections must sign in again"},
+	},
+}
+
 // Settings represents the OneDrive provider settings from settings.json
 type Settings struct {
-	ClientID string `json:"clientId"`
+	ClientID    string `json:"clientId"`
+	AllowUpload bool   `json:"allowUpload,omitempty"`
 }
 
 // tokens is the internal struct for storing OAuth tokens
@@ -54,7 +77,15 @@ type OneDriveProvider struct {
 	storageDir  string // The provider's directory (e.g., {safesDir}/onedrive)
 	clientID    string
 	redirectURI string
+	scopes      string
 	tokenMutex  sync.Mutex
+	httpClient  *http.Client
+	extensions  provider.Extensions
+
+	// In-memory cache of parsed tokens so status polls don't re-read .tokens.json
+	cacheMutex   sync.Mutex
+	cachedTokens *tokens
+	cachedAt     time.Time
 }
 
 // Factory creates an OneDriveProvider from settings.json content
@@ -70,7 +101,11 @@ func Factory(providerDir string, baseURL string, settingsJSON []byte) (provider.
 	// Callback URL derived from baseURL + fixed path
 	redirectURI := strings.TrimSuffix(baseURL, "/") + "/api/providers/onedrive/auth/callback"
 
-	return NewOneDriveProvider(providerDir, settings.ClientID, redirectURI), nil
+	p := NewOneDriveProvider(providerDir, settings.ClientID, redirectURI)
+	if settings.AllowUpload {
+		p.EnableUpload()
+	}
+	return p, nil
 }
 
 // NewOneDriveProvider creates a new OneDrive provider
@@ -80,20 +115,54 @@ func NewOneDriveProvider(storageDir, clientID, redirectURI string) *OneDriveProv
 		storageDir:  storageDir,
 		clientID:    clientID,
 		redirectURI: redirectURI,
+		scopes:      onedriveScopes,
+		httpClient:  http.DefaultClient,
+		extensions:  provider.DefaultExtensions,
 	}
 	// Clean up any stale code verifier from previous runs
 	p.cleanupStaleCodeVerifier()
 	return p
 }
 
+// EnableUpload requests write access at sign-in so UploadFile can be used.
+// Tokens granted read-only access can't be refreshed with the wider scope, so
+// existing connections must sign in again.
+func (p *OneDriveProvider) EnableUpload() {
+	p.scopes = uploadScopes
+}
+
+// SetHTTPClient replaces the client used for all Microsoft API requests
+func (p *OneDriveProvider) SetHTTPClient(client *http.Client) {
+	p.httpClient = client
+}
+
+// APIHosts returns the Graph and sign-in hosts. Downloads redirect to
+// storage hosts outside this list.
+func (p *OneDriveProvider) APIHosts() []string {
+	var hosts []string
+	for _, endpoint := range []string{msAuthority, msGraphURL} {
+		if u, err := url.Parse(endpoint); err == nil {
+			hosts = append(hosts, u.Host)
+		}
+	}
+	return hosts
+}
+
+// SetExtensions sets which file extensions are searched for and listed
+func (p *OneDriveProvider) SetExtensions(exts provider.Extensions) {
+	if len(exts) > 0 {
+		p.extensions = exts
+	}
+}
+
 // ============ IDENTITY (2 methods) ============
 
 func (p *OneDriveProvider) ID() string {
-	return "onedrive"
+	return Type.ID
 }
 
 func (p *OneDriveProvider) DisplayName() string {
-	return "OneDrive"
+	return Type.DisplayName
 }
 
 // ============ METADATA (2 methods) ============
@@ -106,7 +175,7 @@ func (p *OneDriveProvider) BrandColor() string {
 	return onedriveBrandColor
 }
 
-// ============ AUTH (4 methods) ============
+// ============ AUTH (5 methods, plus device-code sign-in) ============
 
 func (p *OneDriveProvider) GetAuthURL(ctx context.Context) (string, error) {
 	if p.clientID == "" {
@@ -130,7 +199,7 @@ func (p *OneDriveProvider) GetAuthURL(ctx context.Context) (string, error) {
 		"client_id":             {p.clientID},
 		"response_type":         {"code"},
 		"redirect_uri":          {p.redirectURI},
-		"scope":                 {onedriveScopes},
+		"scope":                 {p.scopes},
 		"response_mode":         {"query"},
 		"code_challenge":        {codeChallenge},
 		"code_challenge_method": {"S256"},
@@ -151,13 +220,170 @@ func (p *OneDriveProvider) HandleCallback(ctx context.Context, code string) erro
 	}
 
 	// Exchange code for tokens
-	newTokens, err := p.exchangeCodeForTokens(code, codeVerifier)
+	newTokens, err := p.exchangeCodeForTokens(ctx, code, codeVerifier)
 	if err != nil {
 		return fmt.Errorf("failed to exchange code for tokens: %w", err)
 	}
 
+	if err := p.completeSignIn(ctx, newTokens); err != nil {
+		return err
+	}
+
+	// Clean up code verifier
+	p.deleteCodeVerifier()
+
+	return nil
+}
+
+// RequestDeviceCode starts a device-code sign-in, for servers whose callback
+// URL isn't reachable from the user's browser. The app registration must
+// allow public client flows.
+func (p *OneDriveProvider) RequestDeviceCode(ctx context.Context) (*provider.DeviceCode, error) {
+	if p.clientID == "" {
+		return nil, fmt.Errorf("OneDrive client ID not configured")
+	}
+
+	form := url.Values{
+		"client_id": {p.clientID},
+		"scope":     {p.scopes},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msDeviceCodeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("device code request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device code response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("device code request failed: %s", string(body))
+	}
+
+	var codeResp struct {
+		DeviceCode      string `json:"device_code"`
+		UserCode        string `json:"user_code"`
+		VerificationURI string `json:"verification_uri"`
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+		Message         string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &codeResp); err != nil {
+		return nil, fmt.Errorf("failed to parse device code response: %w", err)
+	}
+
+	interval := time.Duration(codeResp.Interval) * time.Second
+	if interval <= 0 {
+		interval = deviceCodeInterval
+	}
+	return &provider.DeviceCode{
+		UserCode:        codeResp.UserCode,
+		VerificationURI: codeResp.VerificationURI,
+		ExpiresAt:       time.Now().Add(time.Duration(codeResp.ExpiresIn) * time.Second),
+		Message:         codeResp.Message,
+		DeviceCode:      codeResp.DeviceCode,
+		Interval:        interval,
+	}, nil
+}
+
+// CompleteDeviceAuth polls the token endpoint until the user finishes signing
+// in with code, then stores the tokens like HandleCallback
+func (p *OneDriveProvider) CompleteDeviceAuth(ctx context.Context, code *provider.DeviceCode) error {
+	interval := code.Interval
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("device sign-in abandoned: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+
+		newTokens, pending, err := p.pollDeviceToken(ctx, code.DeviceCode)
+		if err != nil {
+			return err
+		}
+		switch pending {
+		case "":
+			return p.completeSignIn(ctx, newTokens)
+		case "slow_down":
+			interval += deviceCodeInterval
+		}
+	}
+}
+
+// pollDeviceToken asks once whether the device code has been approved. While
+// the user hasn't finished, it returns the pending error code instead of tokens.
+func (p *OneDriveProvider) pollDeviceToken(ctx context.Context, deviceCode string) (*tokens, string, error) {
+	form := url.Values{
+		"client_id":   {p.clientID},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {deviceCode},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, "", fmt.Errorf("device sign-in abandoned: %w", ctx.Err())
+		}
+		// Transient: try again at the next interval
+		log.Printf("OneDrive: device token poll failed: %v", err)
+		return nil, "authorization_pending", nil
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(body, &errResp)
+		switch errResp.Error {
+		case "authorization_pending", "slow_down":
+			return nil, errResp.Error, nil
+		case "authorization_declined":
+			return nil, "", fmt.Errorf("device sign-in declined")
+		case "expired_token":
+			return nil, "", fmt.Errorf("device code expired")
+		default:
+			return nil, "", fmt.Errorf("device token request failed: %s", string(body))
+		}
+	}
+
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, "", fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	return &tokens{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second).Format(time.RFC3339),
+	}, "", nil
+}
+
+// completeSignIn adds the account's profile to newly issued tokens and stores them
+func (p *OneDriveProvider) completeSignIn(ctx context.Context, newTokens *tokens) error {
 	// Get user profile
-	accountName, accountEmail, err := p.getUserProfile(newTokens.AccessToken)
+	accountName, accountEmail, err := p.getUserProfile(ctx, newTokens.AccessToken)
 	if err != nil {
 		// Non-fatal: continue without profile info
 		accountName = ""
@@ -170,10 +396,6 @@ func (p *OneDriveProvider) HandleCallback(ctx context.Context, code string) erro
 	if err := p.storeTokens(newTokens); err != nil {
 		return fmt.Errorf("failed to store tokens: %w", err)
 	}
-
-	// Clean up code verifier
-	p.deleteCodeVerifier()
-
 	return nil
 }
 
@@ -183,11 +405,16 @@ func (p *OneDriveProvider) Disconnect(ctx context.Context) error {
 	if err := os.Remove(tokensPath); err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	p.invalidateTokenCache()
 	// Delete code verifier if exists
 	p.deleteCodeVerifier()
 	return nil
 }
 
+func (p *OneDriveProvider) ResetAuthState(ctx context.Context) error {
+	return p.deleteCodeVerifier()
+}
+
 func (p *OneDriveProvider) GetConnectionStatus(ctx context.Context, attemptRefresh bool) (*provider.ConnectionStatus, error) {
 	status := &provider.ConnectionStatus{}
 
@@ -214,7 +441,7 @@ func (p *OneDriveProvider) GetConnectionStatus(ctx context.Context, attemptRefre
 
 	// If requested, verify we can actually refresh the token
 	if attemptRefresh {
-		if _, err := p.getValidAccessToken(); err != nil {
+		if _, err := p.getValidAccessToken(ctx); err != nil {
 			status.NeedsReauth = true
 		}
 	}
@@ -225,19 +452,40 @@ func (p *OneDriveProvider) GetConnectionStatus(ctx context.Context, attemptRefre
 // ============ REMOTE OPERATIONS (2 methods - the core primitives) ============
 
 func (p *OneDriveProvider) ListRemoteFiles(ctx context.Context) ([]provider.RemoteFile, error) {
-	accessToken, err := p.getValidAccessToken()
+	accessToken, err := p.getValidAccessToken(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	searchURL := msGraphURL + "/me/drive/root/search(q='.psafe3')"
+	// Search matches names, so run one search per extension and merge
+	var files []provider.RemoteFile
+	seen := make(map[string]bool)
+	for _, ext := range p.extensions {
+		found, err := p.searchFiles(ctx, accessToken, ext)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range found {
+			if !seen[f.ID] {
+				seen[f.ID] = true
+				files = append(files, f)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// searchFiles returns the safe files matching a drive search for query
+func (p *OneDriveProvider) searchFiles(ctx context.Context, accessToken, query string) ([]provider.RemoteFile, error) {
+	searchURL := msGraphURL + "/me/drive/root/search(q='" + url.PathEscape(query) + "')"
 	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("search request failed: %w", err)
 	}
@@ -252,6 +500,7 @@ func (p *OneDriveProvider) ListRemoteFiles(ctx context.Context) ([]provider.Remo
 		Value []struct {
 			ID              string `json:"id"`
 			Name            string `json:"name"`
+			ETag            string `json:"eTag"`
 			ParentReference struct {
 				Path string `json:"path"`
 			} `json:"parentReference"`
@@ -264,8 +513,8 @@ func (p *OneDriveProvider) ListRemoteFiles(ctx context.Context) ([]provider.Remo
 
 	var files []provider.RemoteFile
 	for _, item := range searchResp.Value {
-		// Filter to only .psafe3 files (search may return partial matches)
-		if !strings.HasSuffix(strings.ToLower(item.Name), ".psafe3") {
+		// Filter to safe files only (search may return partial matches)
+		if !p.extensions.Match(item.Name) {
 			continue
 		}
 
@@ -286,14 +535,132 @@ func (p *OneDriveProvider) ListRemoteFiles(ctx context.Context) ([]provider.Remo
 			ID:   item.ID,
 			Name: item.Name,
 			Path: path,
+			ETag: item.ETag,
 		})
 	}
 
 	return files, nil
 }
 
+// BrowseFolder lists a drive folder's subfolders and safe files from its children
+func (p *OneDriveProvider) BrowseFolder(ctx context.Context, folderPath string) (*provider.FolderListing, error) {
+	accessToken, err := p.getValidAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pageURL := msGraphURL + "/me/drive/root/children"
+	if folderPath != "/" {
+		var segments []string
+		for _, segment := range strings.Split(strings.Trim(folderPath, "/"), "/") {
+			segments = append(segments, url.PathEscape(segment))
+		}
+		pageURL = msGraphURL + "/me/drive/root:/" + strings.Join(segments, "/") + ":/children"
+	}
+	pageURL += "?$select=id,name,eTag,folder"
+
+	listing := &provider.FolderListing{Folders: []string{}, Files: []provider.RemoteFile{}}
+	for pageURL != "" {
+		page, err := p.childrenPage(ctx, accessToken, pageURL, folderPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Value {
+			if item.Folder != nil {
+				listing.Folders = append(listing.Folders, item.Name)
+			} else if p.extensions.Match(item.Name) {
+				listing.Files = append(listing.Files, provider.RemoteFile{
+					ID:   item.ID,
+					Name: item.Name,
+					Path: folderPath,
+					ETag: item.ETag,
+				})
+			}
+		}
+		pageURL = page.NextLink
+	}
+	return listing, nil
+}
+
+// childrenPage is one page of a folder's children
+type childrenPage struct {
+	Value []struct {
+		ID     string    `json:"id"`
+		Name   string    `json:"name"`
+		ETag   string    `json:"eTag"`
+		Folder *struct{} `json:"folder"` // Set only for folders
+	} `json:"value"`
+	NextLink string `json:"@odata.nextLink"`
+}
+
+func (p *OneDriveProvider) childrenPage(ctx context.Context, accessToken, pageURL, folderPath string) (*childrenPage, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("browse request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("folder not found: %s", folderPath)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("browse failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var page childrenPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to decode browse response: %w", err)
+	}
+	return &page, nil
+}
+
+// Quota reports the drive's storage usage from /me/drive
+func (p *OneDriveProvider) Quota(ctx context.Context) (*provider.Quota, error) {
+	accessToken, err := p.getValidAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", msGraphURL+"/me/drive", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("quota request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("quota request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var drive struct {
+		Quota provider.Quota `json:"quota"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&drive); err != nil {
+		return nil, fmt.Errorf("failed to decode quota response: %w", err)
+	}
+	return &drive.Quota, nil
+}
+
 func (p *OneDriveProvider) DownloadFile(ctx context.Context, fileID string) (*provider.DownloadResult, error) {
-	accessToken, err := p.getValidAccessToken()
+	return p.DownloadFileIfNoneMatch(ctx, fileID, "")
+}
+
+// DownloadFileIfNoneMatch downloads the file unless its ETag still matches etag
+func (p *OneDriveProvider) DownloadFileIfNoneMatch(ctx context.Context, fileID, etag string) (*provider.DownloadResult, error) {
+	accessToken, err := p.getValidAccessToken(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -304,25 +671,141 @@ func (p *OneDriveProvider) DownloadFile(ctx context.Context, fileID string) (*pr
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("download request failed: %w", err)
 	}
 
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return &provider.DownloadResult{
+			LastModified: resp.Header.Get("Last-Modified"),
+			ETag:         etag,
+			NotModified:  true,
+		}, nil
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("download failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("download failed with %w", &provider.StatusError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	// An empty body is only trusted when the item's metadata says it is
+	// empty; a faulty response can't vouch for itself
+	expectEmpty := false
+	if resp.ContentLength == 0 {
+		size, err := p.itemSize(ctx, accessToken, fileID)
+		expectEmpty = err == nil && size == 0
 	}
 
 	// Return the body stream and last modified - caller is responsible for closing
 	return &provider.DownloadResult{
 		Content:      resp.Body,
 		LastModified: resp.Header.Get("Last-Modified"),
+		ETag:         resp.Header.Get("ETag"),
+		ExpectEmpty:  expectEmpty,
+		Size:         max(resp.ContentLength, 0), // -1 when the length is unknown
+		// Still set only when the transport didn't decompress the body itself
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
 	}, nil
 }
 
+// itemSize reads the item's size from its Graph metadata
+func (p *OneDriveProvider) itemSize(ctx context.Context, accessToken, fileID string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/me/drive/items/%s?$select=size", msGraphURL, fileID), nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("item request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("item request failed with status %d", resp.StatusCode)
+	}
+
+	var item struct {
+		Size *int64 `json:"size"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		return 0, fmt.Errorf("failed to decode item: %w", err)
+	}
+	if item.Size == nil {
+		return 0, fmt.Errorf("item has no size")
+	}
+	return *item.Size, nil
+}
+
+// UploadFile replaces the file's content with a simple upload to the item's
+// /content endpoint, which Graph accepts for files up to 250 MB
+func (p *OneDriveProvider) UploadFile(ctx context.Context, fileID, ifMatch string, content io.Reader) (*provider.UploadResult, error) {
+	if !p.UploadEnabled() {
+		return nil, fmt.Errorf("upload not enabled: set allowUpload in the OneDrive settings.json and sign in again")
+	}
+	accessToken, err := p.getValidAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadURL := fmt.Sprintf("%s/me/drive/items/%s/content", msGraphURL, url.PathEscape(fileID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uploadURL, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upload request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return nil, provider.ErrUploadConflict
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return nil, fmt.Errorf("REAUTH_REQUIRED: upload rejected with status %d: %s", resp.StatusCode, string(body))
+		}
+		return nil, fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// The response is the updated driveItem
+	var item struct {
+		ETag                 string    `json:"eTag"`
+		LastModifiedDateTime time.Time `json:"lastModifiedDateTime"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		return nil, fmt.Errorf("failed to decode upload response: %w", err)
+	}
+	result := &provider.UploadResult{ETag: resp.Header.Get("ETag")}
+	if result.ETag == "" {
+		result.ETag = item.ETag
+	}
+	if !item.LastModifiedDateTime.IsZero() {
+		result.LastModified = item.LastModifiedDateTime.UTC().Format(http.TimeFormat)
+	}
+	return result, nil
+}
+
+// UploadEnabled reports whether allowUpload was set, so sign-in asks for write access
+func (p *OneDriveProvider) UploadEnabled() bool {
+	return p.scopes == uploadScopes
+}
+
 // ============ PRIVATE HELPERS (token management) ============
 
 func (p *OneDriveProvider) tokensPath() string {
@@ -330,6 +813,10 @@ func (p *OneDriveProvider) tokensPath() string {
 }
 
 func (p *OneDriveProvider) loadTokens() (*tokens, error) {
+	if t := p.getCachedTokens(); t != nil {
+		return t, nil
+	}
+
 	data, err := os.ReadFile(p.tokensPath())
 	if err != nil {
 		return nil, err
@@ -338,6 +825,7 @@ func (p *OneDriveProvider) loadTokens() (*tokens, error) {
 	if err := json.Unmarshal(data, &t); err != nil {
 		return nil, err
 	}
+	p.setCachedTokens(&t)
 	return &t, nil
 }
 
@@ -349,10 +837,43 @@ func (p *OneDriveProvider) storeTokens(t *tokens) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(p.tokensPath(), data, 0600)
+	if err := os.WriteFile(p.tokensPath(), data, 0600); err != nil {
+		p.invalidateTokenCache()
+		return err
+	}
+	p.setCachedTokens(t)
+	return nil
+}
+
+// getCachedTokens returns a copy of the cached tokens, or nil if the cache is empty or stale
+func (p *OneDriveProvider) getCachedTokens() *tokens {
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+
+	if p.cachedTokens == nil || time.Since(p.cachedAt) > tokenCacheTTL {
+		return nil
+	}
+	t := *p.cachedTokens
+	return &t
+}
+
+func (p *OneDriveProvider) setCachedTokens(t *tokens) {
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+
+	cached := *t
+	p.cachedTokens = &cached
+	p.cachedAt = time.Now()
 }
 
-func (p *OneDriveProvider) getValidAccessToken() (string, error) {
+func (p *OneDriveProvider) invalidateTokenCache() {
+	p.cacheMutex.Lock()
+	defer p.cacheMutex.Unlock()
+
+	p.cachedTokens = nil
+}
+
+func (p *OneDriveProvider) getValidAccessToken(ctx context.Context) (string, error) {
 	p.tokenMutex.Lock()
 	defer p.tokenMutex.Unlock()
 
@@ -380,7 +901,7 @@ func (p *OneDriveProvider) getValidAccessToken() (string, error) {
 		return "", fmt.Errorf("REAUTH_REQUIRED: token expired and no refresh token")
 	}
 
-	newTokens, err := p.refreshAccessToken(t)
+	newTokens, err := p.refreshAccessToken(ctx, t)
 	if err != nil {
 		return "", err
 	}
@@ -388,15 +909,15 @@ func (p *OneDriveProvider) getValidAccessToken() (string, error) {
 	return newTokens.AccessToken, nil
 }
 
-func (p *OneDriveProvider) refreshAccessToken(t *tokens) (*tokens, error) {
+func (p *OneDriveProvider) refreshAccessToken(ctx context.Context, t *tokens) (*tokens, error) {
 	formData := url.Values{
 		"client_id":     {p.clientID},
 		"grant_type":    {"refresh_token"},
 		"refresh_token": {t.RefreshToken},
-		"scope":         {onedriveScopes},
+		"scope":         {p.scopes},
 	}
 
-	resp, err := http.PostForm(msTokenURL, formData)
+	resp, err := p.postTokenForm(ctx, formData)
 	if err != nil {
 		return nil, fmt.Errorf("refresh request failed: %w", err)
 	}
@@ -445,7 +966,7 @@ func (p *OneDriveProvider) refreshAccessToken(t *tokens) (*tokens, error) {
 	return newTokens, nil
 }
 
-func (p *OneDriveProvider) exchangeCodeForTokens(code, codeVerifier string) (*tokens, error) {
+func (p *OneDriveProvider) exchangeCodeForTokens(ctx context.Context, code, codeVerifier string) (*tokens, error) {
 	data := url.Values{
 		"client_id":     {p.clientID},
 		"code":          {code},
@@ -454,7 +975,7 @@ func (p *OneDriveProvider) exchangeCodeForTokens(code, codeVerifier string) (*to
 		"code_verifier": {codeVerifier},
 	}
 
-	resp, err := http.PostForm(msTokenURL, data)
+	resp, err := p.postTokenForm(ctx, data)
 	if err != nil {
 		return nil, fmt.Errorf("token request failed: %w", err)
 	}
@@ -488,14 +1009,25 @@ func (p *OneDriveProvider) exchangeCodeForTokens(code, codeVerifier string) (*to
 	}, nil
 }
 
-func (p *OneDriveProvider) getUserProfile(accessToken string) (name, email string, err error) {
-	req, err := http.NewRequest("GET", msGraphURL+"/me", nil)
+// postTokenForm posts form to the token endpoint, bound to ctx so a cancelled
+// sync or request doesn't leave the exchange running
+func (p *OneDriveProvider) postTokenForm(ctx context.Context, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return p.httpClient.Do(req)
+}
+
+func (p *OneDriveProvider) getUserProfile(ctx context.Context, accessToken string) (name, email string, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", msGraphURL+"/me", nil)
 	if err != nil {
 		return "", "", err
 	}
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := p.httpClient.Do(req)
 	if err != nil {
 		return "", "", err
 	}
@@ -552,12 +1084,21 @@ func (p *OneDriveProvider) loadCodeVerifier() (string, error) {
 	return string(data), nil
 }
 
-func (p *OneDriveProvider) deleteCodeVerifier() {
+// deleteCodeVerifier removes the stored verifier; a missing one isn't an error
+func (p *OneDriveProvider) deleteCodeVerifier() error {
 	verifierPath := filepath.Join(p.storageDir, ".code_verifier")
-	os.Remove(verifierPath)
+	if err := os.Remove(verifierPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// PruneExpiredAuthState implements provider.AuthStatePruner
+func (p *OneDriveProvider) PruneExpiredAuthState() {
+	p.cleanupStaleCodeVerifier()
 }
 
-// cleanupStaleCodeVerifier removes any expired code verifier from previous runs
+// cleanupStaleCodeVerifier removes any expired code verifier left by abandoned auth attempts
 func (p *OneDriveProvider) cleanupStaleCodeVerifier() {
 	verifierPath := filepath.Join(p.storageDir, ".code_verifier")
 	stat, err := os.Stat(verifierPath)
@@ -0,0 +1,412 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/provider"
+)
+
+func writeTestTokens(t *testing.T, dir string) {
+	t.Helper()
+	data := `{"accessToken":"access","refreshToken":"refresh","expiresAt":"` +
+		time.Now().Add(time.Hour).Format(time.RFC3339) + `","accountName":"Test User","accountEmail":"test@example.com"}`
+	if err := os.WriteFile(filepath.Join(dir, ".tokens.json"), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetConnectionStatus_UsesCachedTokens(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestTokens(t, tmpDir)
+
+	p := NewOneDriveProvider(tmpDir, "client", "http://localhost/callback")
+	ctx := context.Background()
+
+	status, err := p.GetConnectionStatus(ctx, false)
+	if err != nil {
+		t.Fatalf("GetConnectionStatus failed: %v", err)
+	}
+	if !status.Connected {
+		t.Fatal("Expected Connected=true")
+	}
+
+	// Remove the file behind the provider's back - cached tokens should still be served
+	os.Remove(filepath.Join(tmpDir, ".tokens.json"))
+
+	status, err = p.GetConnectionStatus(ctx, false)
+	if err != nil {
+		t.Fatalf("GetConnectionStatus failed: %v", err)
+	}
+	if !status.Connected {
+		t.Error("Expected cached status to still report Connected=true")
+	}
+	if status.AccountEmail != "test@example.com" {
+		t.Errorf("Expected AccountEmail 'test@example.com', got '%s'", status.AccountEmail)
+	}
+}
+
+func TestGetConnectionStatus_CacheExpires(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestTokens(t, tmpDir)
+
+	p := NewOneDriveProvider(tmpDir, "client", "http://localhost/callback")
+	ctx := context.Background()
+
+	if _, err := p.GetConnectionStatus(ctx, false); err != nil {
+		t.Fatalf("GetConnectionStatus failed: %v", err)
+	}
+
+	os.Remove(filepath.Join(tmpDir, ".tokens.json"))
+	p.cachedAt = time.Now().Add(-2 * tokenCacheTTL)
+
+	status, _ := p.GetConnectionStatus(ctx, false)
+	if status.Connected {
+		t.Error("Expected Connected=false after cache expired and tokens removed")
+	}
+}
+
+func TestDisconnect_InvalidatesTokenCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestTokens(t, tmpDir)
+
+	p := NewOneDriveProvider(tmpDir, "client", "http://localhost/callback")
+	ctx := context.Background()
+
+	if _, err := p.GetConnectionStatus(ctx, false); err != nil {
+		t.Fatalf("GetConnectionStatus failed: %v", err)
+	}
+
+	if err := p.Disconnect(ctx); err != nil {
+		t.Fatalf("Disconnect failed: %v", err)
+	}
+
+	status, _ := p.GetConnectionStatus(ctx, false)
+	if status.Connected {
+		t.Error("Expected Connected=false after Disconnect")
+	}
+}
+
+func TestStoreTokens_UpdatesCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	p := NewOneDriveProvider(tmpDir, "client", "http://localhost/callback")
+	ctx := context.Background()
+
+	status, _ := p.GetConnectionStatus(ctx, false)
+	if status.Connected {
+		t.Fatal("Expected Connected=false with no tokens")
+	}
+
+	err := p.storeTokens(&tokens{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(time.Hour).Format(time.RFC3339),
+		AccountName:  "New User",
+	})
+	if err != nil {
+		t.Fatalf("storeTokens failed: %v", err)
+	}
+
+	status, _ = p.GetConnectionStatus(ctx, false)
+	if !status.Connected {
+		t.Error("Expected Connected=true after storeTokens")
+	}
+	if status.AccountName != "New User" {
+		t.Errorf("Expected AccountName 'New User', got '%s'", status.AccountName)
+	}
+}
+
+func TestRefreshAccessToken_UsesRequestContext(t *testing.T) {
+	tmpDir := t.TempDir()
+	p := NewOneDriveProvider(tmpDir, "client", "http://localhost/callback")
+	if err := p.storeTokens(&tokens{AccessToken: "old", RefreshToken: "refresh", ExpiresAt: time.Now().Add(-time.Minute).Format(time.RFC3339)}); err != nil {
+		t.Fatal(err)
+	}
+
+	type ctxKey struct{}
+	var tokenCtx context.Context
+	p.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() != msTokenURL {
+			return jsonResponse(http.StatusNotFound, `{}`), nil
+		}
+		tokenCtx = req.Context()
+		req.ParseForm()
+		if req.Header.Get("Content-Type") != "application/x-www-form-urlencoded" || req.PostForm.Get("refresh_token") != "refresh" {
+			return jsonResponse(http.StatusBadRequest, `{"error":"invalid_request"}`), nil
+		}
+		return jsonResponse(http.StatusOK, `{"access_token":"new","expires_in":3600}`), nil
+	})})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "caller")
+	accessToken, err := p.getValidAccessToken(ctx)
+	if err != nil || accessToken != "new" {
+		t.Fatalf("Expected a refreshed token, got %q (err: %v)", accessToken, err)
+	}
+	if tokenCtx == nil || tokenCtx.Value(ctxKey{}) != "caller" {
+		t.Error("Expected the token request to carry the caller's context")
+	}
+}
+
+func TestResetAuthState_RemovesVerifierKeepsTokens(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestTokens(t, tmpDir)
+
+	p := NewOneDriveProvider(tmpDir, "client", "http://localhost/callback")
+	if err := p.storeCodeVerifier("verifier"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.ResetAuthState(context.Background()); err != nil {
+		t.Fatalf("ResetAuthState failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, ".code_verifier")); !os.IsNotExist(err) {
+		t.Error("Expected .code_verifier to be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, ".tokens.json")); err != nil {
+		t.Errorf("Expected .tokens.json to be kept, got: %v", err)
+	}
+
+	// Resetting again with nothing pending is not an error
+	if err := p.ResetAuthState(context.Background()); err != nil {
+		t.Errorf("Expected no error when no verifier exists, got: %v", err)
+	}
+}
+
+func TestPruneExpiredAuthState(t *testing.T) {
+	tmpDir := t.TempDir()
+	p := NewOneDriveProvider(tmpDir, "client", "http://localhost/callback")
+	verifierPath := filepath.Join(tmpDir, ".code_verifier")
+
+	// Fresh verifier is kept
+	if err := p.storeCodeVerifier("verifier"); err != nil {
+		t.Fatal(err)
+	}
+	p.PruneExpiredAuthState()
+	if _, err := os.Stat(verifierPath); err != nil {
+		t.Fatalf("Expected fresh verifier to be kept, got: %v", err)
+	}
+
+	// Expired verifier is removed
+	old := time.Now().Add(-2 * codeVerifierMaxAge)
+	os.Chtimes(verifierPath, old, old)
+	p.PruneExpiredAuthState()
+	if _, err := os.Stat(verifierPath); !os.IsNotExist(err) {
+		t.Error("Expected expired verifier to be removed")
+	}
+}
+
+// roundTripFunc serves Microsoft API requests in tests without a network
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func jsonResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestIcon_IsEmbeddedSVG(t *testing.T) {
+	icon, err := provider.ParseDataURL((&OneDriveProvider{}).Icon())
+	if err != nil {
+		t.Fatalf("Icon is not a valid data URL: %v", err)
+	}
+	if icon.ContentType != "image/svg+xml" {
+		t.Errorf("Expected image/svg+xml, got %q", icon.ContentType)
+	}
+	if !bytes.Equal(icon.Data, iconSVG) {
+		t.Error("Expected the data URL to carry icon.svg")
+	}
+	if Type.Icon != (&OneDriveProvider{}).Icon() {
+		t.Error("Expected the provider type listing to use the same icon")
+	}
+}
+
+func TestDeviceCodeFlow(t *testing.T) {
+	tmpDir := t.TempDir()
+	p := NewOneDriveProvider(tmpDir, "client", "http://localhost/callback")
+
+	var polls int
+	p.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req.ParseForm()
+		switch req.URL.String() {
+		case msDeviceCodeURL:
+			return jsonResponse(http.StatusOK, `{"device_code":"secret","user_code":"ABCD-EFGH","verification_uri":"https://microsoft.com/devicelogin","expires_in":900,"interval":5}`), nil
+		case msTokenURL:
+			if req.PostForm.Get("device_code") != "secret" {
+				return jsonResponse(http.StatusBadRequest, `{"error":"bad_verification_code"}`), nil
+			}
+			polls++
+			if polls < 3 {
+				return jsonResponse(http.StatusBadRequest, `{"error":"authorization_pending"}`), nil
+			}
+			return jsonResponse(http.StatusOK, `{"access_token":"access","refresh_token":"refresh","expires_in":3600}`), nil
+		case msGraphURL + "/me":
+			return jsonResponse(http.StatusOK, `{"displayName":"Test User","mail":"test@example.com"}`), nil
+		}
+		return jsonResponse(http.StatusNotFound, `{}`), nil
+	})})
+
+	ctx := context.Background()
+	code, err := p.RequestDeviceCode(ctx)
+	if err != nil {
+		t.Fatalf("RequestDeviceCode failed: %v", err)
+	}
+	if code.UserCode != "ABCD-EFGH" || code.Interval != 5*time.Second || time.Until(code.ExpiresAt) < 14*time.Minute {
+		t.Errorf("Unexpected device code: %+v", code)
+	}
+
+	code.Interval = time.Millisecond
+	if err := p.CompleteDeviceAuth(ctx, code); err != nil {
+		t.Fatalf("CompleteDeviceAuth failed: %v", err)
+	}
+	if polls != 3 {
+		t.Errorf("Expected polling until approved (3 polls), got %d", polls)
+	}
+
+	status, err := p.GetConnectionStatus(ctx, false)
+	if err != nil || !status.Connected {
+		t.Fatalf("Expected connected, got %+v (err: %v)", status, err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, ".tokens.json")); err != nil {
+		t.Errorf("Expected tokens to be stored: %v", err)
+	}
+
+	code.DeviceCode = "wrong"
+	if err := p.CompleteDeviceAuth(ctx, code); err == nil {
+		t.Error("Expected a rejected device code to fail")
+	}
+}
+
+func TestBrowseFolder(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestTokens(t, tmpDir)
+	p := NewOneDriveProvider(tmpDir, "client", "http://localhost/callback")
+
+	const firstPage = msGraphURL + "/me/drive/root:/Documents/My%20Safes:/children?$select=id,name,eTag,folder"
+	const secondPage = msGraphURL + "/next-page"
+	p.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.String() {
+		case firstPage:
+			return jsonResponse(http.StatusOK, `{"value":[{"id":"d1","name":"Old","folder":{"childCount":1}},{"id":"f1","name":"work.psafe3","eTag":"e1"},{"id":"f2","name":"notes.txt"}],"@odata.nextLink":"`+secondPage+`"}`), nil
+		case secondPage:
+			return jsonResponse(http.StatusOK, `{"value":[{"id":"f3","name":"home.psafe3","eTag":"e3"}]}`), nil
+		}
+		return jsonResponse(http.StatusNotFound, `{"error":{"code":"itemNotFound"}}`), nil
+	})})
+
+	listing, err := p.BrowseFolder(context.Background(), "/Documents/My Safes")
+	if err != nil {
+		t.Fatalf("BrowseFolder failed: %v", err)
+	}
+	if len(listing.Folders) != 1 || listing.Folders[0] != "Old" {
+		t.Errorf("Expected folder 'Old', got %v", listing.Folders)
+	}
+	if len(listing.Files) != 2 || listing.Files[0].ID != "f1" || listing.Files[1].ID != "f3" {
+		t.Fatalf("Expected safe files from both pages, got %+v", listing.Files)
+	}
+	if listing.Files[0].Path != "/Documents/My Safes" || listing.Files[0].ETag != "e1" {
+		t.Errorf("Unexpected file: %+v", listing.Files[0])
+	}
+
+	if _, err := p.BrowseFolder(context.Background(), "/Missing"); err == nil || !strings.Contains(err.Error(), "folder not found") {
+		t.Errorf("Expected folder not found, got %v", err)
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestTokens(t, tmpDir)
+	p := NewOneDriveProvider(tmpDir, "client", "http://localhost/callback")
+	ctx := context.Background()
+
+	if p.UploadEnabled() {
+		t.Error("Expected uploads to be off without allowUpload")
+	}
+	if _, err := p.UploadFile(ctx, "f1", `"v1"`, strings.NewReader("new")); err == nil || !strings.Contains(err.Error(), "upload not enabled") {
+		t.Fatalf("Expected uploads to need allowUpload, got %v", err)
+	}
+
+	var uploaded string
+	p.EnableUpload()
+	p.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodPut || req.URL.String() != msGraphURL+"/me/drive/items/f1/content" {
+			return jsonResponse(http.StatusNotFound, `{"error":{"code":"itemNotFound"}}`), nil
+		}
+		if req.Header.Get("If-Match") != `"v1"` {
+			return jsonResponse(http.StatusPreconditionFailed, `{"error":{"code":"resourceModified"}}`), nil
+		}
+		body, _ := io.ReadAll(req.Body)
+		uploaded = string(body)
+		return jsonResponse(http.StatusOK, `{"id":"f1","eTag":"\"v2\"","lastModifiedDateTime":"2024-01-02T03:04:05Z"}`), nil
+	})})
+
+	if !p.UploadEnabled() {
+		t.Error("Expected uploads to be on after EnableUpload")
+	}
+	result, err := p.UploadFile(ctx, "f1", `"v1"`, strings.NewReader("new"))
+	if err != nil {
+		t.Fatalf("UploadFile failed: %v", err)
+	}
+	if uploaded != "new" {
+		t.Errorf("Expected the content to be uploaded, got %q", uploaded)
+	}
+	if result.ETag != `"v2"` || result.LastModified != "Tue, 02 Jan 2024 03:04:05 GMT" {
+		t.Errorf("Expected the new version to be reported, got %+v", result)
+	}
+	if _, err := p.UploadFile(ctx, "f1", `"stale"`, strings.NewReader("new")); !errors.Is(err, provider.ErrUploadConflict) {
+		t.Errorf("Expected a 412 to be an upload conflict, got %v", err)
+	}
+	if _, err := p.UploadFile(ctx, "missing", `"v1"`, strings.NewReader("new")); err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("Expected a 404 upload failure, got %v", err)
+	}
+
+	if authURL, _ := p.GetAuthURL(ctx); !strings.Contains(authURL, "Files.ReadWrite") {
+		t.Errorf("Expected sign-in to request write access, got %s", authURL)
+	}
+}
+
+func TestDownloadFile_EmptyBodyNeedsEmptyItem(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTestTokens(t, tmpDir)
+	p := NewOneDriveProvider(tmpDir, "client", "http://localhost/callback")
+
+	sizes := map[string]string{"empty": `{"size":0}`, "full": `{"size":2048}`}
+	p.SetHTTPClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		for id, item := range sizes {
+			switch req.URL.String() {
+			case msGraphURL + "/me/drive/items/" + id + "/content":
+				resp := jsonResponse(http.StatusOK, "")
+				resp.ContentLength = 0
+				return resp, nil
+			case msGraphURL + "/me/drive/items/" + id + "?$select=size":
+				return jsonResponse(http.StatusOK, item), nil
+			}
+		}
+		return jsonResponse(http.StatusNotFound, `{"error":{"code":"itemNotFound"}}`), nil
+	})})
+
+	for id, want := range map[string]bool{"empty": true, "full": false} {
+		result, err := p.DownloadFile(context.Background(), id)
+		if err != nil {
+			t.Fatalf("DownloadFile(%s) failed: %v", id, err)
+		}
+		result.Content.Close()
+		if result.ExpectEmpty != want {
+			t.Errorf("%s: expected ExpectEmpty %v for a 200 with Content-Length: 0, got %v", id, want, result.ExpectEmpty)
+		}
+	}
+}
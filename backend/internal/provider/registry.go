@@ -1,22 +1,28 @@
 package provider
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 )
 
 // Registry manages provider discovery and creation
 type Registry struct {
 	factories map[string]ProviderFactory
+	types     map[string]ProviderType
 }
 
 // NewRegistry creates a new provider registry
 func NewRegistry() *Registry {
 	return &Registry{
 		factories: make(map[string]ProviderFactory),
+		types:     make(map[string]ProviderType),
 	}
 }
 
@@ -25,26 +31,43 @@ func (r *Registry) Register(providerID string, factory ProviderFactory) {
 	r.factories[providerID] = factory
 }
 
-// Discover scans safesDir for valid provider configs and creates providers.
-// Returns map of providerID -> SyncableSafesProvider for successfully created providers.
-func (r *Registry) Discover(safesDir string) (map[string]SyncableSafesProvider, error) {
-	// Step 1: Read root settings.json for baseURL
-	rootSettingsPath := filepath.Join(safesDir, "settings.json")
-	rootData, err := os.ReadFile(rootSettingsPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("settings.json not found in %s: baseUrl is required", safesDir)
+// RegisterType adds a provider factory along with the metadata listed by Types
+func (r *Registry) RegisterType(t ProviderType, factory ProviderFactory) {
+	r.Register(t.ID, factory)
+	r.types[t.ID] = t
+}
+
+// Types lists every registered provider type sorted by ID, with the common
+// settings fields appended to each type's own. Factories added with Register
+// have no metadata beyond their ID.
+func (r *Registry) Types() []ProviderType {
+	types := make([]ProviderType, 0, len(r.factories))
+	for id := range r.factories {
+		t, ok := r.types[id]
+		if !ok {
+			t = ProviderType{ID: id}
 		}
-		return nil, fmt.Errorf("failed to read settings.json: %w", err)
+		t.Settings = append(slices.Clip(t.Settings), CommonSettingsSchema...)
+		types = append(types, t)
 	}
+	slices.SortFunc(types, func(a, b ProviderType) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return types
+}
 
-	var rootSettings RootSettings
-	if err := json.Unmarshal(rootData, &rootSettings); err != nil {
-		return nil, fmt.Errorf("invalid settings.json: %w", err)
+// Discover scans safesDir for valid provider configs and creates providers.
+// Returns map of providerID -> SyncableSafesProvider for successfully created providers.
+func (r *Registry) Discover(safesDir string) (map[string]SyncableSafesProvider, error) {
+	// Step 1: Read root settings.json for baseURL. Without one, only static
+	// safes are served - that's a valid setup, not an error
+	if _, err := os.Stat(filepath.Join(safesDir, "settings.json")); os.IsNotExist(err) {
+		log.Printf("No settings.json in %s, skipping provider discovery", safesDir)
+		return map[string]SyncableSafesProvider{}, nil
 	}
-
-	if rootSettings.BaseURL == "" {
-		return nil, fmt.Errorf("baseUrl is required in settings.json")
+	rootSettings, err := LoadRootSettings(safesDir)
+	if err != nil {
+		return nil, err
 	}
 
 	// Step 2: Scan for provider subdirectories
@@ -83,6 +106,21 @@ func (r *Registry) Discover(safesDir string) (map[string]SyncableSafesProvider,
 			continue
 		}
 
+		// Fail this provider early if its custom CA can't be used for requests
+		common := LoadCommonSettings(providerDir)
+		if _, err := common.RootCAs(providerDir); err != nil {
+			log.Printf("Warning: failed to create %s provider: %v", providerID, err)
+			continue
+		}
+		if err := common.Exclude.Validate(); err != nil {
+			log.Printf("Warning: failed to create %s provider: %v", providerID, err)
+			continue
+		}
+		if err := common.Headers.Validate(); err != nil {
+			log.Printf("Warning: failed to create %s provider: %v", providerID, err)
+			continue
+		}
+
 		// Try to create the provider
 		provider, err := factory(providerDir, rootSettings.BaseURL, settingsData)
 		if err != nil {
@@ -96,3 +134,166 @@ func (r *Registry) Discover(safesDir string) (map[string]SyncableSafesProvider,
 
 	return providers, nil
 }
+
+// CheckPermissions reports safesDir and every registered provider directory
+// under it that group or other users can access. Tokens and settings are
+// written 0600 inside 0700 directories, but a directory the operator created
+// by hand may be looser. Returns nil on platforms without Unix permissions.
+func (r *Registry) CheckPermissions(safesDir string) []string {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	dirs := []string{safesDir}
+	for id := range r.factories {
+		dirs = append(dirs, filepath.Join(safesDir, id))
+	}
+	slices.Sort(dirs[1:])
+
+	var problems []string
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if perm := info.Mode().Perm(); perm&0077 != 0 {
+			problems = append(problems, fmt.Sprintf("%s is accessible by other users (mode %04o, expected 0700)", dir, perm))
+		}
+	}
+	return problems
+}
+
+// CheckWritable reports an error if files can't be created in dir, or in its
+// nearest existing parent when dir doesn't exist yet. A read-only mount lists
+// and unlocks fine but fails every sync and token write.
+func CheckWritable(dir string) error {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// Configure validates settingsJSON with the provider's factory, then writes it
+// as {safesDir}/{providerID}/settings.json, replacing any existing settings.
+// Returns the provider created from the new settings.
+func (r *Registry) Configure(safesDir, providerID string, settingsJSON []byte) (SyncableSafesProvider, error) {
+	factory, ok := r.factories[providerID]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider type: %s", providerID)
+	}
+
+	var common CommonSettings
+	if err := json.Unmarshal(settingsJSON, &common); err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+
+	rootSettings, err := LoadRootSettings(safesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	providerDir := filepath.Join(safesDir, providerID)
+	if _, err := common.RootCAs(providerDir); err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+	if err := common.Exclude.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+	if err := common.Headers.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+	provider, err := factory(providerDir, rootSettings.BaseURL, settingsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+
+	if err := os.MkdirAll(providerDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create provider directory: %w", err)
+	}
+	settingsPath := filepath.Join(providerDir, "settings.json")
+	tmpPath := settingsPath + ".tmp"
+	if err := os.WriteFile(tmpPath, settingsJSON, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write settings: %w", err)
+	}
+	if err := os.Rename(tmpPath, settingsPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to write settings: %w", err)
+	}
+
+	log.Printf("Configured provider: %s", providerID)
+	return provider, nil
+}
+
+// LoadRootSettings reads and validates {safesDir}/settings.json
+func LoadRootSettings(safesDir string) (*RootSettings, error) {
+	rootSettingsPath := filepath.Join(safesDir, "settings.json")
+	rootData, err := os.ReadFile(rootSettingsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("settings.json not found in %s: baseUrl is required", safesDir)
+		}
+		return nil, fmt.Errorf("failed to read settings.json: %w", err)
+	}
+
+	var rootSettings RootSettings
+	if err := json.Unmarshal(rootData, &rootSettings); err != nil {
+		return nil, fmt.Errorf("invalid settings.json: %w", err)
+	}
+
+	if rootSettings.BaseURL == "" {
+		return nil, fmt.Errorf("baseUrl is required in settings.json")
+	}
+
+	return &rootSettings, nil
+}
+
+// LoadCommonSettings reads the provider-agnostic fields from {providerDir}/settings.json.
+// Missing or invalid files yield zero-value settings.
+func LoadCommonSettings(providerDir string) CommonSettings {
+	var settings CommonSettings
+	data, err := os.ReadFile(filepath.Join(providerDir, "settings.json"))
+	if err != nil {
+		return settings
+	}
+	json.Unmarshal(data, &settings)
+	return settings
+}
+
+// RootCAs returns the system roots plus the certificates from CACertPath,
+// or nil if no custom CA is configured
+func (c CommonSettings) RootCAs(providerDir string) (*x509.CertPool, error) {
+	if c.CACertPath == "" {
+		return nil, nil
+	}
+
+	path := c.CACertPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(providerDir, path)
+	}
+	pemData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read caCertPath: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("caCertPath %s contains no valid PEM certificates", c.CACertPath)
+	}
+	return pool, nil
+}
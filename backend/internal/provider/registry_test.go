@@ -2,9 +2,15 @@ package provider
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -30,6 +36,7 @@ func (m *mockProvider) BrandColor() string
 func (m *mockProvider) GetAuthURL(ctx context.Context) (string, error)          { return "", nil }
 func (m *mockProvider) HandleCallback(ctx context.Context, code string) error   { return nil }
 func (m *mockProvider) Disconnect(ctx context.Context) error                    { return nil }
+func (m *mockProvider) ResetAuthState(ctx context.Context) error                { return nil }
 func (m *mockProvider) GetConnectionStatus(ctx context.Context, attemptRefresh bool) (*ConnectionStatus, error) {
 	return &ConnectionStatus{}, nil
 }
@@ -82,9 +89,53 @@ func TestRegistry_Discover_MissingRootSettings(t *testing.T) {
 	registry := NewRegistry()
 	registry.Register("testprovider", mockFactory)
 
-	_, err := registry.Discover(tmpDir)
-	if err == nil {
-		t.Error("Expected error when root settings.json is missing")
+	// Static-only setups need no provider config, so discovery is skipped
+	providers, err := registry.Discover(tmpDir)
+	if err != nil {
+		t.Fatalf("Expected missing root settings.json to be non-fatal, got: %v", err)
+	}
+	if len(providers) != 0 {
+		t.Errorf("Expected no providers, got %d", len(providers))
+	}
+}
+
+func TestRegistry_Discover_MissingRootSettingsSkipsProviders(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A configured provider is still ignored without root settings.json
+	providerDir := filepath.Join(tmpDir, "testprovider")
+	if err := os.MkdirAll(providerDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(providerDir, "settings.json"), []byte(`{"clientId": "test-client"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewRegistry()
+	registry.Register("testprovider", mockFactory)
+
+	providers, err := registry.Discover(tmpDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(providers) != 0 {
+		t.Errorf("Expected providers to be skipped without root settings, got %d", len(providers))
+	}
+}
+
+func TestRegistry_Discover_InvalidRootSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A present but broken settings.json is still a configuration error
+	if err := os.WriteFile(filepath.Join(tmpDir, "settings.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewRegistry()
+	registry.Register("testprovider", mockFactory)
+
+	if _, err := registry.Discover(tmpDir); err == nil {
+		t.Error("Expected error when baseUrl is missing from settings.json")
 	}
 }
 
@@ -259,3 +310,227 @@ func TestRegistry_Discover_BaseURLPassedToFactory(t *testing.T) {
 		t.Errorf("Expected baseURL %q, got %q", expectedBaseURL, capturedBaseURL)
 	}
 }
+
+func writeDiscoverFixture(t *testing.T, providerSettings string) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "settings.json"), []byte(`{"baseUrl": "http://localhost:8080"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	providerDir := filepath.Join(tmpDir, "testprovider")
+	if err := os.MkdirAll(providerDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(providerDir, "settings.json"), []byte(providerSettings), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return tmpDir
+}
+
+func TestRegistry_Discover_CustomCACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	tmpDir := writeDiscoverFixture(t, `{"clientId": "test-client", "caCertPath": "ca.pem"}`)
+	providerDir := filepath.Join(tmpDir, "testprovider")
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(filepath.Join(providerDir, "ca.pem"), pemData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewRegistry()
+	registry.Register("testprovider", mockFactory)
+
+	providers, err := registry.Discover(tmpDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if len(providers) != 1 {
+		t.Fatalf("Expected provider with valid CA to be discovered, got %d", len(providers))
+	}
+
+	// The loaded pool verifies the server's certificate
+	rootCAs, err := LoadCommonSettings(providerDir).RootCAs(providerDir)
+	if err != nil {
+		t.Fatalf("RootCAs failed: %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs}}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected TLS request to verify against custom CA, got: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestRegistry_Discover_InvalidCACert(t *testing.T) {
+	for _, settings := range []string{
+		`{"clientId": "test-client", "caCertPath": "missing.pem"}`,
+		`{"clientId": "test-client", "caCertPath": "settings.json"}`, // not PEM
+	} {
+		tmpDir := writeDiscoverFixture(t, settings)
+
+		registry := NewRegistry()
+		registry.Register("testprovider", mockFactory)
+
+		providers, err := registry.Discover(tmpDir)
+		if err != nil {
+			t.Fatalf("Discover should not fail: %v", err)
+		}
+		if len(providers) != 0 {
+			t.Errorf("Expected provider with unusable CA (%s) to be skipped", settings)
+		}
+	}
+}
+
+func TestRegistry_Types(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("zeta", mockFactory)
+	registry.RegisterType(ProviderType{ID: "alpha", DisplayName: "Alpha"}, mockFactory)
+
+	types := registry.Types()
+	if len(types) != 2 {
+		t.Fatalf("Expected 2 types, got %d", len(types))
+	}
+	if types[0].ID != "alpha" || types[0].DisplayName != "Alpha" {
+		t.Errorf("Expected alpha with metadata first, got %+v", types[0])
+	}
+	if types[1].ID != "zeta" {
+		t.Errorf("Expected zeta second, got %+v", types[1])
+	}
+}
+
+func TestRegistry_Types_IncludesCommonSettings(t *testing.T) {
+	registry := NewRegistry()
+	own := []SettingsField{{Name: "secretKey", Type: SettingsTypeString, Required: true, Secret: true}}
+	registry.RegisterType(ProviderType{ID: "s3", Settings: own}, mockFactory)
+
+	fields := registry.Types()[0].Settings
+	if len(fields) != 1+len(CommonSettingsSchema) {
+		t.Fatalf("Expected own and common fields, got %+v", fields)
+	}
+	if fields[0].Name != "secretKey" || !fields[0].Secret {
+		t.Errorf("Expected provider's own field first, got %+v", fields[0])
+	}
+	if fields[1].Name != CommonSettingsSchema[0].Name {
+		t.Errorf("Expected common fields after own fields, got %+v", fields[1])
+	}
+
+	// Listing twice must not accumulate common fields
+	if again := registry.Types()[0].Settings; len(again) != len(fields) {
+		t.Errorf("Expected %d fields on second call, got %d", len(fields), len(again))
+	}
+}
+
+func TestRegistry_Configure_WritesSettingsForDiscover(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "settings.json"), []byte(`{"baseUrl": "http://localhost:8080"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewRegistry()
+	registry.Register("testprovider", mockFactory)
+
+	p, err := registry.Configure(tmpDir, "testprovider", []byte(`{"clientId": "new-client"}`))
+	if err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if p.ID() != "testprovider" {
+		t.Errorf("Expected testprovider, got %s", p.ID())
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "testprovider", "settings.json"))
+	if err != nil {
+		t.Fatalf("Expected settings.json to be written: %v", err)
+	}
+	if string(content) != `{"clientId": "new-client"}` {
+		t.Errorf("Unexpected settings.json content: %s", content)
+	}
+
+	providers, err := registry.Discover(tmpDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if _, ok := providers["testprovider"]; !ok {
+		t.Error("Expected configured provider to be discovered")
+	}
+}
+
+func TestRegistry_Configure_RejectsInvalidSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "settings.json"), []byte(`{"baseUrl": "http://localhost:8080"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rejectingFactory := func(providerDir, baseURL string, settingsJSON []byte) (SyncableSafesProvider, error) {
+		return nil, fmt.Errorf("clientId is required in settings.json")
+	}
+	registry := NewRegistry()
+	registry.Register("testprovider", rejectingFactory)
+
+	tests := []struct {
+		name       string
+		providerID string
+		settings   string
+		wantErr    string
+	}{
+		{"unknown type", "nope", `{}`, "unknown provider type"},
+		{"factory rejects", "testprovider", `{}`, "invalid settings"},
+		{"not an object", "testprovider", `[]`, "invalid settings"},
+		{"missing CA bundle", "testprovider", `{"caCertPath": "missing.pem"}`, "invalid settings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := registry.Configure(tmpDir, tt.providerID, []byte(tt.settings))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected %q error, got %v", tt.wantErr, err)
+			}
+			if _, statErr := os.Stat(filepath.Join(tmpDir, tt.providerID, "settings.json")); !os.IsNotExist(statErr) {
+				t.Error("Expected no settings.json to be written")
+			}
+		})
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	safesDir := t.TempDir()
+	os.Chmod(safesDir, 0700)
+	os.Mkdir(filepath.Join(safesDir, "mock"), 0700)
+	os.Mkdir(filepath.Join(safesDir, "other"), 0755) // not a registered provider
+
+	registry := NewRegistry()
+	registry.Register("mock", mockFactory)
+	registry.Register("absent", mockFactory)
+
+	if problems := registry.CheckPermissions(safesDir); len(problems) != 0 {
+		t.Fatalf("Expected no problems, got %v", problems)
+	}
+
+	os.Chmod(safesDir, 0750)
+	os.Chmod(filepath.Join(safesDir, "mock"), 0705)
+	problems := registry.CheckPermissions(safesDir)
+	if len(problems) != 2 {
+		t.Fatalf("Expected safes and provider directories reported, got %v", problems)
+	}
+	if !strings.Contains(problems[0], "mode 0750") || !strings.Contains(problems[1], filepath.Join(safesDir, "mock")) {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckWritable(filepath.Join(dir, "not-yet-created")); err != nil {
+		t.Errorf("Expected writable directory, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the check to leave nothing behind, found %v", entries)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	os.Chmod(dir, 0500)
+	defer os.Chmod(dir, 0700)
+	if err := CheckWritable(dir); err == nil {
+		t.Error("Expected read-only directory to be reported")
+	}
+}
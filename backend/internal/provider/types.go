@@ -2,12 +2,24 @@ package provider
 
 import "time"
 
-// RemoteFile represents a file discovered on a remote storage provider
+// RemoteFile represents a file discovered on a remote storage provider.
+//
+// ID may be any string the provider can later resolve in DownloadFile - an API
+// item ID, or the remote path itself for path-addressed stores (WebDAV, S3,
+// local filesystems). The sync service only compares and stores IDs; it never
+// parses them or uses them to build local paths, which come from Path and Name.
 type RemoteFile struct {
-	ID           string    // Provider-specific unique identifier
+	ID           string    // Provider-defined unique identifier, opaque to the sync service
 	Name         string    // Display name (e.g., "passwords.psafe3")
 	Path         string    // Parent folder path (e.g., "/Documents/Passwords")
 	LastModified time.Time // Optional: for smarter sync decisions
+	ETag         string    // Optional: opaque version tag, matches DownloadResult.ETag
+}
+
+// FolderListing is the contents of one remote folder
+type FolderListing struct {
+	Folders []string     // Names of the folder's subfolders
+	Files   []RemoteFile // Safe files directly in the folder
 }
 
 // ConnectionStatus represents the connection/auth state of a provider
@@ -18,9 +30,83 @@ type ConnectionStatus struct {
 	AccountEmail string
 }
 
+// Quota is an account's storage usage in bytes
+type Quota struct {
+	Used      int64 `json:"used"`
+	Total     int64 `json:"total"`
+	Remaining int64 `json:"remaining"`
+}
+
+// DeviceCode is a pending device-code sign-in
+type DeviceCode struct {
+	UserCode        string    `json:"userCode"`
+	VerificationURI string    `json:"verificationUri"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+	Message         string    `json:"message,omitempty"` // Provider's instructions for the user
+
+	DeviceCode string        `json:"-"` // Secret the server polls with
+	Interval   time.Duration `json:"-"` // Minimum wait between polls
+}
+
 // RootSettings represents {safesDirectory}/settings.json
 type RootSettings struct {
-	BaseURL string `json:"baseUrl"` // e.g., "http://localhost:8080"
+	BaseURL             string `json:"baseUrl"`                       // e.g., "http://localhost:8080"
+	OnSyncWebhook       string `json:"onSyncWebhook,omitempty"`       // Optional URL to POST a summary to after each sync
+	AllowPrivateWebhook bool   `json:"allowPrivateWebhook,omitempty"` // Allow webhook targets on private/loopback addresses
+	FlattenPaths        bool   `json:"flattenPaths,omitempty"`        // Store synced files directly under each provider dir instead of by remote path
+	SyncLogPath         string `json:"syncLogPath,omitempty"`         // Optional file each sync appends a JSON line to; relative to the safes dir
+}
+
+// CommonSettings holds provider-agnostic fields any {provider}/settings.json may set
+type CommonSettings struct {
+	OnSyncWebhook string `json:"onSyncWebhook,omitempty"` // Overrides the root onSyncWebhook for this provider
+	CACertPath    string `json:"caCertPath,omitempty"`    // PEM bundle trusted in addition to system roots; relative to the provider dir
+	FlattenPaths  *bool  `json:"flattenPaths,omitempty"`  // Overrides the root flattenPaths for this provider
+
+	SyncIntervalMinutes int `json:"syncIntervalMinutes,omitempty"` // Minutes between periodic syncs; absent or under 1 uses the default
+
+	Exclude ExcludePatterns `json:"exclude,omitempty"` // Remote files and folders never listed or synced
+	Headers Headers         `json:"headers,omitempty"` // Extra headers sent on every request the provider makes
+}
+
+// ProviderType describes a provider the binary supports, whether or not an
+// instance is configured
+type ProviderType struct {
+	ID          string          `json:"id"`
+	DisplayName string          `json:"displayName"`
+	Icon        string          `json:"icon"` // Base64-encoded image (data URL)
+	BrandColor  string          `json:"brandColor"`
+	Settings    []SettingsField `json:"settings"` // Provider-specific fields of {provider}/settings.json
+}
+
+// SettingsField describes one field of a provider's settings.json, enough for
+// the UI to render a configuration form
+type SettingsField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // One of the SettingsType* values
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Secret      bool   `json:"secret,omitempty"` // Mask in forms (keys, passwords)
+}
+
+// JSON value types a SettingsField may hold
+const (
+	SettingsTypeString  = "string"
+	SettingsTypeNumber  = "number"
+	SettingsTypeBoolean = "boolean"
+	SettingsTypeArray   = "array"  // of strings
+	SettingsTypeObject  = "object" // of string values
+)
+
+// CommonSettingsSchema describes the CommonSettings fields every provider's
+// settings.json accepts. Types appends it to each provider type's own fields.
+var CommonSettingsSchema = []SettingsField{
+	{Name: "onSyncWebhook", Type: SettingsTypeString, Description: "URL to POST a summary to after each sync, overriding the root setting"},
+	{Name: "caCertPath", Type: SettingsTypeString, Description: "PEM bundle trusted in addition to system roots, relative to the provider directory"},
+	{Name: "flattenPaths", Type: SettingsTypeBoolean, Description: "Store synced files directly in the provider directory instead of by remote folder, overriding the root setting"},
+	{Name: "syncIntervalMinutes", Type: SettingsTypeNumber, Description: "Minutes between periodic syncs, at least 1; defaults to 15"},
+	{Name: "exclude", Type: SettingsTypeArray, Description: "Glob patterns for remote files or folders that are never listed or synced, e.g. \"*template*\" or \"/Archive\""},
+	{Name: "headers", Type: SettingsTypeObject, Description: "Extra HTTP headers sent on every request to the provider, e.g. for an auth proxy", Secret: true},
 }
 
 // ProviderFactory creates a provider from its settings.json
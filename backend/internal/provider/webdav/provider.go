@@ -0,0 +1,452 @@
+package webdav
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/provider"
+)
+
+const (
+	statusCacheTTL = 30 * time.Second
+
+	// Nextcloud brand color
+	webdavBrandColor = "#0082C9"
+)
+
+// propfindBody asks only for the properties listings need
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getetag/><d:getlastmodified/><d:getcontentlength/></d:prop></d:propfind>`
+
+// iconSVG is a generic cloud storage icon
+//
+//go:embed icon.svg
+var iconSVG []byte
+
+// webdavIcon is iconSVG as a data URL
+var webdavIcon = provider.NewIcon(iconSVG).DataURL()
+
+// Type describes the WebDAV provider for the provider types listing
+var Type = provider.ProviderType{
+	ID:          "webdav",
+	DisplayName: "WebDAV",
+	Icon:        webdavIcon,
+	BrandColor:  webdavBrandColor,
+	Settings: []provider.SettingsField{
+		{Name: "baseUrl", Type: provider.SettingsTypeString, Description: "WebDAV root URL, e.g. https://cloud.example.com/remote.php/dav/files/alice for Nextcloud", Required: true},
+		{Name: "username", Type: provider.SettingsTypeString, Description: "Account user name", Required: true},
+		{Name: "password", Type: provider.SettingsTypeString, Description: "App password for the account", Required: true, Secret: true},
+		{Name: "directory", Type: provider.SettingsTypeString, Description: "Folder under baseUrl searched for safes, including subfolders; defaults to the whole share"},
+	},
+}
+
+// Settings represents the WebDAV provider settings from settings.json
+type Settings struct {
+	BaseURL   string `json:"baseUrl"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Directory string `json:"directory,omitempty"`
+}
+
+// WebDAVProvider implements provider.SyncableSafesProvider for any WebDAV
+// server, such as Nextcloud or ownCloud. Credentials come from settings.json,
+// so there is no sign-in flow. Remote paths are relative to the base URL and
+// double as file IDs.
+type WebDAVProvider struct {
+	baseURL    *url.URL
+	username   string
+	password   string
+	directory  string // Cleaned absolute path searched by ListRemoteFiles
+	httpClient *http.Client
+	extensions provider.Extensions
+
+	// Last credential check, so status polls don't hit the server every time
+	statusMutex  sync.Mutex
+	cachedStatus *provider.ConnectionStatus
+	cachedAt     time.Time
+}
+
+// Factory creates a WebDAVProvider from settings.json content
+func Factory(providerDir string, baseURL string, settingsJSON []byte) (provider.SyncableSafesProvider, error) {
+	var settings Settings
+	if err := json.Unmarshal(settingsJSON, &settings); err != nil {
+		return nil, fmt.Errorf("invalid settings.json: %w", err)
+	}
+	if settings.BaseURL == "" {
+		return nil, fmt.Errorf("baseUrl is required in settings.json")
+	}
+	if settings.Username == "" || settings.Password == "" {
+		return nil, fmt.Errorf("username and password are required in settings.json")
+	}
+	return NewWebDAVProvider(settings)
+}
+
+// NewWebDAVProvider creates a new WebDAV provider
+func NewWebDAVProvider(settings Settings) (*WebDAVProvider, error) {
+	u, err := url.Parse(settings.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("baseUrl must be an http or https URL")
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	return &WebDAVProvider{
+		baseURL:    u,
+		username:   settings.Username,
+		password:   settings.Password,
+		directory:  path.Clean("/" + settings.Directory),
+		httpClient: http.DefaultClient,
+		extensions: provider.DefaultExtensions,
+	}, nil
+}
+
+// SetHTTPClient replaces the client used for all WebDAV requests
+func (p *WebDAVProvider) SetHTTPClient(client *http.Client) {
+	p.httpClient = client
+}
+
+// APIHosts returns the host of baseUrl, which every request goes to
+func (p *WebDAVProvider) APIHosts() []string {
+	return []string{p.baseURL.Host}
+}
+
+// SetExtensions sets which file extensions are listed
+func (p *WebDAVProvider) SetExtensions(exts provider.Extensions) {
+	if len(exts) > 0 {
+		p.extensions = exts
+	}
+}
+
+// ============ IDENTITY (2 methods) ============
+
+func (p *WebDAVProvider) ID() string {
+	return Type.ID
+}
+
+func (p *WebDAVProvider) DisplayName() string {
+	return Type.DisplayName
+}
+
+// ============ METADATA (2 methods) ============
+
+func (p *WebDAVProvider) Icon() string {
+	return webdavIcon
+}
+
+func (p *WebDAVProvider) BrandColor() string {
+	return webdavBrandColor
+}
+
+// ============ AUTH (5 methods) ============
+
+// GetAuthURL returns an empty URL: WebDAV uses basic auth with the
+// credentials in settings.json, so there is nothing to sign in to
+func (p *WebDAVProvider) GetAuthURL(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+func (p *WebDAVProvider) HandleCallback(ctx context.Context, code string) error {
+	return fmt.Errorf("WebDAV has no sign-in callback; credentials are set in settings.json")
+}
+
+// Disconnect only forgets the last credential check, since the credentials
+// live in settings.json
+func (p *WebDAVProvider) Disconnect(ctx context.Context) error {
+	p.statusMutex.Lock()
+	defer p.statusMutex.Unlock()
+
+	p.cachedStatus = nil
+	return nil
+}
+
+func (p *WebDAVProvider) ResetAuthState(ctx context.Context) error {
+	return nil
+}
+
+// GetConnectionStatus checks the credentials with a depth-0 PROPFIND of the
+// configured directory. The result is cached briefly unless attemptRefresh
+// asks for a fresh check.
+func (p *WebDAVProvider) GetConnectionStatus(ctx context.Context, attemptRefresh bool) (*provider.ConnectionStatus, error) {
+	p.statusMutex.Lock()
+	defer p.statusMutex.Unlock()
+
+	if !attemptRefresh && p.cachedStatus != nil && time.Since(p.cachedAt) < statusCacheTTL {
+		status := *p.cachedStatus
+		return &status, nil
+	}
+
+	status := &provider.ConnectionStatus{AccountName: p.username}
+	if _, err := p.propfind(ctx, p.directory, "0"); err != nil {
+		if strings.Contains(err.Error(), "REAUTH_REQUIRED") {
+			status.NeedsReauth = true
+		} else {
+			log.Printf("WebDAV: connection check failed: %v", err)
+		}
+	} else {
+		status.Connected = true
+	}
+
+	cached := *status
+	p.cachedStatus = &cached
+	p.cachedAt = time.Now()
+	return status, nil
+}
+
+// ============ REMOTE OPERATIONS (2 methods - the core primitives) ============
+
+// ListRemoteFiles walks the configured directory one level at a time, since
+// servers such as Nextcloud reject Depth: infinity
+func (p *WebDAVProvider) ListRemoteFiles(ctx context.Context) ([]provider.RemoteFile, error) {
+	var files []provider.RemoteFile
+	pending := []string{p.directory}
+	seen := map[string]bool{p.directory: true}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		entries, err := p.propfind(ctx, dir, "1")
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.path == dir {
+				continue
+			}
+			if entry.isDir {
+				if !seen[entry.path] {
+					seen[entry.path] = true
+					pending = append(pending, entry.path)
+				}
+			} else if p.extensions.Match(path.Base(entry.path)) {
+				files = append(files, entry.remoteFile())
+			}
+		}
+	}
+	return files, nil
+}
+
+// BrowseFolder lists a folder's subfolders and safe files with a depth-1 PROPFIND
+func (p *WebDAVProvider) BrowseFolder(ctx context.Context, folderPath string) (*provider.FolderListing, error) {
+	dir := path.Clean("/" + folderPath)
+	entries, err := p.propfind(ctx, dir, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	listing := &provider.FolderListing{Folders: []string{}, Files: []provider.RemoteFile{}}
+	for _, entry := range entries {
+		if entry.path == dir {
+			continue
+		}
+		if entry.isDir {
+			listing.Folders = append(listing.Folders, path.Base(entry.path))
+		} else if p.extensions.Match(path.Base(entry.path)) {
+			listing.Files = append(listing.Files, entry.remoteFile())
+		}
+	}
+	return listing, nil
+}
+
+func (p *WebDAVProvider) DownloadFile(ctx context.Context, fileID string) (*provider.DownloadResult, error) {
+	return p.DownloadFileIfNoneMatch(ctx, fileID, "")
+}
+
+// DownloadFileIfNoneMatch downloads the file unless its ETag still matches etag
+func (p *WebDAVProvider) DownloadFileIfNoneMatch(ctx context.Context, fileID, etag string) (*provider.DownloadResult, error) {
+	// IDs are remote paths; refuse anything that isn't already clean
+	if !strings.HasPrefix(fileID, "/") || path.Clean(fileID) != fileID || fileID == "/" {
+		return nil, fmt.Errorf("invalid file ID: %s", fileID)
+	}
+
+	req, err := p.newRequest(ctx, http.MethodGet, fileID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download request failed: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return &provider.DownloadResult{
+			LastModified: resp.Header.Get("Last-Modified"),
+			ETag:         etag,
+			NotModified:  true,
+		}, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if isAuthFailure(resp.StatusCode) {
+			return nil, fmt.Errorf("REAUTH_REQUIRED: WebDAV server rejected the credentials")
+		}
+		return nil, fmt.Errorf("download failed with %w", &provider.StatusError{StatusCode: resp.StatusCode, Body: string(body)})
+	}
+
+	// An empty body is only trusted when the listing says the file is
+	// empty; a faulty response can't vouch for itself
+	expectEmpty := false
+	if resp.ContentLength == 0 {
+		entries, err := p.propfind(ctx, fileID, "0")
+		expectEmpty = err == nil && len(entries) == 1 && entries[0].size == 0
+	}
+
+	// Return the body stream and last modified - caller is responsible for closing
+	return &provider.DownloadResult{
+		Content:      resp.Body,
+		LastModified: resp.Header.Get("Last-Modified"),
+		ETag:         resp.Header.Get("ETag"),
+		ExpectEmpty:  expectEmpty,
+		Size:         max(resp.ContentLength, 0), // -1 when the length is unknown
+		// Still set only when the transport didn't decompress the body itself
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+	}, nil
+}
+
+// ============ PRIVATE HELPERS (WebDAV requests) ============
+
+// davEntry is one resource from a PROPFIND response
+type davEntry struct {
+	path         string // Relative to the base URL, e.g. "/Passwords/work.psafe3"
+	isDir        bool
+	etag         string
+	lastModified time.Time
+	size         int64 // -1 when the server didn't report one
+}
+
+func (e davEntry) remoteFile() provider.RemoteFile {
+	return provider.RemoteFile{
+		ID:           e.path,
+		Name:         path.Base(e.path),
+		Path:         path.Dir(e.path),
+		LastModified: e.lastModified,
+		ETag:         e.etag,
+	}
+}
+
+// multistatus is the body of a 207 Multi-Status response
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ETag          string `xml:"DAV: getetag"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// propfind lists remotePath ("0") or it and its children ("1")
+func (p *WebDAVProvider) propfind(ctx context.Context, remotePath, depth string) ([]davEntry, error) {
+	req, err := p.newRequest(ctx, "PROPFIND", remotePath, strings.NewReader(propfindBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("list request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if isAuthFailure(resp.StatusCode) {
+		return nil, fmt.Errorf("REAUTH_REQUIRED: WebDAV server rejected the credentials")
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("folder not found: %s", remotePath)
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("failed to decode list response: %w", err)
+	}
+
+	var entries []davEntry
+	for _, r := range ms.Responses {
+		entryPath, ok := p.remotePath(r.Href)
+		if !ok {
+			continue
+		}
+		entry := davEntry{path: entryPath, size: -1}
+		for _, ps := range r.Propstat {
+			// Properties the server doesn't have come back in a 404 propstat
+			if ps.Status != "" && !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			entry.isDir = entry.isDir || ps.Prop.ResourceType.Collection != nil
+			if ps.Prop.ETag != "" {
+				entry.etag = ps.Prop.ETag
+			}
+			if t, err := http.ParseTime(ps.Prop.LastModified); err == nil {
+				entry.lastModified = t
+			}
+			if n, err := strconv.ParseInt(strings.TrimSpace(ps.Prop.ContentLength), 10, 64); err == nil {
+				entry.size = n
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// remotePath converts a response href (a path or full URL, percent-encoded)
+// to a cleaned path relative to the base URL. Hrefs outside it are dropped.
+func (p *WebDAVProvider) remotePath(href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(u.Path, p.baseURL.Path)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return "", false
+	}
+	return path.Clean("/" + rest), true
+}
+
+// newRequest builds an authenticated request for remotePath under the base URL
+func (p *WebDAVProvider) newRequest(ctx context.Context, method, remotePath string, body io.Reader) (*http.Request, error) {
+	u := *p.baseURL
+	u.Path = p.baseURL.Path + path.Clean("/"+remotePath)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(p.username, p.password)
+	return req, nil
+}
+
+func isAuthFailure(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
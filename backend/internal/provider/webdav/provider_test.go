@@ -0,0 +1,230 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeDAV serves a small tree under /dav/files/alice the way Nextcloud does:
+// hrefs are percent-encoded and only Depth 0 and 1 are accepted
+func fakeDAV(t *testing.T) *httptest.Server {
+	t.Helper()
+	tree := map[string][]string{
+		"/":                    {"/Passwords/", "/readme.txt"},
+		"/Passwords/":          {"/Passwords/My Safes/", "/Passwords/work.psafe3"},
+		"/Passwords/My Safes/": {"/Passwords/My Safes/home.psafe3"},
+	}
+	const prefix = "/dav/files/alice"
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "alice" || pass != "app-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		switch r.Method {
+		case http.MethodGet:
+			if name != "/Passwords/work.psafe3" {
+				http.NotFound(w, r)
+				return
+			}
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			io.WriteString(w, "safe content")
+		case "PROPFIND":
+			if !strings.HasSuffix(name, "/") {
+				name += "/"
+			}
+			children, ok := tree[name]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			if depth := r.Header.Get("Depth"); depth != "0" && depth != "1" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprint(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+			writeResponse(w, prefix+name)
+			if r.Header.Get("Depth") == "1" {
+				for _, child := range children {
+					writeResponse(w, prefix+child)
+				}
+			}
+			fmt.Fprint(w, `</d:multistatus>`)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func writeResponse(w io.Writer, href string) {
+	escaped := strings.ReplaceAll(href, " ", "%20")
+	if strings.HasSuffix(href, "/") {
+		fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, escaped)
+		return
+	}
+	fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype/><d:getetag>"v1"</d:getetag><d:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</d:getlastmodified></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, escaped)
+}
+
+func newTestProvider(t *testing.T, server *httptest.Server, password string) *WebDAVProvider {
+	t.Helper()
+	p, err := NewWebDAVProvider(Settings{BaseURL: server.URL + "/dav/files/alice/", Username: "alice", Password: password})
+	if err != nil {
+		t.Fatalf("NewWebDAVProvider failed: %v", err)
+	}
+	return p
+}
+
+func TestFactory_RequiresCredentials(t *testing.T) {
+	for _, settings := range []string{
+		`{"username":"alice","password":"x"}`,
+		`{"baseUrl":"https://cloud.example.com","password":"x"}`,
+		`{"baseUrl":"ftp://cloud.example.com","username":"alice","password":"x"}`,
+	} {
+		if _, err := Factory(t.TempDir(), "http://localhost", []byte(settings)); err == nil {
+			t.Errorf("Expected %s to be rejected", settings)
+		}
+	}
+	if _, err := Factory(t.TempDir(), "http://localhost", []byte(`{"baseUrl":"https://cloud.example.com/dav","username":"alice","password":"x"}`)); err != nil {
+		t.Errorf("Expected valid settings to be accepted: %v", err)
+	}
+}
+
+func TestListRemoteFiles_WalksSubfolders(t *testing.T) {
+	server := fakeDAV(t)
+	defer server.Close()
+	p := newTestProvider(t, server, "app-password")
+
+	files, err := p.ListRemoteFiles(context.Background())
+	if err != nil {
+		t.Fatalf("ListRemoteFiles failed: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 safe files, got %+v", files)
+	}
+	if files[0].ID != "/Passwords/work.psafe3" || files[0].Path != "/Passwords" || files[0].ETag != `"v1"` || files[0].LastModified.IsZero() {
+		t.Errorf("Unexpected file: %+v", files[0])
+	}
+	if files[1].ID != "/Passwords/My Safes/home.psafe3" || files[1].Name != "home.psafe3" {
+		t.Errorf("Expected an unescaped path from the subfolder, got %+v", files[1])
+	}
+
+	p.directory = "/Passwords/My Safes"
+	files, err = p.ListRemoteFiles(context.Background())
+	if err != nil || len(files) != 1 {
+		t.Errorf("Expected only the configured directory to be searched, got %+v (err: %v)", files, err)
+	}
+}
+
+func TestBrowseFolder(t *testing.T) {
+	server := fakeDAV(t)
+	defer server.Close()
+	p := newTestProvider(t, server, "app-password")
+
+	listing, err := p.BrowseFolder(context.Background(), "/Passwords")
+	if err != nil {
+		t.Fatalf("BrowseFolder failed: %v", err)
+	}
+	if len(listing.Folders) != 1 || listing.Folders[0] != "My Safes" {
+		t.Errorf("Expected folder 'My Safes', got %v", listing.Folders)
+	}
+	if len(listing.Files) != 1 || listing.Files[0].ID != "/Passwords/work.psafe3" {
+		t.Errorf("Expected work.psafe3, got %+v", listing.Files)
+	}
+
+	if _, err := p.BrowseFolder(context.Background(), "/Missing"); err == nil || !strings.Contains(err.Error(), "folder not found") {
+		t.Errorf("Expected folder not found, got %v", err)
+	}
+}
+
+func TestDownloadFileIfNoneMatch(t *testing.T) {
+	server := fakeDAV(t)
+	defer server.Close()
+	p := newTestProvider(t, server, "app-password")
+	ctx := context.Background()
+
+	result, err := p.DownloadFile(ctx, "/Passwords/work.psafe3")
+	if err != nil {
+		t.Fatalf("DownloadFile failed: %v", err)
+	}
+	content, _ := io.ReadAll(result.Content)
+	result.Content.Close()
+	if string(content) != "safe content" || result.ETag != `"v1"` {
+		t.Errorf("Unexpected download: %q, ETag %q", content, result.ETag)
+	}
+
+	result, err = p.DownloadFileIfNoneMatch(ctx, "/Passwords/work.psafe3", `"v1"`)
+	if err != nil || !result.NotModified {
+		t.Errorf("Expected NotModified for a matching ETag, got %+v (err: %v)", result, err)
+	}
+
+	for _, id := range []string{"Passwords/work.psafe3", "/Passwords/../work.psafe3", "/"} {
+		if _, err := p.DownloadFile(ctx, id); err == nil || !strings.Contains(err.Error(), "invalid file ID") {
+			t.Errorf("Expected %q to be rejected, got %v", id, err)
+		}
+	}
+}
+
+func TestGetConnectionStatus(t *testing.T) {
+	server := fakeDAV(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	status, err := newTestProvider(t, server, "app-password").GetConnectionStatus(ctx, false)
+	if err != nil || !status.Connected || status.AccountName != "alice" {
+		t.Errorf("Expected connected as alice, got %+v (err: %v)", status, err)
+	}
+
+	p := newTestProvider(t, server, "wrong")
+	status, err = p.GetConnectionStatus(ctx, false)
+	if err != nil || status.Connected || !status.NeedsReauth {
+		t.Errorf("Expected NeedsReauth for rejected credentials, got %+v (err: %v)", status, err)
+	}
+	if _, err := p.ListRemoteFiles(ctx); err == nil || !strings.Contains(err.Error(), "REAUTH_REQUIRED") {
+		t.Errorf("Expected REAUTH_REQUIRED from listing, got %v", err)
+	}
+}
+
+func TestDownloadFile_EmptyBodyNeedsEmptyListing(t *testing.T) {
+	sizes := map[string]string{"/empty.psafe3": "0", "/full.psafe3": "2048"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/dav")
+		size, ok := sizes[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Length", "0")
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:"><d:response><d:href>/dav%s</d:href><d:propstat><d:prop><d:resourcetype/><d:getcontentlength>%s</d:getcontentlength></d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response></d:multistatus>`, name, size)
+	}))
+	defer server.Close()
+	p, err := NewWebDAVProvider(Settings{BaseURL: server.URL + "/dav", Username: "alice", Password: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, want := range map[string]bool{"/empty.psafe3": true, "/full.psafe3": false} {
+		result, err := p.DownloadFile(context.Background(), id)
+		if err != nil {
+			t.Fatalf("DownloadFile(%s) failed: %v", id, err)
+		}
+		result.Content.Close()
+		if result.ExpectEmpty != want {
+			t.Errorf("%s: expected ExpectEmpty %v for a 200 with Content-Length: 0, got %v", id, want, result.ExpectEmpty)
+		}
+	}
+}
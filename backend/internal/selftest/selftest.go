@@ -0,0 +1,65 @@
+// Package selftest checks that the bundled gopwsafe library can still open a
+// known safe. It is run via the -selftest flag after dependency upgrades.
+package selftest
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/service"
+)
+
+// simpleSafe is a copy of testdata/simple.psafe3, embedded so the check also
+// works from a deployed binary without the source tree
+//
+//go:embed simple.psafe3
+var simpleSafe []byte
+
+const (
+	safePassword  = "password"
+	entryUUID     = "c4dcfb52-b944-f141-af96-b746f184afe2"
+	entryTitle    = "Test entry"
+	entryUsername = "test"
+	entryPassword = "password"
+)
+
+// Run unlocks the embedded safe through SafeService and verifies its known entry
+func Run() error {
+	dir, err := os.MkdirTemp("", "pwsafe-selftest-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "simple.psafe3"), simpleSafe, 0600); err != nil {
+		return fmt.Errorf("failed to write test safe: %w", err)
+	}
+
+	svc := service.NewSafeService(dir)
+	safePath := "/" + filepath.Base(dir) + "/simple.psafe3"
+
+	structure, err := svc.UnlockSafe(safePath, safePassword)
+	if err != nil {
+		return fmt.Errorf("failed to unlock test safe: %w", err)
+	}
+
+	if len(structure.Groups) != 1 || len(structure.Groups[0].Entries) != 1 {
+		return fmt.Errorf("unexpected tree structure: %d groups, %d root entries", len(structure.Groups), len(structure.Entries))
+	}
+	entry := structure.Groups[0].Entries[0]
+	if entry.UUID != entryUUID || entry.Title != entryTitle || entry.Username != entryUsername {
+		return fmt.Errorf("unexpected entry: uuid=%s title=%q username=%q", entry.UUID, entry.Title, entry.Username)
+	}
+
+	password, err := svc.GetEntryPassword(safePath, safePassword, entryUUID)
+	if err != nil {
+		return fmt.Errorf("failed to read entry password: %w", err)
+	}
+	if password != entryPassword {
+		return fmt.Errorf("entry password mismatch")
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package selftest
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	if err := Run(); err != nil {
+		t.Fatalf("Self-test failed: %v", err)
+	}
+}
+
+func TestEmbeddedSafeMatchesTestdata(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/simple.psafe3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, simpleSafe) {
+		t.Error("Embedded simple.psafe3 is out of sync with testdata/simple.psafe3")
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+	"github.com/tkuhlman/gopwsafe/pwsafe"
+)
+
+// CreateSafeFromStructure writes a new safe at absPath holding every entry in
+// structure, which is the shape produced by export. Group nesting becomes the
+// dotted group path. Fails if absPath already exists.
+func CreateSafeFromStructure(absPath, password string, structure *models.SafeStructure) error {
+	if password == "" {
+		return fmt.Errorf("invalid import: master password is required")
+	}
+
+	name := strings.TrimSuffix(filepath.Base(absPath), filepath.Ext(absPath))
+	db := pwsafe.NewV3(name, password)
+
+	seenUUIDs := make(map[[16]byte]bool)
+	if err := addImportedEntries(db, seenUUIDs, "", structure.Entries); err != nil {
+		return err
+	}
+	for _, group := range structure.Groups {
+		if err := addImportedGroup(db, seenUUIDs, "", group); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := db.Encrypt(&buf); err != nil {
+		return fmt.Errorf("failed to write safe: %w", err)
+	}
+
+	// O_EXCL so a file created since the caller's check is never overwritten
+	file, err := os.OpenFile(absPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("safe already exists: %s", filepath.Base(absPath))
+		}
+		return fmt.Errorf("failed to write safe: %w", err)
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		os.Remove(absPath)
+		return fmt.Errorf("failed to write safe: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(absPath)
+		return fmt.Errorf("failed to write safe: %w", err)
+	}
+	return nil
+}
+
+func addImportedGroup(db *pwsafe.V3, seenUUIDs map[[16]byte]bool, parentPath string, group *models.Group) error {
+	if group == nil {
+		return fmt.Errorf("invalid import: null group")
+	}
+	// Dots separate levels in V3 group paths, so a name can't contain one
+	if group.Name == "" || strings.Contains(group.Name, ".") {
+		return fmt.Errorf("invalid import: invalid group name %q", group.Name)
+	}
+
+	groupPath := group.Name
+	if parentPath != "" {
+		groupPath = parentPath + "." + group.Name
+	}
+
+	if err := addImportedEntries(db, seenUUIDs, groupPath, group.Entries); err != nil {
+		return err
+	}
+	for _, child := range group.Groups {
+		if err := addImportedGroup(db, seenUUIDs, groupPath, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addImportedEntries(db *pwsafe.V3, seenUUIDs map[[16]byte]bool, groupPath string, entries []models.Entry) error {
+	for _, entry := range entries {
+		// Records are keyed by title
+		if entry.Title == "" {
+			return fmt.Errorf("invalid import: entry title is required")
+		}
+		if _, exists := db.Records[entry.Title]; exists {
+			return fmt.Errorf("invalid import: duplicate entry title %q", entry.Title)
+		}
+
+		record := pwsafe.Record{
+			Title:    entry.Title,
+			Group:    groupPath,
+			Username: entry.Username,
+			URL:      entry.URL,
+			Notes:    entry.Notes,
+			Password: entry.Password,
+		}
+		applyExtraFields(&record, entry.ExtraFields)
+		if entry.PasswordChangedAt != nil {
+			record.PasswordModTime = encodePasswordModTime(*entry.PasswordChangedAt)
+		}
+
+		// Keep exported UUIDs so links to entries survive a restore
+		if entry.UUID != "" {
+			uuid, err := parseUUID(entry.UUID)
+			if err != nil {
+				return fmt.Errorf("invalid import: %w", err)
+			}
+			if seenUUIDs[uuid] {
+				return fmt.Errorf("invalid import: duplicate entry uuid %s", entry.UUID)
+			}
+			seenUUIDs[uuid] = true
+			record.UUID = uuid
+		}
+
+		db.SetRecord(record)
+
+		// SetRecord stamps both times with now; a restore keeps the exported
+		// ones. An entry created without createdAt is new, so keeps the stamp.
+		stored := db.Records[record.Title]
+		if entry.CreatedAt != nil {
+			stored.CreateTime = *entry.CreatedAt
+		}
+		stored.ModTime = exportedTime(entry.ModifiedAt)
+		db.Records[record.Title] = stored
+	}
+	return nil
+}
+
+// exportedTime is the inverse of recordTime
+func exportedTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// applyExtraFields is the inverse of extraFields
+func applyExtraFields(record *pwsafe.Record, fields map[string]string) {
+	record.Autotype = fields["autotype"]
+	record.Email = fields["email"]
+	record.RunCommand = fields["runCommand"]
+	record.PasswordPolicy = fields["passwordPolicy"]
+	record.PasswordPolicyName = fields["passwordPolicyName"]
+	record.OwnSymbolsForPassword = fields["ownSymbolsForPassword"]
+}
+
+// parseUUID is the inverse of formatUUID
+func parseUUID(s string) ([16]byte, error) {
+	var u [16]byte
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != len(u) {
+		return u, fmt.Errorf("invalid entry uuid %q", s)
+	}
+	copy(u[:], b)
+	return u, nil
+}
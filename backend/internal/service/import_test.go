@@ -0,0 +1,161 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+)
+
+func TestCreateSafeFromStructure_RoundTripsExport(t *testing.T) {
+	exported, err := NewSafeService("../../testdata").ExportSafe("/testdata/three.psafe3", "three3#;")
+	if err != nil {
+		t.Fatalf("ExportSafe failed: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	if err := CreateSafeFromStructure(filepath.Join(tmpDir, "restored.psafe3"), "new-master", exported); err != nil {
+		t.Fatalf("CreateSafeFromStructure failed: %v", err)
+	}
+
+	restored, err := NewSafeService(tmpDir).ExportSafe("/"+filepath.Base(tmpDir)+"/restored.psafe3", "new-master")
+	if err != nil {
+		t.Fatalf("Failed to unlock restored safe: %v", err)
+	}
+
+	original := collectEntries(exported)
+	got := collectEntries(restored)
+	if len(got) != len(original) {
+		t.Fatalf("Expected %d entries, got %d", len(original), len(got))
+	}
+	for path, entry := range original {
+		// An entry exported without a creation time is stamped on import
+		restoredEntry := got[path]
+		if entry.CreatedAt == nil && restoredEntry.CreatedAt != nil {
+			restoredEntry.CreatedAt = nil
+		}
+		if !reflect.DeepEqual(restoredEntry, entry) {
+			t.Errorf("Entry %s: expected %+v, got %+v", path, entry, restoredEntry)
+		}
+	}
+}
+
+func TestCreateSafeFromStructure_KeepsTOTPSecret(t *testing.T) {
+	notes := "recovery codes in the drawer\nTOTP: JBSWY3DPEHPK3PXP"
+	tmpDir := t.TempDir()
+	original := &models.SafeStructure{Entries: []models.Entry{{Title: "totp", Password: "p", Notes: notes}}}
+	if err := CreateSafeFromStructure(filepath.Join(tmpDir, "original.psafe3"), "master", original); err != nil {
+		t.Fatal(err)
+	}
+	service := NewSafeService(tmpDir)
+
+	// The secret is stripped from unlocked notes but carried by the export
+	exported, err := service.ExportSafe("/"+filepath.Base(tmpDir)+"/original.psafe3", "master")
+	if err != nil {
+		t.Fatalf("ExportSafe failed: %v", err)
+	}
+	if exported.Entries[0].Notes != notes {
+		t.Fatalf("Expected the export to keep the secret in the notes, got %q", exported.Entries[0].Notes)
+	}
+
+	if err := CreateSafeFromStructure(filepath.Join(tmpDir, "restored.psafe3"), "master", exported); err != nil {
+		t.Fatalf("CreateSafeFromStructure failed: %v", err)
+	}
+	restored, err := service.UnlockSafe("/"+filepath.Base(tmpDir)+"/restored.psafe3", "master")
+	if err != nil {
+		t.Fatalf("Failed to unlock restored safe: %v", err)
+	}
+	if entry := restored.Entries[0]; !entry.HasTOTP || entry.Notes != "recovery codes in the drawer" {
+		t.Errorf("Expected the restored entry to keep its TOTP secret, got %+v", entry)
+	}
+}
+
+func TestCreateSafeFromStructure_StampsNewEntries(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tmpDir := t.TempDir()
+	structure := &models.SafeStructure{Entries: []models.Entry{
+		{Title: "restored", Password: "p", CreatedAt: &created},
+		{Title: "new", Password: "p"},
+	}}
+	before := time.Now().Add(-time.Second)
+	if err := CreateSafeFromStructure(filepath.Join(tmpDir, "import.psafe3"), "master", structure); err != nil {
+		t.Fatalf("CreateSafeFromStructure failed: %v", err)
+	}
+
+	unlocked, err := NewSafeService(tmpDir).UnlockSafe("/"+filepath.Base(tmpDir)+"/import.psafe3", "master")
+	if err != nil {
+		t.Fatalf("Failed to unlock imported safe: %v", err)
+	}
+	entries := collectEntries(unlocked)
+	if got := entries["restored"].CreatedAt; got == nil || !got.Equal(created) {
+		t.Errorf("Expected the exported creation time to be kept, got %v", got)
+	}
+	if got := entries["new"].CreatedAt; got == nil || got.Before(before) {
+		t.Errorf("Expected an entry without createdAt to be stamped with the import time, got %v", got)
+	}
+}
+
+func TestCreateSafeFromStructure_RejectsInvalidShape(t *testing.T) {
+	tests := []struct {
+		name      string
+		structure models.SafeStructure
+	}{
+		{"missing title", models.SafeStructure{Entries: []models.Entry{{Username: "u"}}}},
+		{"duplicate title", models.SafeStructure{Entries: []models.Entry{{Title: "a"}, {Title: "a"}}}},
+		{"dotted group name", models.SafeStructure{Groups: []*models.Group{{Name: "a.b"}}}},
+		{"bad uuid", models.SafeStructure{Entries: []models.Entry{{Title: "a", UUID: "xyz"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			absPath := filepath.Join(t.TempDir(), "import.psafe3")
+			err := CreateSafeFromStructure(absPath, "master", &tt.structure)
+			if err == nil || !strings.Contains(err.Error(), "invalid import") {
+				t.Errorf("Expected invalid import error, got %v", err)
+			}
+			if _, statErr := os.Stat(absPath); !os.IsNotExist(statErr) {
+				t.Error("Expected no safe to be written")
+			}
+		})
+	}
+}
+
+func TestCreateSafeFromStructure_RefusesExistingFile(t *testing.T) {
+	absPath := filepath.Join(t.TempDir(), "existing.psafe3")
+	if err := os.WriteFile(absPath, []byte("keep me"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := CreateSafeFromStructure(absPath, "master", &models.SafeStructure{})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected already exists error, got %v", err)
+	}
+	content, _ := os.ReadFile(absPath)
+	if string(content) != "keep me" {
+		t.Error("Expected existing file to be left untouched")
+	}
+}
+
+// collectEntries flattens a structure into group path + title -> entry
+func collectEntries(structure *models.SafeStructure) map[string]models.Entry {
+	entries := make(map[string]models.Entry)
+	var walk func(prefix string, groups []*models.Group)
+	walk = func(prefix string, groups []*models.Group) {
+		for _, group := range groups {
+			path := prefix + group.Name + "."
+			for _, entry := range group.Entries {
+				entries[path+entry.Title] = entry
+			}
+			walk(path, group.Groups)
+		}
+	}
+	for _, entry := range structure.Entries {
+		entries[entry.Title] = entry
+	}
+	walk("", structure.Groups)
+	return entries
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxKeyfileSize bounds how much of a keyfile is read
+const maxKeyfileSize = 4 << 10
+
+// WithKeyfileDirectory lets requests name a keyfile in dir holding the master
+// password instead of sending the password itself. Each keyfile opens only the
+// safe it is named after. Unset disables keyfiles.
+func WithKeyfileDirectory(dir string) SafeOption {
+	return func(s *SafeService) {
+		s.keyfileDirectory = dir
+	}
+}
+
+// ResolvePassword returns the master password for a request on safePath:
+// password as-is, or the contents of keyfile (a name relative to the keyfile
+// directory) with any trailing newline removed. Supplying both is an error.
+// A keyfile is bound to the safe it is named after - the safe's path under
+// the safes directory with its extension replaced by ".key" - and is refused
+// for any other safe.
+func (s *SafeService) ResolvePassword(safePath, password, keyfile string) (string, error) {
+	if keyfile == "" {
+		return password, nil
+	}
+	if s.keyfileDirectory == "" {
+		return "", fmt.Errorf("invalid keyfile: keyfiles are not enabled")
+	}
+	if password != "" {
+		return "", fmt.Errorf("invalid keyfile: provide either password or keyfile, not both")
+	}
+
+	absPath, err := s.validateKeyfilePath(keyfile)
+	if err != nil {
+		return "", err
+	}
+	bound, err := s.keyfileFor(safePath)
+	if err != nil {
+		return "", err
+	}
+	if absPath != bound {
+		return "", fmt.Errorf("invalid keyfile: %s is not the keyfile for %s", keyfile, safePath)
+	}
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("keyfile not found: %s", keyfile)
+		}
+		return "", fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxKeyfileSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	if len(data) > maxKeyfileSize {
+		return "", fmt.Errorf("invalid keyfile: larger than %d bytes", maxKeyfileSize)
+	}
+
+	resolved := strings.TrimRight(string(data), "\r\n")
+	if resolved == "" {
+		return "", fmt.Errorf("invalid keyfile: %s is empty", keyfile)
+	}
+	return resolved, nil
+}
+
+// validateKeyfilePath resolves keyfile under the keyfile directory, rejecting
+// anything that escapes it, the same way ValidateSafePath does for safes
+func (s *SafeService) validateKeyfilePath(keyfile string) (string, error) {
+	absDir, err := filepath.Abs(s.keyfileDirectory)
+	if err != nil {
+		return "", fmt.Errorf("invalid keyfile directory: %w", err)
+	}
+
+	absPath, err := filepath.Abs(filepath.Join(absDir, filepath.FromSlash(strings.TrimPrefix(keyfile, "/"))))
+	if err != nil {
+		return "", fmt.Errorf("invalid keyfile: %w", err)
+	}
+	if !strings.HasPrefix(absPath, absDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid keyfile: directory traversal not allowed")
+	}
+	return absPath, nil
+}
+
+// keyfileFor returns where the keyfile bound to safePath lives: for the safe
+// "onedrive/work.psafe3" under the safes directory, "onedrive/work.key" under
+// the keyfile directory
+func (s *SafeService) keyfileFor(safePath string) (string, error) {
+	absSafe, err := s.ValidateSafePath(safePath)
+	if err != nil {
+		return "", err
+	}
+	absSafesDir, err := filepath.Abs(s.safesDirectory)
+	if err != nil {
+		return "", fmt.Errorf("invalid safes directory: %w", err)
+	}
+	rel, err := filepath.Rel(absSafesDir, absSafe)
+	if err != nil {
+		return "", fmt.Errorf("invalid safe path: %w", err)
+	}
+	return s.validateKeyfilePath(filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)) + ".key"))
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolvePassword(t *testing.T) {
+	keyDir := t.TempDir()
+	os.WriteFile(filepath.Join(keyDir, "simple.key"), []byte("password\n"), 0600)
+	os.WriteFile(filepath.Join(keyDir, "three.key"), []byte("three3#;"), 0600)
+	os.WriteFile(filepath.Join(keyDir, "empty.key"), []byte("\n"), 0600)
+	os.WriteFile(filepath.Join(filepath.Dir(keyDir), "outside.key"), []byte("secret"), 0600)
+
+	safesDir := t.TempDir()
+	safe, err := os.ReadFile("../../testdata/simple.psafe3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"simple.psafe3", "three.psafe3", "empty.psafe3", "nokey.psafe3"} {
+		os.WriteFile(filepath.Join(safesDir, name), safe, 0600)
+	}
+	dir := "/" + filepath.Base(safesDir) + "/"
+	service := NewSafeService(safesDir, WithKeyfileDirectory(keyDir))
+
+	tests := []struct {
+		name     string
+		safe     string
+		password string
+		keyfile  string
+		want     string
+		wantErr  string
+	}{
+		{"password only", dir + "simple.psafe3", "inline", "", "inline", ""},
+		{"keyfile", dir + "simple.psafe3", "", "simple.key", "password", ""},
+		{"keyfile with leading slash", dir + "simple.psafe3", "", "/simple.key", "password", ""},
+		{"both", dir + "simple.psafe3", "inline", "simple.key", "", "not both"},
+		{"traversal", dir + "simple.psafe3", "", "../outside.key", "", "directory traversal"},
+		{"another safe's keyfile", dir + "simple.psafe3", "", "three.key", "", "not the keyfile for"},
+		{"missing", dir + "nokey.psafe3", "", "nokey.key", "", "keyfile not found"},
+		{"empty", dir + "empty.psafe3", "", "empty.key", "", "is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := service.ResolvePassword(tt.safe, tt.password, tt.keyfile)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected %q error, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Expected %q, got %q (err: %v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestResolvePassword_DisabledWithoutDirectory(t *testing.T) {
+	service := NewSafeService("../../testdata")
+	if _, err := service.ResolvePassword("/testdata/simple.psafe3", "", "simple.key"); err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Errorf("Expected keyfiles to be disabled, got %v", err)
+	}
+}
+
+func TestUnlockSafe_WithKeyfile(t *testing.T) {
+	keyDir := t.TempDir()
+	os.WriteFile(filepath.Join(keyDir, "three.key"), []byte("three3#;\r\n"), 0600)
+	service := NewSafeService("../../testdata", WithKeyfileDirectory(keyDir))
+
+	password, err := service.ResolvePassword("/testdata/three.psafe3", "", "three.key")
+	if err != nil {
+		t.Fatalf("ResolvePassword failed: %v", err)
+	}
+	if _, err := service.UnlockSafe("/testdata/three.psafe3", password); err != nil {
+		t.Errorf("Expected keyfile password to unlock the safe: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+)
+
+// ListSafesMerged returns the same safes as ListSafes in one list sorted by
+// name, with copies of a name in precedence order. With dedupe, files with
+// identical content collapse into the first copy listed, and each remaining
+// safe's Sources names every provider (or "static") holding a copy. Files
+// that can't be read are never collapsed.
+func (s *SafeService) ListSafesMerged(dedupe bool) ([]models.SafeFile, error) {
+	safes, err := s.ListSafes()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(safes, func(a, b models.SafeFile) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+	if !dedupe {
+		return safes, nil
+	}
+
+	merged := make([]models.SafeFile, 0, len(safes))
+	byHash := make(map[[sha256.Size]byte]int) // content hash to index in merged
+	for _, safe := range safes {
+		safe.Sources = []string{safe.Provider}
+		hash, ok := s.contentHash(safe.Path)
+		if !ok {
+			merged = append(merged, safe)
+			continue
+		}
+		if i, seen := byHash[hash]; seen {
+			if !slices.Contains(merged[i].Sources, safe.Provider) {
+				merged[i].Sources = append(merged[i].Sources, safe.Provider)
+			}
+			continue
+		}
+		byHash[hash] = len(merged)
+		merged = append(merged, safe)
+	}
+	return merged, nil
+}
+
+// contentHash returns the SHA-256 of the safe file at safePath
+func (s *SafeService) contentHash(safePath string) ([sha256.Size]byte, bool) {
+	var sum [sha256.Size]byte
+	absPath, err := s.ValidateSafePath(safePath)
+	if err != nil {
+		return sum, false
+	}
+	f, err := os.Open(absPath)
+	if err != nil {
+		return sum, false
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, false
+	}
+	h.Sum(sum[:0])
+	return sum, true
+}
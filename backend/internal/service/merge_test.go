@@ -0,0 +1,68 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListSafesMerged(t *testing.T) {
+	dir := t.TempDir()
+	safe, err := os.ReadFile("../../testdata/simple.psafe3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"zeta.psafe3":            safe,
+		"alpha/copy.psafe3":      safe, // same safe under another name
+		"beta/zeta.psafe3":       safe,
+		"beta/different.psafe3":  safe[:len(safe)-16],
+		"gamma/Different.psafe3": safe[:len(safe)-16],
+	}
+	for rel, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := "/" + filepath.Base(dir)
+	service := NewSafeService(dir)
+
+	safes, err := service.ListSafesMerged(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, s := range safes {
+		paths = append(paths, s.Path)
+	}
+	wantPaths := []string{
+		base + "/alpha/copy.psafe3",
+		base + "/beta/different.psafe3",
+		base + "/gamma/Different.psafe3",
+		base + "/zeta.psafe3",
+		base + "/beta/zeta.psafe3",
+	}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("Expected merged order %v, got %v", wantPaths, paths)
+	}
+
+	deduped, err := service.ListSafesMerged(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		base + "/alpha/copy.psafe3":     {"alpha", "static", "beta"},
+		base + "/beta/different.psafe3": {"beta", "gamma"},
+	}
+	if len(deduped) != len(want) {
+		t.Fatalf("Expected %d safes after dedupe, got %+v", len(want), deduped)
+	}
+	for _, s := range deduped {
+		if !reflect.DeepEqual(s.Sources, want[s.Path]) {
+			t.Errorf("Expected %s to have sources %v, got %v", s.Path, want[s.Path], s.Sources)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// PasswordPolicy is the minimum standard for the master password of a safe
+// the service creates. The zero value accepts any non-empty password.
+type PasswordPolicy struct {
+	MinLength int // in characters; zero or less disables the check
+	breached  *bloomFilter
+}
+
+// LoadBreachedList reads a list of known-breached passwords, one per line,
+// into a bloom filter so even large lists stay small in memory. Matches are
+// exact and case-sensitive; about 1% of passwords not on the list are also
+// rejected. Returns how many passwords were loaded.
+func (p *PasswordPolicy) LoadBreachedList(path string) (int, error) {
+	count := 0
+	if err := scanPasswordList(path, func(string) { count++ }); err != nil {
+		return 0, err
+	}
+	filter := newBloomFilter(count)
+	if err := scanPasswordList(path, filter.add); err != nil {
+		return 0, err
+	}
+	p.breached = filter
+	return count, nil
+}
+
+func scanPasswordList(path string, fn func(password string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if password := strings.TrimSuffix(scanner.Text(), "\r"); password != "" {
+			fn(password)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read breached password list: %w", err)
+	}
+	return nil
+}
+
+// Check returns a "weak master password" error naming the rule password
+// breaks. A nil policy accepts anything.
+func (p *PasswordPolicy) Check(password string) error {
+	if p == nil {
+		return nil
+	}
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("weak master password: must be at least %d characters", p.MinLength)
+	}
+	if p.breached != nil && p.breached.contains(password) {
+		return fmt.Errorf("weak master password: appears in a list of breached passwords")
+	}
+	return nil
+}
+
+// bloomHashes is the number of bit positions set per password
+const bloomHashes = 7
+
+// bloomFilter is a set membership test with no false negatives, sized at 10
+// bits per element for a false positive rate of about 1%
+type bloomFilter struct {
+	bits []uint64
+}
+
+func newBloomFilter(n int) *bloomFilter {
+	words := (n*10 + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+	return &bloomFilter{bits: make([]uint64, words)}
+}
+
+// positions derives the bit positions for s by double hashing
+func (f *bloomFilter) positions(s string, fn func(bit uint64)) {
+	h1 := fnv.New64a()
+	h1.Write([]byte(s))
+	h2 := fnv.New64()
+	h2.Write([]byte(s))
+	a, b := h1.Sum64(), h2.Sum64()|1
+
+	m := uint64(len(f.bits)) * 64
+	for i := uint64(0); i < bloomHashes; i++ {
+		fn((a + i*b) % m)
+	}
+}
+
+func (f *bloomFilter) add(s string) {
+	f.positions(s, func(bit uint64) {
+		f.bits[bit/64] |= 1 << (bit % 64)
+	})
+}
+
+func (f *bloomFilter) contains(s string) bool {
+	found := true
+	f.positions(s, func(bit uint64) {
+		found = found && f.bits[bit/64]&(1<<(bit%64)) != 0
+	})
+	return found
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy_MinLength(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 8}
+
+	if err := policy.Check("short"); err == nil || !strings.Contains(err.Error(), "weak master password") {
+		t.Errorf("Expected weak master password error, got %v", err)
+	}
+	if err := policy.Check("long enough"); err != nil {
+		t.Errorf("Expected long password to pass, got %v", err)
+	}
+
+	var none *PasswordPolicy
+	if err := none.Check("x"); err != nil {
+		t.Errorf("Expected nil policy to accept anything, got %v", err)
+	}
+}
+
+func TestPasswordPolicy_BreachedList(t *testing.T) {
+	var breached []string
+	for i := 0; i < 1000; i++ {
+		breached = append(breached, fmt.Sprintf("breached-%d", i))
+	}
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(breached, "\r\n")+"\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &PasswordPolicy{}
+	count, err := policy.LoadBreachedList(path)
+	if err != nil {
+		t.Fatalf("LoadBreachedList failed: %v", err)
+	}
+	if count != len(breached) {
+		t.Errorf("Expected %d passwords loaded, got %d", len(breached), count)
+	}
+
+	for _, password := range breached {
+		if err := policy.Check(password); err == nil {
+			t.Fatalf("Expected %q to be rejected", password)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if policy.Check(fmt.Sprintf("unlisted-%d", i)) != nil {
+			falsePositives++
+		}
+	}
+	if falsePositives > 30 {
+		t.Errorf("Expected about 1%% false positives, got %d in 1000", falsePositives)
+	}
+}
+
+func TestPasswordPolicy_MissingList(t *testing.T) {
+	policy := &PasswordPolicy{}
+	if _, err := policy.LoadBreachedList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Expected an error for a missing list")
+	}
+}
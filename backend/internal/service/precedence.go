@@ -0,0 +1,67 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider"
+)
+
+// Which copy of a safe wins when the same file name is both a static upload
+// and synced by a provider (or by several providers)
+const (
+	PrecedenceStaticFirst   = "static-first"
+	PrecedenceProviderFirst = "provider-first"
+)
+
+// WithDuplicatePrecedence sets which copy of a duplicated safe name lists first
+// and which one a bare name resolves to. Providers always rank among
+// themselves by ID. Unknown values are ignored.
+func WithDuplicatePrecedence(precedence string) SafeOption {
+	return func(s *SafeService) {
+		if precedence == PrecedenceStaticFirst || precedence == PrecedenceProviderFirst {
+			s.precedence = precedence
+		}
+	}
+}
+
+// applyPrecedence orders safes so the preferred copy of each name comes first,
+// then marks every later copy of that name as shadowed. safes must be in scan
+// order: static safes, then providers by ID.
+func (s *SafeService) applyPrecedence(safes []models.SafeFile) {
+	if s.precedence == PrecedenceProviderFirst {
+		slices.SortStableFunc(safes, func(a, b models.SafeFile) int {
+			return staticRank(a) - staticRank(b)
+		})
+	}
+
+	seen := make(map[string]bool)
+	for i := range safes {
+		name := provider.FoldName(safes[i].Name)
+		safes[i].Shadowed = seen[name]
+		seen[name] = true
+	}
+}
+
+func staticRank(safe models.SafeFile) int {
+	if safe.Provider == "static" {
+		return 1
+	}
+	return 0
+}
+
+// ResolveSafeName returns the path of the preferred safe called name, for
+// callers that only know a file name. Paths from ListSafes never need this.
+func (s *SafeService) ResolveSafeName(name string) (string, error) {
+	safes, err := s.ListSafes()
+	if err != nil {
+		return "", err
+	}
+	for _, safe := range safes {
+		if !safe.Shadowed && provider.SameName(safe.Name, name) {
+			return safe.Path, nil
+		}
+	}
+	return "", fmt.Errorf("safe file not found: %s", name)
+}
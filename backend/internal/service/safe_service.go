@@ -1,23 +1,91 @@
 package service
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rolledback/pwsafe-service/backend/internal/models"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider"
 	"github.com/tkuhlman/gopwsafe/pwsafe"
 )
 
+const (
+	defaultMaxGroupDepth = 32
+	defaultMaxRecords    = 100000
+)
+
 type SafeService struct {
 	safesDirectory string
+	maxGroupDepth  int
+	maxRecords     int
+	extensions     provider.Extensions
+	precedence     string // one of the Precedence* values
+
+	keyfileDirectory string        // empty disables keyfiles
+	sessions         *sessionStore // nil disables sessions
+	cache            *safeCache    // nil disables caching decrypted safes
+
+	writeMutex sync.Mutex
+	writeLocks map[string]*sync.Mutex // per absPath, serializing read-modify-write edits
+}
+
+// SafeOption configures optional behavior of a SafeService
+type SafeOption func(*SafeService)
+
+// WithMaxGroupDepth limits how many dotted group levels are expanded into the tree.
+// Deeper paths are flattened into their last allowed level.
+func WithMaxGroupDepth(depth int) SafeOption {
+	return func(s *SafeService) {
+		if depth > 0 {
+			s.maxGroupDepth = depth
+		}
+	}
 }
 
-func NewSafeService(safesDirectory string) *SafeService {
-	return &SafeService{
+// WithMaxRecords caps how many records a safe may contain before tree-returning
+// operations refuse it, bounding the size of the JSON response
+func WithMaxRecords(n int) SafeOption {
+	return func(s *SafeService) {
+		if n > 0 {
+			s.maxRecords = n
+		}
+	}
+}
+
+// WithExtensions sets which file extensions are listed and may be unlocked.
+// Use the same set as the sync services so every synced file is listed.
+func WithExtensions(exts provider.Extensions) SafeOption {
+	return func(s *SafeService) {
+		if len(exts) > 0 {
+			s.extensions = exts
+		}
+	}
+}
+
+func NewSafeService(safesDirectory string, opts ...SafeOption) *SafeService {
+	s := &SafeService{
 		safesDirectory: safesDirectory,
+		maxGroupDepth:  defaultMaxGroupDepth,
+		maxRecords:     defaultMaxRecords,
+		extensions:     provider.DefaultExtensions,
+		precedence:     PrecedenceStaticFirst,
+		cache:          newSafeCache(defaultSafeCacheTTL),
+		writeLocks:     make(map[string]*sync.Mutex),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 func (s *SafeService) ListSafes() ([]models.SafeFile, error) {
@@ -34,6 +102,7 @@ func (s *SafeService) ListSafes() ([]models.SafeFile, error) {
 	// Each subdirectory is treated as a provider (e.g., "onedrive", "gdrive")
 	entries, err := os.ReadDir(s.safesDirectory)
 	if err != nil {
+		s.applyPrecedence(safes)
 		return safes, nil // Return what we have if we can't read subdirs
 	}
 
@@ -50,6 +119,7 @@ func (s *SafeService) ListSafes() ([]models.SafeFile, error) {
 		}
 	}
 
+	s.applyPrecedence(safes)
 	return safes, nil
 }
 
@@ -59,6 +129,10 @@ func (s *SafeService) scanDirectory(dir, source string, recursive bool) ([]model
 	if recursive {
 		err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
 			if err != nil {
+				// A sync may rename or remove files mid-walk
+				if os.IsNotExist(err) {
+					return nil
+				}
 				return err
 			}
 
@@ -70,11 +144,11 @@ func (s *SafeService) scanDirectory(dir, source string, recursive bool) ([]model
 				return nil
 			}
 
-			if d.IsDir() {
+			if d.IsDir() || isInFlightFile(d.Name()) {
 				return nil
 			}
 
-			if !strings.HasSuffix(strings.ToLower(d.Name()), ".psafe3") {
+			if !s.extensions.Match(d.Name()) {
 				return nil
 			}
 
@@ -87,11 +161,13 @@ func (s *SafeService) scanDirectory(dir, source string, recursive bool) ([]model
 			relPath, _ := filepath.Rel(s.safesDirectory, path)
 			apiPath := "/" + filepath.ToSlash(filepath.Join(filepath.Base(s.safesDirectory), relPath))
 
+			absPath, _ := filepath.Abs(path)
 			safes = append(safes, models.SafeFile{
 				Name:         d.Name(),
 				Path:         apiPath,
 				LastModified: info.ModTime(),
 				Provider:     source,
+				Writable:     s.isWritable(absPath),
 			})
 
 			return nil
@@ -111,11 +187,11 @@ func (s *SafeService) scanDirectory(dir, source string, recursive bool) ([]model
 			}
 
 			// Skip hidden files
-			if strings.HasPrefix(entry.Name(), ".") {
+			if strings.HasPrefix(entry.Name(), ".") || isInFlightFile(entry.Name()) {
 				continue
 			}
 
-			if !strings.HasSuffix(strings.ToLower(entry.Name()), ".psafe3") {
+			if !s.extensions.Match(entry.Name()) {
 				continue
 			}
 
@@ -127,11 +203,13 @@ func (s *SafeService) scanDirectory(dir, source string, recursive bool) ([]model
 			// Use forward slashes for API path consistency (URL-style)
 			apiPath := "/" + filepath.ToSlash(filepath.Join(filepath.Base(s.safesDirectory), getRelativePath(s.safesDirectory, dir), entry.Name()))
 
+			absPath, _ := filepath.Abs(filepath.Join(dir, entry.Name()))
 			safes = append(safes, models.SafeFile{
 				Name:         entry.Name(),
 				Path:         apiPath,
 				LastModified: info.ModTime(),
 				Provider:     source,
+				Writable:     s.isWritable(absPath),
 			})
 		}
 	}
@@ -139,6 +217,14 @@ func (s *SafeService) scanDirectory(dir, source string, recursive bool) ([]model
 	return safes, nil
 }
 
+// isInFlightFile reports whether name is a partial write (sync downloads go to
+// "<name>.tmp" and are renamed into place when complete). These never match a
+// safe extension anyway, but are excluded explicitly so a configured extension
+// can't expose them.
+func isInFlightFile(name string) bool {
+	return strings.HasSuffix(name, ".tmp")
+}
+
 func getRelativePath(base, target string) string {
 	rel, err := filepath.Rel(base, target)
 	if err != nil || rel == "." {
@@ -149,6 +235,8 @@ func getRelativePath(base, target string) string {
 
 // ValidateSafePath validates that the given path is within the safes directory
 // and returns the absolute filesystem path if valid.
+// Synced safes live under their provider's directory, so the provider ID is part
+// of the path and same-named files from different providers never collide.
 func (s *SafeService) ValidateSafePath(safePath string) (string, error) {
 	// safePath should be like "/safes/file.psafe3" or "/safes/onedrive/file.psafe3"
 	// Convert to filesystem path relative to safesDirectory
@@ -180,6 +268,17 @@ func (s *SafeService) ValidateSafePath(safePath string) (string, error) {
 		return "", fmt.Errorf("invalid safe path: directory traversal not allowed")
 	}
 
+	// The path must name its file directly, so "onedrive/../vault.psafe3" can't
+	// look like a provider's copy while opening the static safe of that name
+	if path.Clean("/"+relativePath) != "/"+relativePath {
+		return "", fmt.Errorf("invalid safe path: must not contain empty, . or .. segments")
+	}
+
+	// Only files that would be listed may be opened
+	if !s.extensions.Match(absPath) {
+		return "", fmt.Errorf("invalid safe path: unsupported file extension")
+	}
+
 	// Check file exists
 	if _, err := os.Stat(absPath); os.IsNotExist(err) {
 		return "", fmt.Errorf("safe file not found: %s", safePath)
@@ -188,19 +287,282 @@ func (s *SafeService) ValidateSafePath(safePath string) (string, error) {
 	return absPath, nil
 }
 
+// UnlockOptions controls what is included in an unlocked safe structure
+type UnlockOptions struct {
+	IncludeExtra     bool // Populate Entry.ExtraFields with non-core record fields
+	IncludePasswords bool // Populate Entry.Password - only for export
+}
+
 func (s *SafeService) UnlockSafe(safePath, password string) (*models.SafeStructure, error) {
+	return s.UnlockSafeWithOptions(safePath, password, UnlockOptions{})
+}
+
+func (s *SafeService) UnlockSafeWithOptions(safePath, password string, opts UnlockOptions) (*models.SafeStructure, error) {
+	db, err := s.unlock(safePath, password)
+	if err != nil {
+		return nil, err
+	}
+
+	structure := s.buildGroupTree(db, opts)
+	return structure, nil
+}
+
+// unlock opens the safe at safePath for reading entries, refusing safes over
+// the record limit. The result may be cached and shared (see openSafe).
+func (s *SafeService) unlock(safePath, password string) (*pwsafe.V3, error) {
 	absPath, err := s.ValidateSafePath(safePath)
 	if err != nil {
 		return nil, err
 	}
 
-	db, err := pwsafe.OpenPWSafeFile(absPath, password)
+	// A wrong file type would otherwise fail exactly like a wrong password
+	if err := checkV3Format(absPath); err != nil {
+		return nil, err
+	}
+
+	db, err := s.openSafe(absPath, password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unlock safe: %w", err)
 	}
 
-	structure := s.buildGroupTree(db)
-	return structure, nil
+	if err := s.checkRecordLimit(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// GetChanges returns the entries whose records were modified (or, lacking a
+// modification time, created) after since, without passwords. Records with
+// neither time are never reported, and deleted entries can't be.
+func (s *SafeService) GetChanges(safePath, password string, since time.Time) (*models.SafeChanges, error) {
+	db, err := s.unlock(safePath, password)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := &models.SafeChanges{Since: since, Entries: []models.ChangedEntry{}}
+	for _, record := range db.Records {
+		modifiedAt := record.ModTime
+		if modifiedAt.IsZero() {
+			modifiedAt = record.CreateTime
+		}
+		if modifiedAt.IsZero() || !modifiedAt.After(since) {
+			continue
+		}
+		changes.Entries = append(changes.Entries, models.ChangedEntry{
+			Entry: recordToEntry(record, UnlockOptions{}),
+			Group: strings.Join(splitGroupPath(record.Group), "."), // As the unlocked tree shows it
+		})
+	}
+	slices.SortFunc(changes.Entries, func(a, b models.ChangedEntry) int {
+		return changedAt(a.Entry).Compare(changedAt(b.Entry))
+	})
+	return changes, nil
+}
+
+// changedAt is when entry last changed: its modification time, or its
+// creation time if it has none
+func changedAt(entry models.Entry) time.Time {
+	if entry.ModifiedAt != nil {
+		return *entry.ModifiedAt
+	}
+	if entry.CreatedAt != nil {
+		return *entry.CreatedAt
+	}
+	return time.Time{}
+}
+
+// ExportSafe returns the full safe structure including every entry's password,
+// for local backups
+func (s *SafeService) ExportSafe(safePath, password string) (*models.SafeStructure, error) {
+	return s.UnlockSafeWithOptions(safePath, password, UnlockOptions{IncludeExtra: true, IncludePasswords: true})
+}
+
+// v3Magic is the tag every Password Safe v3 file starts with
+var v3Magic = []byte("PWS3")
+
+// checkV3Format rejects files that don't start with the v3 tag, such as v2
+// safes or files that aren't safes at all
+func checkV3Format(absPath string) error {
+	f, err := os.Open(absPath)
+	if err != nil {
+		return fmt.Errorf("failed to open safe: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, len(v3Magic))
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header, v3Magic) {
+		return fmt.Errorf("unsupported format: not a Password Safe v3 file")
+	}
+	return nil
+}
+
+// v3Trailer is the EOF marker and HMAC that end every v3 file
+var v3Trailer = []byte("PWS3-EOFPWS3-EOF")
+
+const (
+	v3HeaderSize  = 152 // tag, salt, iterations, password hash, key blocks and IV
+	v3TrailerSize = 48  // EOF marker and HMAC
+	v3BlockSize   = 16  // records are encrypted in whole Twofish blocks
+)
+
+// checkV3Integrity reports whether absPath is laid out like a complete v3
+// file - the tag up front, whole blocks of records and the EOF marker before
+// the HMAC - without decrypting it. This catches truncated downloads and
+// files that aren't safes, but not a corrupt record or a wrong password.
+func checkV3Integrity(absPath string) bool {
+	f, err := os.Open(absPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	size := info.Size()
+	if size < v3HeaderSize+v3TrailerSize || (size-v3HeaderSize-v3TrailerSize)%v3BlockSize != 0 {
+		return false
+	}
+
+	header := make([]byte, len(v3Magic))
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header, v3Magic) {
+		return false
+	}
+	trailer := make([]byte, len(v3Trailer))
+	if _, err := f.ReadAt(trailer, size-v3TrailerSize); err != nil || !bytes.Equal(trailer, v3Trailer) {
+		return false
+	}
+	return true
+}
+
+// VerifySafeFiles sets Valid on each listed safe from a structural check of
+// its file. No password is needed and nothing is decrypted.
+func (s *SafeService) VerifySafeFiles(safes []models.SafeFile) {
+	for i := range safes {
+		valid := false
+		if absPath, err := s.ValidateSafePath(safes[i].Path); err == nil {
+			valid = checkV3Integrity(absPath)
+		}
+		safes[i].Valid = &valid
+	}
+}
+
+// checkRecordLimit rejects safes with more records than the service will build a tree for
+func (s *SafeService) checkRecordLimit(db *pwsafe.V3) error {
+	if len(db.Records) > s.maxRecords {
+		return fmt.Errorf("safe too large: %d records exceeds limit of %d", len(db.Records), s.maxRecords)
+	}
+	return nil
+}
+
+// VerifyPassword checks that password opens the safe without returning any of its contents
+func (s *SafeService) VerifyPassword(safePath, password string) error {
+	absPath, err := s.ValidateSafePath(safePath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.openSafe(absPath, password); err != nil {
+		return fmt.Errorf("failed to unlock safe: %w", err)
+	}
+	return nil
+}
+
+// GetSafeInfo returns the safe's record count and when and by what
+// application it was last saved. It still decrypts the safe, since the
+// header is encrypted too.
+func (s *SafeService) GetSafeInfo(safePath, password string) (*models.SafeInfo, error) {
+	absPath, err := s.ValidateSafePath(safePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkV3Format(absPath); err != nil {
+		return nil, err
+	}
+
+	db, err := s.openSafe(absPath, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock safe: %w", err)
+	}
+
+	info := &models.SafeInfo{
+		RecordCount: len(db.Records),
+		LastSavedBy: string(db.Header.LastSaveBy),
+	}
+	if lastSave := db.Header.LastSave; !lastSave.IsZero() && lastSave.Unix() != 0 {
+		t := lastSave.UTC()
+		info.LastSaved = &t
+	}
+	return info, nil
+}
+
+// DiagnoseSafe reports record and tree counts plus per-record issues for debugging
+func (s *SafeService) DiagnoseSafe(safePath, password string) (*models.SafeDiagnostics, error) {
+	absPath, err := s.ValidateSafePath(safePath)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := s.openSafe(absPath, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock safe: %w", err)
+	}
+
+	diag := &models.SafeDiagnostics{
+		RawRecordCount: len(db.Records),
+		Issues:         make(map[string]int),
+	}
+
+	seenUUIDs := make(map[[16]byte]bool)
+	for _, record := range db.Records {
+		if record.UUID == [16]byte{} {
+			diag.Issues["missingUuid"]++
+		} else if seenUUIDs[record.UUID] {
+			diag.Issues["duplicateUuid"]++
+		}
+		seenUUIDs[record.UUID] = true
+
+		if record.Title == "" {
+			diag.Issues["untitled"]++
+		}
+		if record.Group != "" {
+			if len(splitGroupPath(record.Group)) > s.maxGroupDepth {
+				diag.Issues["flattenedGroup"]++
+			}
+			for _, part := range strings.Split(record.Group, ".") {
+				if part == "" {
+					diag.Issues["emptyGroupSegment"]++
+					break
+				}
+			}
+		}
+	}
+
+	if s.checkRecordLimit(db) != nil {
+		diag.Issues["exceedsRecordLimit"] = len(db.Records)
+		return diag, nil
+	}
+
+	structure := s.buildGroupTree(db, UnlockOptions{})
+	diag.RootEntryCount = len(structure.Entries)
+	var countGroups func(groups []*models.Group)
+	countGroups = func(groups []*models.Group) {
+		for _, g := range groups {
+			diag.GroupCount++
+			diag.GroupedEntryCount += len(g.Entries)
+			countGroups(g.Groups)
+		}
+	}
+	countGroups(structure.Groups)
+	diag.TreeEntryCount = diag.RootEntryCount + diag.GroupedEntryCount
+
+	if len(diag.Issues) == 0 {
+		diag.Issues = nil
+	}
+	return diag, nil
 }
 
 func (s *SafeService) GetEntryPassword(safePath, password, entryUUID string) (string, error) {
@@ -209,18 +571,13 @@ func (s *SafeService) GetEntryPassword(safePath, password, entryUUID string) (st
 		return "", err
 	}
 
-	db, err := pwsafe.OpenPWSafeFile(absPath, password)
+	db, err := s.openSafe(absPath, password)
 	if err != nil {
 		return "", fmt.Errorf("failed to unlock safe: %w", err)
 	}
 
 	for _, record := range db.Records {
-		uuid := fmt.Sprintf("%x-%x-%x-%x-%x",
-			record.UUID[0:4],
-			record.UUID[4:6],
-			record.UUID[6:8],
-			record.UUID[8:10],
-			record.UUID[10:16])
+		uuid := formatUUID(record.UUID)
 
 		if uuid == entryUUID {
 			return record.Password, nil
@@ -230,38 +587,192 @@ func (s *SafeService) GetEntryPassword(safePath, password, entryUUID string) (st
 	return "", fmt.Errorf("entry not found: %s", entryUUID)
 }
 
-func (s *SafeService) buildGroupTree(db *pwsafe.V3) *models.SafeStructure {
+// MoveEntry reassigns an entry to a new dotted group path and rewrites the safe.
+// An empty group moves the entry to the root.
+func (s *SafeService) MoveEntry(safePath, password, entryUUID, newGroup string) (*models.SafeStructure, error) {
+	absPath, err := s.ValidateSafePath(safePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.validateGroupPath(newGroup); err != nil {
+		return nil, err
+	}
+
+	if !s.isWritable(absPath) {
+		return nil, fmt.Errorf("safe is read-only: %s", safePath)
+	}
+
+	// Held until the rewrite lands so overlapping edits don't drop each other
+	release := s.lockSafe(absPath)
+	defer release()
+
+	db, err := pwsafe.OpenPWSafeFile(absPath, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock safe: %w", err)
+	}
+
+	if err := s.checkRecordLimit(db); err != nil {
+		return nil, err
+	}
+
+	record, ok := findRecord(db, entryUUID)
+	if !ok {
+		return nil, fmt.Errorf("entry not found: %s", entryUUID)
+	}
+
+	record.Group = newGroup
+	db.SetRecord(record)
+
+	if err := writeSafeAtomic(db, absPath); err != nil {
+		return nil, err
+	}
+	s.invalidateSafe(absPath)
+
+	return s.buildGroupTree(db, UnlockOptions{}), nil
+}
+
+// UpdateEntry applies the non-nil fields to the entry with the given UUID and rewrites the safe.
+// The record's modified time is bumped; its creation time and other fields are preserved.
+func (s *SafeService) UpdateEntry(safePath, password, entryUUID string, fields models.EntryUpdate) (*models.SafeStructure, error) {
+	absPath, err := s.ValidateSafePath(safePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if fields.Title != nil && strings.TrimSpace(*fields.Title) == "" {
+		return nil, fmt.Errorf("invalid entry: title is required")
+	}
+
+	if !s.isWritable(absPath) {
+		return nil, fmt.Errorf("safe is read-only: %s", safePath)
+	}
+
+	// Held until the rewrite lands so overlapping edits don't drop each other
+	release := s.lockSafe(absPath)
+	defer release()
+
+	db, err := pwsafe.OpenPWSafeFile(absPath, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock safe: %w", err)
+	}
+
+	if err := s.checkRecordLimit(db); err != nil {
+		return nil, err
+	}
+
+	record, ok := findRecord(db, entryUUID)
+	if !ok {
+		return nil, fmt.Errorf("entry not found: %s", entryUUID)
+	}
+
+	oldTitle := record.Title
+	if fields.Title != nil {
+		record.Title = *fields.Title
+	}
+	if fields.Username != nil {
+		record.Username = *fields.Username
+	}
+	if fields.URL != nil {
+		record.URL = *fields.URL
+	}
+	if fields.Notes != nil {
+		record.Notes = keepTOTPLines(record.Notes, *fields.Notes)
+	}
+	if fields.Password != nil && *fields.Password != record.Password {
+		record.Password = *fields.Password
+		record.PasswordModTime = encodePasswordModTime(time.Now())
+	}
+
+	// Records are keyed by title, so a rename has to move the map entry
+	if record.Title != oldTitle {
+		if _, exists := db.Records[record.Title]; exists {
+			return nil, fmt.Errorf("entry title already exists: %s", record.Title)
+		}
+		db.DeleteRecord(oldTitle)
+	}
+	db.SetRecord(record)
+	if record.Title != oldTitle {
+		// SetRecord treats a new key as a new record and resets its creation time
+		renamed := db.Records[record.Title]
+		renamed.CreateTime = record.CreateTime
+		db.Records[record.Title] = renamed
+	}
+
+	if err := writeSafeAtomic(db, absPath); err != nil {
+		return nil, err
+	}
+	s.invalidateSafe(absPath)
+
+	return s.buildGroupTree(db, UnlockOptions{}), nil
+}
+
+// isWritable reports whether the safe may be modified in place.
+// Only static safes are writable; provider-synced copies are overwritten on the next sync.
+func (s *SafeService) isWritable(absPath string) bool {
+	absSafesDir, err := filepath.Abs(s.safesDirectory)
+	if err != nil {
+		return false
+	}
+	return filepath.Dir(absPath) == absSafesDir
+}
+
+// validateGroupPath rejects dotted group paths with empty segments, control characters,
+// or more levels than the tree builder will expand
+func (s *SafeService) validateGroupPath(group string) error {
+	if group == "" {
+		return nil
+	}
+	for _, r := range group {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("invalid group path: control characters not allowed")
+		}
+	}
+	parts := strings.Split(group, ".")
+	if len(parts) > s.maxGroupDepth {
+		return fmt.Errorf("invalid group path: exceeds maximum depth of %d", s.maxGroupDepth)
+	}
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" {
+			return fmt.Errorf("invalid group path: empty group name")
+		}
+	}
+	return nil
+}
+
+// splitGroupPath splits a dotted group path into its names, dropping the
+// empty segments left by leading, trailing or consecutive dots
+func splitGroupPath(group string) []string {
+	var parts []string
+	for _, part := range strings.Split(group, ".") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func (s *SafeService) buildGroupTree(db *pwsafe.V3, opts UnlockOptions) *models.SafeStructure {
 	groupMap := make(map[string]*models.Group)
 	rootGroups := make(map[string]*models.Group)
 	rootEntries := []models.Entry{}
 
 	for _, record := range db.Records {
 		groupPath := record.Group
-		title := record.Title
-		uuid := fmt.Sprintf("%x-%x-%x-%x-%x",
-			record.UUID[0:4],
-			record.UUID[4:6],
-			record.UUID[6:8],
-			record.UUID[8:10],
-			record.UUID[10:16])
-		username := record.Username
-		url := record.URL
-		notes := record.Notes
-
-		entry := models.Entry{
-			UUID:     uuid,
-			Title:    title,
-			Username: username,
-			URL:      url,
-			Notes:    notes,
-		}
+		entry := recordToEntry(record, opts)
 
-		if groupPath == "" {
+		parts := splitGroupPath(groupPath)
+		if len(parts) == 0 {
 			rootEntries = append(rootEntries, entry)
 			continue
 		}
 
-		parts := strings.Split(groupPath, ".")
+		if len(parts) > s.maxGroupDepth {
+			log.Printf("Warning: group path depth %d exceeds limit %d, flattening", len(parts), s.maxGroupDepth)
+			tail := strings.Join(parts[s.maxGroupDepth-1:], ".")
+			parts = append(parts[:s.maxGroupDepth-1], tail)
+		}
+
 		var currentPath string
 		var parentGroup *models.Group
 
@@ -306,3 +817,160 @@ func (s *SafeService) buildGroupTree(db *pwsafe.V3) *models.SafeStructure {
 		Entries: rootEntries,
 	}
 }
+
+// recordToEntry converts a record to the entry served to clients
+func recordToEntry(record pwsafe.Record, opts UnlockOptions) models.Entry {
+	entry := models.Entry{
+		UUID:     formatUUID(record.UUID),
+		Title:    record.Title,
+		Username: record.Username,
+		URL:      record.URL,
+		Notes:    stripTOTPLines(record.Notes),
+		HasTOTP:  totpSecret(record) != "",
+
+		CreatedAt:         recordTime(record.CreateTime),
+		ModifiedAt:        recordTime(record.ModTime),
+		PasswordChangedAt: passwordChangedAt(record),
+	}
+	if opts.IncludeExtra {
+		entry.ExtraFields = extraFields(record)
+	}
+	if opts.IncludePasswords {
+		// Exports are backups, so they keep the TOTP secret with the notes
+		entry.Password = record.Password
+		entry.Notes = record.Notes
+	}
+	return entry
+}
+
+func formatUUID(u [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// extraFields collects the non-core record fields that are set.
+// Password history is deliberately excluded since it contains old passwords.
+func extraFields(record pwsafe.Record) map[string]string {
+	fields := map[string]string{
+		"autotype":              record.Autotype,
+		"email":                 record.Email,
+		"runCommand":            record.RunCommand,
+		"passwordPolicy":        record.PasswordPolicy,
+		"passwordPolicyName":    record.PasswordPolicyName,
+		"ownSymbolsForPassword": record.OwnSymbolsForPassword,
+	}
+	for key, value := range fields {
+		if value == "" {
+			delete(fields, key)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// recordTime returns t in UTC, or nil when the safe doesn't record it
+func recordTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+// passwordChangedAt decodes the record's password modification time, which
+// the library leaves as raw bytes: a little-endian time_t of 4 or 8 bytes.
+// Returns nil when the safe doesn't record one.
+func passwordChangedAt(record pwsafe.Record) *time.Time {
+	var seconds int64
+	switch data := []byte(record.PasswordModTime); len(data) {
+	case 4:
+		seconds = int64(binary.LittleEndian.Uint32(data))
+	case 8:
+		seconds = int64(binary.LittleEndian.Uint64(data))
+	default:
+		return nil
+	}
+	if seconds == 0 {
+		return nil
+	}
+	t := time.Unix(seconds, 0).UTC()
+	return &t
+}
+
+// encodePasswordModTime is the inverse of passwordChangedAt
+func encodePasswordModTime(t time.Time) string {
+	return string(binary.LittleEndian.AppendUint32(nil, uint32(t.Unix())))
+}
+
+func findRecord(db *pwsafe.V3, entryUUID string) (pwsafe.Record, bool) {
+	for _, record := range db.Records {
+		if formatUUID(record.UUID) == entryUUID {
+			return record, true
+		}
+	}
+	return pwsafe.Record{}, false
+}
+
+// lockSafe takes the write lock for absPath and returns its release. Edits
+// hold it from decrypting the safe through writing and invalidating it.
+func (s *SafeService) lockSafe(absPath string) func() {
+	s.writeMutex.Lock()
+	lock, ok := s.writeLocks[absPath]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.writeLocks[absPath] = lock
+	}
+	s.writeMutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// safeTempPattern names the temp files writeSafeAtomic encrypts into
+const safeTempPattern = ".tmp-*.psafe3"
+
+// RemoveSafeTempFiles deletes temp files left beside static safes by a process
+// killed mid-write. Call it before serving requests.
+func (s *SafeService) RemoveSafeTempFiles() {
+	matches, _ := filepath.Glob(filepath.Join(s.safesDirectory, safeTempPattern))
+	for _, path := range matches {
+		if err := os.Remove(path); err != nil {
+			log.Printf("Error removing leftover safe write %s: %v", path, err)
+		}
+	}
+}
+
+// writeSafeAtomic encrypts db to a temp file beside absPath and renames it into place
+func writeSafeAtomic(db *pwsafe.V3, absPath string) error {
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return fmt.Errorf("failed to write safe: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(absPath), safeTempPattern)
+	if err != nil {
+		return fmt.Errorf("failed to write safe: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if err := db.Encrypt(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write safe: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write safe: %w", err)
+	}
+	tmp.Close()
+
+	os.Chmod(tmpPath, info.Mode().Perm())
+
+	if err := os.Rename(tmpPath, absPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write safe: %w", err)
+	}
+	return nil
+}
@@ -1,9 +1,19 @@
 package service
 
 import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider"
+	"github.com/tkuhlman/gopwsafe/pwsafe"
 )
 
 func TestListSafes(t *testing.T) {
@@ -400,3 +410,776 @@ func TestListSafes_SkipsHiddenDirectories(t *testing.T) {
 		t.Errorf("Expected name 'visible.psafe3', got '%s'", safes[0].Name)
 	}
 }
+
+func TestBuildGroupTree_FlattensDeepGroups(t *testing.T) {
+	service := NewSafeService(t.TempDir(), WithMaxGroupDepth(3))
+
+	db := &pwsafe.V3{Records: map[string]pwsafe.Record{
+		"deep": {Title: "deep", Group: "a.b.c.d.e"},
+	}}
+
+	structure := service.buildGroupTree(db, UnlockOptions{})
+
+	if len(structure.Groups) != 1 || structure.Groups[0].Name != "a" {
+		t.Fatalf("Expected single root group 'a', got %+v", structure.Groups)
+	}
+	b := structure.Groups[0].Groups[0]
+	if b.Name != "b" {
+		t.Errorf("Expected second level 'b', got '%s'", b.Name)
+	}
+	if len(b.Groups) != 1 {
+		t.Fatalf("Expected 1 group under 'b', got %d", len(b.Groups))
+	}
+	leaf := b.Groups[0]
+	if leaf.Name != "c.d.e" {
+		t.Errorf("Expected flattened leaf 'c.d.e', got '%s'", leaf.Name)
+	}
+	if len(leaf.Groups) != 0 {
+		t.Errorf("Expected no groups below the depth limit, got %d", len(leaf.Groups))
+	}
+	if len(leaf.Entries) != 1 || leaf.Entries[0].Title != "deep" {
+		t.Errorf("Expected entry 'deep' in flattened leaf, got %+v", leaf.Entries)
+	}
+}
+
+func TestBuildGroupTree_WithinDepthLimit(t *testing.T) {
+	service := NewSafeService(t.TempDir(), WithMaxGroupDepth(3))
+
+	db := &pwsafe.V3{Records: map[string]pwsafe.Record{
+		"shallow": {Title: "shallow", Group: "a.b.c"},
+	}}
+
+	structure := service.buildGroupTree(db, UnlockOptions{})
+
+	leaf := structure.Groups[0].Groups[0].Groups[0]
+	if leaf.Name != "c" {
+		t.Errorf("Expected leaf 'c', got '%s'", leaf.Name)
+	}
+}
+
+func TestBuildGroupTree_DropsEmptySegments(t *testing.T) {
+	service := NewSafeService(t.TempDir())
+
+	db := &pwsafe.V3{Records: map[string]pwsafe.Record{
+		"double":   {Title: "double", Group: "Work..Projects"},
+		"leading":  {Title: "leading", Group: ".Work.Projects"},
+		"trailing": {Title: "trailing", Group: "Work.Projects."},
+		"dots":     {Title: "dots", Group: "..."},
+	}}
+
+	structure := service.buildGroupTree(db, UnlockOptions{})
+
+	if len(structure.Entries) != 1 || structure.Entries[0].Title != "dots" {
+		t.Errorf("Expected only 'dots' at the root, got %+v", structure.Entries)
+	}
+	if len(structure.Groups) != 1 || structure.Groups[0].Name != "Work" {
+		t.Fatalf("Expected single root group 'Work', got %+v", structure.Groups)
+	}
+	work := structure.Groups[0]
+	if len(work.Entries) != 0 {
+		t.Errorf("Expected no entries directly under 'Work', got %d", len(work.Entries))
+	}
+	if len(work.Groups) != 1 || work.Groups[0].Name != "Projects" {
+		t.Fatalf("Expected single group 'Projects' under 'Work', got %+v", work.Groups)
+	}
+	projects := work.Groups[0]
+	if len(projects.Groups) != 0 {
+		t.Errorf("Expected no groups under 'Projects', got %d", len(projects.Groups))
+	}
+	if len(projects.Entries) != 3 {
+		t.Errorf("Expected 3 entries under 'Projects', got %d", len(projects.Entries))
+	}
+}
+
+func TestGetChanges_NormalizesGroupPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	db := pwsafe.NewV3("groups", "master")
+	db.SetRecord(pwsafe.Record{Title: "double", Group: "Work..Projects", Password: "p"})
+	if err := pwsafe.WritePWSafeFile(db, filepath.Join(tmpDir, "groups.psafe3")); err != nil {
+		t.Fatal(err)
+	}
+	service := NewSafeService(tmpDir)
+
+	changes, err := service.GetChanges("/"+filepath.Base(tmpDir)+"/groups.psafe3", "master", time.Time{})
+	if err != nil {
+		t.Fatalf("GetChanges failed: %v", err)
+	}
+	if len(changes.Entries) != 1 || changes.Entries[0].Group != "Work.Projects" {
+		t.Errorf("Expected the group path as the unlocked tree shows it, got %+v", changes.Entries)
+	}
+
+	if _, err := service.GetChanges("/"+filepath.Base(tmpDir)+"/groups.psafe3", "wrong", time.Time{}); err == nil || !strings.Contains(err.Error(), "failed to unlock safe") {
+		t.Errorf("Expected an unlock error, got %v", err)
+	}
+}
+
+// copyTestSafe copies a testdata safe into dir and returns its API path
+func copyTestSafe(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("../../testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return "/" + filepath.Base(dir) + "/" + name
+}
+
+func TestMoveEntry_UpdatesGroup(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	service := NewSafeService(tmpDir)
+
+	structure, err := service.MoveEntry(safePath, "password", "c4dcfb52-b944-f141-af96-b746f184afe2", "work.email")
+	if err != nil {
+		t.Fatalf("MoveEntry failed: %v", err)
+	}
+
+	if len(structure.Groups) != 1 || structure.Groups[0].Name != "work" {
+		t.Fatalf("Expected root group 'work', got %+v", structure.Groups)
+	}
+
+	// Reopen from disk to verify the change was persisted with other fields intact
+	reopened, err := service.UnlockSafe(safePath, "password")
+	if err != nil {
+		t.Fatalf("UnlockSafe after move failed: %v", err)
+	}
+	email := reopened.Groups[0].Groups[0]
+	if email.Name != "email" || len(email.Entries) != 1 {
+		t.Fatalf("Expected entry under 'work.email', got %+v", reopened.Groups[0])
+	}
+	entry := email.Entries[0]
+	if entry.Username != "test" || entry.URL != "http://test.com" || entry.Notes != "no notes" {
+		t.Errorf("Expected other fields preserved, got %+v", entry)
+	}
+
+	password, err := service.GetEntryPassword(safePath, "password", entry.UUID)
+	if err != nil || password != "password" {
+		t.Errorf("Expected password preserved, got '%s' (err: %v)", password, err)
+	}
+}
+
+func TestMoveEntry_ToRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	service := NewSafeService(tmpDir)
+
+	structure, err := service.MoveEntry(safePath, "password", "c4dcfb52-b944-f141-af96-b746f184afe2", "")
+	if err != nil {
+		t.Fatalf("MoveEntry failed: %v", err)
+	}
+
+	if len(structure.Groups) != 0 || len(structure.Entries) != 1 {
+		t.Errorf("Expected entry at root, got %d groups and %d entries", len(structure.Groups), len(structure.Entries))
+	}
+}
+
+func TestMoveEntry_InvalidGroup(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	service := NewSafeService(tmpDir)
+
+	for _, group := range []string{"a..b", ".a", "a.", "a\nb"} {
+		if _, err := service.MoveEntry(safePath, "password", "c4dcfb52-b944-f141-af96-b746f184afe2", group); err == nil {
+			t.Errorf("Expected error for invalid group %q", group)
+		}
+	}
+}
+
+func TestMoveEntry_WrongUUID(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	service := NewSafeService(tmpDir)
+
+	_, err := service.MoveEntry(safePath, "password", "00000000-0000-0000-0000-000000000000", "other")
+	if err == nil {
+		t.Error("Expected error for nonexistent UUID")
+	}
+}
+
+func TestMoveEntry_ProviderSafeIsReadOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	onedriveDir := filepath.Join(tmpDir, "onedrive")
+	os.MkdirAll(onedriveDir, 0755)
+	copyTestSafe(t, onedriveDir, "simple.psafe3")
+	service := NewSafeService(tmpDir)
+
+	safePath := "/" + filepath.Base(tmpDir) + "/onedrive/simple.psafe3"
+	_, err := service.MoveEntry(safePath, "password", "c4dcfb52-b944-f141-af96-b746f184afe2", "other")
+	if err == nil {
+		t.Error("Expected error when moving an entry in a provider-synced safe")
+	}
+}
+
+func TestListSafes_MatchesExtensionVariants(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(tmpDir, "upper.PSAFE3"), []byte{}, 0644)
+	os.WriteFile(filepath.Join(tmpDir, "trailing.psafe3 "), []byte{}, 0644)
+	os.WriteFile(filepath.Join(tmpDir, "backup.psafe3.bak"), []byte{}, 0644)
+
+	onedriveDir := filepath.Join(tmpDir, "onedrive")
+	os.MkdirAll(onedriveDir, 0755)
+	os.WriteFile(filepath.Join(onedriveDir, "Mixed.PSafe3"), []byte{}, 0644)
+
+	service := NewSafeService(tmpDir)
+	safes, err := service.ListSafes()
+	if err != nil {
+		t.Fatalf("ListSafes failed: %v", err)
+	}
+
+	if len(safes) != 3 {
+		t.Errorf("Expected 3 safe files, got %d", len(safes))
+		for _, s := range safes {
+			t.Logf("  Found: %q", s.Name)
+		}
+	}
+}
+
+func TestBuildGroupTree_ExtraFields(t *testing.T) {
+	service := NewSafeService(t.TempDir())
+
+	db := &pwsafe.V3{Records: map[string]pwsafe.Record{
+		"entry": {
+			Title:              "entry",
+			Autotype:           "\\u\\t\\p\\n",
+			RunCommand:         "ssh host",
+			PasswordPolicyName: "strong",
+			PasswordHistory:    "secret-history",
+		},
+	}}
+
+	structure := service.buildGroupTree(db, UnlockOptions{})
+	if structure.Entries[0].ExtraFields != nil {
+		t.Errorf("Expected no extra fields by default, got %v", structure.Entries[0].ExtraFields)
+	}
+
+	structure = service.buildGroupTree(db, UnlockOptions{IncludeExtra: true})
+	extra := structure.Entries[0].ExtraFields
+	if extra["autotype"] != "\\u\\t\\p\\n" {
+		t.Errorf("Expected autotype field, got %v", extra)
+	}
+	if extra["runCommand"] != "ssh host" {
+		t.Errorf("Expected runCommand field, got %v", extra)
+	}
+	if extra["passwordPolicyName"] != "strong" {
+		t.Errorf("Expected passwordPolicyName field, got %v", extra)
+	}
+	if _, ok := extra["email"]; ok {
+		t.Error("Expected empty fields to be omitted")
+	}
+	for _, value := range extra {
+		if value == "secret-history" {
+			t.Error("Expected password history to never be included")
+		}
+	}
+}
+
+func TestListSafes_CustomExtensions(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(tmpDir, "a.psafe3"), []byte{}, 0644)
+	os.WriteFile(filepath.Join(tmpDir, "b.dat"), []byte{}, 0644)
+	onedriveDir := filepath.Join(tmpDir, "onedrive")
+	os.MkdirAll(onedriveDir, 0755)
+	os.WriteFile(filepath.Join(onedriveDir, "c.psafe"), []byte{}, 0644)
+	os.WriteFile(filepath.Join(onedriveDir, "d.txt"), []byte{}, 0644)
+
+	service := NewSafeService(tmpDir, WithExtensions(provider.Extensions{".psafe3", ".psafe", ".dat"}))
+	safes, err := service.ListSafes()
+	if err != nil {
+		t.Fatalf("ListSafes failed: %v", err)
+	}
+
+	if len(safes) != 3 {
+		t.Errorf("Expected 3 safe files, got %d", len(safes))
+	}
+}
+
+func TestListSafes_SkipsTempFilesEvenIfExtensionMatches(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(tmpDir, "a.psafe3"), []byte{}, 0644)
+	os.WriteFile(filepath.Join(tmpDir, "a.psafe3.tmp"), []byte{}, 0644)
+	onedriveDir := filepath.Join(tmpDir, "onedrive")
+	os.MkdirAll(onedriveDir, 0755)
+	os.WriteFile(filepath.Join(onedriveDir, "b.tmp"), []byte{}, 0644)
+
+	service := NewSafeService(tmpDir, WithExtensions(provider.Extensions{".psafe3", ".tmp"}))
+	safes, err := service.ListSafes()
+	if err != nil {
+		t.Fatalf("ListSafes failed: %v", err)
+	}
+
+	if len(safes) != 1 || safes[0].Name != "a.psafe3" {
+		t.Errorf("Expected only a.psafe3, got %+v", safes)
+	}
+}
+
+func TestUnlockSafe_RejectsUnlistedExtension(t *testing.T) {
+	tmpDir := t.TempDir()
+	data, _ := os.ReadFile("../../testdata/simple.psafe3")
+	os.WriteFile(filepath.Join(tmpDir, "simple.txt"), data, 0644)
+
+	service := NewSafeService(tmpDir)
+	_, err := service.UnlockSafe("/"+filepath.Base(tmpDir)+"/simple.txt", "password")
+	if err == nil {
+		t.Error("Expected error when unlocking a file with an unlisted extension")
+	}
+}
+
+func TestGetSafeInfo(t *testing.T) {
+	service := NewSafeService("../../testdata")
+
+	info, err := service.GetSafeInfo("/testdata/simple.psafe3", "password")
+	if err != nil {
+		t.Fatalf("GetSafeInfo failed: %v", err)
+	}
+	if info.RecordCount != 1 {
+		t.Errorf("Expected 1 record, got %d", info.RecordCount)
+	}
+	if info.LastSaved == nil || !info.LastSaved.Equal(time.Date(2015, 6, 4, 3, 52, 27, 0, time.UTC)) {
+		t.Errorf("Unexpected last save time: %v", info.LastSaved)
+	}
+	if info.LastSavedBy != "Loxodo 0.0-git" {
+		t.Errorf("Expected Loxodo as the last saving application, got %q", info.LastSavedBy)
+	}
+
+	if _, err := service.GetSafeInfo("/testdata/simple.psafe3", "wrongpassword"); err == nil {
+		t.Error("Expected error for wrong password")
+	}
+}
+
+func TestDiagnoseSafe_Three(t *testing.T) {
+	service := NewSafeService("../../testdata")
+
+	diag, err := service.DiagnoseSafe("/testdata/three.psafe3", "three3#;")
+	if err != nil {
+		t.Fatalf("DiagnoseSafe failed: %v", err)
+	}
+
+	if diag.RawRecordCount != 3 {
+		t.Errorf("Expected 3 raw records, got %d", diag.RawRecordCount)
+	}
+	if diag.TreeEntryCount != 3 || diag.GroupedEntryCount != 3 || diag.RootEntryCount != 0 {
+		t.Errorf("Expected 3 grouped entries and 0 root entries, got %+v", diag)
+	}
+	if diag.GroupCount != 3 {
+		t.Errorf("Expected 3 groups, got %d", diag.GroupCount)
+	}
+	if diag.Issues != nil {
+		t.Errorf("Expected no issues, got %v", diag.Issues)
+	}
+}
+
+func TestDiagnoseSafe_WrongPassword(t *testing.T) {
+	service := NewSafeService("../../testdata")
+
+	if _, err := service.DiagnoseSafe("/testdata/simple.psafe3", "wrongpassword"); err == nil {
+		t.Error("Expected error for wrong password")
+	}
+}
+
+func TestUpdateEntry_ChangesOnlyGivenFields(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	service := NewSafeService(tmpDir)
+
+	title := "Renamed entry"
+	username := "newuser"
+	_, err := service.UpdateEntry(safePath, "password", "c4dcfb52-b944-f141-af96-b746f184afe2", models.EntryUpdate{
+		Title:    &title,
+		Username: &username,
+	})
+	if err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+
+	reopened, err := service.UnlockSafe(safePath, "password")
+	if err != nil {
+		t.Fatalf("UnlockSafe after update failed: %v", err)
+	}
+	if len(reopened.Groups) != 1 || len(reopened.Groups[0].Entries) != 1 {
+		t.Fatalf("Expected a single entry after rename, got %+v", reopened)
+	}
+	entry := reopened.Groups[0].Entries[0]
+	if entry.Title != title || entry.Username != username {
+		t.Errorf("Expected updated title and username, got %+v", entry)
+	}
+	if entry.URL != "http://test.com" || entry.Notes != "no notes" {
+		t.Errorf("Expected omitted fields preserved, got %+v", entry)
+	}
+
+	password, err := service.GetEntryPassword(safePath, "password", entry.UUID)
+	if err != nil || password != "password" {
+		t.Errorf("Expected password preserved, got '%s' (err: %v)", password, err)
+	}
+}
+
+func TestEdits_SerializedPerSafe(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	service := NewSafeService(tmpDir)
+	uuid := "c4dcfb52-b944-f141-af96-b746f184afe2"
+
+	// Each pair decrypts and rewrites the same safe; unserialized, one of the
+	// two renames would replace the other's change
+	for i := 0; i < 5; i++ {
+		group := fmt.Sprintf("group%d", i)
+		username := fmt.Sprintf("user%d", i)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := service.MoveEntry(safePath, "password", uuid, group); err != nil {
+				t.Errorf("MoveEntry failed: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := service.UpdateEntry(safePath, "password", uuid, models.EntryUpdate{Username: &username}); err != nil {
+				t.Errorf("UpdateEntry failed: %v", err)
+			}
+		}()
+		wg.Wait()
+
+		reopened, err := service.UnlockSafe(safePath, "password")
+		if err != nil {
+			t.Fatalf("UnlockSafe failed: %v", err)
+		}
+		if len(reopened.Groups) != 1 || reopened.Groups[0].Name != group || reopened.Groups[0].Entries[0].Username != username {
+			t.Fatalf("Expected both edits to land (group %s, username %s), got %+v", group, username, reopened.Groups)
+		}
+	}
+}
+
+func TestRemoveSafeTempFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	keep := filepath.Join(tmpDir, "vault.psafe3")
+	leftover := filepath.Join(tmpDir, ".tmp-123.psafe3")
+	for _, path := range []string{keep, leftover} {
+		os.WriteFile(path, []byte("data"), 0600)
+	}
+
+	NewSafeService(tmpDir).RemoveSafeTempFiles()
+
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("Expected the safe to be kept: %v", err)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Error("Expected the leftover temp file to be removed")
+	}
+}
+
+func TestUpdateEntry_ChangesPassword(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	service := NewSafeService(tmpDir)
+
+	newPassword := "s3cret"
+	_, err := service.UpdateEntry(safePath, "password", "c4dcfb52-b944-f141-af96-b746f184afe2", models.EntryUpdate{
+		Password: &newPassword,
+	})
+	if err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+
+	password, err := service.GetEntryPassword(safePath, "password", "c4dcfb52-b944-f141-af96-b746f184afe2")
+	if err != nil || password != newPassword {
+		t.Errorf("Expected password '%s', got '%s' (err: %v)", newPassword, password, err)
+	}
+}
+
+func TestUpdateEntry_RecordsPasswordChangedAt(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	service := NewSafeService(tmpDir)
+	entryUUID := "c4dcfb52-b944-f141-af96-b746f184afe2"
+
+	changedAt := func() *time.Time {
+		t.Helper()
+		structure, err := service.UnlockSafe(safePath, "password")
+		if err != nil {
+			t.Fatalf("UnlockSafe failed: %v", err)
+		}
+		return structure.Groups[0].Entries[0].PasswordChangedAt
+	}
+
+	if got := changedAt(); got != nil {
+		t.Fatalf("Expected no password change time in test safe, got %v", got)
+	}
+
+	// Other edits, including resaving the same password, leave it alone
+	notes := "updated notes"
+	samePassword := "password"
+	if _, err := service.UpdateEntry(safePath, "password", entryUUID, models.EntryUpdate{Notes: &notes, Password: &samePassword}); err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	if got := changedAt(); got != nil {
+		t.Errorf("Expected unchanged password to leave passwordChangedAt unset, got %v", got)
+	}
+
+	before := time.Now().Add(-time.Second)
+	newPassword := "s3cret"
+	if _, err := service.UpdateEntry(safePath, "password", entryUUID, models.EntryUpdate{Password: &newPassword}); err != nil {
+		t.Fatalf("UpdateEntry failed: %v", err)
+	}
+	got := changedAt()
+	if got == nil || got.Before(before) || got.After(time.Now().Add(time.Second)) {
+		t.Errorf("Expected passwordChangedAt close to now, got %v", got)
+	}
+}
+
+func TestPasswordChangedAt_DecodesTimeT(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		raw  string
+		want *time.Time
+	}{
+		{"unset", "", nil},
+		{"32-bit", encodePasswordModTime(want), &want},
+		{"64-bit", string(binary.LittleEndian.AppendUint64(nil, uint64(want.Unix()))), &want},
+		{"zero", "\x00\x00\x00\x00", nil},
+		{"malformed", "abc", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := passwordChangedAt(pwsafe.Record{PasswordModTime: tt.raw})
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRecordToEntry_Timestamps(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("EST", -5*3600))
+	entry := recordToEntry(pwsafe.Record{CreateTime: created}, UnlockOptions{})
+
+	if entry.CreatedAt == nil || !entry.CreatedAt.Equal(created) || entry.CreatedAt.Location() != time.UTC {
+		t.Errorf("Expected createdAt %v in UTC, got %v", created, entry.CreatedAt)
+	}
+	if entry.ModifiedAt != nil {
+		t.Errorf("Expected unset modification time to be omitted, got %v", entry.ModifiedAt)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"createdAt":"2020-01-02T08:04:05Z"`) || strings.Contains(string(data), "modifiedAt") {
+		t.Errorf("Expected RFC 3339 createdAt and no modifiedAt, got %s", data)
+	}
+}
+
+func TestUpdateEntry_WrongUUID(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	service := NewSafeService(tmpDir)
+
+	notes := "x"
+	_, err := service.UpdateEntry(safePath, "password", "00000000-0000-0000-0000-000000000000", models.EntryUpdate{Notes: &notes})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestUpdateEntry_EmptyTitle(t *testing.T) {
+	tmpDir := t.TempDir()
+	safePath := copyTestSafe(t, tmpDir, "simple.psafe3")
+	service := NewSafeService(tmpDir)
+
+	title := " "
+	if _, err := service.UpdateEntry(safePath, "password", "c4dcfb52-b944-f141-af96-b746f184afe2", models.EntryUpdate{Title: &title}); err == nil {
+		t.Error("Expected error for empty title")
+	}
+}
+
+func TestListSafes_SameFilenameAcrossProvidersIsUnique(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, providerID := range []string{"onedrive", "gdrive"} {
+		dir := filepath.Join(tmpDir, providerID)
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, "passwords.psafe3"), []byte(providerID), 0644)
+	}
+	service := NewSafeService(tmpDir)
+
+	safes, err := service.ListSafes()
+	if err != nil {
+		t.Fatalf("ListSafes failed: %v", err)
+	}
+	if len(safes) != 2 {
+		t.Fatalf("Expected 2 safes, got %d", len(safes))
+	}
+	if safes[0].Path == safes[1].Path {
+		t.Fatalf("Expected distinct paths, both were %s", safes[0].Path)
+	}
+
+	// Each listed path resolves to its own provider's file
+	for _, safe := range safes {
+		absPath, err := service.ValidateSafePath(safe.Path)
+		if err != nil {
+			t.Fatalf("ValidateSafePath(%s) failed: %v", safe.Path, err)
+		}
+		content, _ := os.ReadFile(absPath)
+		if string(content) != safe.Provider {
+			t.Errorf("Path %s resolved to %s's file", safe.Path, string(content))
+		}
+	}
+}
+
+func TestListSafes_WritableOnlyForStaticSafes(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "static.psafe3"), []byte{}, 0644)
+	onedriveDir := filepath.Join(tmpDir, "onedrive")
+	os.MkdirAll(onedriveDir, 0755)
+	os.WriteFile(filepath.Join(onedriveDir, "synced.psafe3"), []byte{}, 0644)
+
+	service := NewSafeService(tmpDir)
+	safes, err := service.ListSafes()
+	if err != nil {
+		t.Fatalf("ListSafes failed: %v", err)
+	}
+
+	for _, safe := range safes {
+		expected := safe.Provider == "static"
+		if safe.Writable != expected {
+			t.Errorf("%s: expected writable=%v, got %v", safe.Path, expected, safe.Writable)
+		}
+	}
+}
+
+func TestVerifySafeFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	safe, err := os.ReadFile("../../testdata/simple.psafe3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"good.psafe3":      safe,
+		"truncated.psafe3": safe[:len(safe)-20],
+		"partial.psafe3":   safe[:len(safe)-64], // ends on a block boundary, but without the EOF marker
+		"renamed.psafe3":   []byte("just some notes, not a safe"),
+		"empty.psafe3":     {},
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(tmpDir, name), content, 0644)
+	}
+
+	service := NewSafeService(tmpDir)
+	safes, err := service.ListSafes()
+	if err != nil {
+		t.Fatalf("ListSafes failed: %v", err)
+	}
+	for _, safe := range safes {
+		if safe.Valid != nil {
+			t.Errorf("%s: expected valid to be unset without verification", safe.Name)
+		}
+	}
+
+	service.VerifySafeFiles(safes)
+	for _, safe := range safes {
+		expected := safe.Name == "good.psafe3"
+		if safe.Valid == nil || *safe.Valid != expected {
+			t.Errorf("%s: expected valid=%v, got %v", safe.Name, expected, safe.Valid)
+		}
+	}
+}
+
+func TestUnlockSafe_RecordLimit(t *testing.T) {
+	service := NewSafeService("../../testdata", WithMaxRecords(2))
+
+	_, err := service.UnlockSafe("/testdata/three.psafe3", "three3#;")
+	if err == nil || !strings.Contains(err.Error(), "safe too large: 3 records") {
+		t.Errorf("Expected safe too large error with count, got %v", err)
+	}
+
+	// Safes within the limit still unlock
+	if _, err := service.UnlockSafe("/testdata/simple.psafe3", "password"); err != nil {
+		t.Errorf("Expected simple safe to unlock, got %v", err)
+	}
+}
+
+func TestUnlockSafe_UnsupportedFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	baseName := filepath.Base(tmpDir)
+	os.WriteFile(filepath.Join(tmpDir, "v2.psafe3"), []byte("not a v3 safe at all"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "short.psafe3"), []byte("PW"), 0644)
+
+	service := NewSafeService(tmpDir)
+	for _, name := range []string{"v2.psafe3", "short.psafe3"} {
+		_, err := service.UnlockSafe("/"+baseName+"/"+name, "password")
+		if err == nil || !strings.Contains(err.Error(), "unsupported format") {
+			t.Errorf("%s: expected unsupported format error, got %v", name, err)
+		}
+	}
+
+	// A real v3 safe with the wrong password is still a plain unlock failure
+	_, err := NewSafeService("../../testdata").UnlockSafe("/testdata/simple.psafe3", "wrongpassword")
+	if err == nil || strings.Contains(err.Error(), "unsupported format") {
+		t.Errorf("Expected a wrong-password failure, got %v", err)
+	}
+}
+
+func TestListSafes_DuplicatePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	safe, err := os.ReadFile("../../testdata/simple.psafe3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range []string{"vault.psafe3", "alpha/Vault.psafe3", "beta/vault.psafe3", "beta/other.psafe3"} {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := os.WriteFile(path, safe, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := "/" + filepath.Base(dir)
+
+	tests := []struct {
+		precedence string
+		wantFirst  string
+	}{
+		{PrecedenceStaticFirst, base + "/vault.psafe3"},
+		{PrecedenceProviderFirst, base + "/alpha/Vault.psafe3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.precedence, func(t *testing.T) {
+			service := NewSafeService(dir, WithDuplicatePrecedence(tt.precedence))
+			safes, err := service.ListSafes()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var preferred []string
+			for _, s := range safes {
+				if !s.Shadowed {
+					preferred = append(preferred, s.Path)
+				}
+			}
+			if len(safes) != 4 || len(preferred) != 2 {
+				t.Fatalf("Expected 4 safes with 2 preferred, got %+v", safes)
+			}
+			if got, err := service.ResolveSafeName("vault.psafe3"); err != nil || got != tt.wantFirst {
+				t.Errorf("Expected vault.psafe3 to resolve to %s, got %q (err: %v)", tt.wantFirst, got, err)
+			}
+			// Every copy stays reachable by its own path
+			for _, s := range safes {
+				if _, err := service.UnlockSafe(s.Path, "password"); err != nil {
+					t.Errorf("Failed to unlock %s: %v", s.Path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSafePath_RejectsNonCanonicalPaths(t *testing.T) {
+	service := NewSafeService("../../testdata")
+	for _, path := range []string{"/testdata/onedrive/../simple.psafe3", "/testdata/./simple.psafe3", "/testdata//simple.psafe3"} {
+		if _, err := service.ValidateSafePath(path); err == nil || !strings.Contains(err.Error(), "invalid safe path") {
+			t.Errorf("Expected %s to be rejected, got %v", path, err)
+		}
+	}
+}
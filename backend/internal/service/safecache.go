@@ -0,0 +1,160 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tkuhlman/gopwsafe/pwsafe"
+)
+
+const (
+	defaultSafeCacheTTL = 60 * time.Second
+	// maxCachedSafes bounds how many decrypted safes are held at once
+	maxCachedSafes = 100
+)
+
+// cachedSafe is a decrypted safe, tied to the file as it was when opened so
+// any change to the safe drops it
+type cachedSafe struct {
+	absPath   string
+	db        *pwsafe.V3
+	modTime   time.Time
+	size      int64
+	expiresAt time.Time
+}
+
+// safeCache holds recently decrypted safes so repeated reads skip the key
+// derivation. Entries are keyed by an HMAC of the path and password under a
+// random per-process key, so the password itself is never kept.
+type safeCache struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	key   []byte
+	safes map[[sha256.Size]byte]*cachedSafe
+}
+
+func newSafeCache(ttl time.Duration) *safeCache {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil // No cache beats a predictable key
+	}
+	return &safeCache{ttl: ttl, key: key, safes: make(map[[sha256.Size]byte]*cachedSafe)}
+}
+
+// WithSafeCacheTTL sets how long a decrypted safe is kept in memory for later
+// reads with the same password. Zero disables the cache.
+func WithSafeCacheTTL(ttl time.Duration) SafeOption {
+	return func(s *SafeService) {
+		switch {
+		case ttl > 0:
+			s.cache = newSafeCache(ttl)
+		case ttl == 0:
+			s.cache = nil
+		}
+	}
+}
+
+// openSafe decrypts the safe at absPath, reusing a cached copy while the file
+// is unchanged. The result may be shared with other requests, so callers must
+// not modify it; writers open the file with pwsafe.OpenPWSafeFile instead.
+func (s *SafeService) openSafe(absPath, password string) (*pwsafe.V3, error) {
+	c := s.cache
+	if c == nil {
+		return pwsafe.OpenPWSafeFile(absPath, password)
+	}
+
+	// Stat before decrypting: if the file changes in between, the entry
+	// records the older time and is dropped on its next use
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return pwsafe.OpenPWSafeFile(absPath, password)
+	}
+	key := c.keyFor(absPath, password)
+	if db, ok := c.get(key, info); ok {
+		return db, nil
+	}
+
+	db, err := pwsafe.OpenPWSafeFile(absPath, password)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, &cachedSafe{
+		absPath: absPath,
+		db:      db,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	})
+	return db, nil
+}
+
+// invalidateSafe drops every cached copy of absPath, whatever its password
+func (s *SafeService) invalidateSafe(absPath string) {
+	c := s.cache
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.safes {
+		if entry.absPath == absPath {
+			delete(c.safes, key)
+		}
+	}
+}
+
+func (c *safeCache) keyFor(absPath, password string) [sha256.Size]byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(absPath))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+	var key [sha256.Size]byte
+	mac.Sum(key[:0])
+	return key
+}
+
+func (c *safeCache) get(key [sha256.Size]byte, info os.FileInfo) (*pwsafe.V3, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.safes[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expiresAt) || !info.ModTime().Equal(entry.modTime) || info.Size() != entry.size {
+		delete(c.safes, key)
+		return nil, false
+	}
+	return entry.db, true
+}
+
+func (c *safeCache) put(key [sha256.Size]byte, entry *cachedSafe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked(time.Now())
+	if len(c.safes) >= maxCachedSafes {
+		return
+	}
+	entry.expiresAt = time.Now().Add(c.ttl)
+	c.safes[key] = entry
+
+	// Drop the entry on expiry rather than on the next request, so a
+	// decrypted safe doesn't outlive its TTL on an idle server
+	time.AfterFunc(c.ttl, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.safes[key] == entry {
+			delete(c.safes, key)
+		}
+	})
+}
+
+func (c *safeCache) pruneLocked(now time.Time) {
+	for key, entry := range c.safes {
+		if !now.Before(entry.expiresAt) {
+			delete(c.safes, key)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSafeCache(t *testing.T) {
+	dir := t.TempDir()
+	safe, err := os.ReadFile("../../testdata/simple.psafe3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	absPath := filepath.Join(dir, "a.psafe3")
+	if err := os.WriteFile(absPath, safe, 0600); err != nil {
+		t.Fatal(err)
+	}
+	service := NewSafeService(dir)
+
+	first, err := service.openSafe(absPath, "password")
+	if err != nil {
+		t.Fatalf("openSafe failed: %v", err)
+	}
+	if again, _ := service.openSafe(absPath, "password"); again != first {
+		t.Error("Expected the second open to be served from the cache")
+	}
+	if _, err := service.openSafe(absPath, "wrong"); err == nil {
+		t.Error("Expected a wrong password to fail despite a cached copy")
+	}
+	if len(service.cache.safes) != 1 {
+		t.Errorf("Expected only the successful open to be cached, have %d", len(service.cache.safes))
+	}
+	for key := range service.cache.safes {
+		if string(key[:]) == "password" {
+			t.Error("Expected the cache key not to be the password")
+		}
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(absPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := service.openSafe(absPath, "password")
+	if err != nil || changed == first {
+		t.Errorf("Expected a changed file to be decrypted again (err: %v)", err)
+	}
+
+	for _, entry := range service.cache.safes {
+		entry.expiresAt = time.Now().Add(-time.Second)
+	}
+	if expired, _ := service.openSafe(absPath, "password"); expired == changed {
+		t.Error("Expected an expired entry to be decrypted again")
+	}
+
+	service.invalidateSafe(absPath)
+	if len(service.cache.safes) != 0 {
+		t.Errorf("Expected invalidation to drop the safe, have %d", len(service.cache.safes))
+	}
+}
+
+func TestSafeCache_Disabled(t *testing.T) {
+	service := NewSafeService("../../testdata", WithSafeCacheTTL(0))
+	if service.cache != nil {
+		t.Fatal("Expected a zero TTL to disable the cache")
+	}
+	absPath, _ := filepath.Abs("../../testdata/simple.psafe3")
+	first, err := service.openSafe(absPath, "password")
+	if err != nil {
+		t.Fatalf("openSafe failed: %v", err)
+	}
+	if again, _ := service.openSafe(absPath, "password"); again == first {
+		t.Error("Expected every open to decrypt when the cache is disabled")
+	}
+}
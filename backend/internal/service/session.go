@@ -0,0 +1,135 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxSessions bounds how many unexpired sessions are held at once
+const maxSessions = 1000
+
+// session lets later reads of one safe skip re-sending its master password.
+// It is tied to the file as it was when issued, so any change to the safe ends it.
+type session struct {
+	token     string
+	safePath  string
+	password  string
+	modTime   time.Time
+	size      int64
+	expiresAt time.Time
+}
+
+type sessionStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*session
+}
+
+// WithSessionTTL lets a successful unlock issue a session token, valid for
+// ttl, that later reads of the same safe can send instead of the password.
+// The password is held in memory for the session's lifetime. Zero disables
+// sessions.
+func WithSessionTTL(ttl time.Duration) SafeOption {
+	return func(s *SafeService) {
+		if ttl > 0 {
+			s.sessions = &sessionStore{ttl: ttl, sessions: make(map[string]*session)}
+		}
+	}
+}
+
+// SessionsEnabled reports whether CreateSession can issue tokens
+func (s *SafeService) SessionsEnabled() bool {
+	return s.sessions != nil
+}
+
+// CreateSession issues a token for safePath. Callers must have already
+// checked that password opens the safe.
+func (s *SafeService) CreateSession(safePath, password string) (string, time.Time, error) {
+	if s.sessions == nil {
+		return "", time.Time{}, fmt.Errorf("invalid session: sessions are not enabled")
+	}
+	absPath, err := s.ValidateSafePath(safePath)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to stat safe: %w", err)
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	store := s.sessions
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.pruneLocked(time.Now())
+	if len(store.sessions) >= maxSessions {
+		return "", time.Time{}, fmt.Errorf("too many active sessions")
+	}
+
+	sess := &session{
+		token:     hex.EncodeToString(buf),
+		safePath:  safePath,
+		password:  password,
+		modTime:   info.ModTime(),
+		size:      info.Size(),
+		expiresAt: time.Now().Add(store.ttl),
+	}
+	store.sessions[sess.token] = sess
+	return sess.token, sess.expiresAt, nil
+}
+
+// SessionPassword returns the master password held by token. Unknown, expired
+// and other safes' tokens are all reported as "invalid session"; a token whose
+// safe has changed since it was issued is ended.
+func (s *SafeService) SessionPassword(safePath, token string) (string, error) {
+	if s.sessions == nil {
+		return "", fmt.Errorf("invalid session: sessions are not enabled")
+	}
+
+	store := s.sessions
+	store.mu.Lock()
+	store.pruneLocked(time.Now())
+	sess, ok := store.sessions[token]
+	store.mu.Unlock()
+	if !ok || subtle.ConstantTimeCompare([]byte(sess.safePath), []byte(safePath)) != 1 {
+		return "", fmt.Errorf("invalid session")
+	}
+
+	absPath, err := s.ValidateSafePath(safePath)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil || !info.ModTime().Equal(sess.modTime) || info.Size() != sess.size {
+		s.EndSession(token)
+		return "", fmt.Errorf("invalid session: safe changed since it was unlocked")
+	}
+	return sess.password, nil
+}
+
+// EndSession forgets token, if it exists
+func (s *SafeService) EndSession(token string) {
+	if s.sessions == nil {
+		return
+	}
+	s.sessions.mu.Lock()
+	delete(s.sessions.sessions, token)
+	s.sessions.mu.Unlock()
+}
+
+func (st *sessionStore) pruneLocked(now time.Time) {
+	for token, sess := range st.sessions {
+		if !now.Before(sess.expiresAt) {
+			delete(st.sessions, token)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessions(t *testing.T) {
+	dir := t.TempDir()
+	safe, err := os.ReadFile("../../testdata/simple.psafe3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.psafe3", "b.psafe3"} {
+		if err := os.WriteFile(filepath.Join(dir, name), safe, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := NewSafeService(dir, WithSessionTTL(time.Minute))
+	pathA := "/" + filepath.Base(dir) + "/a.psafe3"
+	pathB := "/" + filepath.Base(dir) + "/b.psafe3"
+
+	token, expiresAt, err := service.CreateSession(pathA, "password")
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if len(token) != 64 || time.Until(expiresAt) <= 0 {
+		t.Errorf("Unexpected token %q expiring %v", token, expiresAt)
+	}
+
+	if got, err := service.SessionPassword(pathA, token); err != nil || got != "password" {
+		t.Errorf("Expected session password, got %q (err: %v)", got, err)
+	}
+	if _, err := service.SessionPassword(pathB, token); err == nil || !strings.Contains(err.Error(), "invalid session") {
+		t.Errorf("Expected invalid session for another safe, got %v", err)
+	}
+	if _, err := service.SessionPassword(pathA, "unknown"); err == nil || !strings.Contains(err.Error(), "invalid session") {
+		t.Errorf("Expected invalid session for unknown token, got %v", err)
+	}
+
+	// Any change to the file ends the session
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.psafe3"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.SessionPassword(pathA, token); err == nil || !strings.Contains(err.Error(), "safe changed") {
+		t.Errorf("Expected safe changed error, got %v", err)
+	}
+	if _, err := service.SessionPassword(pathA, token); err == nil || strings.Contains(err.Error(), "safe changed") {
+		t.Errorf("Expected ended session to be unknown, got %v", err)
+	}
+}
+
+func TestSessions_Expire(t *testing.T) {
+	service := NewSafeService("../../testdata", WithSessionTTL(time.Minute))
+	token, _, err := service.CreateSession("/testdata/simple.psafe3", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.sessions.sessions[token].expiresAt = time.Now().Add(-time.Second)
+
+	if _, err := service.SessionPassword("/testdata/simple.psafe3", token); err == nil || !strings.Contains(err.Error(), "invalid session") {
+		t.Errorf("Expected expired session to be invalid, got %v", err)
+	}
+	if len(service.sessions.sessions) != 0 {
+		t.Errorf("Expected expired session to be pruned, have %d", len(service.sessions.sessions))
+	}
+}
+
+func TestSessions_Disabled(t *testing.T) {
+	service := NewSafeService("../../testdata")
+	if service.SessionsEnabled() {
+		t.Error("Expected sessions disabled by default")
+	}
+	if _, _, err := service.CreateSession("/testdata/simple.psafe3", "password"); err == nil {
+		t.Error("Expected CreateSession to fail when disabled")
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"math"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+)
+
+// strengthThresholds are the entropy bits needed for scores 1-4
+var strengthThresholds = []float64{28, 36, 60, 128}
+
+// GetEntryPasswordStrength rates an entry's password without returning it
+func (s *SafeService) GetEntryPasswordStrength(safePath, password, entryUUID string) (*models.PasswordStrength, error) {
+	entryPassword, err := s.GetEntryPassword(safePath, password, entryUUID)
+	if err != nil {
+		return nil, err
+	}
+	strength := passwordStrength(entryPassword)
+	return &strength, nil
+}
+
+// passwordStrength scores a password 0-4 from its estimated entropy: length
+// times log2 of the character pool its character classes draw from. Runs of a
+// single repeated character only count once.
+func passwordStrength(password string) models.PasswordStrength {
+	var lower, upper, digit, symbol, other bool
+	effectiveLength := 0
+	var prev rune = -1
+	for _, r := range password {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLower(r):
+			lower = true
+		case r < utf8.RuneSelf && unicode.IsUpper(r):
+			upper = true
+		case r < utf8.RuneSelf && unicode.IsDigit(r):
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+		if r != prev {
+			effectiveLength++
+		}
+		prev = r
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+
+	score := 0
+	if pool > 0 {
+		bits := float64(effectiveLength) * math.Log2(float64(pool))
+		for _, threshold := range strengthThresholds {
+			if bits >= threshold {
+				score++
+			}
+		}
+	}
+
+	return models.PasswordStrength{
+		Score:  score,
+		Length: lengthBucket(utf8.RuneCountInString(password)),
+	}
+}
+
+// lengthBucket reports length coarsely so the exact length isn't disclosed
+func lengthBucket(n int) string {
+	switch {
+	case n == 0:
+		return models.LengthEmpty
+	case n < 8:
+		return models.LengthShort
+	case n < 12:
+		return models.LengthMedium
+	case n < 20:
+		return models.LengthLong
+	default:
+		return models.LengthVeryLong
+	}
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+)
+
+func TestPasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		score    int
+		length   string
+	}{
+		{"", 0, models.LengthEmpty},
+		{"abc", 0, models.LengthShort},
+		{"aaaaaaaaaaaaaaaaaaaaaaaa", 0, models.LengthVeryLong},
+		{"password", 1, models.LengthMedium},
+		{"Passw0rd!x", 2, models.LengthMedium},
+		{"correct-horse-battery", 3, models.LengthVeryLong},
+		{"x7#Kq!9vL@2mZ$4pW&8r", 4, models.LengthVeryLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			got := passwordStrength(tt.password)
+			if got.Score != tt.score {
+				t.Errorf("Expected score %d, got %d", tt.score, got.Score)
+			}
+			if got.Length != tt.length {
+				t.Errorf("Expected length %q, got %q", tt.length, got.Length)
+			}
+		})
+	}
+}
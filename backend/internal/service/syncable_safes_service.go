@@ -1,21 +1,43 @@
 package service
 
 import (
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime/debug"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/rolledback/pwsafe-service/backend/internal/outbound"
 	"github.com/rolledback/pwsafe-service/backend/internal/provider"
 )
 
-const defaultSyncInterval = 15 * time.Minute
+const (
+	defaultSyncInterval         = 15 * time.Minute
+	idleSyncInterval            = 2 * time.Hour // between checks while disconnected
+	defaultSyncJitter           = 0.1           // fraction each interval varies by
+	defaultDownloadStallTimeout = 60 * time.Second
+	defaultDownloadRetries      = 2
+	defaultDownloadRetryBackoff = 2 * time.Second
+	stopTimeout                 = 10 * time.Second // how long Stop waits for a sync to unwind
+)
 
 // SyncableSafesService orchestrates sync for ANY provider.
 // All sync logic lives here - providers only implement primitives.
@@ -25,35 +47,218 @@ type SyncableSafesService struct {
 
 	syncMutex      sync.RWMutex
 	nextSyncMutex  sync.RWMutex
+	configMutex    sync.Mutex // serializes read-modify-write of .config.json
 	nextSyncAt     time.Time
 	syncInterval   time.Duration
+	syncJitter     float64       // each interval is randomly stretched or shrunk by up to this fraction
+	connectedWake  chan struct{} // wakes an idle periodic loop once connected
+
+	// runMutex is held for a whole sync so TrySync can detect one in progress
+	// without contending with status readers on syncMutex
+	runMutex      sync.Mutex
+	syncStartedAt time.Time // guarded by nextSyncMutex; zero when idle
+
+	// Device-code sign-in polled in the background, guarded by deviceMutex
+	deviceMutex   sync.Mutex
+	deviceCancel  context.CancelFunc // non-nil while a sign-in is pending
+	deviceGen     int                // identifies the latest sign-in, so a replaced one can't report
+	deviceAuthErr string             // why the latest sign-in failed, if it did
+
+	webhookURL          string
+	allowPrivateWebhook bool
+	syncLog             *SyncLog
+	history             *syncHistory
+	outboundGuard       *outbound.Guard
+	syncLimiter         *SyncLimiter // nil leaves this service's syncs unbounded
+
+	downloadStallTimeout time.Duration
+	downloadRetries      int
+	downloadRetryBackoff time.Duration
+	extensions           provider.Extensions
+	flattenPaths         bool // store files directly under the provider dir instead of by remote path
+	exclude              provider.ExcludePatterns
+	readOnly             bool // list only: no syncs or selection changes, which would write to disk
 
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
+// SyncOption configures optional behavior of a SyncableSafesService
+type SyncOption func(*SyncableSafesService)
+
+// WithSyncWebhook POSTs a summary to url after each completed sync.
+// Private and loopback targets are refused unless allowPrivate is set.
+func WithSyncWebhook(url string, allowPrivate bool) SyncOption {
+	return func(s *SyncableSafesService) {
+		s.webhookURL = url
+		s.allowPrivateWebhook = allowPrivate
+	}
+}
+
+// WithSyncLog appends a line to l after each sync attempt, including failed ones
+func WithSyncLog(l *SyncLog) SyncOption {
+	return func(s *SyncableSafesService) {
+		s.syncLog = l
+	}
+}
+
+// WithSyncLimiter makes each sync wait for a slot in l, so services sharing it
+// never sync more providers at once than l allows
+func WithSyncLimiter(l *SyncLimiter) SyncOption {
+	return func(s *SyncableSafesService) {
+		s.syncLimiter = l
+	}
+}
+
+// WithOutboundGuard restricts which addresses service-initiated requests
+// (e.g., the sync webhook) may connect to
+func WithOutboundGuard(g *outbound.Guard) SyncOption {
+	return func(s *SyncableSafesService) {
+		if g != nil {
+			s.outboundGuard = g
+		}
+	}
+}
+
+// WithDownloadStallTimeout aborts a download that produces no bytes for d.
+// Slow downloads that keep making progress are allowed to continue.
+func WithDownloadStallTimeout(d time.Duration) SyncOption {
+	return func(s *SyncableSafesService) {
+		if d > 0 {
+			s.downloadStallTimeout = d
+		}
+	}
+}
+
+// WithDownloadRetries retries a file's download up to retries times after a
+// transient failure (network error, stall, cut-off transfer, 5xx/429), waiting backoff before the
+// first retry and doubling it each time. Zero disables retries.
+func WithDownloadRetries(retries int, backoff time.Duration) SyncOption {
+	return func(s *SyncableSafesService) {
+		if retries >= 0 {
+			s.downloadRetries = retries
+		}
+		if backoff > 0 {
+			s.downloadRetryBackoff = backoff
+		}
+	}
+}
+
+// WithSyncInterval sets the time between periodic syncs. Intervals under a
+// minute are ignored, leaving the 15 minute default.
+func WithSyncInterval(d time.Duration) SyncOption {
+	return func(s *SyncableSafesService) {
+		if d >= time.Minute {
+			s.syncInterval = d
+		}
+	}
+}
+
+// WithSyncJitter randomly varies each periodic sync interval by up to
+// ±fraction so providers started together don't all sync at once.
+// Zero disables jitter; values of 0.5 or more are ignored.
+func WithSyncJitter(fraction float64) SyncOption {
+	return func(s *SyncableSafesService) {
+		if fraction >= 0 && fraction < 0.5 {
+			s.syncJitter = fraction
+		}
+	}
+}
+
+// WithSyncExtensions sets which remote files are listed and which local files are
+// treated as synced safes during cleanup.
+// Use the same set as the SafeService so every synced file is listed.
+func WithSyncExtensions(exts provider.Extensions) SyncOption {
+	return func(s *SyncableSafesService) {
+		if len(exts) > 0 {
+			s.extensions = exts
+		}
+	}
+}
+
+// WithFlattenPaths stores every synced file directly under the provider
+// directory instead of recreating the remote folder structure. Files that share
+// a name get a suffix derived from their ID.
+func WithFlattenPaths(flatten bool) SyncOption {
+	return func(s *SyncableSafesService) {
+		s.flattenPaths = flatten
+	}
+}
+
+// WithExcludePatterns hides matching remote files from the file list and skips
+// them during sync, even if they were selected before being excluded
+func WithExcludePatterns(patterns provider.ExcludePatterns) SyncOption {
+	return func(s *SyncableSafesService) {
+		s.exclude = patterns
+	}
+}
+
+// WithReadOnly runs the service in listing-only mode for a safes directory
+// that can't be written: remote files and already-synced copies still list,
+// but syncs and selection changes fail with a "read-only" error instead of
+// failing midway on a write
+func WithReadOnly() SyncOption {
+	return func(s *SyncableSafesService) {
+		s.readOnly = true
+	}
+}
+
 // NewSyncableSafesService creates a sync service for a single provider
 func NewSyncableSafesService(
 	ctx context.Context,
 	safesDirectory string,
 	p provider.SyncableSafesProvider,
+	opts ...SyncOption,
 ) *SyncableSafesService {
 	ctx, cancel := context.WithCancel(ctx)
 	svc := &SyncableSafesService{
 		safesDirectory: safesDirectory,
 		provider:       p,
 		syncInterval:   defaultSyncInterval,
-		nextSyncAt:     time.Now().Add(defaultSyncInterval),
+		syncJitter:     defaultSyncJitter,
+		connectedWake:  make(chan struct{}, 1),
+		history:        newSyncHistory(DefaultSyncHistorySize),
 		ctx:            ctx,
 		cancel:         cancel,
+
+		downloadStallTimeout: defaultDownloadStallTimeout,
+		downloadRetries:      defaultDownloadRetries,
+		downloadRetryBackoff: defaultDownloadRetryBackoff,
+		extensions:           provider.DefaultExtensions,
+		outboundGuard:        outbound.Default(),
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+	if svc.readOnly {
+		return svc
 	}
-	go svc.periodicSync()
+	// Schedule before starting the loop so status never reports a zero nextSyncAt
+	initialInterval := svc.scheduleNextSync(svc.syncInterval)
+	go svc.periodicSync(initialInterval)
 	return svc
 }
 
-// Stop gracefully shuts down the sync loop
+// Stop gracefully shuts down the sync loop. Any sync in progress is cancelled
+// and given up to stopTimeout to unwind; once it has, leftover temp files are
+// removed.
 func (s *SyncableSafesService) Stop() {
 	s.cancel()
+
+	unwound := make(chan struct{})
+	go func() {
+		s.runMutex.Lock()
+		defer s.runMutex.Unlock()
+		close(unwound)
+	}()
+	select {
+	case <-unwound:
+		s.cleanupTempFiles()
+	case <-time.After(stopTimeout):
+		// The sync may still be writing its temp files, so they're left for
+		// RemoveTempFiles at the next startup
+		log.Printf("%s: sync still running after %s, shutting down anyway", s.provider.ID(), stopTimeout)
+	}
 }
 
 // Provider returns the underlying provider (for auth flow delegation)
@@ -70,22 +275,34 @@ func (s *SyncableSafesService) GetProviderStatus(ctx context.Context) (*Provider
 	if err != nil {
 		return nil, err
 	}
+	if status.Connected {
+		s.notifyConnected()
+	}
 
 	config, _ := s.loadConfig()
+	deviceAuthPending, deviceAuthErr := s.deviceAuthState()
 
-	s.nextSyncMutex.RLock()
-	nextSyncAt := s.nextSyncAt.Format(time.RFC3339)
-	s.nextSyncMutex.RUnlock()
+	// No periodic syncs are scheduled in read-only mode
+	var nextSyncAt string
+	if !s.readOnly {
+		s.nextSyncMutex.RLock()
+		nextSyncAt = s.nextSyncAt.Format(time.RFC3339)
+		s.nextSyncMutex.RUnlock()
+	}
 
 	return &ProviderStatus{
-		ID:           s.provider.ID(),
-		DisplayName:  s.provider.DisplayName(),
-		Connected:    status.Connected,
-		NeedsReauth:  status.NeedsReauth,
-		AccountName:  status.AccountName,
-		AccountEmail: status.AccountEmail,
-		LastSyncTime: config.LastSyncTime,
-		NextSyncAt:   nextSyncAt,
+		ID:                     s.provider.ID(),
+		DisplayName:            s.provider.DisplayName(),
+		Connected:              status.Connected,
+		NeedsReauth:            status.NeedsReauth,
+		AccountName:            status.AccountName,
+		AccountEmail:           status.AccountEmail,
+		LastSyncTime:           config.LastSyncTime,
+		LastSuccessfulSyncTime: config.LastSuccessfulSyncTime,
+		NextSyncAt:             nextSyncAt,
+		ReadOnly:               s.readOnly,
+		DeviceAuthPending:      deviceAuthPending,
+		DeviceAuthError:        deviceAuthErr,
 	}, nil
 }
 
@@ -102,12 +319,17 @@ func (s *SyncableSafesService) ListFiles(ctx context.Context) ([]SelectedFile, e
 	remoteFiles, err := s.provider.ListRemoteFiles(ctx)
 	if err != nil {
 		// Return cached files if remote unavailable
-		return config.Files, nil
+		files := slices.DeleteFunc(config.Files, s.excluded)
+		sortFiles(files)
+		return files, nil
 	}
 
 	// Merge: remote files + saved selection state
 	var result []SelectedFile
 	for _, rf := range remoteFiles {
+		if !s.extensions.Match(rf.Name) || s.exclude.Match(rf) {
+			continue
+		}
 		result = append(result, SelectedFile{
 			ID:       rf.ID,
 			Name:     rf.Name,
@@ -115,20 +337,274 @@ func (s *SyncableSafesService) ListFiles(ctx context.Context) ([]SelectedFile, e
 			Selected: savedSelections[rf.ID],
 		})
 	}
+	sortFiles(result)
 
 	return result, nil
 }
 
+// excluded reports whether a saved file matches the exclude patterns
+func (s *SyncableSafesService) excluded(f SelectedFile) bool {
+	return s.exclude.Match(provider.RemoteFile{ID: f.ID, Name: f.Name, Path: f.Path})
+}
+
+// BrowseFolder lists one remote folder's subfolders and safe files, merged with
+// the saved selection state. Excluded folders and files are left out, and an
+// excluded folder can't be browsed. Providers that can't list a folder return
+// a "browse not supported" error.
+func (s *SyncableSafesService) BrowseFolder(ctx context.Context, folderPath string) (*FolderContents, error) {
+	browser, ok := s.provider.(provider.FolderBrowser)
+	if !ok {
+		return nil, fmt.Errorf("browse not supported")
+	}
+	if !strings.HasPrefix(folderPath, "/") {
+		return nil, fmt.Errorf("invalid folder path: must start with /")
+	}
+	folderPath = path.Clean(folderPath)
+	if folderPath != "/" && s.exclude.Match(provider.RemoteFile{Name: path.Base(folderPath), Path: path.Dir(folderPath)}) {
+		return nil, fmt.Errorf("folder not found: %s", folderPath)
+	}
+
+	listing, err := browser.BrowseFolder(ctx, folderPath)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _ := s.loadConfig()
+	savedSelections := make(map[string]bool)
+	for _, f := range config.Files {
+		savedSelections[f.ID] = f.Selected
+	}
+
+	contents := &FolderContents{Path: folderPath, Folders: []string{}, Files: []SelectedFile{}}
+	for _, name := range listing.Folders {
+		if !s.exclude.Match(provider.RemoteFile{Name: name, Path: folderPath}) {
+			contents.Folders = append(contents.Folders, name)
+		}
+	}
+	slices.Sort(contents.Folders)
+	for _, rf := range listing.Files {
+		if !s.extensions.Match(rf.Name) || s.exclude.Match(rf) {
+			continue
+		}
+		contents.Files = append(contents.Files, SelectedFile{
+			ID:       rf.ID,
+			Name:     rf.Name,
+			Path:     rf.Path,
+			Selected: savedSelections[rf.ID],
+		})
+	}
+	sortFiles(contents.Files)
+	return contents, nil
+}
+
+// GroupFilesByFolder groups files by Path, keeping the order of the input
+// (ListFiles returns files sorted by Path, so folders come out sorted too)
+func GroupFilesByFolder(files []SelectedFile) []FileFolder {
+	folders := []FileFolder{}
+	index := make(map[string]int)
+	for _, f := range files {
+		i, ok := index[f.Path]
+		if !ok {
+			i = len(folders)
+			index[f.Path] = i
+			folders = append(folders, FileFolder{Path: f.Path})
+		}
+		folders[i].Files = append(folders[i].Files, f)
+	}
+	return folders
+}
+
+// SelectedFiles returns the persisted selection straight from disk, without
+// contacting the provider, so it works while offline or awaiting reauth
+func (s *SyncableSafesService) SelectedFiles() ([]SelectedFile, error) {
+	config, err := s.loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	selected := []SelectedFile{}
+	for _, f := range config.Files {
+		if f.Selected && !s.excluded(f) {
+			selected = append(selected, f)
+		}
+	}
+	sortFiles(selected)
+	return selected, nil
+}
+
+// GetQuota reports the provider account's storage usage. Providers that can't
+// report it return a "quota not supported" error.
+func (s *SyncableSafesService) GetQuota(ctx context.Context) (*provider.Quota, error) {
+	reporter, ok := s.provider.(provider.QuotaReporter)
+	if !ok {
+		return nil, fmt.Errorf("quota not supported")
+	}
+	return reporter.Quota(ctx)
+}
+
+// PushFile uploads the synced copy of a selected file back to the provider,
+// replacing the remote file. Providers that can't write return an "upload not
+// supported" error.
+func (s *SyncableSafesService) PushFile(ctx context.Context, fileID string) error {
+	writer, ok := s.provider.(provider.WritableSafesProvider)
+	if !ok {
+		return fmt.Errorf("upload not supported")
+	}
+	if s.readOnly {
+		return fmt.Errorf("read-only: safes directory is not writable, uploads are disabled")
+	}
+
+	s.syncMutex.Lock()
+	defer s.syncMutex.Unlock()
+
+	config, err := s.loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	var selectedFiles []SelectedFile
+	var file *SelectedFile
+	for i, f := range config.Files {
+		if f.Selected && !s.excluded(f) {
+			selectedFiles = append(selectedFiles, f)
+			if f.ID == fileID {
+				file = &config.Files[i]
+			}
+		}
+	}
+	if file == nil {
+		return fmt.Errorf("file not selected: %s", fileID)
+	}
+
+	localPath, err := s.getLocalPath(*file, s.nameCollisions(selectedFiles))
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("file not synced: %s", file.Name)
+	}
+	defer f.Close()
+
+	// The upload is conditional on the remote file still being the version
+	// last synced, so a change made elsewhere is never silently overwritten
+	etag := config.ETags[fileID]
+	if etag == "" {
+		return fmt.Errorf("%w: no ETag recorded for %s, sync it first", provider.ErrUploadConflict, file.Name)
+	}
+	uploaded, err := writer.UploadFile(ctx, fileID, etag, f)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", file.Name, err)
+	}
+
+	// The local copy is now the remote version, so it becomes the baseline
+	// the next sync compares against
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", file.Name, err)
+	}
+	return s.updateConfig(func(config *SyncConfig) {
+		if config.ETags == nil {
+			config.ETags = make(map[string]string)
+		}
+		if config.Versions == nil {
+			config.Versions = make(map[string]SyncedVersion)
+		}
+		if uploaded.ETag != "" {
+			config.ETags[fileID] = uploaded.ETag
+		} else {
+			delete(config.ETags, fileID)
+		}
+		config.Versions[fileID] = SyncedVersion{
+			LocalModified:  info.ModTime().UTC().Format(time.RFC3339Nano),
+			RemoteModified: uploaded.LastModified,
+		}
+	})
+}
+
+// Capabilities reports which of the optional provider interfaces the provider
+// implements, along with this instance's read-only mode
+func (s *SyncableSafesService) Capabilities() ProviderCapabilities {
+	_, conditional := s.provider.(provider.ConditionalDownloader)
+	_, quota := s.provider.(provider.QuotaReporter)
+	_, browse := s.provider.(provider.FolderBrowser)
+	_, device := s.provider.(provider.DeviceAuthorizer)
+	writer, upload := s.provider.(provider.WritableSafesProvider)
+	upload = upload && writer.UploadEnabled()
+	return ProviderCapabilities{
+		ID:                  s.provider.ID(),
+		DisplayName:         s.provider.DisplayName(),
+		ConditionalDownload: conditional,
+		Quota:               quota,
+		Browse:              browse,
+		DeviceAuth:          device,
+		Upload:              upload,
+		ReadOnly:            s.readOnly,
+	}
+}
+
 // SaveFiles persists file selection state
 func (s *SyncableSafesService) SaveFiles(files []SelectedFile) error {
-	config, _ := s.loadConfig()
-	config.Files = files
-	return s.saveConfig(config)
+	if s.readOnly {
+		return fmt.Errorf("read-only: safes directory is not writable, file selection can't be saved")
+	}
+	return s.updateConfig(func(config *SyncConfig) {
+		config.Files = files
+	})
 }
 
-// Sync performs the sync operation
-// THIS IS THE CORE GENERIC SYNC ALGORITHM
+// Sync performs the sync operation, waiting for any sync already in progress
 func (s *SyncableSafesService) Sync(ctx context.Context) ([]SyncResult, error) {
+	s.runMutex.Lock()
+	defer s.runMutex.Unlock()
+	results, err := s.runSync(ctx)
+	s.recordSync(results, err)
+	return results, err
+}
+
+// TrySync performs the sync operation unless one is already in progress,
+// in which case it returns a "sync already in progress" error immediately
+func (s *SyncableSafesService) TrySync(ctx context.Context) ([]SyncResult, error) {
+	if !s.runMutex.TryLock() {
+		return nil, fmt.Errorf("sync already in progress")
+	}
+	defer s.runMutex.Unlock()
+	results, err := s.runSync(ctx)
+	s.recordSync(results, err)
+	return results, err
+}
+
+// SyncStartedAt returns when the in-progress sync started, or the zero time if none is running
+func (s *SyncableSafesService) SyncStartedAt() time.Time {
+	s.nextSyncMutex.RLock()
+	defer s.nextSyncMutex.RUnlock()
+	return s.syncStartedAt
+}
+
+// runSync is the body of Sync; callers must hold runMutex
+// THIS IS THE CORE GENERIC SYNC ALGORITHM
+func (s *SyncableSafesService) runSync(ctx context.Context) ([]SyncResult, error) {
+	if s.ctx.Err() != nil {
+		return nil, fmt.Errorf("sync service stopped")
+	}
+	if s.readOnly {
+		return nil, fmt.Errorf("read-only: safes directory is not writable, sync is disabled")
+	}
+
+	// Stop cancels the sync whichever context it was started with
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopOnShutdown := context.AfterFunc(s.ctx, cancel)
+	defer stopOnShutdown()
+
+	if s.syncLimiter != nil {
+		if err := s.syncLimiter.acquire(ctx, s.provider.ID()); err != nil {
+			return nil, fmt.Errorf("sync cancelled while waiting to start: %w", err)
+		}
+		defer s.syncLimiter.release()
+	}
+
+	s.setSyncStartedAt(time.Now())
+	defer s.setSyncStartedAt(time.Time{})
+
 	s.syncMutex.Lock()
 	defer s.syncMutex.Unlock()
 
@@ -148,19 +624,31 @@ func (s *SyncableSafesService) Sync(ctx context.Context) ([]SyncResult, error) {
 	}
 
 	// Get selected files
+	// Excluded files count as unselected, so earlier copies are cleaned up
 	var selectedFiles []SelectedFile
 	for _, f := range config.Files {
-		if f.Selected {
+		if f.Selected && !s.excluded(f) {
 			selectedFiles = append(selectedFiles, f)
 		}
 	}
 
 	var results []SyncResult
+	etags := make(map[string]string)
+	versions := make(map[string]SyncedVersion)
 
 	// Step 2: For each selected file, download from remote
+	collisions := s.nameCollisions(selectedFiles)
 	for _, file := range selectedFiles {
-		localPath := s.getLocalPath(file)
+		if ctx.Err() != nil {
+			break
+		}
 		result := SyncResult{Name: file.Name, Success: false}
+		localPath, err := s.getLocalPath(file, collisions)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
 
 		// Ensure parent directory exists
 		if err := os.MkdirAll(filepath.Dir(localPath), 0700); err != nil {
@@ -169,31 +657,163 @@ func (s *SyncableSafesService) Sync(ctx context.Context) ([]SyncResult, error) {
 			continue
 		}
 
+		// Only ask for a conditional download if we still have the copy it refers to
+		etag := config.ETags[file.ID]
+		version, hasVersion := config.Versions[file.ID]
+		localInfo, err := os.Stat(localPath)
+		if err != nil {
+			etag = ""
+			hasVersion = false
+		}
+
+		// A local copy changed since its download is only replaced if the
+		// remote one hasn't changed too
+		var changedSince *SyncedVersion
+		if hasVersion && localModifiedSince(localInfo, version) {
+			changedSince = &version
+		}
+
 		// Download via provider primitive (returns DownloadResult with LastModified)
-		lastModified, err := s.downloadToPath(ctx, file.ID, localPath)
+		download, written, err := s.downloadWithRetry(ctx, file.ID, localPath, etag, changedSince)
 		if err != nil {
 			result.Error = err.Error()
+			if errors.Is(err, errSyncConflict) {
+				result.Conflict = true
+				result.LastModified = download.LastModified
+				result.LocalModified = localInfo.ModTime().UTC().Format(time.RFC3339)
+			}
+			if etag != "" {
+				etags[file.ID] = etag // local copy is untouched
+			}
+			if hasVersion {
+				versions[file.ID] = version
+			}
 		} else {
 			result.Success = true
-			result.LastModified = lastModified
+			result.LastModified = download.LastModified
+			result.Unchanged = download.NotModified
+			result.Bytes = written
+			if download.ETag != "" {
+				etags[file.ID] = download.ETag
+			}
+			if download.NotModified && hasVersion {
+				versions[file.ID] = version
+			} else if info, err := os.Stat(localPath); err == nil {
+				versions[file.ID] = SyncedVersion{
+					LocalModified:  info.ModTime().UTC().Format(time.RFC3339Nano),
+					RemoteModified: download.LastModified,
+				}
+			}
 		}
 		results = append(results, result)
 	}
 
+	// A cancelled sync leaves config and local files as they were
+	if err := ctx.Err(); err != nil {
+		return results, fmt.Errorf("sync cancelled: %w", err)
+	}
+
 	// Step 3: Cleanup files no longer selected
 	s.cleanupUnselectedFiles(selectedFiles)
 
-	// Step 4: Update LastSyncTime
-	config.LastSyncTime = time.Now().Format(time.RFC3339)
-	s.saveConfig(config)
+	// Step 4: Update LastSyncTime and ETags. Reload rather than saving the copy
+	// read in step 1 so a selection saved during the sync isn't overwritten.
+	allSucceeded := true
+	for _, result := range results {
+		allSucceeded = allSucceeded && result.Success
+	}
+	s.updateConfig(func(config *SyncConfig) {
+		now := time.Now().Format(time.RFC3339)
+		config.ETags = etags
+		config.Versions = versions
+		config.LastSyncTime = now
+		if allSucceeded {
+			config.LastSuccessfulSyncTime = now
+		}
+	})
+
+	// Step 5: Notify webhook (best-effort, never affects the sync result)
+	s.notifySyncWebhook(results)
 
-	// Step 5: Next sync scheduled by periodic loop
+	// Step 6: Next sync scheduled by periodic loop
 
 	return results, nil
 }
 
+// StartDeviceAuth begins a device-code sign-in and polls for the user's
+// approval in the background until the code expires or the service stops.
+// Starting another replaces any pending one.
+func (s *SyncableSafesService) StartDeviceAuth(ctx context.Context) (*provider.DeviceCode, error) {
+	authorizer, ok := s.provider.(provider.DeviceAuthorizer)
+	if !ok {
+		return nil, fmt.Errorf("device code auth not supported")
+	}
+	if s.readOnly {
+		return nil, fmt.Errorf("read-only: safes directory is not writable, sign-in tokens can't be saved")
+	}
+	code, err := authorizer.RequestDeviceCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Outlives the request that started it
+	pollCtx, cancel := context.WithDeadline(s.ctx, code.ExpiresAt)
+	s.deviceMutex.Lock()
+	if s.deviceCancel != nil {
+		s.deviceCancel()
+	}
+	s.deviceGen++
+	gen := s.deviceGen
+	s.deviceCancel = cancel
+	s.deviceAuthErr = ""
+	s.deviceMutex.Unlock()
+
+	go func() {
+		defer cancel()
+		err := authorizer.CompleteDeviceAuth(pollCtx, code)
+		if err != nil && errors.Is(pollCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("device code expired")
+		}
+
+		s.deviceMutex.Lock()
+		latest := gen == s.deviceGen
+		if latest {
+			s.deviceCancel = nil
+			if err != nil {
+				s.deviceAuthErr = err.Error()
+			}
+		}
+		s.deviceMutex.Unlock()
+
+		switch {
+		case err == nil:
+			log.Printf("%s: device sign-in completed", s.provider.ID())
+			s.notifyConnected()
+		case latest && s.ctx.Err() == nil:
+			log.Printf("%s: device sign-in failed: %v", s.provider.ID(), err)
+		}
+	}()
+
+	return code, nil
+}
+
+// deviceAuthState reports whether a device-code sign-in is pending and why
+// the latest one failed
+func (s *SyncableSafesService) deviceAuthState() (pending bool, lastErr string) {
+	s.deviceMutex.Lock()
+	defer s.deviceMutex.Unlock()
+	return s.deviceCancel != nil, s.deviceAuthErr
+}
+
 // Disconnect removes provider connection and cleans up
 func (s *SyncableSafesService) Disconnect(ctx context.Context) error {
+	// A pending device sign-in would reconnect right after
+	s.deviceMutex.Lock()
+	if s.deviceCancel != nil {
+		s.deviceCancel()
+	}
+	s.deviceMutex.Unlock()
+
 	// Let provider clean up its auth state (tokens)
 	if err := s.provider.Disconnect(ctx); err != nil {
 		return err
@@ -206,31 +826,132 @@ func (s *SyncableSafesService) Disconnect(ctx context.Context) error {
 	return nil
 }
 
+// HandleCallback completes an OAuth sign-in with the authorization code from
+// the provider's redirect, then wakes the periodic loop so syncing resumes
+// right away rather than at the next idle check
+func (s *SyncableSafesService) HandleCallback(ctx context.Context, code string) error {
+	if s.readOnly {
+		return fmt.Errorf("read-only: safes directory is not writable, sign-in tokens can't be saved")
+	}
+	if err := s.provider.HandleCallback(ctx, code); err != nil {
+		return err
+	}
+	s.notifyConnected()
+	return nil
+}
+
+// ForceReauth discards the provider's tokens so the next sign-in starts
+// clean, keeping the saved file selection and synced files so syncing
+// resumes once the user signs in again
+func (s *SyncableSafesService) ForceReauth(ctx context.Context) error {
+	s.deviceMutex.Lock()
+	if s.deviceCancel != nil {
+		s.deviceCancel()
+	}
+	s.deviceMutex.Unlock()
+
+	return s.provider.Disconnect(ctx)
+}
+
 // ============ PRIVATE HELPER METHODS (all generic) ============
 
-func (s *SyncableSafesService) periodicSync() {
-	ticker := time.NewTicker(s.syncInterval)
-	defer ticker.Stop()
+// sortFiles orders files by Path then Name so folders stay together
+func sortFiles(files []SelectedFile) {
+	slices.SortStableFunc(files, func(a, b SelectedFile) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+func (s *SyncableSafesService) setSyncStartedAt(t time.Time) {
+	s.nextSyncMutex.Lock()
+	s.syncStartedAt = t
+	s.nextSyncMutex.Unlock()
+}
+
+// periodicSync runs a sync every syncInterval. While the provider is
+// disconnected it only checks back every idleSyncInterval, returning to the
+// normal cadence as soon as a status check sees it connected.
+func (s *SyncableSafesService) periodicSync(initialInterval time.Duration) {
+	timer := time.NewTimer(initialInterval)
+	defer timer.Stop()
+	idle := false
 
 	for {
 		select {
 		case <-s.ctx.Done():
 			log.Printf("%s: periodic sync stopped", s.provider.ID())
 			return
-		case <-ticker.C:
-			s.tryPeriodicSync()
-			s.nextSyncMutex.Lock()
-			s.nextSyncAt = time.Now().Add(s.syncInterval)
-			s.nextSyncMutex.Unlock()
+		case <-s.connectedWake:
+			if !idle {
+				continue
+			}
+			idle = false
+			log.Printf("%s: connected, resuming periodic sync", s.provider.ID())
+			timer.Reset(s.scheduleNextSync(s.syncInterval))
+		case <-timer.C:
+			s.pruneAuthState()
+			connected := s.tryPeriodicSync()
+			idle = !connected
+			interval := s.syncInterval
+			if idle {
+				interval = idleSyncInterval
+			}
+			timer.Reset(s.scheduleNextSync(interval))
 		}
 	}
 }
 
-func (s *SyncableSafesService) tryPeriodicSync() {
+// scheduleNextSync jitters interval, records when the next periodic sync is due
+// and returns the jittered interval to wait
+func (s *SyncableSafesService) scheduleNextSync(interval time.Duration) time.Duration {
+	interval = jitter(interval, s.syncJitter)
+	s.nextSyncMutex.Lock()
+	s.nextSyncAt = time.Now().Add(interval)
+	s.nextSyncMutex.Unlock()
+	return interval
+}
+
+// jitter returns d randomly adjusted by up to ±fraction
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	return d + time.Duration((rand.Float64()*2-1)*fraction*float64(d))
+}
+
+// notifyConnected wakes the periodic loop if it's idling while disconnected
+func (s *SyncableSafesService) notifyConnected() {
+	select {
+	case s.connectedWake <- struct{}{}:
+	default:
+	}
+}
+
+// pruneAuthState lets providers drop expired auth state, even while disconnected
+func (s *SyncableSafesService) pruneAuthState() {
+	if pruner, ok := s.provider.(provider.AuthStatePruner); ok {
+		pruner.PruneExpiredAuthState()
+	}
+}
+
+// tryPeriodicSync runs one scheduled sync and reports whether the provider was
+// connected. A panic in a provider is logged and recovered so the periodic loop
+// keeps running for future ticks.
+func (s *SyncableSafesService) tryPeriodicSync() (connected bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("%s: periodic sync panicked: %v\n%s", s.provider.ID(), r, debug.Stack())
+		}
+	}()
+
 	status, err := s.provider.GetConnectionStatus(s.ctx, false) // cheap check
 	if err != nil || !status.Connected {
-		return // Skip if not connected
+		return false // Skip if not connected
 	}
+	connected = true
 
 	log.Printf("%s: starting periodic sync", s.provider.ID())
 	results, err := s.Sync(s.ctx)
@@ -245,6 +966,7 @@ func (s *SyncableSafesService) tryPeriodicSync() {
 		}
 		log.Printf("%s: periodic sync completed (%d/%d files)", s.provider.ID(), successCount, len(results))
 	}
+	return connected
 }
 
 func (s *SyncableSafesService) providerDir() string {
@@ -270,6 +992,8 @@ func (s *SyncableSafesService) loadConfig() (*SyncConfig, error) {
 	return &config, nil
 }
 
+// saveConfig writes via a temp file and rename so concurrent readers never see
+// a partial file. Use updateConfig to change fields of the saved config.
 func (s *SyncableSafesService) saveConfig(config *SyncConfig) error {
 	if err := os.MkdirAll(s.providerDir(), 0700); err != nil {
 		return err
@@ -278,52 +1002,331 @@ func (s *SyncableSafesService) saveConfig(config *SyncConfig) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.configPath(), data, 0600)
+	tmpPath := s.configPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, s.configPath()); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
 }
 
-func (s *SyncableSafesService) getLocalPath(file SelectedFile) string {
-	relativePath := filepath.FromSlash(file.Path)
-	relativePath = strings.TrimPrefix(relativePath, string(filepath.Separator))
-	return filepath.Join(s.providerDir(), relativePath, file.Name)
+// updateConfig loads the config, applies fn and saves it, holding configMutex
+// so concurrent updates (e.g. SaveFiles during a sync) don't clobber each other
+func (s *SyncableSafesService) updateConfig(fn func(config *SyncConfig)) error {
+	s.configMutex.Lock()
+	defer s.configMutex.Unlock()
+
+	config, err := s.loadConfig()
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		// A corrupt file would otherwise block every later update, including
+		// saving a new selection to recover. Keep it for inspection and start
+		// over, which at worst costs a full download on the next sync.
+		corruptPath := s.configPath() + ".corrupt"
+		log.Printf("%s: config is corrupt (%v), moving it to %s and starting from an empty config", s.provider.ID(), err, filepath.Base(corruptPath))
+		if err := os.Rename(s.configPath(), corruptPath); err != nil {
+			return fmt.Errorf("failed to move aside corrupt config: %w", err)
+		}
+		config, err = &SyncConfig{Files: []SelectedFile{}}, nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	fn(config)
+	return s.saveConfig(config)
 }
 
-// downloadToPath handles atomic file writing from provider stream
-// Returns the LastModified header value from the download
-func (s *SyncableSafesService) downloadToPath(ctx context.Context, fileID, localPath string) (string, error) {
+// getLocalPath maps a remote file to its path under the provider directory.
+// Path and Name come from the provider, so a result that would land outside
+// the directory (e.g. Path "../..") is rejected rather than written.
+// collisions comes from nameCollisions over the same selection.
+func (s *SyncableSafesService) getLocalPath(file SelectedFile, collisions map[string]bool) (string, error) {
+	var localPath string
+	if s.flattenPaths {
+		name := file.Name
+		if collisions[name] {
+			name = disambiguatedName(file)
+		}
+		localPath = filepath.Join(s.providerDir(), name)
+	} else {
+		relativePath := filepath.FromSlash(file.Path)
+		relativePath = strings.TrimPrefix(relativePath, string(filepath.Separator))
+		localPath = filepath.Join(s.providerDir(), relativePath, file.Name)
+	}
+	if !isStrictlyWithin(s.providerDir(), localPath) {
+		return "", fmt.Errorf("invalid file path: %s escapes the provider directory", path.Join(file.Path, file.Name))
+	}
+	return localPath, nil
+}
+
+// nameCollisions returns the file names shared by more than one selected file.
+// Only the flat layout can collide, so it's nil for the nested layout.
+func (s *SyncableSafesService) nameCollisions(files []SelectedFile) map[string]bool {
+	if !s.flattenPaths {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, f := range files {
+		counts[f.Name]++
+	}
+	collisions := make(map[string]bool)
+	for name, n := range counts {
+		if n > 1 {
+			collisions[name] = true
+		}
+	}
+	return collisions
+}
+
+// disambiguatedName inserts a short hash of the file's ID before its
+// extension, e.g. "work.psafe3" -> "work-1a2b3c4d.psafe3"
+func disambiguatedName(file SelectedFile) string {
+	sum := sha256.Sum256([]byte(file.ID))
+	ext := filepath.Ext(file.Name)
+	return strings.TrimSuffix(file.Name, ext) + "-" + hex.EncodeToString(sum[:4]) + ext
+}
+
+// downloadWithRetry calls downloadToPath, retrying transient failures with
+// exponential backoff. Stops early if ctx is cancelled.
+func (s *SyncableSafesService) downloadWithRetry(ctx context.Context, fileID, localPath, etag string, changedSince *SyncedVersion) (*provider.DownloadResult, int64, error) {
+	backoff := s.downloadRetryBackoff
+	for attempt := 0; ; attempt++ {
+		result, written, err := s.downloadToPath(ctx, fileID, localPath, etag, changedSince)
+		if err == nil || attempt >= s.downloadRetries || !isRetryableDownloadError(err) {
+			return result, written, err
+		}
+
+		log.Printf("%s: download of %s failed, retrying in %s: %v", s.provider.ID(), fileID, backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil, 0, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Download failures worth retrying: the transfer stopped or was cut short,
+// rather than failing for a reason another attempt won't change
+var (
+	errDownloadStalled     = errors.New("download stalled")
+	errDownloadInterrupted = errors.New("download interrupted")
+	errDownloadIncomplete  = errors.New("download incomplete")
+)
+
+// isRetryableDownloadError reports whether a download failure is likely
+// transient: a network error, a 5xx or 429 response, or a transfer that
+// stalled or ended early. Auth failures, missing files, bad content and local
+// disk errors are not retried.
+func isRetryableDownloadError(err error) bool {
+	msg := err.Error()
+	if errors.Is(err, context.Canceled) || strings.Contains(msg, "not authenticated") || strings.Contains(msg, "REAUTH_REQUIRED") {
+		return false
+	}
+	if errors.Is(err, errDownloadStalled) || errors.Is(err, errDownloadInterrupted) || errors.Is(err, errDownloadIncomplete) {
+		return true
+	}
+	var statusErr *provider.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	// Not net.Error: syscall.Errno satisfies it, and local disk errors carry one
+	var opErr *net.OpError
+	var urlErr *url.Error
+	return errors.As(err, &opErr) || errors.As(err, &urlErr)
+}
+
+// errSyncConflict reports a file whose local copy and remote version both
+// changed since it was last downloaded
+var errSyncConflict = errors.New("sync conflict: local copy and remote file both changed since the last sync")
+
+// localModifiedSince reports whether the local copy's mtime differs from the
+// one recorded when it was downloaded
+func localModifiedSince(info os.FileInfo, version SyncedVersion) bool {
+	recorded, err := time.Parse(time.RFC3339Nano, version.LocalModified)
+	return err == nil && !info.ModTime().Equal(recorded)
+}
+
+// downloadToPath handles atomic file writing from provider stream.
+// If etag is set and the provider supports conditional downloads, an unchanged
+// file is left in place and the result has NotModified set.
+// If changedSince is set, the local copy has changed since that version was
+// downloaded; a remote file that has changed too is not written and
+// errSyncConflict is returned along with its metadata.
+// Returns the download metadata (Content is consumed and closed) and the number
+// of bytes written
+func (s *SyncableSafesService) downloadToPath(ctx context.Context, fileID, localPath, etag string, changedSince *SyncedVersion) (*provider.DownloadResult, int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Get stream from provider
-	result, err := s.provider.DownloadFile(ctx, fileID)
+	var result *provider.DownloadResult
+	var err error
+	if cd, ok := s.provider.(provider.ConditionalDownloader); ok && etag != "" {
+		result, err = cd.DownloadFileIfNoneMatch(ctx, fileID, etag)
+	} else {
+		result, err = s.provider.DownloadFile(ctx, fileID)
+	}
 	if err != nil {
-		return "", fmt.Errorf("download failed: %w", err)
+		return nil, 0, fmt.Errorf("download failed: %w", err)
+	}
+	if result.NotModified {
+		return result, 0, nil
 	}
 	defer result.Content.Close()
+	if changedSince != nil && (result.LastModified == "" || result.LastModified != changedSince.RemoteModified) {
+		return result, 0, errSyncConflict
+	}
+
+	// Abort if the stream stops producing bytes. Closing the body unblocks
+	// readers that don't observe context cancellation.
+	var stalled atomic.Bool
+	stallTimer := time.AfterFunc(s.downloadStallTimeout, func() {
+		stalled.Store(true)
+		cancel()
+		result.Content.Close()
+	})
+	defer stallTimer.Stop()
+	stopOnCancel := context.AfterFunc(ctx, func() { result.Content.Close() })
+	defer stopOnCancel()
+
+	// Stall detection and the size check apply to the bytes as sent. The
+	// body's own read errors are kept apart from decoding and disk errors,
+	// since only a broken transfer is worth retrying.
+	raw := &progressReader{r: result.Content, onProgress: func() {
+		stallTimer.Reset(s.downloadStallTimeout)
+	}}
+	decoded, err := decodeContent(raw, result.ContentEncoding)
+	if err != nil {
+		if stalled.Load() {
+			return nil, 0, fmt.Errorf("%w: no data received for %s", errDownloadStalled, s.downloadStallTimeout)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, 0, fmt.Errorf("download cancelled: %w", ctxErr)
+		}
+		if raw.err != nil {
+			return nil, 0, fmt.Errorf("%w: %w", errDownloadInterrupted, raw.err)
+		}
+		return nil, 0, fmt.Errorf("failed to decode download: %w", err)
+	}
+	content := &errRecordingReader{r: decoded}
 
 	// Write to temp file first (atomic write)
 	tmpPath := localPath + ".tmp"
 	file, err := os.Create(tmpPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
+		return nil, 0, fmt.Errorf("failed to create temp file: %w", err)
 	}
 
-	if _, err := io.Copy(file, result.Content); err != nil {
+	written, err := io.Copy(file, content)
+	if err != nil {
 		file.Close()
 		os.Remove(tmpPath)
-		return "", fmt.Errorf("failed to write file: %w", err)
+		if stalled.Load() {
+			return nil, 0, fmt.Errorf("%w: no data received for %s", errDownloadStalled, s.downloadStallTimeout)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, 0, fmt.Errorf("download cancelled: %w", ctxErr)
+		}
+		if raw.err != nil {
+			return nil, 0, fmt.Errorf("%w: %w", errDownloadInterrupted, raw.err)
+		}
+		if content.err != nil {
+			return nil, 0, fmt.Errorf("failed to decode download: %w", err)
+		}
+		return nil, 0, fmt.Errorf("failed to write file: %w", err)
+	}
+	stallTimer.Stop()
+	if stalled.Load() {
+		file.Close()
+		os.Remove(tmpPath)
+		return nil, 0, fmt.Errorf("%w: no data received for %s", errDownloadStalled, s.downloadStallTimeout)
 	}
 	file.Close()
 
+	// An empty body the provider didn't advertise would replace a good copy with
+	// something that can't be unlocked - keep whatever we had instead
+	if written == 0 && !result.ExpectEmpty {
+		os.Remove(tmpPath)
+		return nil, 0, fmt.Errorf("download returned no data")
+	}
+	if result.Size > 0 && raw.n != result.Size {
+		os.Remove(tmpPath)
+		return nil, 0, fmt.Errorf("%w: received %d of %d bytes", errDownloadIncomplete, raw.n, result.Size)
+	}
+
 	// Atomic rename
 	if err := os.Rename(tmpPath, localPath); err != nil {
 		os.Remove(tmpPath)
-		return "", fmt.Errorf("failed to finalize file: %w", err)
+		return nil, 0, fmt.Errorf("failed to finalize file: %w", err)
+	}
+
+	return result, written, nil
+}
+
+// progressReader invokes onProgress after every read that returns data,
+// counts the bytes read and keeps the last read error other than io.EOF
+type progressReader struct {
+	r          io.Reader
+	onProgress func()
+	n          int64
+	err        error
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	if n > 0 {
+		p.n += int64(n)
+		p.onProgress()
+	}
+	if err != nil && err != io.EOF {
+		p.err = err
+	}
+	return n, err
+}
+
+// errRecordingReader keeps the last read error other than io.EOF, so a failed
+// copy can be told apart from a failed write
+type errRecordingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errRecordingReader) Read(buf []byte) (int, error) {
+	n, err := e.r.Read(buf)
+	if err != nil && err != io.EOF {
+		e.err = err
 	}
+	return n, err
+}
 
-	return result.LastModified, nil
+// decodeContent undoes an HTTP Content-Encoding so the safe is stored as the
+// provider holds it. An empty or identity encoding returns r unchanged.
+func decodeContent(r io.Reader, encoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return r, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
 }
 
 func (s *SyncableSafesService) cleanupUnselectedFiles(selectedFiles []SelectedFile) {
 	selectedPaths := make(map[string]bool)
+	collisions := s.nameCollisions(selectedFiles)
 	for _, f := range selectedFiles {
-		selectedPaths[s.getLocalPath(f)] = true
+		if localPath, err := s.getLocalPath(f, collisions); err == nil {
+			selectedPaths[localPath] = true
+		}
 	}
 
 	providerDir := s.providerDir()
@@ -331,7 +1334,7 @@ func (s *SyncableSafesService) cleanupUnselectedFiles(selectedFiles []SelectedFi
 		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".") {
 			return nil
 		}
-		if strings.HasSuffix(strings.ToLower(d.Name()), ".psafe3") {
+		if s.extensions.Match(d.Name()) {
 			if !selectedPaths[path] {
 				if os.Remove(path) == nil {
 					s.cleanupEmptyParentDirs(filepath.Dir(path), providerDir)
@@ -342,6 +1345,27 @@ func (s *SyncableSafesService) cleanupUnselectedFiles(selectedFiles []SelectedFi
 	})
 }
 
+// cleanupTempFiles removes partial downloads and config writes left in the
+// provider directory
+func (s *SyncableSafesService) cleanupTempFiles() {
+	RemoveTempFiles(s.providerDir())
+}
+
+// RemoveTempFiles deletes the partial downloads and config writes a sync
+// leaves under providerDir if the process dies before finishing. Call it only
+// while no sync service for the directory is running.
+func RemoveTempFiles(providerDir string) {
+	filepath.WalkDir(providerDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), ".tmp") {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
 func (s *SyncableSafesService) cleanupAllSafeFiles() {
 	providerDir := s.providerDir()
 	if _, err := os.Stat(providerDir); os.IsNotExist(err) {
@@ -352,7 +1376,7 @@ func (s *SyncableSafesService) cleanupAllSafeFiles() {
 		if err != nil || d.IsDir() {
 			return nil
 		}
-		if strings.HasSuffix(strings.ToLower(d.Name()), ".psafe3") {
+		if s.extensions.Match(d.Name()) {
 			if os.Remove(path) == nil {
 				s.cleanupEmptyParentDirs(filepath.Dir(path), providerDir)
 			}
@@ -361,11 +1385,24 @@ func (s *SyncableSafesService) cleanupAllSafeFiles() {
 	})
 }
 
+// cleanupEmptyParentDirs removes empty directories from dir upward, stopping before baseDir.
+// It never removes baseDir itself or anything outside it.
 func (s *SyncableSafesService) cleanupEmptyParentDirs(dir, baseDir string) {
-	for dir != baseDir && len(dir) > len(baseDir) {
+	baseDir = filepath.Clean(baseDir)
+	dir = filepath.Clean(dir)
+	for isStrictlyWithin(baseDir, dir) {
 		if err := os.Remove(dir); err != nil {
 			break
 		}
 		dir = filepath.Dir(dir)
 	}
 }
+
+// isStrictlyWithin reports whether target is a descendant of (and not equal to) base
+func isStrictlyWithin(base, target string) bool {
+	rel, err := filepath.Rel(base, target)
+	if err != nil || rel == "." {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -1,10 +1,20 @@
 package service
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/rolledback/pwsafe-service/backend/internal/provider"
 	"github.com/rolledback/pwsafe-service/backend/internal/provider/mock"
@@ -109,6 +119,43 @@ func TestSync_UpdatesLastSyncTime(t *testing.T) {
 	}
 }
 
+func TestSync_LastSuccessfulSyncTimeOnlyAdvancesWhenAllSucceed(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	// f2 has no content, so it fails
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true},
+		{ID: "f2", Name: "b.psafe3", Path: "/", Selected: true},
+	})
+	svc.Sync(ctx)
+
+	config, _ := svc.loadConfig()
+	if config.LastSyncTime == "" {
+		t.Error("Expected LastSyncTime to record the attempt")
+	}
+	if config.LastSuccessfulSyncTime != "" {
+		t.Errorf("Expected no successful sync with a failing file, got %s", config.LastSuccessfulSyncTime)
+	}
+
+	mockProvider.SetContent("f2", []byte("content"))
+	svc.Sync(ctx)
+
+	status, err := svc.GetProviderStatus(ctx)
+	if err != nil {
+		t.Fatalf("GetProviderStatus failed: %v", err)
+	}
+	if status.LastSuccessfulSyncTime == "" {
+		t.Error("Expected LastSuccessfulSyncTime once every file synced")
+	}
+}
+
 func TestListFiles_MergesWithSavedSelections(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -159,6 +206,115 @@ func TestListFiles_MergesWithSavedSelections(t *testing.T) {
 	}
 }
 
+func TestListFiles_FiltersByConfiguredExtensions(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetFiles([]provider.RemoteFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/"},
+		{ID: "f2", Name: "b.dat", Path: "/"},
+		{ID: "f3", Name: "c.txt", Path: "/"},
+	})
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider,
+		WithSyncExtensions(provider.Extensions{".psafe3", ".dat"}))
+	defer svc.Stop()
+
+	files, err := svc.ListFiles(ctx)
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+
+	if len(files) != 2 || files[0].ID != "f1" || files[1].ID != "f2" {
+		t.Errorf("Expected only f1 and f2 to be listed, got %+v", files)
+	}
+}
+
+func TestExcludePatterns_HideFilesAndSkipSync(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetFiles([]provider.RemoteFile{
+		{ID: "f1", Name: "work.psafe3", Path: "/Documents"},
+		{ID: "f2", Name: "template.psafe3", Path: "/Documents"},
+		{ID: "f3", Name: "2019.psafe3", Path: "/Archive/Old"},
+	})
+	for _, id := range []string{"f1", "f2", "f3"} {
+		mockProvider.SetContent(id, []byte(id))
+	}
+
+	// f2 was selected and synced before the exclusion was added
+	stale := filepath.Join(tempDir, "mock", "Documents", "template.psafe3")
+	os.MkdirAll(filepath.Dir(stale), 0700)
+	os.WriteFile(stale, []byte("old"), 0600)
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider,
+		WithExcludePatterns(provider.ExcludePatterns{"*template*", "/Archive"}))
+	defer svc.Stop()
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "work.psafe3", Path: "/Documents", Selected: true},
+		{ID: "f2", Name: "template.psafe3", Path: "/Documents", Selected: true},
+	})
+
+	files, err := svc.ListFiles(ctx)
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+	if len(files) != 1 || files[0].ID != "f1" {
+		t.Errorf("Expected only f1 to be listed, got %+v", files)
+	}
+
+	results, err := svc.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Name != "work.psafe3" {
+		t.Errorf("Expected only work.psafe3 to sync, got %+v", results)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Expected the excluded file's local copy to be cleaned up")
+	}
+}
+
+func TestListFiles_SortsByPathThenName(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetFiles([]provider.RemoteFile{
+		{ID: "f1", Name: "z.psafe3", Path: "/work"},
+		{ID: "f2", Name: "b.psafe3", Path: "/"},
+		{ID: "f3", Name: "a.psafe3", Path: "/work"},
+		{ID: "f4", Name: "a.psafe3", Path: "/"},
+	})
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	files, err := svc.ListFiles(ctx)
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+
+	var order []string
+	for _, f := range files {
+		order = append(order, f.ID)
+	}
+	if strings.Join(order, ",") != "f4,f2,f3,f1" {
+		t.Errorf("Expected order f4,f2,f3,f1, got %s", strings.Join(order, ","))
+	}
+
+	folders := GroupFilesByFolder(files)
+	if len(folders) != 2 || folders[0].Path != "/" || folders[1].Path != "/work" {
+		t.Fatalf("Expected folders / and /work, got %+v", folders)
+	}
+	if len(folders[0].Files) != 2 || len(folders[1].Files) != 2 {
+		t.Errorf("Expected 2 files per folder, got %d and %d", len(folders[0].Files), len(folders[1].Files))
+	}
+}
+
 func TestGetProviderStatus_ReturnsCorrectInfo(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -234,6 +390,38 @@ func TestDisconnect_CleansUpFiles(t *testing.T) {
 	}
 }
 
+func TestForceReauth_KeepsSelection(t *testing.T) {
+	tempDir := t.TempDir()
+	mockProvider := mock.NewProvider("mock")
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	if err := svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	}); err != nil {
+		t.Fatalf("SaveFiles failed: %v", err)
+	}
+	safePath := filepath.Join(tempDir, "mock", "test.psafe3")
+	os.WriteFile(safePath, []byte("content"), 0644)
+
+	if err := svc.ForceReauth(ctx); err != nil {
+		t.Fatalf("ForceReauth failed: %v", err)
+	}
+
+	if mockProvider.DisconnectCalls != 1 {
+		t.Errorf("Expected 1 Disconnect call, got %d", mockProvider.DisconnectCalls)
+	}
+	selected, err := svc.SelectedFiles()
+	if err != nil || len(selected) != 1 || selected[0].ID != "f1" {
+		t.Errorf("Expected the selection to survive, got %+v (err: %v)", selected, err)
+	}
+	if _, err := os.Stat(safePath); err != nil {
+		t.Errorf("Expected the synced file to be kept: %v", err)
+	}
+}
+
 func TestSync_HandlesDownloadError(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -357,3 +545,1404 @@ func TestSync_ReturnsLastModified(t *testing.T) {
 		t.Error("Expected LastModified to be populated")
 	}
 }
+
+func TestCleanupEmptyParentDirs_RemovesNestedEmptyDirs(t *testing.T) {
+	tempDir := t.TempDir()
+	svc := NewSyncableSafesService(context.Background(), tempDir, mock.NewProvider("mock"))
+	defer svc.Stop()
+
+	baseDir := filepath.Join(tempDir, "mock")
+	deepDir := filepath.Join(baseDir, "a", "b", "c")
+	os.MkdirAll(deepDir, 0755)
+
+	svc.cleanupEmptyParentDirs(deepDir, baseDir)
+
+	if _, err := os.Stat(filepath.Join(baseDir, "a")); !os.IsNotExist(err) {
+		t.Error("Expected nested empty directories to be removed")
+	}
+	if _, err := os.Stat(baseDir); err != nil {
+		t.Errorf("Expected base directory to be kept, got: %v", err)
+	}
+}
+
+func TestCleanupEmptyParentDirs_TrailingSeparatorBase(t *testing.T) {
+	tempDir := t.TempDir()
+	svc := NewSyncableSafesService(context.Background(), tempDir, mock.NewProvider("mock"))
+	defer svc.Stop()
+
+	baseDir := filepath.Join(tempDir, "mock")
+	deepDir := filepath.Join(baseDir, "a", "b")
+	os.MkdirAll(deepDir, 0755)
+
+	svc.cleanupEmptyParentDirs(deepDir+string(filepath.Separator), baseDir+string(filepath.Separator))
+
+	if _, err := os.Stat(filepath.Join(baseDir, "a")); !os.IsNotExist(err) {
+		t.Error("Expected nested empty directories to be removed with trailing separators")
+	}
+	if _, err := os.Stat(baseDir); err != nil {
+		t.Errorf("Expected base directory to be kept, got: %v", err)
+	}
+}
+
+func TestCleanupEmptyParentDirs_StopsAtNonEmptyDir(t *testing.T) {
+	tempDir := t.TempDir()
+	svc := NewSyncableSafesService(context.Background(), tempDir, mock.NewProvider("mock"))
+	defer svc.Stop()
+
+	baseDir := filepath.Join(tempDir, "mock")
+	os.MkdirAll(filepath.Join(baseDir, "a", "b"), 0755)
+	os.WriteFile(filepath.Join(baseDir, "a", "keep.psafe3"), []byte("x"), 0644)
+
+	svc.cleanupEmptyParentDirs(filepath.Join(baseDir, "a", "b"), baseDir)
+
+	if _, err := os.Stat(filepath.Join(baseDir, "a", "b")); !os.IsNotExist(err) {
+		t.Error("Expected empty directory 'b' to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(baseDir, "a")); err != nil {
+		t.Errorf("Expected non-empty directory 'a' to be kept, got: %v", err)
+	}
+}
+
+func TestCleanupEmptyParentDirs_NeverLeavesBase(t *testing.T) {
+	tempDir := t.TempDir()
+	svc := NewSyncableSafesService(context.Background(), tempDir, mock.NewProvider("mock"))
+	defer svc.Stop()
+
+	baseDir := filepath.Join(tempDir, "mock")
+	os.MkdirAll(baseDir, 0755)
+	outsideDir := filepath.Join(tempDir, "mockother", "empty")
+	os.MkdirAll(outsideDir, 0755)
+
+	// A sibling sharing the base's name as a prefix must not be treated as inside it
+	svc.cleanupEmptyParentDirs(outsideDir, baseDir)
+
+	if _, err := os.Stat(outsideDir); err != nil {
+		t.Errorf("Expected directory outside base to be kept, got: %v", err)
+	}
+}
+
+func TestIsStrictlyWithin(t *testing.T) {
+	base := filepath.FromSlash("/safes/mock")
+	tests := []struct {
+		target   string
+		expected bool
+	}{
+		{"/safes/mock/a", true},
+		{"/safes/mock/a/b", true},
+		{"/safes/mock", false},
+		{"/safes/mock/", false},
+		{"/safes", false},
+		{"/safes/mockother", false},
+		{"/safes/mock/../other", false},
+	}
+
+	for _, tt := range tests {
+		if got := isStrictlyWithin(base, filepath.Clean(filepath.FromSlash(tt.target))); got != tt.expected {
+			t.Errorf("isStrictlyWithin(%q, %q) = %v, expected %v", base, tt.target, got, tt.expected)
+		}
+	}
+}
+
+func TestPruneAuthState_CallsProviderWhenDisconnected(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetConnected(false)
+
+	svc := NewSyncableSafesService(context.Background(), t.TempDir(), mockProvider)
+	defer svc.Stop()
+
+	svc.pruneAuthState()
+
+	if calls := mockProvider.PruneCalls.Load(); calls != 1 {
+		t.Errorf("Expected 1 PruneExpiredAuthState call, got %d", calls)
+	}
+}
+
+func TestSync_AbortsStalledDownload(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Writer sends a few bytes then never sends more or closes
+	pr, pw := io.Pipe()
+	go pw.Write([]byte("partial"))
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContentReader("f1", pr)
+
+	// Pre-existing good copy must survive a failed download
+	localPath := filepath.Join(tempDir, "mock", "test.psafe3")
+	os.MkdirAll(filepath.Dir(localPath), 0755)
+	os.WriteFile(localPath, []byte("good copy"), 0644)
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider,
+		WithDownloadStallTimeout(50*time.Millisecond), WithDownloadRetries(0, 0))
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+
+	done := make(chan []SyncResult)
+	go func() {
+		results, _ := svc.Sync(ctx)
+		done <- results
+	}()
+
+	select {
+	case results := <-done:
+		if len(results) != 1 || results[0].Success {
+			t.Fatalf("Expected stalled download to fail, got %+v", results)
+		}
+		if !strings.Contains(results[0].Error, "stalled") {
+			t.Errorf("Expected stall error, got '%s'", results[0].Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sync did not abort stalled download")
+	}
+
+	content, _ := os.ReadFile(localPath)
+	if string(content) != "good copy" {
+		t.Errorf("Expected previous copy to be preserved, got '%s'", string(content))
+	}
+}
+
+func TestSync_AllowsSlowButProgressingDownload(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Each chunk arrives well within the stall timeout, but the total exceeds it
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < 5; i++ {
+			time.Sleep(30 * time.Millisecond)
+			pw.Write([]byte("x"))
+		}
+		pw.Close()
+	}()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContentReader("f1", pr)
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider, WithDownloadStallTimeout(100*time.Millisecond))
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+
+	results, err := svc.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("Expected slow download to succeed, got %+v", results)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(tempDir, "mock", "test.psafe3"))
+	if string(content) != "xxxxx" {
+		t.Errorf("Expected 'xxxxx', got '%s'", string(content))
+	}
+}
+
+func TestSync_CleanupUsesConfiguredExtensions(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockDir := filepath.Join(tempDir, "mock")
+	os.MkdirAll(mockDir, 0755)
+	os.WriteFile(filepath.Join(mockDir, "old.dat"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(mockDir, "notes.txt"), []byte("keep"), 0644)
+
+	mockProvider := mock.NewProvider("mock")
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider, WithSyncExtensions(provider.Extensions{".psafe3", ".dat"}))
+	defer svc.Stop()
+
+	svc.Sync(ctx)
+
+	if _, err := os.Stat(filepath.Join(mockDir, "old.dat")); !os.IsNotExist(err) {
+		t.Error("Expected unselected old.dat to be cleaned up")
+	}
+	if _, err := os.Stat(filepath.Join(mockDir, "notes.txt")); err != nil {
+		t.Error("Expected notes.txt to be left alone")
+	}
+}
+
+func TestTryPeriodicSync_RecoversFromProviderPanic(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+	mockProvider.DownloadPanic = "boom"
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+
+	// Must not propagate the panic
+	svc.tryPeriodicSync()
+
+	// A subsequent sync must still work (and must not deadlock on syncMutex)
+	mockProvider.DownloadPanic = nil
+	done := make(chan struct{})
+	go func() {
+		svc.tryPeriodicSync()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Subsequent sync blocked after a panic")
+	}
+
+	content, err := os.ReadFile(filepath.Join(tempDir, "mock", "test.psafe3"))
+	if err != nil || string(content) != "content" {
+		t.Errorf("Expected subsequent sync to download file, got '%s' (err: %v)", string(content), err)
+	}
+}
+
+func TestSync_SkipsUnchangedETag(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetFiles([]provider.RemoteFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", ETag: `"v1"`},
+	})
+	mockProvider.SetContent("f1", []byte("v1 content"))
+	mockProvider.SetETag("f1", `"v1"`)
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+
+	// First sync downloads and records the ETag
+	if _, err := svc.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	// Second sync sends If-None-Match and gets a 304
+	results, err := svc.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !results[0].Success || !results[0].Unchanged {
+		t.Errorf("Expected unchanged success, got %+v", results[0])
+	}
+	if len(mockProvider.DownloadedFiles) != 1 {
+		t.Errorf("Expected a single full download, got %v", mockProvider.DownloadedFiles)
+	}
+	if len(mockProvider.NotModifiedFiles) != 1 {
+		t.Errorf("Expected one not-modified response, got %v", mockProvider.NotModifiedFiles)
+	}
+
+	// A new remote version is downloaded again
+	mockProvider.SetContent("f1", []byte("v2 content"))
+	mockProvider.SetETag("f1", `"v2"`)
+	results, _ = svc.Sync(ctx)
+	if !results[0].Success || results[0].Unchanged {
+		t.Errorf("Expected changed success, got %+v", results[0])
+	}
+	content, _ := os.ReadFile(filepath.Join(tempDir, "mock", "test.psafe3"))
+	if string(content) != "v2 content" {
+		t.Errorf("Expected 'v2 content', got '%s'", string(content))
+	}
+}
+
+func TestSync_IgnoresETagWhenLocalCopyMissing(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+	mockProvider.SetETag("f1", `"v1"`)
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+	svc.Sync(ctx)
+
+	os.Remove(filepath.Join(tempDir, "mock", "test.psafe3"))
+
+	results, _ := svc.Sync(ctx)
+	if results[0].Unchanged {
+		t.Error("Expected a full download when the local copy is gone")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "mock", "test.psafe3")); err != nil {
+		t.Errorf("Expected file to be re-downloaded: %v", err)
+	}
+}
+
+func TestSync_KeepsLocalCopyOnConflict(t *testing.T) {
+	tempDir := t.TempDir()
+	localPath := filepath.Join(tempDir, "mock", "test.psafe3")
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("v1 content"))
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+	if _, err := svc.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	// Edited locally by another client, and changed remotely too
+	os.WriteFile(localPath, []byte("local edit"), 0600)
+	edited := time.Now().Add(time.Hour)
+	os.Chtimes(localPath, edited, edited)
+	mockProvider.SetContent("f1", []byte("v2 content"))
+	mockProvider.LastModified = "Tue, 25 Jan 2026 12:00:00 GMT"
+
+	// The conflict stands until one side is resolved
+	for i := 0; i < 2; i++ {
+		results, err := svc.Sync(ctx)
+		if err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		r := results[0]
+		if r.Success || !r.Conflict || r.Error == "" {
+			t.Fatalf("Expected a conflict, got %+v", r)
+		}
+		if r.LastModified != mockProvider.LastModified || r.LocalModified != edited.UTC().Format(time.RFC3339) {
+			t.Errorf("Expected both timestamps, got remote %q and local %q", r.LastModified, r.LocalModified)
+		}
+		if content, _ := os.ReadFile(localPath); string(content) != "local edit" {
+			t.Fatalf("Expected the local edit to be kept, got %q", content)
+		}
+	}
+
+	// Once the remote is back to the version last synced, it wins as before
+	mockProvider.LastModified = ""
+	results, _ := svc.Sync(ctx)
+	if !results[0].Success || results[0].Conflict {
+		t.Errorf("Expected success when only the local copy changed, got %+v", results[0])
+	}
+
+	// Deleting the local copy also takes the remote version
+	mockProvider.LastModified = "Wed, 26 Jan 2026 12:00:00 GMT"
+	os.Remove(localPath)
+	results, _ = svc.Sync(ctx)
+	if !results[0].Success {
+		t.Errorf("Expected success with no local copy, got %+v", results[0])
+	}
+	if content, _ := os.ReadFile(localPath); string(content) != "v2 content" {
+		t.Errorf("Expected remote content, got %q", content)
+	}
+}
+
+func TestSync_ZeroByteDownloadKeepsPreviousCopy(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("good content"))
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+	svc.Sync(ctx)
+
+	// Provider now returns an empty body without advertising an empty file
+	mockProvider.SetContent("f1", []byte{})
+	results, err := svc.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if results[0].Success {
+		t.Error("Expected zero-byte download to fail")
+	}
+
+	localPath := filepath.Join(tempDir, "mock", "test.psafe3")
+	content, _ := os.ReadFile(localPath)
+	if string(content) != "good content" {
+		t.Errorf("Expected previous copy to be kept, got '%s'", string(content))
+	}
+	if _, err := os.Stat(localPath + ".tmp"); !os.IsNotExist(err) {
+		t.Error("Expected temp file to be removed")
+	}
+
+	// An advertised empty file is accepted
+	mockProvider.AdvertiseEmpty = true
+	results, _ = svc.Sync(ctx)
+	if !results[0].Success {
+		t.Errorf("Expected advertised empty file to sync, got error: %s", results[0].Error)
+	}
+}
+
+func TestSync_ReportsBytesWritten(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+
+	results, err := svc.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if results[0].Bytes != int64(len("content")) {
+		t.Errorf("Expected %d bytes, got %d", len("content"), results[0].Bytes)
+	}
+}
+
+func TestSync_RejectsDownloadShorterThanAdvertised(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+	mockProvider.AdvertisedSize = 100
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+
+	results, err := svc.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if results[0].Success {
+		t.Error("Expected download shorter than its Content-Length to fail")
+	}
+	if !strings.Contains(results[0].Error, "incomplete") {
+		t.Errorf("Expected incomplete download error, got '%s'", results[0].Error)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "mock", "test.psafe3")); !os.IsNotExist(err) {
+		t.Error("Expected no local copy for an incomplete download")
+	}
+}
+
+func TestSync_DecodesContentEncoding(t *testing.T) {
+	safe := []byte("PWS3 safe content")
+
+	var gzipped, deflated bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write(safe)
+	gw.Close()
+	zw := zlib.NewWriter(&deflated)
+	zw.Write(safe)
+	zw.Close()
+
+	tests := []struct {
+		encoding string
+		body     []byte
+		wantErr  string
+	}{
+		{"", safe, ""},
+		{"gzip", gzipped.Bytes(), ""},
+		{"deflate", deflated.Bytes(), ""},
+		{"gzip", safe, "failed to decode download"},
+		{"br", safe, "unsupported content encoding"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding+tt.wantErr, func(t *testing.T) {
+			tempDir := t.TempDir()
+
+			mockProvider := mock.NewProvider("mock")
+			mockProvider.SetContent("f1", tt.body)
+			mockProvider.ContentEncoding = tt.encoding
+			mockProvider.AdvertisedSize = int64(len(tt.body)) // Content-Length counts encoded bytes
+
+			ctx := context.Background()
+			svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+			defer svc.Stop()
+			svc.SaveFiles([]SelectedFile{{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true}})
+
+			results, err := svc.Sync(ctx)
+			if err != nil {
+				t.Fatalf("Sync failed: %v", err)
+			}
+			localPath := filepath.Join(tempDir, "mock", "test.psafe3")
+			if tt.wantErr != "" {
+				if results[0].Success || !strings.Contains(results[0].Error, tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %+v", tt.wantErr, results[0])
+				}
+				if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+					t.Error("Expected no local copy when decoding fails")
+				}
+				return
+			}
+			if !results[0].Success {
+				t.Fatalf("Expected success, got %s", results[0].Error)
+			}
+			content, _ := os.ReadFile(localPath)
+			if !bytes.Equal(content, safe) {
+				t.Errorf("Expected decoded content %q, got %q", safe, content)
+			}
+		})
+	}
+}
+
+func TestSync_RetriesTransientDownloadErrors(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+	mockProvider.DownloadErrors = []error{
+		fmt.Errorf("download request failed: %w", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}),
+		fmt.Errorf("download failed with %w", &provider.StatusError{StatusCode: 503, Body: "unavailable"}),
+	}
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider, WithDownloadRetries(2, time.Millisecond))
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+
+	results, err := svc.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !results[0].Success {
+		t.Errorf("Expected download to succeed after retries, got error: %s", results[0].Error)
+	}
+}
+
+func TestSync_DoesNotRetryPermanentDownloadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"not found", fmt.Errorf("download failed with %w", &provider.StatusError{StatusCode: 404, Body: "itemNotFound"})},
+		{"reauth", fmt.Errorf("not authenticated")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProvider := mock.NewProvider("mock")
+			mockProvider.SetContent("f1", []byte("content"))
+			mockProvider.DownloadErrors = []error{tt.err}
+
+			ctx := context.Background()
+			svc := NewSyncableSafesService(ctx, t.TempDir(), mockProvider, WithDownloadRetries(2, time.Millisecond))
+			defer svc.Stop()
+
+			svc.SaveFiles([]SelectedFile{
+				{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+			})
+
+			results, _ := svc.Sync(ctx)
+			if results[0].Success {
+				t.Error("Expected permanent error to fail without retrying")
+			}
+			if len(mockProvider.DownloadedFiles) != 0 {
+				t.Errorf("Expected no further download attempts, got %v", mockProvider.DownloadedFiles)
+			}
+		})
+	}
+}
+
+func TestIsRetryableDownloadError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		retry bool
+	}{
+		{"connection reset", fmt.Errorf("download request failed: %w", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), true},
+		{"server error", fmt.Errorf("download failed with %w", &provider.StatusError{StatusCode: 502}), true},
+		{"rate limited", fmt.Errorf("download failed with %w", &provider.StatusError{StatusCode: 429}), true},
+		{"not found", fmt.Errorf("download failed with %w", &provider.StatusError{StatusCode: 404}), false},
+		{"stalled", fmt.Errorf("%w: no data received for 1s", errDownloadStalled), true},
+		{"body cut off", fmt.Errorf("%w: %w", errDownloadInterrupted, io.ErrUnexpectedEOF), true},
+		{"short read", fmt.Errorf("%w: received 1 of 2 bytes", errDownloadIncomplete), true},
+		{"disk full", fmt.Errorf("failed to write file: %w", &os.PathError{Op: "write", Path: "a.tmp", Err: syscall.ENOSPC}), false},
+		{"permission denied", fmt.Errorf("failed to create temp file: %w", &os.PathError{Op: "open", Path: "a.tmp", Err: syscall.EACCES}), false},
+		{"cancelled", fmt.Errorf("download cancelled: %w", context.Canceled), false},
+		{"reauth", fmt.Errorf("not authenticated"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isRetryableDownloadError(tt.err); got != tt.retry {
+			t.Errorf("%s: isRetryableDownloadError(%v) = %v, expected %v", tt.name, tt.err, got, tt.retry)
+		}
+	}
+}
+
+func TestSync_RetriesShortDownloads(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+	mockProvider.AdvertisedSize = 100
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, t.TempDir(), mockProvider, WithDownloadRetries(1, time.Millisecond))
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+
+	results, _ := svc.Sync(ctx)
+	if results[0].Success || !strings.Contains(results[0].Error, "download incomplete") {
+		t.Errorf("Expected the short download to fail, got %+v", results[0])
+	}
+	if len(mockProvider.DownloadedFiles) != 2 {
+		t.Errorf("Expected the short download to be retried once, got %v", mockProvider.DownloadedFiles)
+	}
+}
+
+func TestSync_RetryStopsWhenContextCancelled(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("content"))
+	mockProvider.DownloadErrors = []error{fmt.Errorf("download failed with %w", &provider.StatusError{StatusCode: 500, Body: "boom"})}
+
+	svc := NewSyncableSafesService(context.Background(), t.TempDir(), mockProvider, WithDownloadRetries(2, time.Hour))
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan []SyncResult)
+	go func() {
+		results, _ := svc.Sync(ctx)
+		done <- results
+	}()
+
+	select {
+	case results := <-done:
+		if results[0].Success {
+			t.Error("Expected cancelled retry to report the original failure")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Retry backoff did not observe context cancellation")
+	}
+}
+
+func TestSaveFiles_DuringSyncIsNotOverwritten(t *testing.T) {
+	tempDir := t.TempDir()
+
+	pr, pw := io.Pipe()
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContentReader("f1", pr)
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		svc.Sync(ctx)
+		close(done)
+	}()
+
+	// Write returns once the sync is reading the download
+	pw.Write([]byte("content"))
+
+	newSelection := []SelectedFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true},
+		{ID: "f2", Name: "b.psafe3", Path: "/", Selected: true},
+	}
+	if err := svc.SaveFiles(newSelection); err != nil {
+		t.Fatalf("SaveFiles failed: %v", err)
+	}
+	pw.Close()
+	<-done
+
+	config, err := svc.loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if len(config.Files) != 2 {
+		t.Errorf("Expected selection saved during sync to survive, got %+v", config.Files)
+	}
+	if config.LastSyncTime == "" {
+		t.Error("Expected sync to still record LastSyncTime")
+	}
+}
+
+func TestSaveFiles_CorruptConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	mockDir := filepath.Join(tempDir, "mock")
+	os.MkdirAll(mockDir, 0700)
+	configPath := filepath.Join(mockDir, ".config.json")
+	os.WriteFile(configPath, []byte(`{"files": [`), 0600)
+
+	svc := NewSyncableSafesService(context.Background(), tempDir, mock.NewProvider("mock"))
+	defer svc.Stop()
+
+	files := []SelectedFile{{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true}}
+	if err := svc.SaveFiles(files); err != nil {
+		t.Fatalf("Expected saving to recover from a corrupt config, got %v", err)
+	}
+	if saved, err := svc.SelectedFiles(); err != nil || len(saved) != 1 || saved[0].ID != "f1" {
+		t.Errorf("Expected the new selection to be saved, got %+v (err: %v)", saved, err)
+	}
+	if data, err := os.ReadFile(configPath + ".corrupt"); err != nil || string(data) != `{"files": [` {
+		t.Errorf("Expected the corrupt config to be kept aside, got %q (err: %v)", data, err)
+	}
+}
+
+func TestSync_TreatsFileIDAsOpaque(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Path-addressed providers may use the remote path (with separators,
+	// traversal-looking segments or URL syntax) as the ID
+	ids := []string{
+		"/Documents/My Safes/a.psafe3",
+		"../../outside/b.psafe3",
+		"s3://bucket/key.psafe3?versionId=1",
+	}
+
+	mockProvider := mock.NewProvider("mock")
+	var remote []provider.RemoteFile
+	var selection []SelectedFile
+	for i, id := range ids {
+		name := fmt.Sprintf("file%d.psafe3", i)
+		mockProvider.SetContent(id, []byte(id))
+		mockProvider.SetETag(id, fmt.Sprintf(`"v%d"`, i))
+		remote = append(remote, provider.RemoteFile{ID: id, Name: name, Path: "/synced"})
+		selection = append(selection, SelectedFile{ID: id, Name: name, Path: "/synced", Selected: true})
+	}
+	mockProvider.SetFiles(remote)
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	svc.SaveFiles(selection)
+
+	// Selection state is matched by ID
+	files, err := svc.ListFiles(ctx)
+	if err != nil {
+		t.Fatalf("ListFiles failed: %v", err)
+	}
+	for _, f := range files {
+		if !f.Selected {
+			t.Errorf("Expected %q to keep its selection", f.ID)
+		}
+	}
+
+	results, err := svc.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	for i, result := range results {
+		if !result.Success {
+			t.Fatalf("Expected %q to sync, got error: %s", ids[i], result.Error)
+		}
+	}
+
+	// Local paths come from Path and Name only, never from the ID
+	for i, id := range ids {
+		localPath := filepath.Join(tempDir, "mock", "synced", fmt.Sprintf("file%d.psafe3", i))
+		content, err := os.ReadFile(localPath)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", localPath, err)
+		}
+		if string(content) != id {
+			t.Errorf("Expected %s to hold content for %q, got %q", localPath, id, content)
+		}
+	}
+
+	// IDs round-trip through the saved config unchanged
+	config, _ := svc.loadConfig()
+	for i, id := range ids {
+		if config.ETags[id] != fmt.Sprintf(`"v%d"`, i) {
+			t.Errorf("Expected ETag for %q to be persisted under its ID, got %v", id, config.ETags)
+		}
+	}
+
+	// A second sync passes the same IDs back for conditional downloads
+	svc.Sync(ctx)
+	if len(mockProvider.NotModifiedFiles) != len(ids) {
+		t.Errorf("Expected every ID to be sent back unchanged, got %v", mockProvider.NotModifiedFiles)
+	}
+}
+
+func TestStop_CancelsInProgressSyncAndRemovesTempFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContentReader("f1", pr)
+
+	svc := NewSyncableSafesService(context.Background(), tempDir, mockProvider)
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true},
+	})
+
+	// Left behind by an earlier crash
+	staleTmp := filepath.Join(tempDir, "mock", "stale.psafe3.tmp")
+	if err := os.WriteFile(staleTmp, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var syncErr error
+	done := make(chan struct{})
+	go func() {
+		_, syncErr = svc.Sync(context.Background())
+		close(done)
+	}()
+
+	// Write returns once the sync is reading the download
+	pw.Write([]byte("partial content"))
+
+	stopped := make(chan struct{})
+	go func() {
+		svc.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return while a sync was in progress")
+	}
+	<-done
+
+	if syncErr == nil || !strings.Contains(syncErr.Error(), "cancelled") {
+		t.Errorf("Expected sync cancelled error, got %v", syncErr)
+	}
+	tmps, _ := filepath.Glob(filepath.Join(tempDir, "mock", "*.tmp"))
+	if len(tmps) != 0 {
+		t.Errorf("Expected temp files to be removed, found %v", tmps)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "mock", "a.psafe3")); !os.IsNotExist(err) {
+		t.Error("Expected no partial safe file to be written")
+	}
+
+	if _, err := svc.Sync(context.Background()); err == nil {
+		t.Error("Expected sync after Stop to fail")
+	}
+}
+
+func TestSync_RejectsPathsOutsideProviderDir(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	selection := []SelectedFile{
+		{ID: "up", Name: "escape.psafe3", Path: "/../..", Selected: true},
+		{ID: "name", Name: "../escape.psafe3", Path: "/", Selected: true},
+		{ID: "ok", Name: "ok.psafe3", Path: "/a/../b", Selected: true},
+	}
+	for _, f := range selection {
+		mockProvider.SetContent(f.ID, []byte("content"))
+	}
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+	svc.SaveFiles(selection)
+
+	results, err := svc.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	for i, result := range results[:2] {
+		if result.Success || !strings.Contains(result.Error, "escapes the provider directory") {
+			t.Errorf("Expected %s to be rejected, got %+v", selection[i].ID, result)
+		}
+	}
+	if !results[2].Success {
+		t.Errorf("Expected path that stays inside to sync, got %s", results[2].Error)
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(tempDir), "escape.psafe3")); !os.IsNotExist(err) {
+		t.Error("Expected nothing written above the safes directory")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "escape.psafe3")); !os.IsNotExist(err) {
+		t.Error("Expected nothing written outside the provider directory")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "mock", "b", "ok.psafe3")); err != nil {
+		t.Errorf("Expected ok.psafe3 inside the provider directory: %v", err)
+	}
+}
+
+func TestPeriodicSync_IdlesWhileDisconnected(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetConnected(false)
+
+	// Read-only services run no periodic loop, so only the test reads connectedWake
+	svc := NewSyncableSafesService(context.Background(), t.TempDir(), mockProvider, WithReadOnly())
+	defer svc.Stop()
+
+	if svc.tryPeriodicSync() {
+		t.Error("Expected tryPeriodicSync to report disconnected")
+	}
+
+	// A status check while disconnected must not wake the loop
+	if _, err := svc.GetProviderStatus(context.Background()); err != nil {
+		t.Fatalf("GetProviderStatus failed: %v", err)
+	}
+	select {
+	case <-svc.connectedWake:
+		t.Fatal("Expected no wake while disconnected")
+	default:
+	}
+
+	mockProvider.SetConnected(true)
+	if !svc.tryPeriodicSync() {
+		t.Error("Expected tryPeriodicSync to report connected")
+	}
+	if _, err := svc.GetProviderStatus(context.Background()); err != nil {
+		t.Fatalf("GetProviderStatus failed: %v", err)
+	}
+	select {
+	case <-svc.connectedWake:
+	default:
+		t.Error("Expected a connected status check to wake the loop")
+	}
+}
+
+func TestHandleCallback_WakesPeriodicSync(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetConnected(false)
+	// Read-only services run no periodic loop, so only the test reads
+	// connectedWake; clearing the flag afterwards lets sign-in through
+	svc := NewSyncableSafesService(context.Background(), t.TempDir(), mockProvider, WithReadOnly())
+	defer svc.Stop()
+	svc.readOnly = false
+
+	mockProvider.AuthError = fmt.Errorf("invalid_grant")
+	if err := svc.HandleCallback(context.Background(), "bad-code"); err == nil {
+		t.Fatal("Expected the provider's error")
+	}
+	select {
+	case <-svc.connectedWake:
+		t.Fatal("Expected no wake after a failed sign-in")
+	default:
+	}
+
+	mockProvider.AuthError = nil
+	if err := svc.HandleCallback(context.Background(), "code"); err != nil {
+		t.Fatalf("HandleCallback failed: %v", err)
+	}
+	select {
+	case <-svc.connectedWake:
+	default:
+		t.Error("Expected a completed sign-in to wake the loop")
+	}
+}
+
+func TestScheduleNextSync_Jitter(t *testing.T) {
+	svc := NewSyncableSafesService(context.Background(), t.TempDir(), mock.NewProvider("mock"))
+	defer svc.Stop()
+
+	interval := 15 * time.Minute
+	min, max := interval-interval/10, interval+interval/10
+	varied := false
+	for i := 0; i < 50; i++ {
+		before := time.Now()
+		got := svc.scheduleNextSync(interval)
+		if got < min || got > max {
+			t.Fatalf("Expected interval within ±10%% of %v, got %v", interval, got)
+		}
+		varied = varied || got != interval
+
+		// nextSyncAt must reflect the jittered wait, not the nominal interval
+		svc.nextSyncMutex.RLock()
+		nextSyncAt := svc.nextSyncAt
+		svc.nextSyncMutex.RUnlock()
+		if nextSyncAt.Before(before.Add(got)) || nextSyncAt.After(time.Now().Add(got)) {
+			t.Fatalf("Expected nextSyncAt %v to be %v from now", nextSyncAt, got)
+		}
+	}
+	if !varied {
+		t.Error("Expected jitter to vary the interval")
+	}
+
+	WithSyncJitter(0)(svc)
+	if got := svc.scheduleNextSync(interval); got != interval {
+		t.Errorf("Expected no jitter when disabled, got %v", got)
+	}
+}
+
+func TestSync_FlattenPaths(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	selection := []SelectedFile{
+		{ID: "f1", Name: "work.psafe3", Path: "/Documents/A", Selected: true},
+		{ID: "f2", Name: "work.psafe3", Path: "/Documents/B", Selected: true},
+		{ID: "f3", Name: "home.psafe3", Path: "/Documents/C", Selected: true},
+	}
+	for _, f := range selection {
+		mockProvider.SetContent(f.ID, []byte(f.ID))
+	}
+
+	// A copy left from the nested layout is cleaned up once flattened
+	nested := filepath.Join(tempDir, "mock", "Documents", "C", "home.psafe3")
+	os.MkdirAll(filepath.Dir(nested), 0700)
+	os.WriteFile(nested, []byte("old"), 0600)
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider, WithFlattenPaths(true))
+	defer svc.Stop()
+	svc.SaveFiles(selection)
+
+	results, err := svc.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	for _, result := range results {
+		if !result.Success {
+			t.Fatalf("Expected %s to sync, got %s", result.Name, result.Error)
+		}
+	}
+
+	providerDir := filepath.Join(tempDir, "mock")
+	expected := map[string]string{
+		disambiguatedName(selection[0]): "f1",
+		disambiguatedName(selection[1]): "f2",
+		"home.psafe3":                   "f3",
+	}
+	for name, id := range expected {
+		content, err := os.ReadFile(filepath.Join(providerDir, name))
+		if err != nil {
+			t.Errorf("Expected %s in provider dir: %v", name, err)
+			continue
+		}
+		if string(content) != id {
+			t.Errorf("Expected %s to hold %s, got %s", name, id, content)
+		}
+	}
+	if disambiguatedName(selection[0]) == disambiguatedName(selection[1]) {
+		t.Error("Expected colliding names to be disambiguated by ID")
+	}
+	if _, err := os.Stat(filepath.Join(providerDir, "Documents")); !os.IsNotExist(err) {
+		t.Error("Expected nested layout to be cleaned up")
+	}
+}
+
+func TestListSafes_NeverShowsInFlightSyncDownloads(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("first version"))
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true},
+	})
+	if _, err := svc.Sync(ctx); err != nil {
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+
+	// Hold the next download open so its temp file sits beside the synced copy
+	pr, pw := io.Pipe()
+	mockProvider.SetContentReader("f1", pr)
+	done := make(chan struct{})
+	go func() {
+		svc.Sync(ctx)
+		close(done)
+	}()
+	pw.Write([]byte("second"))
+
+	if _, err := os.Stat(filepath.Join(tempDir, "mock", "a.psafe3.tmp")); err != nil {
+		t.Fatalf("Expected an in-flight temp file: %v", err)
+	}
+	safes, err := NewSafeService(tempDir).ListSafes()
+	if err != nil {
+		t.Fatalf("ListSafes failed: %v", err)
+	}
+	if len(safes) != 1 || safes[0].Name != "a.psafe3" {
+		t.Errorf("Expected only the synced copy during a sync, got %+v", safes)
+	}
+
+	pw.Close()
+	<-done
+}
+
+func TestSyncLimiter_BoundsConcurrentSyncs(t *testing.T) {
+	tempDir := t.TempDir()
+	limiter := NewSyncLimiter(1)
+
+	pr, pw := io.Pipe()
+	blocking := mock.NewProvider("blocking")
+	blocking.SetContentReader("f1", pr)
+	other := mock.NewProvider("other")
+	other.SetContent("f2", []byte("content"))
+
+	ctx := context.Background()
+	blockingSvc := NewSyncableSafesService(ctx, tempDir, blocking, WithSyncLimiter(limiter))
+	defer blockingSvc.Stop()
+	otherSvc := NewSyncableSafesService(ctx, tempDir, other, WithSyncLimiter(limiter))
+	defer otherSvc.Stop()
+	blockingSvc.SaveFiles([]SelectedFile{{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true}})
+	otherSvc.SaveFiles([]SelectedFile{{ID: "f2", Name: "b.psafe3", Path: "/", Selected: true}})
+
+	blockingDone := make(chan struct{})
+	go func() {
+		blockingSvc.Sync(ctx)
+		close(blockingDone)
+	}()
+	// Write returns once the first sync holds the only slot
+	pw.Write([]byte("content"))
+
+	otherDone := make(chan error, 1)
+	go func() {
+		_, err := otherSvc.Sync(ctx)
+		otherDone <- err
+	}()
+	select {
+	case <-otherDone:
+		t.Fatal("Expected second provider's sync to wait for a slot")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	pw.Close()
+	<-blockingDone
+	select {
+	case err := <-otherDone:
+		if err != nil {
+			t.Errorf("Expected waiting sync to succeed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Waiting sync did not start once the slot was free")
+	}
+
+	// A waiting sync gives up with its context
+	pr2, pw2 := io.Pipe()
+	defer pw2.Close()
+	blocking.SetContentReader("f1", pr2)
+	go blockingSvc.Sync(ctx)
+	pw2.Write([]byte("content"))
+
+	cancelled, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := otherSvc.Sync(cancelled); err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Errorf("Expected cancelled error while waiting, got %v", err)
+	}
+}
+
+func TestReadOnly_ListsButDoesNotSync(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetFiles([]provider.RemoteFile{
+		{ID: "f1", Name: "a.psafe3", Path: "/"},
+	})
+	mockProvider.SetContent("f1", []byte("content"))
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider, WithReadOnly())
+	defer svc.Stop()
+
+	files, err := svc.ListFiles(ctx)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected remote files to list, got %v (err: %v)", files, err)
+	}
+	if err := svc.SaveFiles([]SelectedFile{{ID: "f1", Name: "a.psafe3", Path: "/", Selected: true}}); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("Expected read-only error saving files, got %v", err)
+	}
+	if _, err := svc.TrySync(ctx); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("Expected read-only error syncing, got %v", err)
+	}
+	if err := svc.HandleCallback(ctx, "code"); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("Expected read-only error completing sign-in, got %v", err)
+	}
+	if _, err := svc.StartDeviceAuth(ctx); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("Expected read-only error starting device sign-in, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "mock")); !os.IsNotExist(err) {
+		t.Error("Expected nothing written in read-only mode")
+	}
+
+	status, err := svc.GetProviderStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.ReadOnly || status.NextSyncAt != "" {
+		t.Errorf("Expected read-only status with no next sync, got %+v", status)
+	}
+}
+
+func TestStartDeviceAuth_PollsInBackground(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetConnected(false)
+	mockProvider.DeviceAuth = make(chan error)
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, t.TempDir(), mockProvider)
+	defer svc.Stop()
+
+	waitForDeviceAuth := func() string {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if pending, lastErr := svc.deviceAuthState(); !pending {
+				return lastErr
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("Device sign-in still pending")
+		return ""
+	}
+
+	// The request context ending doesn't stop polling
+	reqCtx, cancel := context.WithCancel(ctx)
+	if _, err := svc.StartDeviceAuth(reqCtx); err != nil {
+		t.Fatalf("StartDeviceAuth failed: %v", err)
+	}
+	cancel()
+	if pending, _ := svc.deviceAuthState(); !pending {
+		t.Fatal("Expected sign-in to be pending")
+	}
+
+	mockProvider.DeviceAuth <- fmt.Errorf("device sign-in declined")
+	if lastErr := waitForDeviceAuth(); !strings.Contains(lastErr, "declined") {
+		t.Errorf("Expected declined error, got %q", lastErr)
+	}
+
+	if _, err := svc.StartDeviceAuth(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mockProvider.DeviceAuth <- nil
+	if lastErr := waitForDeviceAuth(); lastErr != "" {
+		t.Errorf("Expected success, got %q", lastErr)
+	}
+	status, err := svc.GetProviderStatus(ctx)
+	if err != nil || !status.Connected || status.DeviceAuthPending {
+		t.Errorf("Expected connected after device sign-in, got %+v (err: %v)", status, err)
+	}
+}
+
+func TestPushFile_ResolvesConflict(t *testing.T) {
+	tempDir := t.TempDir()
+	localPath := filepath.Join(tempDir, "mock", "test.psafe3")
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetContent("f1", []byte("v1 content"))
+	mockProvider.SetETag("f1", `"v1"`)
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider)
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "test.psafe3", Path: "/", Selected: true},
+	})
+	if _, err := svc.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	os.WriteFile(localPath, []byte("local edit"), 0600)
+	edited := time.Now().Add(time.Hour)
+	os.Chtimes(localPath, edited, edited)
+	mockProvider.LastModified = "Tue, 25 Jan 2026 12:00:00 GMT"
+
+	// A remote edit since the sync must not be overwritten
+	mockProvider.SetETag("f1", `"elsewhere"`)
+	if err := svc.PushFile(ctx, "f1"); !errors.Is(err, provider.ErrUploadConflict) {
+		t.Fatalf("Expected an upload conflict, got %v", err)
+	}
+	if len(mockProvider.UploadedFiles) != 0 {
+		t.Fatalf("Expected nothing to be uploaded, got %v", mockProvider.UploadedFiles)
+	}
+	mockProvider.SetETag("f1", `"v1"`)
+
+	if err := svc.PushFile(ctx, "f1"); err != nil {
+		t.Fatalf("PushFile failed: %v", err)
+	}
+	if len(mockProvider.UploadedFiles) != 1 || mockProvider.UploadedFiles[0] != "f1" {
+		t.Fatalf("Expected f1 to be uploaded, got %v", mockProvider.UploadedFiles)
+	}
+
+	// The pushed copy is the remote version now, so the next sync isn't a conflict
+	results, err := svc.Sync(ctx)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !results[0].Success || results[0].Conflict {
+		t.Errorf("Expected success after pushing, got %+v", results[0])
+	}
+	if content, _ := os.ReadFile(localPath); string(content) != "local edit" {
+		t.Errorf("Expected the pushed content, got %q", content)
+	}
+	if config, _ := svc.loadConfig(); config.ETags["f1"] != `"upload-1"` {
+		t.Errorf("Expected the uploaded ETag as the baseline, got %q", config.ETags["f1"])
+	}
+
+	if err := svc.PushFile(ctx, "f2"); err == nil || !strings.Contains(err.Error(), "file not selected") {
+		t.Errorf("Expected file not selected, got %v", err)
+	}
+
+	unsupported := NewSyncableSafesService(ctx, t.TempDir(), struct{ provider.SyncableSafesProvider }{mockProvider})
+	defer unsupported.Stop()
+	if err := unsupported.PushFile(ctx, "f1"); err == nil || !strings.Contains(err.Error(), "upload not supported") {
+		t.Errorf("Expected upload not supported, got %v", err)
+	}
+}
+
+func TestRemoveTempFiles(t *testing.T) {
+	providerDir := t.TempDir()
+	os.MkdirAll(filepath.Join(providerDir, "Documents"), 0700)
+	keep := filepath.Join(providerDir, "Documents", "work.psafe3")
+	partial := filepath.Join(providerDir, "Documents", "work.psafe3.tmp")
+	config := filepath.Join(providerDir, ".config.json.tmp")
+	for _, path := range []string{keep, partial, config} {
+		os.WriteFile(path, []byte("data"), 0600)
+	}
+
+	RemoveTempFiles(providerDir)
+
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("Expected the safe to be kept: %v", err)
+	}
+	for _, path := range []string{partial, config} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", filepath.Base(path))
+		}
+	}
+}
+
+func TestWithSyncInterval(t *testing.T) {
+	before := time.Now()
+	svc := NewSyncableSafesService(context.Background(), t.TempDir(), mock.NewProvider("mock"),
+		WithSyncJitter(0), WithSyncInterval(time.Hour))
+	defer svc.Stop()
+
+	if svc.syncInterval != time.Hour {
+		t.Errorf("Expected a 1h interval, got %v", svc.syncInterval)
+	}
+	svc.nextSyncMutex.RLock()
+	nextSyncAt := svc.nextSyncAt
+	svc.nextSyncMutex.RUnlock()
+	if nextSyncAt.Before(before.Add(time.Hour)) || nextSyncAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("Expected nextSyncAt an hour from now, got %v", nextSyncAt)
+	}
+
+	WithSyncInterval(30 * time.Second)(svc)
+	if svc.syncInterval != time.Hour {
+		t.Errorf("Expected an interval under a minute to be ignored, got %v", svc.syncInterval)
+	}
+}
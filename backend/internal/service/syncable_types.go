@@ -2,8 +2,19 @@ package service
 
 // SyncConfig stores the persistent state for a provider (saved to .config.json)
 type SyncConfig struct {
-	Files        []SelectedFile `json:"files"`
-	LastSyncTime string         `json:"lastSyncTime,omitempty"`
+	Files                  []SelectedFile           `json:"files"`
+	LastSyncTime           string                   `json:"lastSyncTime,omitempty"`           // Last attempt, whatever its outcome
+	LastSuccessfulSyncTime string                   `json:"lastSuccessfulSyncTime,omitempty"` // Last sync in which every selected file synced
+	ETags                  map[string]string        `json:"etags,omitempty"`                  // fileID -> ETag of the local copy
+	Versions               map[string]SyncedVersion `json:"versions,omitempty"`               // fileID -> modification times when the local copy was last downloaded
+}
+
+// SyncedVersion is the baseline a sync checks for conflicts: a local copy
+// changed since LocalModified is only replaced if the remote file is still
+// the RemoteModified version
+type SyncedVersion struct {
+	LocalModified  string `json:"localModified"`            // RFC3339Nano mtime of the local copy after download
+	RemoteModified string `json:"remoteModified,omitempty"` // Last-Modified the provider sent with it
 }
 
 // SelectedFile tracks a file's selection state (provider-agnostic)
@@ -14,22 +25,57 @@ type SelectedFile struct {
 	Selected bool   `json:"selected"`
 }
 
+// FileFolder groups the files that share a Path
+type FileFolder struct {
+	Path  string         `json:"path"`
+	Files []SelectedFile `json:"files"`
+}
+
+// FolderContents is one remote folder's subfolders and safe files, for
+// navigating the drive while selecting files
+type FolderContents struct {
+	Path    string         `json:"path"`
+	Folders []string       `json:"folders"`
+	Files   []SelectedFile `json:"files"`
+}
+
 // SyncResult represents the outcome of syncing a single file
 type SyncResult struct {
-	Name         string `json:"name"`
-	Success      bool   `json:"success"`
-	LastModified string `json:"lastModified,omitempty"`
-	Error        string `json:"error,omitempty"`
+	Name          string `json:"name"`
+	Success       bool   `json:"success"`
+	LastModified  string `json:"lastModified,omitempty"`
+	Unchanged     bool   `json:"unchanged,omitempty"`     // Remote ETag matched, local copy kept as-is
+	Conflict      bool   `json:"conflict,omitempty"`      // Local and remote copies both changed since the last sync; the local copy is kept
+	LocalModified string `json:"localModified,omitempty"` // Local copy's modification time; only set with Conflict
+	Bytes         int64  `json:"bytes,omitempty"`         // Bytes written to the local copy
+	Error         string `json:"error,omitempty"`
 }
 
 // ProviderStatus is the full status returned by the API (combines provider + service state)
 type ProviderStatus struct {
-	ID           string `json:"id"`
-	DisplayName  string `json:"displayName"`
-	Connected    bool   `json:"connected"`
-	NeedsReauth  bool   `json:"needsReauth"`
-	AccountName  string `json:"accountName,omitempty"`
-	AccountEmail string `json:"accountEmail,omitempty"`
-	LastSyncTime string `json:"lastSyncTime,omitempty"`
-	NextSyncAt   string `json:"nextSyncAt,omitempty"`
+	ID                     string `json:"id"`
+	DisplayName            string `json:"displayName"`
+	Connected              bool   `json:"connected"`
+	NeedsReauth            bool   `json:"needsReauth"`
+	AccountName            string `json:"accountName,omitempty"`
+	AccountEmail           string `json:"accountEmail,omitempty"`
+	LastSyncTime           string `json:"lastSyncTime,omitempty"`
+	LastSuccessfulSyncTime string `json:"lastSuccessfulSyncTime,omitempty"` // Lags LastSyncTime while any file keeps failing
+	NextSyncAt             string `json:"nextSyncAt,omitempty"`
+	ReadOnly               bool   `json:"readOnly,omitempty"` // Listing only: the safes directory isn't writable, so nothing syncs
+	DeviceAuthPending      bool   `json:"deviceAuthPending,omitempty"`
+	DeviceAuthError        string `json:"deviceAuthError,omitempty"` // Why the latest device-code sign-in failed
+}
+
+// ProviderCapabilities reports which optional features a provider supports,
+// for debugging why a feature isn't offered
+type ProviderCapabilities struct {
+	ID                  string `json:"id"`
+	DisplayName         string `json:"displayName"`
+	ConditionalDownload bool   `json:"conditionalDownload"` // Unchanged files are skipped by ETag instead of re-downloaded
+	Quota               bool   `json:"quota"`
+	Browse              bool   `json:"browse"`
+	DeviceAuth          bool   `json:"deviceAuth"`
+	Upload              bool   `json:"upload"`   // Synced copies can be pushed back with /files/push
+	ReadOnly            bool   `json:"readOnly"` // The safes directory isn't writable, so nothing syncs
 }
@@ -0,0 +1,56 @@
+package service
+
+import "sync"
+
+// DefaultSyncHistorySize is how many completed syncs each provider keeps in memory
+const DefaultSyncHistorySize = 50
+
+// syncHistory is a fixed-size ring of the most recent sync outcomes. Once
+// full, each new entry overwrites the oldest.
+type syncHistory struct {
+	mu      sync.Mutex
+	entries []SyncLogEntry
+	next    int // index the next entry is written to once entries is full
+}
+
+// WithSyncHistorySize sets how many completed syncs History returns. Values
+// below 1 keep DefaultSyncHistorySize.
+func WithSyncHistorySize(size int) SyncOption {
+	return func(s *SyncableSafesService) {
+		if size > 0 {
+			s.history = newSyncHistory(size)
+		}
+	}
+}
+
+func newSyncHistory(size int) *syncHistory {
+	return &syncHistory{entries: make([]SyncLogEntry, 0, size)}
+}
+
+func (h *syncHistory) add(entry SyncLogEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) < cap(h.entries) {
+		h.entries = append(h.entries, entry)
+		return
+	}
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+}
+
+// list returns the retained entries, newest first
+func (h *syncHistory) list() []SyncLogEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	list := make([]SyncLogEntry, 0, len(h.entries))
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		list = append(list, h.entries[(h.next+i)%len(h.entries)])
+	}
+	return list
+}
+
+// History returns this provider's most recent completed syncs, newest first.
+// It is kept in memory only, so it starts empty after a restart.
+func (s *SyncableSafesService) History() []SyncLogEntry {
+	return s.history.list()
+}
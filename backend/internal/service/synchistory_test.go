@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/provider/mock"
+)
+
+func TestSyncHistory_DropsOldestWhenFull(t *testing.T) {
+	h := newSyncHistory(3)
+	for i := 1; i <= 5; i++ {
+		h.add(SyncLogEntry{SuccessCount: i})
+	}
+
+	list := h.list()
+	if len(list) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(list))
+	}
+	for i, want := range []int{5, 4, 3} {
+		if list[i].SuccessCount != want {
+			t.Errorf("Entry %d: expected sync %d, got %d", i, want, list[i].SuccessCount)
+		}
+	}
+}
+
+func TestSync_RecordsHistory(t *testing.T) {
+	mockProvider := mock.NewProvider("mock")
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, t.TempDir(), mockProvider, WithSyncHistorySize(2))
+	defer svc.Stop()
+
+	if len(svc.History()) != 0 {
+		t.Fatalf("Expected empty history before any sync, got %+v", svc.History())
+	}
+
+	if _, err := svc.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	mockProvider.SetConnected(false)
+	svc.Sync(ctx)
+	svc.Sync(ctx)
+
+	history := svc.History()
+	if len(history) != 2 {
+		t.Fatalf("Expected history bounded to 2 entries, got %d", len(history))
+	}
+	for _, entry := range history {
+		if entry.ProviderID != "mock" || entry.Error == "" {
+			t.Errorf("Expected the two failed syncs to be retained, got %+v", entry)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"log"
+)
+
+// SyncLimiter bounds how many provider syncs run at once across every
+// SyncableSafesService sharing it
+type SyncLimiter struct {
+	slots chan struct{}
+}
+
+// NewSyncLimiter allows up to max concurrent syncs; values below 1 allow one
+func NewSyncLimiter(max int) *SyncLimiter {
+	if max < 1 {
+		max = 1
+	}
+	return &SyncLimiter{slots: make(chan struct{}, max)}
+}
+
+// acquire waits for a free slot, giving up when ctx is done
+func (l *SyncLimiter) acquire(ctx context.Context, providerID string) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	log.Printf("%s: waiting for another provider's sync to finish", providerID)
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *SyncLimiter) release() {
+	<-l.slots
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultSyncLogMaxBytes is the size at which the sync log is rotated
+const DefaultSyncLogMaxBytes = 10 << 20
+
+// SyncLogEntry is one line of the sync log
+type SyncLogEntry struct {
+	Timestamp    string `json:"timestamp"`
+	ProviderID   string `json:"providerId"`
+	SuccessCount int    `json:"successCount"`
+	FailureCount int    `json:"failureCount"`
+	Error        string `json:"error,omitempty"`
+}
+
+// SyncLog appends one JSON line per completed sync to a file, for auditing
+// sync reliability across restarts. When the file would grow past maxBytes it
+// is moved to path + ".1" (replacing the previous one) and a new file started.
+// Safe for concurrent use, so every provider can share one log.
+type SyncLog struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+}
+
+// NewSyncLog creates a sync log writing to path. A maxBytes of zero or less
+// uses DefaultSyncLogMaxBytes.
+func NewSyncLog(path string, maxBytes int64) *SyncLog {
+	if maxBytes <= 0 {
+		maxBytes = DefaultSyncLogMaxBytes
+	}
+	return &SyncLog{path: path, maxBytes: maxBytes}
+}
+
+// Append writes entry as a single line
+func (l *SyncLog) Append(entry SyncLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if info, err := os.Stat(l.path); err == nil && info.Size()+int64(len(line)) > l.maxBytes {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate sync log: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open sync log: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write sync log: %w", err)
+	}
+	return f.Close()
+}
+
+// recordSync adds a finished sync to the in-memory history and the sync log,
+// if one is configured. Log failures are logged and never affect the sync result.
+func (s *SyncableSafesService) recordSync(results []SyncResult, syncErr error) {
+	entry := SyncLogEntry{
+		Timestamp:  time.Now().Format(time.RFC3339),
+		ProviderID: s.provider.ID(),
+	}
+	for _, r := range results {
+		if r.Success {
+			entry.SuccessCount++
+		} else {
+			entry.FailureCount++
+		}
+	}
+	if syncErr != nil {
+		entry.Error = syncErr.Error()
+	}
+
+	s.history.add(entry)
+
+	if s.syncLog == nil {
+		return
+	}
+	if err := s.syncLog.Append(entry); err != nil {
+		log.Printf("%s: %v", s.provider.ID(), err)
+	}
+}
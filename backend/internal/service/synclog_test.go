@@ -0,0 +1,101 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/provider"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider/mock"
+)
+
+func readSyncLog(t *testing.T, path string) []SyncLogEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open sync log: %v", err)
+	}
+	defer f.Close()
+
+	var entries []SyncLogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry SyncLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid sync log line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestSync_AppendsSyncLog(t *testing.T) {
+	tempDir := t.TempDir()
+	logPath := filepath.Join(t.TempDir(), "sync.log")
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetFiles([]provider.RemoteFile{{ID: "f1", Name: "ok.psafe3", Path: "/"}})
+	mockProvider.SetContent("f1", []byte("content"))
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider, WithSyncLog(NewSyncLog(logPath, 0)))
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "ok.psafe3", Path: "/", Selected: true},
+		{ID: "f2", Name: "missing.psafe3", Path: "/", Selected: true},
+	})
+	if _, err := svc.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	mockProvider.SetConnected(false)
+	if _, err := svc.TrySync(ctx); err == nil {
+		t.Fatal("Expected sync to fail while disconnected")
+	}
+
+	entries := readSyncLog(t, logPath)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 log lines, got %+v", entries)
+	}
+	if entries[0].ProviderID != "mock" || entries[0].SuccessCount != 1 || entries[0].FailureCount != 1 || entries[0].Error != "" {
+		t.Errorf("Unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Error != "not authenticated" || entries[1].Timestamp == "" {
+		t.Errorf("Expected the failed sync to be logged, got %+v", entries[1])
+	}
+
+	info, err := os.Stat(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected sync log mode 0600, got %04o", info.Mode().Perm())
+	}
+}
+
+func TestSyncLog_Rotates(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "sync.log")
+	syncLog := NewSyncLog(logPath, 200)
+
+	for i := 0; i < 5; i++ {
+		if err := syncLog.Append(SyncLogEntry{Timestamp: "2026-01-01T00:00:00Z", ProviderID: "mock", SuccessCount: i}); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	current := readSyncLog(t, logPath)
+	rotated := readSyncLog(t, logPath+".1")
+	if len(current) == 0 || len(rotated) == 0 {
+		t.Fatalf("Expected both files to hold entries, got %d and %d", len(current), len(rotated))
+	}
+	if last := current[len(current)-1]; last.SuccessCount != 4 {
+		t.Errorf("Expected the newest entry last, got %+v", last)
+	}
+	if info, _ := os.Stat(logPath); info.Size() > 200 {
+		t.Errorf("Expected the log to stay under its cap, got %d bytes", info.Size())
+	}
+}
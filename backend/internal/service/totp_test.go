@@ -0,0 +1,101 @@
+package service
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/models"
+	"github.com/tkuhlman/gopwsafe/pwsafe"
+)
+
+func TestTOTPSecret(t *testing.T) {
+	tests := []struct {
+		name     string
+		notes    string
+		expected string
+	}{
+		{"no notes", "", ""},
+		{"plain notes", "no notes", ""},
+		{"field line", "TOTP: JBSWY3DPEHPK3PXP", "JBSWY3DPEHPK3PXP"},
+		{"field among other notes", "pin: 1234\nTOTP Secret: jbsw y3dp ehpk 3pxp\n", "JBSWY3DPEHPK3PXP"},
+		{"otp alias", "otp:JBSWY3DPEHPK3PXP", "JBSWY3DPEHPK3PXP"},
+		{"otpauth uri", "otpauth://totp/Example:alice?secret=JBSWY3DPEHPK3PXP&issuer=Example", "JBSWY3DPEHPK3PXP"},
+		{"invalid base32", "TOTP: not-a-secret!", ""},
+		{"unrelated field", "password: JBSWY3DPEHPK3PXP", ""},
+	}
+
+	for _, tt := range tests {
+		if got := totpSecret(pwsafe.Record{Notes: tt.notes}); got != tt.expected {
+			t.Errorf("%s: expected '%s', got '%s'", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// The RFC 6238 SHA-1 key "12345678901234567890", base32-encoded. The RFC
+	// lists 8-digit codes; the 6-digit codes are their last six digits.
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		unix     int64
+		code     string
+		validFor int
+	}{
+		{59, "287082", 1},
+		{1111111109, "081804", 1},
+		{1111111111, "050471", 29},
+		{1234567890, "005924", 30},
+		{2000000000, "279037", 10},
+	}
+	for _, tt := range tests {
+		code, validFor := totpCode(secret, time.Unix(tt.unix, 0))
+		if code != tt.code || validFor != tt.validFor {
+			t.Errorf("At %d: expected %s valid for %ds, got %s valid for %ds", tt.unix, tt.code, tt.validFor, code, validFor)
+		}
+	}
+}
+
+func TestGetEntryTOTP(t *testing.T) {
+	tmpDir := t.TempDir()
+	structure := &models.SafeStructure{Entries: []models.Entry{
+		{UUID: "11111111-1111-1111-1111-111111111111", Title: "with", Password: "p", Notes: "TOTP: JBSWY3DPEHPK3PXP"},
+		{UUID: "22222222-2222-2222-2222-222222222222", Title: "without", Password: "p"},
+	}}
+	if err := CreateSafeFromStructure(filepath.Join(tmpDir, "totp.psafe3"), "master", structure); err != nil {
+		t.Fatal(err)
+	}
+	service := NewSafeService(tmpDir)
+	safePath := "/" + filepath.Base(tmpDir) + "/totp.psafe3"
+
+	got, err := service.GetEntryTOTP(safePath, "master", "11111111-1111-1111-1111-111111111111")
+	if err != nil {
+		t.Fatalf("GetEntryTOTP failed: %v", err)
+	}
+	if len(got.Code) != 6 || got.ValidFor < 1 || got.ValidFor > 30 {
+		t.Errorf("Expected a 6-digit code valid for 1-30s, got %+v", got)
+	}
+
+	_, err = service.GetEntryTOTP(safePath, "master", "22222222-2222-2222-2222-222222222222")
+	if err == nil || !strings.Contains(err.Error(), "no TOTP secret") {
+		t.Errorf("Expected no TOTP secret error, got %v", err)
+	}
+}
+
+func TestStripTOTPLines(t *testing.T) {
+	notes := "pin 1234\nTOTP: JBSWY3DPEHPK3PXP\notpauth://totp/x?secret=KRSXG5CTMVRXEZLU\nTOTP: not base32!"
+	if got := stripTOTPLines(notes); got != "pin 1234\nTOTP: not base32!" {
+		t.Errorf("Unexpected stripped notes: %q", got)
+	}
+
+	// Saving stripped notes back keeps the secret; a new secret replaces it
+	if got := keepTOTPLines(notes, "pin 5678"); !strings.Contains(got, "JBSWY3DPEHPK3PXP") || !strings.HasPrefix(got, "pin 5678\n") {
+		t.Errorf("Expected the secret lines to be kept, got %q", got)
+	}
+	if got := keepTOTPLines(notes, "TOTP: GEZDGNBVGY3TQOJQ"); got != "TOTP: GEZDGNBVGY3TQOJQ" {
+		t.Errorf("Expected a new secret to replace the old, got %q", got)
+	}
+	if got := keepTOTPLines("pin 1234", "pin 5678"); got != "pin 5678" {
+		t.Errorf("Expected notes without a secret unchanged, got %q", got)
+	}
+}
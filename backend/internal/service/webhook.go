@@ -0,0 +1,79 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// SyncWebhookPayload is the JSON summary POSTed to the sync webhook
+type SyncWebhookPayload struct {
+	ProviderID   string `json:"providerId"`
+	Timestamp    string `json:"timestamp"`
+	SuccessCount int    `json:"successCount"`
+	FailureCount int    `json:"failureCount"`
+}
+
+// notifySyncWebhook delivers the sync summary in the background.
+// Delivery failures are logged and never surface to the caller.
+func (s *SyncableSafesService) notifySyncWebhook(results []SyncResult) {
+	if s.webhookURL == "" {
+		return
+	}
+
+	payload := SyncWebhookPayload{
+		ProviderID: s.provider.ID(),
+		Timestamp:  time.Now().Format(time.RFC3339),
+	}
+	for _, r := range results {
+		if r.Success {
+			payload.SuccessCount++
+		} else {
+			payload.FailureCount++
+		}
+	}
+
+	guard := s.outboundGuard
+	if s.allowPrivateWebhook {
+		guard = guard.AllowingPrivate()
+	}
+
+	go func() {
+		if err := postWebhook(s.ctx, s.webhookURL, guard.Client(), payload); err != nil {
+			log.Printf("%s: sync webhook delivery failed: %v", s.provider.ID(), err)
+		}
+	}()
+}
+
+func postWebhook(ctx context.Context, url string, client *http.Client, payload SyncWebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
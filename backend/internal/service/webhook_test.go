@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rolledback/pwsafe-service/backend/internal/outbound"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider"
+	"github.com/rolledback/pwsafe-service/backend/internal/provider/mock"
+)
+
+func TestSync_PostsWebhookSummary(t *testing.T) {
+	received := make(chan SyncWebhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload SyncWebhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer server.Close()
+
+	tempDir := t.TempDir()
+
+	mockProvider := mock.NewProvider("mock")
+	mockProvider.SetFiles([]provider.RemoteFile{
+		{ID: "f1", Name: "ok.psafe3", Path: "/"},
+		{ID: "f2", Name: "missing.psafe3", Path: "/"},
+	})
+	mockProvider.SetContent("f1", []byte("content"))
+
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, tempDir, mockProvider, WithSyncWebhook(server.URL, true))
+	defer svc.Stop()
+
+	svc.SaveFiles([]SelectedFile{
+		{ID: "f1", Name: "ok.psafe3", Path: "/", Selected: true},
+		{ID: "f2", Name: "missing.psafe3", Path: "/", Selected: true},
+	})
+
+	if _, err := svc.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	select {
+	case payload := <-received:
+		if payload.ProviderID != "mock" {
+			t.Errorf("Expected providerId 'mock', got '%s'", payload.ProviderID)
+		}
+		if payload.SuccessCount != 1 || payload.FailureCount != 1 {
+			t.Errorf("Expected 1 success and 1 failure, got %d/%d", payload.SuccessCount, payload.FailureCount)
+		}
+		if payload.Timestamp == "" {
+			t.Error("Expected timestamp to be set")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for webhook")
+	}
+}
+
+func TestPostWebhook_BlocksPrivateTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Webhook should not have been delivered to a loopback address")
+	}))
+	defer server.Close()
+
+	err := postWebhook(context.Background(), server.URL, outbound.Default().Client(), SyncWebhookPayload{ProviderID: "mock"})
+	if err == nil {
+		t.Error("Expected error for private webhook target")
+	}
+}
+
+func TestSync_WebhookUsesOutboundAllowlist(t *testing.T) {
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer server.Close()
+
+	guard, err := outbound.NewGuard([]string{"127.0.0.0/8", "::1/128"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockProvider := mock.NewProvider("mock")
+	ctx := context.Background()
+	svc := NewSyncableSafesService(ctx, t.TempDir(), mockProvider,
+		WithSyncWebhook(server.URL, false),
+		WithOutboundGuard(guard),
+	)
+	defer svc.Stop()
+
+	if _, err := svc.Sync(ctx); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected webhook to reach allowlisted loopback target")
+	}
+}
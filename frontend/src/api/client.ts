@@ -1,10 +1,41 @@
 const API_BASE_URL = "/api";
 
+const API_TOKEN_KEY = "pwsafe.apiToken";
+
+// Sends the API token when the server requires one (PWSAFE_API_TOKEN). When a
+// request is rejected for lacking it, the user is asked once and it's retried.
+async function apiFetch(input: string, init: RequestInit = {}): Promise<Response> {
+  const send = () => {
+    const headers = new Headers(init.headers);
+    const token = localStorage.getItem(API_TOKEN_KEY);
+    if (token) {
+      headers.set("Authorization", `Bearer ${token}`);
+    }
+    return fetch(input, { ...init, headers });
+  };
+
+  const response = await send();
+  // A 401 without the challenge is a wrong master password, not a missing token
+  if (response.status !== 401 || !response.headers.has("WWW-Authenticate")) {
+    return response;
+  }
+  const token = window.prompt("This server requires an API token:");
+  if (!token) {
+    return response;
+  }
+  localStorage.setItem(API_TOKEN_KEY, token);
+  return send();
+}
+
 export type SafeFile = {
   name: string;
   path: string;
   lastModified: string;
   provider: string; // Provider ID (e.g., "local", "onedrive", "gdrive")
+  writable: boolean; // Entry edits are supported (static safes only)
+  shadowed?: boolean; // Another safe listed earlier has the same name and takes precedence
+  valid?: boolean; // Only set when listed with verify; false means truncated or not a safe
+  sources?: string[]; // Only set when listed with dedupe; every provider holding an identical copy
 };
 
 export type Entry = {
@@ -13,8 +44,15 @@ export type Entry = {
   username: string;
   url?: string;
   notes?: string;
+  extraFields?: Record<string, string>;
+  hasTOTP?: boolean;
+  createdAt?: string; // Record creation time, if recorded
+  modifiedAt?: string; // Record modification time, if recorded
+  passwordChangedAt?: string; // When the password itself last changed, if recorded
 };
 
+export type EntryField = "title" | "username" | "url" | "notes" | "extraFields" | "hasTOTP" | "createdAt" | "modifiedAt" | "passwordChangedAt";
+
 export type Group = {
   name: string;
   groups?: Group[];
@@ -26,10 +64,40 @@ export type SafeStructure = {
   entries: Entry[];
 };
 
+export type ChangedEntry = Entry & {
+  group: string; // Dotted group path, empty for root entries
+};
+
+export type SafeChanges = {
+  since: string;
+  entries: ChangedEntry[];
+};
+
+export type SafeInfo = {
+  recordCount: number;
+  lastSaved?: string;
+  lastSavedBy?: string; // Application that last saved the safe
+};
+
+export type UnlockSession = {
+  token: string; // Send instead of the master password
+  expiresAt: string;
+};
+
 export type EntryPasswordResponse = {
   password: string;
 };
 
+export type PasswordStrength = {
+  score: number; // 0 (very weak) to 4 (very strong)
+  length: "empty" | "short" | "medium" | "long" | "very_long";
+};
+
+export type TOTPCode = {
+  code: string;
+  validFor: number; // Seconds until the code changes
+};
+
 // Provider types
 export type Provider = {
   id: string;
@@ -42,19 +110,47 @@ export type ProvidersResponse = {
   providers: Provider[];
 };
 
+export type ProviderSettingsField = {
+  name: string;
+  type: "string" | "number" | "boolean" | "array" | "object"; // array of strings, object of string values
+  description: string;
+  required: boolean;
+  secret?: boolean; // Mask in forms
+};
+
+// A provider the server supports, whether or not one is configured
+export type ProviderType = {
+  id: string;
+  displayName: string;
+  icon: string; // Data URL
+  brandColor: string;
+  settings: ProviderSettingsField[];
+};
+
 export type ProviderStatus = {
   connected: boolean;
   needsReauth: boolean;
   accountName?: string;
   accountEmail?: string;
-  lastSyncTime?: string;
+  lastSyncTime?: string; // Last attempt
+  lastSuccessfulSyncTime?: string; // Last sync where every selected file succeeded
   nextSyncAt?: string;
+  readOnly?: boolean; // Safes directory isn't writable: files list but nothing syncs
+  deviceAuthPending?: boolean;
+  deviceAuthError?: string; // Why the latest device-code sign-in failed
 };
 
 export type ProviderAuthURL = {
   url: string;
 };
 
+export type ProviderDeviceCode = {
+  userCode: string;
+  verificationUri: string;
+  expiresAt: string;
+  message?: string;
+};
+
 export type ProviderFile = {
   id: string;
   name: string;
@@ -62,33 +158,94 @@ export type ProviderFile = {
   selected: boolean;
 };
 
+export type ProviderFileFolder = {
+  path: string;
+  files: ProviderFile[];
+};
+
+export type ProviderFolderContents = {
+  path: string;
+  folders: string[]; // Subfolder names
+  files: ProviderFile[];
+};
+
 export type ProviderFilesResponse = {
   files: ProviderFile[];
+  byFolder?: ProviderFileFolder[]; // Only when requested with groupByFolder
+};
+
+export type ProviderQuota = {
+  used: number; // Bytes
+  total: number;
+  remaining: number;
+};
+
+export type ProviderSyncHistoryEntry = {
+  timestamp: string;
+  providerId: string;
+  successCount: number;
+  failureCount: number;
+  error?: string;
+};
+
+export type ProviderCapabilities = {
+  id: string;
+  displayName: string;
+  conditionalDownload: boolean; // Unchanged files are skipped by ETag
+  quota: boolean;
+  browse: boolean;
+  deviceAuth: boolean;
+  upload: boolean; // Synced copies can be pushed back with pushProviderFile
+  readOnly: boolean;
 };
 
 export type ProviderSyncResult = {
   name: string;
   success: boolean;
   lastModified?: string;
+  unchanged?: boolean;
+  conflict?: boolean; // Local and remote both changed since the last sync; the local copy was kept
+  localModified?: string; // Only set with conflict
+  bytes?: number;
   error?: string;
 };
 
 export type ProviderSyncResponse = {
   results: ProviderSyncResult[];
+  successCount: number;
+  failureCount: number;
+};
+
+export type ProviderSyncSummary = {
+  providerId: string;
+  status: "synced" | "partial" | "skipped" | "failed";
+  results?: ProviderSyncResult[];
+  successCount: number;
+  failureCount: number;
+  error?: string;
+  code?: string; // e.g. "SYNC_IN_PROGRESS", "SYNC_TIMEOUT", "REAUTH_REQUIRED", "READ_ONLY"
 };
 
 export const api = {
-  async listSafes(): Promise<SafeFile[]> {
-    const response = await fetch(`${API_BASE_URL}/safes`);
+  // verify checks each file's structure (no password needed) and sets valid
+  // dedupe returns one flat list sorted by name with identical files collapsed
+  async listSafes(verify = false, dedupe = false): Promise<SafeFile[]> {
+    const params = new URLSearchParams();
+    if (verify) params.set("verify", "true");
+    if (dedupe) params.set("dedupe", "true");
+    const query = params.toString();
+    const response = await apiFetch(`${API_BASE_URL}/safes${query ? `?${query}` : ""}`);
     if (!response.ok) {
       throw new Error("Failed to fetch safes");
     }
     return response.json();
   },
 
-  async unlockSafe(safePath: string, password: string): Promise<SafeStructure> {
+  // Passing fields limits each entry to those fields plus its uuid
+  async unlockSafe(safePath: string, password: string, fields?: EntryField[]): Promise<SafeStructure> {
     const encodedPath = encodeURIComponent(safePath);
-    const response = await fetch(`${API_BASE_URL}/safes/${encodedPath}/unlock`, {
+    const query = fields ? `?fields=${fields.join(",")}` : "";
+    const response = await apiFetch(`${API_BASE_URL}/safes/${encodedPath}/unlock${query}`, {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
@@ -104,9 +261,72 @@ export const api = {
     return response.json();
   },
 
+  // Also returns a session token when the server has PWSAFE_SESSION_TTL set
+  async unlockSafeWithSession(
+    safePath: string,
+    password: string,
+  ): Promise<{ structure: SafeStructure; session?: UnlockSession }> {
+    const encodedPath = encodeURIComponent(safePath);
+    const response = await apiFetch(`${API_BASE_URL}/safes/${encodedPath}/unlock`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ password, createSession: true }),
+    });
+
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || "Failed to unlock safe");
+    }
+
+    const token = response.headers.get("X-Session-Token");
+    const expiresAt = response.headers.get("X-Session-Expires");
+    const structure: SafeStructure = await response.json();
+    return { structure, session: token && expiresAt ? { token, expiresAt } : undefined };
+  },
+
+  // Entries modified after since, for refreshing an already loaded safe
+  async getSafeChanges(safePath: string, password: string, since: string): Promise<SafeChanges> {
+    const encodedPath = encodeURIComponent(safePath);
+    const response = await apiFetch(`${API_BASE_URL}/safes/${encodedPath}/changes?since=${encodeURIComponent(since)}`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ password }),
+    });
+
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || "Failed to get safe changes");
+    }
+
+    return response.json();
+  },
+
+  // Record count and last-save details, without loading the entries
+  async getSafeInfo(safePath: string, password: string): Promise<SafeInfo> {
+    const encodedPath = encodeURIComponent(safePath);
+    const response = await apiFetch(`${API_BASE_URL}/safes/${encodedPath}/info`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ password }),
+    });
+
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || "Failed to get safe info");
+    }
+
+    return response.json();
+  },
+
   async getEntryPassword(safePath: string, password: string, entryUuid: string): Promise<string> {
     const encodedPath = encodeURIComponent(safePath);
-    const response = await fetch(`${API_BASE_URL}/safes/${encodedPath}/entry`, {
+    const response = await apiFetch(`${API_BASE_URL}/safes/${encodedPath}/entry`, {
       method: "POST",
       headers: {
         "Content-Type": "application/json",
@@ -123,17 +343,101 @@ export const api = {
     return data.password;
   },
 
+  // Throws "SESSION_EXPIRED" once the session ends; unlock again with the password
+  async getEntryPasswordWithSession(safePath: string, session: string, entryUuid: string): Promise<string> {
+    const encodedPath = encodeURIComponent(safePath);
+    const response = await apiFetch(`${API_BASE_URL}/safes/${encodedPath}/entry`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ session, entryUuid }),
+    });
+
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.code === "SESSION_EXPIRED" ? "SESSION_EXPIRED" : error.error || "Failed to get entry password");
+    }
+
+    const data: EntryPasswordResponse = await response.json();
+    return data.password;
+  },
+
+  // Rates the entry's password without returning it
+  async getEntryPasswordStrength(safePath: string, password: string, entryUuid: string): Promise<PasswordStrength> {
+    const encodedPath = encodeURIComponent(safePath);
+    const response = await apiFetch(`${API_BASE_URL}/safes/${encodedPath}/entry/strength`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ password, entryUuid }),
+    });
+
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || "Failed to get entry password strength");
+    }
+
+    return response.json();
+  },
+
+  // Generates the entry's current TOTP code; the secret never leaves the server
+  async getEntryTOTP(safePath: string, password: string, entryUuid: string): Promise<TOTPCode> {
+    const encodedPath = encodeURIComponent(safePath);
+    const response = await apiFetch(`${API_BASE_URL}/safes/${encodedPath}/entry/totp`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ password, entryUuid }),
+    });
+
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || "Failed to get entry TOTP code");
+    }
+
+    return response.json();
+  },
+
   // Provider APIs
-  async listProviders(): Promise<ProvidersResponse> {
-    const response = await fetch(`${API_BASE_URL}/providers`);
+  async listProviders(connectedOnly?: boolean): Promise<ProvidersResponse> {
+    const url = connectedOnly ? `${API_BASE_URL}/providers?connected=true` : `${API_BASE_URL}/providers`;
+    const response = await apiFetch(url);
     if (!response.ok) {
       throw new Error("Failed to list providers");
     }
     return response.json();
   },
 
+  async listProviderTypes(): Promise<ProviderType[]> {
+    const response = await apiFetch(`${API_BASE_URL}/provider-types`);
+    if (!response.ok) {
+      throw new Error("Failed to list provider types");
+    }
+    const data: { providerTypes: ProviderType[] } = await response.json();
+    return data.providerTypes;
+  },
+
+  // Writes the provider's settings.json; requires PWSAFE_ENABLE_PROVIDER_SETTINGS
+  async saveProviderSettings(providerId: string, settings: Record<string, unknown>): Promise<{ success: boolean }> {
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/settings`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify(settings),
+    });
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || `Failed to save ${providerId} settings`);
+    }
+    return response.json();
+  },
+
   async getProviderStatus(providerId: string): Promise<ProviderStatus> {
-    const response = await fetch(`${API_BASE_URL}/providers/${providerId}/status`);
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/status`);
     if (!response.ok) {
       throw new Error(`Failed to get ${providerId} status`);
     }
@@ -141,7 +445,7 @@ export const api = {
   },
 
   async getProviderAuthUrl(providerId: string): Promise<ProviderAuthURL> {
-    const response = await fetch(`${API_BASE_URL}/providers/${providerId}/auth/url`);
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/auth/url`);
     if (!response.ok) {
       const error = await response.json();
       throw new Error(error.error || `Failed to get ${providerId} auth URL`);
@@ -149,8 +453,32 @@ export const api = {
     return response.json();
   },
 
+  // Poll getProviderStatus afterwards; it reports connected once the user enters the code
+  async startProviderDeviceAuth(providerId: string): Promise<ProviderDeviceCode> {
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/auth/device`, {
+      method: "POST",
+    });
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || `Failed to start ${providerId} device sign-in`);
+    }
+    return response.json();
+  },
+
+  // Signs the provider out but keeps its file selections, for reconnecting after needsReauth
+  async reauthProvider(providerId: string): Promise<{ success: boolean }> {
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/reauth`, {
+      method: "POST",
+    });
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || `Failed to reset ${providerId} sign-in`);
+    }
+    return response.json();
+  },
+
   async disconnectProvider(providerId: string): Promise<{ success: boolean }> {
-    const response = await fetch(`${API_BASE_URL}/providers/${providerId}/disconnect`, {
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/disconnect`, {
       method: "POST",
     });
     if (!response.ok) {
@@ -160,8 +488,9 @@ export const api = {
     return response.json();
   },
 
-  async getProviderFiles(providerId: string): Promise<ProviderFilesResponse> {
-    const response = await fetch(`${API_BASE_URL}/providers/${providerId}/files`);
+  async getProviderFiles(providerId: string, groupByFolder?: boolean): Promise<ProviderFilesResponse> {
+    const query = groupByFolder ? "?groupBy=folder" : "";
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/files${query}`);
     if (!response.ok) {
       const error = await response.json();
       throw new Error(error.error || `Failed to get ${providerId} files`);
@@ -169,8 +498,29 @@ export const api = {
     return response.json();
   },
 
+  // Saved selection only - works while the provider is offline or needs reauth
+  async getSelectedProviderFiles(providerId: string): Promise<ProviderFilesResponse> {
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/files/selected`);
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || `Failed to get selected ${providerId} files`);
+    }
+    return response.json();
+  },
+
+  async browseProviderFolder(providerId: string, path = "/"): Promise<ProviderFolderContents> {
+    const response = await apiFetch(
+      `${API_BASE_URL}/providers/${providerId}/browse?path=${encodeURIComponent(path)}`
+    );
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || `Failed to browse ${providerId} folder`);
+    }
+    return response.json();
+  },
+
   async saveProviderFiles(providerId: string, files: ProviderFile[]): Promise<{ success: boolean }> {
-    const response = await fetch(`${API_BASE_URL}/providers/${providerId}/files`, {
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/files`, {
       method: "PUT",
       headers: {
         "Content-Type": "application/json",
@@ -184,8 +534,34 @@ export const api = {
     return response.json();
   },
 
+  // Uploads the synced copy back to the provider; throws for providers that can't write (501)
+  async pushProviderFile(providerId: string, fileId: string): Promise<{ success: boolean }> {
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/files/push`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ fileId }),
+    });
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || `Failed to upload ${providerId} file`);
+    }
+    return response.json();
+  },
+
+  // Throws for providers that don't report storage usage (501)
+  async getProviderQuota(providerId: string): Promise<ProviderQuota> {
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/quota`);
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || `Failed to get ${providerId} quota`);
+    }
+    return response.json();
+  },
+
   async syncProvider(providerId: string): Promise<ProviderSyncResponse> {
-    const response = await fetch(`${API_BASE_URL}/providers/${providerId}/sync`, {
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/sync`, {
       method: "POST",
     });
     if (!response.ok) {
@@ -195,15 +571,60 @@ export const api = {
     return response.json();
   },
 
+  // Syncs every provider; one failing doesn't fail the request
+  // Newest first; kept in server memory only, so empty after a restart
+  async getProviderSyncHistory(providerId: string): Promise<ProviderSyncHistoryEntry[]> {
+    const response = await apiFetch(`${API_BASE_URL}/providers/${providerId}/history`);
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || `Failed to get ${providerId} sync history`);
+    }
+    const data: { history: ProviderSyncHistoryEntry[] } = await response.json();
+    return data.history;
+  },
+
+  async syncAllProviders(): Promise<ProviderSyncSummary[]> {
+    const response = await apiFetch(`${API_BASE_URL}/providers/sync-all`, {
+      method: "POST",
+    });
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || "Failed to sync providers");
+    }
+    const data: { providers: ProviderSyncSummary[] } = await response.json();
+    return data.providers;
+  },
+
+  async getProviderCapabilities(): Promise<ProviderCapabilities[]> {
+    const response = await apiFetch(`${API_BASE_URL}/debug/capabilities`);
+    if (!response.ok) {
+      const error = await response.json();
+      throw new Error(error.error || "Failed to get provider capabilities");
+    }
+    const data: { providers: ProviderCapabilities[] } = await response.json();
+    return data.providers;
+  },
+
   // Static provider APIs (upload/delete static safes)
-  async uploadStaticSafe(file: File, overwrite?: boolean): Promise<{ success: boolean; name: string; exists?: boolean }> {
+  // Passing the master password verifies the uploaded safe opens. Reusing an
+  // idempotencyKey for retries of one upload returns its first result.
+  async uploadStaticSafe(
+    file: File,
+    overwrite?: boolean,
+    password?: string,
+    idempotencyKey?: string,
+  ): Promise<{ success: boolean; name: string; renamed?: boolean; exists?: boolean; verified?: boolean }> {
     const formData = new FormData();
     formData.append("file", file);
+    if (password) {
+      formData.append("password", password);
+    }
 
     const url = overwrite ? `${API_BASE_URL}/providers/static/files?overwrite=true` : `${API_BASE_URL}/providers/static/files`;
 
-    const response = await fetch(url, {
+    const response = await apiFetch(url, {
       method: "POST",
+      headers: idempotencyKey ? { "Idempotency-Key": idempotencyKey } : undefined,
       body: formData,
     });
 
@@ -211,18 +632,19 @@ export const api = {
 
     if (response.status === 409) {
       // File exists, return conflict info
-      return { success: false, name: data.name, exists: true };
+      return { success: false, name: data.name, renamed: data.renamed, exists: true };
     }
 
     if (!response.ok) {
       throw new Error(data.error || "Failed to upload safe");
     }
 
-    return { success: true, name: data.name };
+    // name is the stored name; renamed means characters were stripped from the upload's
+    return { success: true, name: data.name, renamed: data.renamed, verified: data.verified };
   },
 
   async deleteStaticSafe(filename: string): Promise<{ success: boolean }> {
-    const response = await fetch(`${API_BASE_URL}/providers/static/files/${encodeURIComponent(filename)}`, {
+    const response = await apiFetch(`${API_BASE_URL}/providers/static/files/${encodeURIComponent(filename)}`, {
       method: "DELETE",
     });
     if (!response.ok) {
@@ -207,7 +207,17 @@ function ProviderPage() {
     setError(null);
 
     try {
+      // Drop the dead tokens first so the new sign-in starts clean; file selections are kept
+      if (status?.needsReauth) {
+        await api.reauthProvider(providerId);
+      }
       const { url } = await api.getProviderAuthUrl(providerId);
+      if (!url) {
+        // Providers such as WebDAV sign in with credentials from settings.json
+        setError("This provider has no sign-in. Check the credentials in its settings.json.");
+        setConnecting(false);
+        return;
+      }
       window.location.href = url;
     } catch (err) {
       console.error("Failed to get auth URL:", err);